@@ -3,14 +3,23 @@ package messaging
 // NATS subjects and JetStream stream/consumer name constants.
 const (
 	// Subjects
-	SubjectStreamsRaw = "twitch.streams.raw"
-	SubjectStreamsNew = "twitch.streams.new"
+	SubjectStreamsRaw      = "twitch.streams.raw"
+	SubjectStreamsNew      = "twitch.streams.new"
+	SubjectStreamsEnded    = "twitch.streams.ended"
+	SubjectStreamsUpdated  = "twitch.streams.updated"
+	SubjectWebhooksInvalid = "twitch.webhooks.invalid"
+	SubjectEmailVerify     = "twitch.email.verification"
 
 	// JetStream stream names
-	StreamTwitchStreamsRaw = "TWITCH_STREAMS_RAW"
-	StreamTwitchStreamsNew = "TWITCH_STREAMS_NEW"
+	StreamTwitchStreamsRaw      = "TWITCH_STREAMS_RAW"
+	StreamTwitchStreamsNew      = "TWITCH_STREAMS_NEW"
+	StreamTwitchStreamsEnded    = "TWITCH_STREAMS_ENDED"
+	StreamTwitchStreamsUpdated  = "TWITCH_STREAMS_UPDATED"
+	StreamTwitchWebhooksInvalid = "TWITCH_WEBHOOKS_INVALID"
+	StreamTwitchEmailVerify     = "TWITCH_EMAIL_VERIFICATION"
 
 	// Durable consumer names
 	ConsumerStreamFilter           = "stream-filter"
 	ConsumerNotificationDispatcher = "notification-dispatcher"
+	ConsumerSubscriptionService    = "subscription-service"
 )
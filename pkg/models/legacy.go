@@ -0,0 +1,95 @@
+package models
+
+import "encoding/json/v2"
+
+// Before other destinations existed, webhook_url was called discord_webhook.
+// Discord subscriptions still carry the old name beside the new one in
+// events and API responses, and it is read when webhook_url is absent, so
+// publishers, consumers and API clients that predate the rename keep working.
+
+// legacyWebhook returns the discord_webhook value of a subscription with the
+// given destination type and webhook URL. Messages without a destination
+// type predate it and are Discord's.
+func legacyWebhook(t DestinationType, webhookURL string) string {
+	if t == DestinationDiscord || t == "" {
+		return webhookURL
+	}
+	return ""
+}
+
+// The types below have the fields but not the methods of the ones they
+// encode, so marshaling them does not recurse.
+type (
+	notificationPayload NotificationPayload
+	subscriptionRef     SubscriptionRef
+	subscription        Subscription
+)
+
+type notificationPayloadJSON struct {
+	notificationPayload
+	DiscordWebhook string `json:"discord_webhook,omitempty"`
+}
+
+type subscriptionRefJSON struct {
+	subscriptionRef
+	DiscordWebhook string `json:"discord_webhook,omitempty"`
+}
+
+type subscriptionJSON struct {
+	subscription
+	DiscordWebhook string `json:"discord_webhook,omitempty"`
+}
+
+// MarshalJSON adds discord_webhook for Discord subscriptions.
+func (p NotificationPayload) MarshalJSON() ([]byte, error) {
+	return json.Marshal(notificationPayloadJSON{notificationPayload(p), legacyWebhook(p.DestinationType, p.WebhookURL)})
+}
+
+// UnmarshalJSON reads discord_webhook if webhook_url is absent.
+func (p *NotificationPayload) UnmarshalJSON(data []byte) error {
+	var v notificationPayloadJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*p = NotificationPayload(v.notificationPayload)
+	if p.WebhookURL == "" {
+		p.WebhookURL = v.DiscordWebhook
+	}
+	return nil
+}
+
+// MarshalJSON adds discord_webhook for Discord subscriptions.
+func (r SubscriptionRef) MarshalJSON() ([]byte, error) {
+	return json.Marshal(subscriptionRefJSON{subscriptionRef(r), legacyWebhook(r.DestinationType, r.WebhookURL)})
+}
+
+// UnmarshalJSON reads discord_webhook if webhook_url is absent.
+func (r *SubscriptionRef) UnmarshalJSON(data []byte) error {
+	var v subscriptionRefJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*r = SubscriptionRef(v.subscriptionRef)
+	if r.WebhookURL == "" {
+		r.WebhookURL = v.DiscordWebhook
+	}
+	return nil
+}
+
+// MarshalJSON adds discord_webhook for Discord subscriptions.
+func (s Subscription) MarshalJSON() ([]byte, error) {
+	return json.Marshal(subscriptionJSON{subscription(s), legacyWebhook(s.DestinationType, s.WebhookURL)})
+}
+
+// UnmarshalJSON reads discord_webhook if webhook_url is absent.
+func (s *Subscription) UnmarshalJSON(data []byte) error {
+	var v subscriptionJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*s = Subscription(v.subscription)
+	if s.WebhookURL == "" {
+		s.WebhookURL = v.DiscordWebhook
+	}
+	return nil
+}
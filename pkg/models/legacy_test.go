@@ -0,0 +1,64 @@
+package models
+
+import (
+	"encoding/json/v2"
+	"strings"
+	"testing"
+)
+
+func TestSubscriptionRef_LegacyWebhook(t *testing.T) {
+	var old SubscriptionRef
+	if err := json.Unmarshal([]byte(`{"subscription_id":"sub-1","discord_webhook":"https://discord.com/api/webhooks/1/a"}`), &old); err != nil {
+		t.Fatal(err)
+	}
+	if old.WebhookURL != "https://discord.com/api/webhooks/1/a" {
+		t.Errorf("WebhookURL = %q, want discord_webhook's value", old.WebhookURL)
+	}
+
+	cases := []struct {
+		ref  SubscriptionRef
+		want string
+	}{
+		{SubscriptionRef{DestinationType: DestinationDiscord, WebhookURL: "https://discord.com/api/webhooks/1/a"},
+			`"discord_webhook":"https://discord.com/api/webhooks/1/a"`},
+		{SubscriptionRef{DestinationType: DestinationSlack, WebhookURL: "https://hooks.slack.com/services/T/B/x"}, ""},
+	}
+	for _, tc := range cases {
+		data, err := json.Marshal(tc.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(data); !strings.Contains(got, `"webhook_url":"`+tc.ref.WebhookURL+`"`) ||
+			strings.Contains(got, "discord_webhook") != (tc.want != "") || !strings.Contains(got, tc.want) {
+			t.Errorf("Marshal(%s) = %s, want webhook_url and %q", tc.ref.DestinationType, got, tc.want)
+		}
+	}
+}
+
+func TestNotificationPayload_RoundTrip(t *testing.T) {
+	in := NotificationPayload{
+		SubscriptionID:  "sub-1",
+		DestinationType: DestinationDiscord,
+		WebhookURL:      "https://discord.com/api/webhooks/1/a",
+		WebhookSecret:   "whsec_test",
+		DestinationConfig: &DestinationConfig{
+			Discord: &DiscordConfig{Username: "watcher"},
+		},
+		StreamID: "stream-1",
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "whsec_test") {
+		t.Errorf("secret was encoded: %s", data)
+	}
+
+	var out NotificationPayload
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.WebhookURL != in.WebhookURL || out.StreamID != in.StreamID || out.DestinationConfig.Discord.Username != "watcher" {
+		t.Errorf("round trip = %+v, want %+v without the secret", out, in)
+	}
+}
@@ -2,10 +2,14 @@ package models
 
 import "time"
 
-// SubscriptionRef links a subscription to its Discord webhook.
+// SubscriptionRef links a subscription to its notification destination.
 type SubscriptionRef struct {
-	SubscriptionID string `json:"subscription_id"`
-	DiscordWebhook string `json:"discord_webhook"`
+	SubscriptionID    string             `json:"subscription_id"`
+	DestinationType   DestinationType    `json:"destination_type"`
+	WebhookURL        string             `json:"webhook_url"`
+	WebhookSecret     string             `json:"-"` // never published; filled in by notification-dispatcher
+	DestinationConfig *DestinationConfig `json:"destination_config,omitempty"`
+	NotifyOnEnd       bool               `json:"notify_on_end,omitempty"`
 }
 
 // TwitchStream represents a raw Twitch stream from the Helix API.
@@ -24,18 +28,38 @@ type TwitchStream struct {
 	ThumbnailURL string    `json:"thumbnail_url"`
 }
 
-// StreamEvent is published to twitch.streams.raw by stream-poller.
+// StreamEvent is published to twitch.streams.raw by stream-poller, and to
+// twitch.streams.updated when a live stream's details change.
 type StreamEvent struct {
-	StreamID      string           `json:"stream_id"`
-	UserLogin     string           `json:"user_login"`
-	UserName      string           `json:"user_name"`
-	GameID        string           `json:"game_id"`
-	GameName      string           `json:"game_name"`
-	Title         string           `json:"title"`
-	ViewerCount   int              `json:"viewer_count"`
-	StartedAt     time.Time        `json:"started_at"`
-	ThumbnailURL  string           `json:"thumbnail_url"`
-	StreamURL     string           `json:"stream_url"`
-	Subscriptions []SubscriptionRef `json:"subscriptions"`
-	PolledAt      time.Time        `json:"polled_at"`
+	StreamID        string            `json:"stream_id"`
+	UserLogin       string            `json:"user_login"`
+	UserName        string            `json:"user_name"`
+	GameID          string            `json:"game_id"`
+	GameName        string            `json:"game_name"`
+	Title           string            `json:"title"`
+	ViewerCount     int               `json:"viewer_count"`
+	StartedAt       time.Time         `json:"started_at"`
+	ThumbnailURL    string            `json:"thumbnail_url"`
+	StreamURL       string            `json:"stream_url"`
+	ProfileImageURL string            `json:"profile_image_url,omitempty"` // streamer's avatar; empty if unknown
+	Subscriptions   []SubscriptionRef `json:"subscriptions"`
+	PolledAt        time.Time         `json:"polled_at"`
+}
+
+// StreamEndedEvent is published to twitch.streams.ended by stream-poller when
+// a stream it saw live is no longer live.
+type StreamEndedEvent struct {
+	StreamID        string            `json:"stream_id"`
+	UserLogin       string            `json:"user_login"`
+	UserName        string            `json:"user_name"`
+	GameName        string            `json:"game_name"`
+	Title           string            `json:"title"`
+	StartedAt       time.Time         `json:"started_at"`
+	EndedAt         time.Time         `json:"ended_at"`
+	DurationSeconds int64             `json:"duration_seconds"`
+	PeakViewers     int               `json:"peak_viewers"`
+	ThumbnailURL    string            `json:"thumbnail_url"`
+	StreamURL       string            `json:"stream_url"`
+	ProfileImageURL string            `json:"profile_image_url,omitempty"`
+	Subscriptions   []SubscriptionRef `json:"subscriptions,omitempty"`
 }
@@ -10,12 +10,168 @@ const (
 	WatchTypeStreamer WatchType = "streamer"
 )
 
+// DestinationType identifies the service a subscription delivers notifications to.
+type DestinationType string
+
+const (
+	DestinationDiscord  DestinationType = "discord"
+	DestinationSlack    DestinationType = "slack"
+	DestinationWebhook  DestinationType = "webhook"  // generic signed HTTP webhook
+	DestinationTelegram DestinationType = "telegram" // webhook_url holds "telegram:<chat_id>"
+	DestinationMatrix   DestinationType = "matrix"   // webhook_url holds "matrix:<room_id>"
+	DestinationEmail    DestinationType = "email"    // webhook_url holds "email:<address>"
+	DestinationNtfy     DestinationType = "ntfy"     // webhook_url holds the topic URL
+	DestinationGotify   DestinationType = "gotify"   // webhook_url holds "gotify:<server_url>#<token fingerprint>"
+	DestinationTeams    DestinationType = "teams"    // Microsoft Teams Workflows webhook
+)
+
+// DestinationConfig holds the settings of destinations that are not addressed
+// by a webhook URL alone. Only the field matching the destination type is set.
+type DestinationConfig struct {
+	Discord  *DiscordConfig  `json:"discord,omitempty"`
+	Telegram *TelegramConfig `json:"telegram,omitempty"`
+	Matrix   *MatrixConfig   `json:"matrix,omitempty"`
+	Email    *EmailConfig    `json:"email,omitempty"`
+	Ntfy     *NtfyConfig     `json:"ntfy,omitempty"`
+	Gotify   *GotifyConfig   `json:"gotify,omitempty"`
+}
+
+// DiscordConfig holds the optional settings of a Discord subscription.
+type DiscordConfig struct {
+	Template *MessageTemplate `json:"template,omitempty"` // replaces the default go-live embed
+	Mentions *DiscordMentions `json:"mentions,omitempty"` // pinged by go-live messages
+
+	// At most one of ThreadID and ThreadName is set.
+	ThreadID   string `json:"thread_id,omitempty"`   // post into this thread or forum post
+	ThreadName string `json:"thread_name,omitempty"` // template naming a new forum post per stream
+
+	// Username and AvatarURL override the webhook's name and avatar. With
+	// AsStreamer, messages use the streamer's display name and profile image
+	// instead, falling back to Username and AvatarURL.
+	Username   string `json:"username,omitempty"`
+	AvatarURL  string `json:"avatar_url,omitempty"`
+	AsStreamer bool   `json:"as_streamer,omitzero"`
+}
+
+// DiscordMentions lists who a Discord go-live message pings. No other
+// mention in the message, such as one in a stream title, notifies anyone.
+type DiscordMentions struct {
+	Roles    []string `json:"roles,omitempty"`   // role IDs
+	Users    []string `json:"users,omitempty"`   // user IDs
+	Everyone bool     `json:"everyone,omitzero"` // @everyone
+	Here     bool     `json:"here,omitzero"`     // @here; ignored with Everyone
+}
+
+// MessageTemplate describes a custom go-live message. Every text is a Go
+// text/template executed with templates.Data; see pkg/templates for the
+// variables and functions available.
+type MessageTemplate struct {
+	Content     string          `json:"content,omitempty"` // text above the embed
+	Title       string          `json:"title,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Color       string          `json:"color,omitempty"` // "#RRGGBB"; Twitch purple if empty
+	Fields      []TemplateField `json:"fields,omitempty"`
+}
+
+// TemplateField is an embed field of a MessageTemplate.
+type TemplateField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitzero"`
+}
+
+// TelegramConfig addresses a Telegram chat through a bot.
+type TelegramConfig struct {
+	BotToken string `json:"bot_token,omitempty"` // kept server-side; never returned by the public API
+	ChatID   string `json:"chat_id"`             // numeric ID or @channelusername
+}
+
+// MatrixConfig addresses a Matrix room through an account on a homeserver.
+type MatrixConfig struct {
+	HomeserverURL string `json:"homeserver_url"`
+	RoomID        string `json:"room_id"`                // e.g. !abcdefg:example.org
+	AccessToken   string `json:"access_token,omitempty"` // kept server-side; never returned by the public API
+}
+
+// EmailDelivery chooses when an email subscription is sent its notifications.
+type EmailDelivery string
+
+const (
+	EmailInstant EmailDelivery = "instant" // one email per stream
+	EmailHourly  EmailDelivery = "hourly"  // one digest per address per hour
+)
+
+// EmailConfig addresses a mailbox.
+type EmailConfig struct {
+	Address  string        `json:"address"`
+	Delivery EmailDelivery `json:"delivery"`
+}
+
+// NtfyConfig addresses a topic on an ntfy server.
+type NtfyConfig struct {
+	ServerURL   string `json:"server_url"` // e.g. https://ntfy.sh
+	Topic       string `json:"topic"`
+	AccessToken string `json:"access_token,omitempty"` // optional; kept server-side, never returned by the public API
+	Priority    int    `json:"priority,omitzero"`      // 1 (min) to 5 (max); 0 uses the server default
+}
+
+// GotifyConfig addresses an application on a Gotify server.
+type GotifyConfig struct {
+	ServerURL string `json:"server_url"`
+	AppToken  string `json:"app_token,omitempty"` // kept server-side; never returned by the public API
+	Priority  int    `json:"priority,omitzero"`   // 1 to 10; 0 uses the application's default
+}
+
 // Subscription represents an active subscription stored in PostgreSQL.
 type Subscription struct {
-	ID             string    `json:"id"`
-	DiscordWebhook string    `json:"discord_webhook"`
+	ID                string             `json:"id"`
+	OwnerID           string             `json:"owner_id,omitempty"`
+	DestinationType   DestinationType    `json:"destination_type"`
+	WebhookURL        string             `json:"webhook_url"`
+	DestinationConfig *DestinationConfig `json:"destination_config,omitempty"`
+	WatchType         WatchType          `json:"watch_type"`
+	WatchTarget       string             `json:"watch_target"`
+	WatchTargetID     string             `json:"watch_target_id,omitempty"` // Twitch game or user ID of WatchTarget
+	NotifyOnEnd       bool               `json:"notify_on_end"`
+	Active            bool               `json:"active"`
+	CreatedAt         time.Time          `json:"created_at"`
+	UpdatedAt         time.Time          `json:"updated_at"`
+
+	// Incremented by every change; the ETag of the subscription.
+	Version int `json:"version"`
+
+	// Signs generic webhook deliveries. Generated by subscription-service and
+	// only returned to the owner when the subscription is created.
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+
+	// Set on email subscriptions until the address is confirmed. Nothing is
+	// sent to a pending subscription.
+	PendingVerification bool `json:"pending_verification,omitzero"`
+
+	// Set when the subscription is deactivated, by its owner or automatically.
+	DeactivatedReason string     `json:"deactivated_reason,omitempty"`
+	DeactivatedAt     *time.Time `json:"deactivated_at,omitempty"`
+}
+
+// WebhookInvalidEvent is published to twitch.webhooks.invalid by
+// notification-dispatcher when a destination reports a webhook as permanently
+// unusable (deleted, or its token revoked).
+type WebhookInvalidEvent struct {
+	DestinationType DestinationType `json:"destination_type"`
+	WebhookURL      string          `json:"webhook_url"`
+	StatusCode      int             `json:"status_code"`
+	Reason          string          `json:"reason"`
+	DetectedAt      time.Time       `json:"detected_at"`
+}
+
+// EmailVerificationEvent is published to twitch.email.verification by
+// subscription-service when an email subscription is created, asking
+// notification-dispatcher to send the confirmation link to the address.
+type EmailVerificationEvent struct {
+	SubscriptionID string    `json:"subscription_id"`
+	Address        string    `json:"address"`
 	WatchType      WatchType `json:"watch_type"`
 	WatchTarget    string    `json:"watch_target"`
-	Active         bool      `json:"active"`
-	CreatedAt      time.Time `json:"created_at"`
+	VerifyURL      string    `json:"verify_url"`
+	ExpiresAt      time.Time `json:"expires_at"`
 }
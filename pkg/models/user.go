@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// User owns subscriptions and authenticates to the public API with APITokens.
+type User struct {
+	ID               string    `json:"id"`
+	Name             string    `json:"name"`
+	MaxSubscriptions int       `json:"max_subscriptions"`         // active subscriptions the user may have
+	DiscordUserID    string    `json:"discord_user_id,omitempty"` // set for users who signed in with Discord
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// APIToken is a bearer token of a User. Only a hash of it is stored, so Token
+// is only set when the token is created.
+type APIToken struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // set for login sessions
+}
+
+// DiscordWebhook is a webhook Discord created for a User who signed in with
+// Discord and picked a channel. Its WebhookURL can be used for their
+// subscriptions.
+type DiscordWebhook struct {
+	ID         string    `json:"id"`
+	WebhookID  string    `json:"webhook_id"`
+	GuildID    string    `json:"guild_id"`
+	ChannelID  string    `json:"channel_id"`
+	Name       string    `json:"name"`
+	WebhookURL string    `json:"webhook_url"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,77 @@
+// Package netguard keeps requests to user-supplied URLs from reaching the
+// services' own network: loopback, private, link-local and other addresses
+// that are not publicly routable are refused.
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrForbidden is returned for an address that is not publicly routable.
+var ErrForbidden = errors.New("address is not publicly routable")
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598, which
+// netip does not count as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Allowed reports whether ip is a publicly routable unicast address.
+func Allowed(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// CheckHost resolves host, a name or an IP address, and returns an error
+// wrapping ErrForbidden if any of its addresses is not Allowed.
+func CheckHost(ctx context.Context, host string) error {
+	var addrs []netip.Addr
+	if ip, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{ip}
+	} else {
+		addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return fmt.Errorf("resolve %s: %w", host, err)
+		}
+	}
+	for _, ip := range addrs {
+		if !Allowed(ip) {
+			return fmt.Errorf("%s resolves to %s: %w", host, ip, ErrForbidden)
+		}
+	}
+	return nil
+}
+
+// Control is a net.Dialer Control function that refuses to connect to
+// addresses that are not Allowed. It sees the address actually dialled, after
+// DNS resolution, so a name that re-resolves to an internal address between
+// validation and delivery is still refused.
+func Control(network, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("dial %s: %w", address, err)
+	}
+	if !Allowed(ap.Addr()) {
+		return fmt.Errorf("dial %s: %w", address, ErrForbidden)
+	}
+	return nil
+}
+
+// Transport returns an HTTP transport like http.DefaultTransport that only
+// connects to Allowed addresses. It ignores proxy settings, since the proxy
+// rather than the destination would be checked.
+func Transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   Control,
+	}).DialContext
+	return t
+}
@@ -0,0 +1,59 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestAllowed(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"fe80::1":          false,
+		"fd00::1":          false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"::ffff:127.0.0.1": false,
+		"224.0.0.1":        false,
+	} {
+		if got := Allowed(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("Allowed(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	ctx := context.Background()
+	if err := CheckHost(ctx, "169.254.169.254"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("metadata address: err = %v, want ErrForbidden", err)
+	}
+	if err := CheckHost(ctx, "localhost"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("localhost: err = %v, want ErrForbidden", err)
+	}
+	if err := CheckHost(ctx, "93.184.216.34"); err != nil {
+		t.Errorf("public address: %v", err)
+	}
+}
+
+func TestTransport_RefusesLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	resp, err := (&http.Client{Transport: Transport()}).Get(srv.URL)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, ErrForbidden) {
+		t.Errorf("err = %v, want ErrForbidden", err)
+	}
+}
@@ -0,0 +1,405 @@
+// Package templates renders the custom go-live messages and forum post names
+// of Discord subscriptions.
+//
+// Each text of a models.MessageTemplate is a Go text/template executed with
+// Data, so {{.UserName}} is the streamer's display name. Only a safe subset of
+// the template language is accepted: actions, if/else and with, the
+// comparison and logic functions (eq, ne, lt, le, gt, ge, and, or, not, len)
+// and these functions:
+//
+//	upper s            s in upper case
+//	lower s            s in lower case
+//	trim s             s without leading and trailing white space
+//	truncate n s       s cut to n characters, ending in "…" if cut
+//	default d s        d if s is empty, else s
+//	replace old new s  s with every old, which must not be empty, replaced by new
+//	number n           n with thousands separators, e.g. 12,345
+//	date layout t      t formatted with a Go time layout, in UTC
+//
+// range, define, block and template are rejected, and no function may return
+// more than 16 KiB, so rendering always finishes quickly and in bounded memory.
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+	"unicode/utf8"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+)
+
+// Discord's limits on the parts of a message. Longer output is truncated.
+const (
+	MaxContent     = 2000
+	MaxTitle       = 256
+	MaxDescription = 4096
+	MaxFields      = 25
+	MaxFieldName   = 256
+	MaxFieldValue  = 1024
+	MaxThreadName  = 100
+)
+
+// maxSource is the longest template text accepted.
+const maxSource = 4096
+
+// maxOutput bounds what one text, or any function call in it, may render to
+// before truncation.
+const maxOutput = 16 << 10
+
+// DefaultColor is the embed color of a template without one: Twitch purple.
+const DefaultColor = 0x9146FF
+
+// ErrInvalid is wrapped by every error about a template being unusable.
+var ErrInvalid = errors.New("invalid message template")
+
+// Data holds the variables available to templates.
+type Data struct {
+	UserLogin       string    // streamer's login, e.g. "ninja"
+	UserName        string    // streamer's display name, e.g. "Ninja"
+	GameName        string    // e.g. "Fortnite"
+	Title           string    // stream title
+	ViewerCount     int       // viewers when the message is rendered
+	StartedAt       time.Time // when the stream went live
+	StreamURL       string    // e.g. https://twitch.tv/ninja
+	ThumbnailURL    string    // stream preview image
+	ProfileImageURL string    // streamer's avatar; empty if unknown
+}
+
+// FromPayload returns the Data of a notification.
+func FromPayload(p models.NotificationPayload) Data {
+	return Data{
+		UserLogin:       p.UserLogin,
+		UserName:        p.UserName,
+		GameName:        p.GameName,
+		Title:           p.Title,
+		ViewerCount:     p.ViewerCount,
+		StartedAt:       p.StartedAt,
+		StreamURL:       p.StreamURL,
+		ThumbnailURL:    p.ThumbnailURL,
+		ProfileImageURL: p.ProfileImageURL,
+	}
+}
+
+// FromEnded returns the Data of a stream that went offline. ViewerCount is its peak.
+func FromEnded(e models.StreamEndedEvent) Data {
+	return Data{
+		UserLogin:       e.UserLogin,
+		UserName:        e.UserName,
+		GameName:        e.GameName,
+		Title:           e.Title,
+		ViewerCount:     e.PeakViewers,
+		StartedAt:       e.StartedAt,
+		StreamURL:       e.StreamURL,
+		ThumbnailURL:    e.ThumbnailURL,
+		ProfileImageURL: e.ProfileImageURL,
+	}
+}
+
+// Sample is the Data templates are dry-rendered with when they are validated.
+var Sample = Data{
+	UserLogin:       "streamer",
+	UserName:        "Streamer",
+	GameName:        "Just Chatting",
+	Title:           "Sample stream title",
+	ViewerCount:     1234,
+	StartedAt:       time.Date(2025, 1, 1, 18, 0, 0, 0, time.UTC),
+	StreamURL:       "https://twitch.tv/streamer",
+	ThumbnailURL:    "https://static-cdn.jtvnw.net/previews-ttv/live_user_streamer-1280x720.jpg",
+	ProfileImageURL: "https://static-cdn.jtvnw.net/jtv_user_pictures/streamer-profile_image-300x300.png",
+}
+
+// Message is a rendered MessageTemplate.
+type Message struct {
+	Content     string
+	Title       string
+	Description string
+	Color       int
+	Fields      []Field
+}
+
+// Field is a rendered embed field.
+type Field struct {
+	Name   string
+	Value  string
+	Inline bool
+}
+
+// Validate checks that t only uses the supported subset of the template
+// language and dry-renders it with Sample.
+func Validate(t *models.MessageTemplate) error {
+	if t.Content == "" && t.Title == "" && t.Description == "" && len(t.Fields) == 0 {
+		return fmt.Errorf("%w: nothing to render", ErrInvalid)
+	}
+	_, err := Render(t, Sample)
+	return err
+}
+
+// Render executes every text of t with d.
+func Render(t *models.MessageTemplate, d Data) (Message, error) {
+	if len(t.Fields) > MaxFields {
+		return Message{}, fmt.Errorf("%w: more than %d fields", ErrInvalid, MaxFields)
+	}
+	color, err := parseColor(t.Color)
+	if err != nil {
+		return Message{}, err
+	}
+
+	msg := Message{Color: color}
+	texts := []struct {
+		name  string
+		src   string
+		limit int
+		out   *string
+	}{
+		{"content", t.Content, MaxContent, &msg.Content},
+		{"title", t.Title, MaxTitle, &msg.Title},
+		{"description", t.Description, MaxDescription, &msg.Description},
+	}
+	for _, text := range texts {
+		if *text.out, err = execute(text.name, text.src, text.limit, d); err != nil {
+			return Message{}, err
+		}
+	}
+
+	for i, f := range t.Fields {
+		name, err := execute(fmt.Sprintf("fields[%d].name", i), f.Name, MaxFieldName, d)
+		if err != nil {
+			return Message{}, err
+		}
+		value, err := execute(fmt.Sprintf("fields[%d].value", i), f.Value, MaxFieldValue, d)
+		if err != nil {
+			return Message{}, err
+		}
+		// Discord rejects fields with an empty name or value.
+		if strings.TrimSpace(name) == "" || strings.TrimSpace(value) == "" {
+			continue
+		}
+		msg.Fields = append(msg.Fields, Field{Name: name, Value: value, Inline: f.Inline})
+	}
+	return msg, nil
+}
+
+// ThreadName renders src, the template naming a new forum post, with d. Line
+// breaks are replaced with spaces, and a name that renders empty is an error
+// since Discord rejects it.
+func ThreadName(src string, d Data) (string, error) {
+	name, err := execute("thread_name", src, MaxThreadName, d)
+	if err != nil {
+		return "", err
+	}
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return "", fmt.Errorf("%w: thread_name renders to nothing", ErrInvalid)
+	}
+	return name, nil
+}
+
+// execute parses src, checks it and renders it with d, truncated to limit characters.
+func execute(name, src string, limit int, d Data) (string, error) {
+	if src == "" {
+		return "", nil
+	}
+	if len(src) > maxSource {
+		return "", fmt.Errorf("%w: %s is longer than %d bytes", ErrInvalid, name, maxSource)
+	}
+	tmpl, err := template.New(name).Funcs(funcs).Parse(src)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if len(tmpl.Templates()) > 1 {
+		return "", fmt.Errorf("%w: %s: define and block are not allowed", ErrInvalid, name)
+	}
+	if err := check(tmpl.Tree.Root); err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalid, name, err)
+	}
+
+	var b limitedBuilder
+	if err := tmpl.Execute(&b, d); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return Truncate(limit, strings.TrimSpace(b.String())), nil
+}
+
+// allowed lists the functions a template may call.
+var allowed = map[string]bool{
+	"eq": true, "ne": true, "lt": true, "le": true, "gt": true, "ge": true,
+	"and": true, "or": true, "not": true, "len": true,
+}
+
+func init() {
+	for name := range funcs {
+		allowed[name] = true
+	}
+}
+
+// check rejects the parts of the template language that are not supported.
+func check(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		for _, child := range n.Nodes {
+			if err := check(child); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return check(n.Pipe)
+	case *parse.IfNode:
+		return checkBranch(&n.BranchNode)
+	case *parse.WithNode:
+		return checkBranch(&n.BranchNode)
+	case *parse.PipeNode:
+		for _, cmd := range n.Cmds {
+			if err := check(cmd); err != nil {
+				return err
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if err := check(arg); err != nil {
+				return err
+			}
+		}
+	case *parse.ChainNode:
+		return check(n.Node)
+	case *parse.IdentifierNode:
+		if !allowed[n.Ident] {
+			return fmt.Errorf("function %q is not allowed", n.Ident)
+		}
+	case *parse.TextNode, *parse.CommentNode, *parse.FieldNode, *parse.VariableNode, *parse.DotNode,
+		*parse.StringNode, *parse.NumberNode, *parse.BoolNode, *parse.NilNode:
+	default:
+		return fmt.Errorf("%q is not allowed", node.String())
+	}
+	return nil
+}
+
+func checkBranch(b *parse.BranchNode) error {
+	if err := check(b.Pipe); err != nil {
+		return err
+	}
+	if err := check(b.List); err != nil {
+		return err
+	}
+	if b.ElseList != nil {
+		return check(b.ElseList)
+	}
+	return nil
+}
+
+// funcs are the functions templates may call. Each one's result is bounded by
+// maxOutput, so nesting them cannot build huge intermediate strings.
+var funcs = template.FuncMap{
+	"upper": func(s string) (string, error) {
+		return bounded(strings.ToUpper(s))
+	},
+	"lower": func(s string) (string, error) {
+		return bounded(strings.ToLower(s))
+	},
+	"trim": func(s string) (string, error) {
+		return bounded(strings.TrimSpace(s))
+	},
+	"truncate": func(n int, s string) (string, error) {
+		return bounded(Truncate(n, s))
+	},
+	"default": func(def, s string) (string, error) {
+		if s == "" {
+			return bounded(def)
+		}
+		return bounded(s)
+	},
+	"replace": replace,
+	"number": func(n int) (string, error) {
+		return bounded(number(n))
+	},
+	"date": func(layout string, t time.Time) (string, error) {
+		if len(layout) > maxOutput {
+			return "", errTooLong
+		}
+		return bounded(t.UTC().Format(layout))
+	},
+}
+
+// replace replaces every old in s with new, refusing to build a result longer
+// than maxOutput.
+func replace(old, new, s string) (string, error) {
+	if old == "" {
+		return "", errors.New("replace: old must not be empty")
+	}
+	if n := strings.Count(s, old); len(s)+n*(len(new)-len(old)) > maxOutput {
+		return "", errTooLong
+	}
+	return bounded(strings.ReplaceAll(s, old, new))
+}
+
+// bounded returns s, or errTooLong if it is longer than maxOutput.
+func bounded(s string) (string, error) {
+	if len(s) > maxOutput {
+		return "", errTooLong
+	}
+	return s, nil
+}
+
+// Truncate cuts s to n characters, replacing the last one with "…" if it was cut.
+func Truncate(n int, s string) string {
+	if n <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
+
+// number formats n with a comma between each group of three digits.
+func number(n int) string {
+	s := strconv.Itoa(n)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	if neg {
+		return "-" + b.String()
+	}
+	return b.String()
+}
+
+// parseColor parses a "#RRGGBB" color; an empty string is DefaultColor.
+func parseColor(s string) (int, error) {
+	if s == "" {
+		return DefaultColor, nil
+	}
+	if len(s) != 7 || s[0] != '#' {
+		return 0, fmt.Errorf("%w: color must look like #9146FF", ErrInvalid)
+	}
+	c, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%w: color must look like #9146FF", ErrInvalid)
+	}
+	return int(c), nil
+}
+
+// errTooLong stops a template whose output exceeds maxOutput.
+var errTooLong = errors.New("output too long")
+
+// limitedBuilder is a strings.Builder that refuses to grow past maxOutput.
+type limitedBuilder struct {
+	strings.Builder
+}
+
+func (b *limitedBuilder) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > maxOutput {
+		return 0, errTooLong
+	}
+	return b.Builder.Write(p)
+}
@@ -0,0 +1,106 @@
+package templates
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+)
+
+func TestRender(t *testing.T) {
+	tmpl := &models.MessageTemplate{
+		Content:     "{{.UserName}} is on!",
+		Title:       "{{upper .UserName}} plays {{.GameName}}",
+		Description: `{{truncate 10 .Title}}{{if gt .ViewerCount 1000}} ({{number .ViewerCount}} watching){{end}}`,
+		Color:       "#00FF7f",
+		Fields: []models.TemplateField{
+			{Name: "Started", Value: `{{date "15:04" .StartedAt}}`, Inline: true},
+			{Name: "Empty", Value: `{{if false}}never{{end}}`},
+		},
+	}
+
+	msg, err := Render(tmpl, Sample)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Content != "Streamer is on!" {
+		t.Errorf("Content = %q", msg.Content)
+	}
+	if msg.Title != "STREAMER plays Just Chatting" {
+		t.Errorf("Title = %q", msg.Title)
+	}
+	if msg.Description != "Sample st… (1,234 watching)" {
+		t.Errorf("Description = %q", msg.Description)
+	}
+	if msg.Color != 0x00FF7F {
+		t.Errorf("Color = %#x", msg.Color)
+	}
+	if len(msg.Fields) != 1 || msg.Fields[0].Value != "18:00" || !msg.Fields[0].Inline {
+		t.Errorf("Fields = %+v, want only the started field", msg.Fields)
+	}
+}
+
+func TestRender_TruncatesToDiscordLimits(t *testing.T) {
+	msg, err := Render(&models.MessageTemplate{Title: `{{replace "e" "` + strings.Repeat("s", 100) + `" .Title}}`}, Sample)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := len([]rune(msg.Title)); n != MaxTitle || !strings.HasSuffix(msg.Title, "…") {
+		t.Errorf("title has %d characters, want %d ending in an ellipsis", n, MaxTitle)
+	}
+}
+
+func TestRender_BoundsNestedFunctions(t *testing.T) {
+	grow := `"e" "` + strings.Repeat("e", 150) + `"`
+	tmpl := &models.MessageTemplate{Title: `{{replace ` + grow + ` (replace ` + grow + ` (replace ` + grow + ` .Title))}}`}
+	if _, err := Render(tmpl, Sample); !errors.Is(err, ErrInvalid) {
+		t.Errorf("err = %v, want ErrInvalid for an oversized intermediate string", err)
+	}
+	if _, err := Render(&models.MessageTemplate{Title: `{{replace "" "x" .Title}}`}, Sample); !errors.Is(err, ErrInvalid) {
+		t.Errorf("err = %v, want ErrInvalid for an empty old string", err)
+	}
+}
+
+func TestThreadName(t *testing.T) {
+	name, err := ThreadName("{{.GameName}}:\n{{.UserName}}", Sample)
+	if err != nil || name != "Just Chatting: Streamer" {
+		t.Errorf("ThreadName = %q, %v", name, err)
+	}
+	if _, err := ThreadName(`{{if false}}x{{end}}`, Sample); !errors.Is(err, ErrInvalid) {
+		t.Errorf("err = %v, want ErrInvalid for an empty name", err)
+	}
+}
+
+func TestValidate_Rejects(t *testing.T) {
+	cases := []struct {
+		name string
+		tmpl models.MessageTemplate
+	}{
+		{"empty", models.MessageTemplate{}},
+		{"syntax error", models.MessageTemplate{Title: "{{.UserName"}},
+		{"unknown variable", models.MessageTemplate{Title: "{{.BotToken}}"}},
+		{"range", models.MessageTemplate{Title: "{{range 1000000000}}x{{end}}"}},
+		{"define", models.MessageTemplate{Title: `{{define "x"}}y{{end}}{{template "x"}}`}},
+		{"printf", models.MessageTemplate{Title: `{{printf "%0999999d" 1}}`}},
+		{"call", models.MessageTemplate{Title: `{{call .UserName}}`}},
+		{"bad color", models.MessageTemplate{Title: "hi", Color: "purple"}},
+		{"too many fields", models.MessageTemplate{Fields: make([]models.TemplateField, MaxFields+1)}},
+		{"too long", models.MessageTemplate{Description: strings.Repeat("x", maxSource+1)}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := Validate(&tc.tmpl); !errors.Is(err, ErrInvalid) {
+				t.Errorf("err = %v, want ErrInvalid", err)
+			}
+		})
+	}
+}
+
+func TestNumber(t *testing.T) {
+	for n, want := range map[int]string{0: "0", 999: "999", 1000: "1,000", 1234567: "1,234,567", -45000: "-45,000"} {
+		if got := number(n); got != want {
+			t.Errorf("number(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
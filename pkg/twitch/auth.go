@@ -14,15 +14,19 @@ import (
 const tokenURL = "https://id.twitch.tv/oauth2/token"
 
 type tokenResponse struct {
-	AccessToken string `json:"access_token"`
-	ExpiresIn   int    `json:"expires_in"`
-	TokenType   string `json:"token_type"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	TokenType    string `json:"token_type"`
 }
 
-// TokenManager manages a Twitch app-access token with proactive refresh.
+// TokenManager manages a Twitch access token with proactive refresh.
+// It holds an app-access token by default, or a user-access token when
+// created with NewUserTokenManager.
 type TokenManager struct {
 	clientID     string
 	clientSecret string
+	refreshToken string
 	httpClient   *http.Client
 
 	mu        sync.RWMutex
@@ -39,6 +43,15 @@ func NewTokenManager(clientID, clientSecret string) *TokenManager {
 	}
 }
 
+// NewUserTokenManager creates a TokenManager that obtains user-access tokens
+// from a refresh token. Twitch may rotate the refresh token on each use; the
+// latest one is kept in memory.
+func NewUserTokenManager(clientID, clientSecret, refreshToken string) *TokenManager {
+	m := NewTokenManager(clientID, clientSecret)
+	m.refreshToken = refreshToken
+	return m
+}
+
 // Token returns the current access token, refreshing if it expires within 5 minutes.
 func (m *TokenManager) Token(ctx context.Context) (string, error) {
 	m.mu.RLock()
@@ -62,6 +75,10 @@ func (m *TokenManager) Refresh(ctx context.Context) (string, error) {
 		"client_secret": {m.clientSecret},
 		"grant_type":    {"client_credentials"},
 	}
+	if m.refreshToken != "" {
+		body.Set("grant_type", "refresh_token")
+		body.Set("refresh_token", m.refreshToken)
+	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(body.Encode()))
 	if err != nil {
@@ -85,6 +102,9 @@ func (m *TokenManager) Refresh(ctx context.Context) (string, error) {
 	}
 
 	m.token = tr.AccessToken
+	if tr.RefreshToken != "" && m.refreshToken != "" {
+		m.refreshToken = tr.RefreshToken
+	}
 	m.expiresAt = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
 	return m.token, nil
 }
@@ -0,0 +1,332 @@
+// Package twitch is a client for the Twitch Helix API and EventSub, shared
+// by the services that look streams, games and users up on Twitch.
+package twitch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+)
+
+const helixBase = "https://api.twitch.tv/helix"
+
+const (
+	// maxStreamFilters is the Helix limit on game_id or user_login values per /streams request.
+	maxStreamFilters = 100
+
+	// streamBatchConcurrency bounds how many /streams batches are fetched in parallel.
+	streamBatchConcurrency = 4
+)
+
+// Client is a Twitch Helix API client.
+type Client struct {
+	clientID   string
+	baseURL    string
+	tokenMgr   *TokenManager
+	limiter    *RateLimiter
+	httpClient *http.Client
+}
+
+// NewClient creates a Twitch Helix client. Requests are sent through limiter,
+// which should be shared by all clients using the same client ID, and which
+// also times them out.
+func NewClient(clientID string, tokenMgr *TokenManager, limiter *RateLimiter) *Client {
+	return &Client{
+		clientID:   clientID,
+		baseURL:    helixBase,
+		tokenMgr:   tokenMgr,
+		limiter:    limiter,
+		httpClient: &http.Client{Transport: limiter},
+	}
+}
+
+// RateLimit returns the current Helix rate-limit budget.
+func (c *Client) RateLimit() Budget {
+	return c.limiter.Budget()
+}
+
+type gamesResponse struct {
+	Data []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"data"`
+}
+
+// GetGameIDs resolves game names to Twitch game IDs.
+// Returns a map of name→id for names that were found. Names are looked up
+// in batches of 100, the Helix limit per request.
+func (c *Client) GetGameIDs(ctx context.Context, names []string) (map[string]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	result := make(map[string]string, len(names))
+	for chunk := range slices.Chunk(names, maxStreamFilters) {
+		params := url.Values{}
+		for _, n := range chunk {
+			params.Add("name", n)
+		}
+
+		body, err := c.get(ctx, "/games?"+params.Encode())
+		if err != nil {
+			return nil, err
+		}
+
+		var resp gamesResponse
+		err = json.UnmarshalRead(body, &resp)
+		body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode games response: %w", err)
+		}
+
+		for _, g := range resp.Data {
+			result[g.Name] = g.ID
+		}
+	}
+	return result, nil
+}
+
+type streamsResponse struct {
+	Data       []models.TwitchStream `json:"data"`
+	Pagination struct {
+		Cursor string `json:"cursor"`
+	} `json:"pagination"`
+}
+
+// BatchFailure describes a single /streams batch that could not be fetched.
+type BatchFailure struct {
+	GameIDs    []string
+	UserLogins []string
+	Err        error
+}
+
+// BatchError is returned by GetStreams when one or more batches fail.
+// Streams from the batches that succeeded are still returned alongside it.
+type BatchError struct {
+	Failures []BatchFailure
+	Total    int
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d of %d stream batches failed: %v", len(e.Failures), e.Total, e.Failures[0].Err)
+}
+
+// Unwrap exposes the per-batch errors to errors.Is and errors.As.
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, f := range e.Failures {
+		errs[i] = f.Err
+	}
+	return errs
+}
+
+// streamBatch is the set of filters sent in a single /streams request.
+type streamBatch struct {
+	gameIDs    []string
+	userLogins []string
+}
+
+// GetStreams fetches live streams matching the given game IDs and/or user logins.
+// Helix accepts at most 100 game IDs and 100 user logins per request, so the
+// targets are split into batches that are fetched concurrently and merged,
+// deduplicated by stream ID. If some batches fail, the streams from the rest
+// are returned together with a *BatchError.
+func (c *Client) GetStreams(ctx context.Context, gameIDs, userLogins []string) ([]models.TwitchStream, error) {
+	batches := splitStreamBatches(gameIDs, userLogins)
+	if len(batches) == 0 {
+		return nil, nil
+	}
+
+	results := make([][]models.TwitchStream, len(batches))
+	errs := make([]error, len(batches))
+	sem := make(chan struct{}, streamBatchConcurrency)
+
+	var wg sync.WaitGroup
+	for i, b := range batches {
+		wg.Go(func() {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+			results[i], errs[i] = c.getStreamBatch(ctx, b)
+		})
+	}
+	wg.Wait()
+
+	seen := make(map[string]struct{})
+	var all []models.TwitchStream
+	var failures []BatchFailure
+
+	for i, b := range batches {
+		if errs[i] != nil {
+			failures = append(failures, BatchFailure{GameIDs: b.gameIDs, UserLogins: b.userLogins, Err: errs[i]})
+			continue
+		}
+		for _, s := range results[i] {
+			if _, ok := seen[s.ID]; ok {
+				continue
+			}
+			seen[s.ID] = struct{}{}
+			all = append(all, s)
+		}
+	}
+
+	if len(failures) > 0 {
+		return all, &BatchError{Failures: failures, Total: len(batches)}
+	}
+	return all, nil
+}
+
+// splitStreamBatches chunks game IDs and user logins into Helix-sized batches.
+// Game and login filters are kept in separate batches so each request has a
+// single, unambiguous filter type.
+func splitStreamBatches(gameIDs, userLogins []string) []streamBatch {
+	var batches []streamBatch
+	for chunk := range slices.Chunk(gameIDs, maxStreamFilters) {
+		batches = append(batches, streamBatch{gameIDs: chunk})
+	}
+	for chunk := range slices.Chunk(userLogins, maxStreamFilters) {
+		batches = append(batches, streamBatch{userLogins: chunk})
+	}
+	return batches
+}
+
+// getStreamBatch fetches every page of /streams for a single batch.
+func (c *Client) getStreamBatch(ctx context.Context, b streamBatch) ([]models.TwitchStream, error) {
+	params := url.Values{"first": {"100"}}
+	for _, id := range b.gameIDs {
+		params.Add("game_id", id)
+	}
+	for _, login := range b.userLogins {
+		params.Add("user_login", login)
+	}
+
+	var all []models.TwitchStream
+	cursor := ""
+
+	for {
+		if cursor != "" {
+			params.Set("after", cursor)
+		}
+
+		body, err := c.get(ctx, "/streams?"+params.Encode())
+		if err != nil {
+			return nil, err
+		}
+
+		var resp streamsResponse
+		if err := json.UnmarshalRead(body, &resp); err != nil {
+			body.Close()
+			return nil, fmt.Errorf("decode streams response: %w", err)
+		}
+		body.Close()
+
+		all = append(all, resp.Data...)
+
+		if resp.Pagination.Cursor == "" || len(resp.Data) == 0 {
+			break
+		}
+		cursor = resp.Pagination.Cursor
+	}
+
+	return all, nil
+}
+
+// APIError is returned when Helix answers with an unexpected status code.
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("helix %s %s: status %d: %s", e.Method, e.Path, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("helix %s %s: status %d", e.Method, e.Path, e.StatusCode)
+}
+
+// get performs a GET request against the Helix API, retrying once on 401.
+func (c *Client) get(ctx context.Context, path string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.apiError(resp, http.MethodGet, path)
+	}
+	return resp.Body, nil
+}
+
+// do sends a request to the Helix API, refreshing the token and retrying once on 401.
+// The caller owns the response body.
+func (c *Client) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	token, err := c.tokenMgr.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get token: %w", err)
+	}
+
+	resp, err := c.send(ctx, method, c.baseURL+path, token, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		token, err = c.tokenMgr.Refresh(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("token refresh after 401: %w", err)
+		}
+		resp, err = c.send(ctx, method, c.baseURL+path, token, body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// apiError closes resp and converts it into an *APIError.
+func (c *Client) apiError(resp *http.Response, method, path string) error {
+	defer resp.Body.Close()
+
+	var body struct {
+		Message string `json:"message"`
+	}
+	_ = json.UnmarshalRead(resp.Body, &body)
+
+	if resp.StatusCode == http.StatusTooManyRequests && body.Message == "" {
+		body.Message = "rate limited until " + c.limiter.Budget().Reset.Format(time.RFC3339)
+	}
+	return &APIError{Method: method, Path: path, StatusCode: resp.StatusCode, Message: body.Message}
+}
+
+func (c *Client) send(ctx context.Context, method, fullURL, token string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, fullURL, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Client-ID", c.clientID)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.httpClient.Do(req)
+}
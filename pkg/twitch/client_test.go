@@ -0,0 +1,170 @@
+package twitch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a Client pointed at srv with a pre-seeded token so no
+// request is made to the real token endpoint.
+func newTestClient(srv *httptest.Server) *Client {
+	tm := &TokenManager{token: "test-token", expiresAt: time.Now().Add(time.Hour)}
+	limiter := NewRateLimiter(srv.Client().Transport)
+	return &Client{
+		clientID:   "test-client",
+		baseURL:    srv.URL,
+		tokenMgr:   tm,
+		limiter:    limiter,
+		httpClient: &http.Client{Transport: limiter},
+	}
+}
+
+func logins(n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = fmt.Sprintf("user%d", i)
+	}
+	return out
+}
+
+func TestSplitStreamBatches(t *testing.T) {
+	batches := splitStreamBatches(logins(120), logins(250))
+	if len(batches) != 5 {
+		t.Fatalf("batches = %d, want 5", len(batches))
+	}
+	for i, b := range batches {
+		if len(b.gameIDs) > maxStreamFilters || len(b.userLogins) > maxStreamFilters {
+			t.Errorf("batch %d exceeds limit: %d games, %d logins", i, len(b.gameIDs), len(b.userLogins))
+		}
+		if len(b.gameIDs) > 0 && len(b.userLogins) > 0 {
+			t.Errorf("batch %d mixes game IDs and user logins", i)
+		}
+	}
+	if got := len(batches[1].gameIDs); got != 20 {
+		t.Errorf("last game batch = %d IDs, want 20", got)
+	}
+	if got := len(batches[4].userLogins); got != 50 {
+		t.Errorf("last login batch = %d logins, want 50", got)
+	}
+}
+
+func TestSplitStreamBatches_Empty(t *testing.T) {
+	if batches := splitStreamBatches(nil, nil); len(batches) != 0 {
+		t.Errorf("expected no batches, got %d", len(batches))
+	}
+}
+
+func TestGetStreams_BatchesAndDeduplicates(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		q := r.URL.Query()
+		if len(q["user_login"]) > maxStreamFilters || len(q["game_id"]) > maxStreamFilters {
+			t.Errorf("request exceeds filter limit: %s", r.URL.RawQuery)
+		}
+		// Every batch reports the same stream, plus one unique to the batch.
+		first := q.Get("user_login")
+		if first == "" {
+			first = q.Get("game_id")
+		}
+		fmt.Fprintf(w, `{"data":[{"id":"shared"},{"id":"only-%s"}],"pagination":{}}`, first)
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv)
+	streams, err := c.GetStreams(context.Background(), []string{"g1"}, logins(201))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := requests.Load(); got != 4 {
+		t.Errorf("requests = %d, want 4", got)
+	}
+	if len(streams) != 5 {
+		t.Errorf("streams = %d, want 5 (1 shared + 4 unique): %+v", len(streams), streams)
+	}
+}
+
+func TestGetStreams_Pagination(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("after") == "" {
+			fmt.Fprint(w, `{"data":[{"id":"1"}],"pagination":{"cursor":"next"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"data":[{"id":"2"}],"pagination":{}}`)
+	}))
+	defer srv.Close()
+
+	streams, err := newTestClient(srv).GetStreams(context.Background(), []string{"g1"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(streams) != 2 {
+		t.Errorf("streams = %d, want 2", len(streams))
+	}
+}
+
+func TestGetStreams_PartialFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("game_id") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"data":[{"id":"1","user_login":"user0"}],"pagination":{}}`)
+	}))
+	defer srv.Close()
+
+	streams, err := newTestClient(srv).GetStreams(context.Background(), []string{"g1"}, []string{"user0"})
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected *BatchError, got %v", err)
+	}
+	if batchErr.Total != 2 || len(batchErr.Failures) != 1 {
+		t.Errorf("failures = %d of %d, want 1 of 2", len(batchErr.Failures), batchErr.Total)
+	}
+	if len(batchErr.Failures[0].GameIDs) != 1 {
+		t.Errorf("failed batch should be the game batch, got %+v", batchErr.Failures[0])
+	}
+	if len(streams) != 1 || streams[0].UserLogin != "user0" {
+		t.Errorf("expected streams from the successful batch, got %+v", streams)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if q := r.URL.Query(); q.Get("query") != "valorent" || q.Get("first") != "3" {
+			t.Errorf("query = %s", r.URL.RawQuery)
+		}
+		switch r.URL.Path {
+		case "/search/categories":
+			fmt.Fprint(w, `{"data":[{"id":"516575","name":"VALORANT"}]}`)
+		case "/search/channels":
+			fmt.Fprint(w, `{"data":[{"id":"1","broadcaster_login":"valorant","display_name":"VALORANT"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv)
+	categories, err := c.SearchCategories(context.Background(), "valorent", 3)
+	if err != nil {
+		t.Fatalf("SearchCategories: %v", err)
+	}
+	if len(categories) != 1 || categories[0].Name != "VALORANT" || categories[0].ID != "516575" {
+		t.Errorf("categories = %+v", categories)
+	}
+	channels, err := c.SearchChannels(context.Background(), "valorent", 3)
+	if err != nil {
+		t.Fatalf("SearchChannels: %v", err)
+	}
+	if len(channels) != 1 || channels[0].BroadcasterLogin != "valorant" {
+		t.Errorf("channels = %+v", channels)
+	}
+}
@@ -0,0 +1,131 @@
+package twitch
+
+import (
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// EventSubTransport describes how Twitch delivers notifications for a subscription.
+type EventSubTransport struct {
+	Method    string `json:"method"`
+	SessionID string `json:"session_id,omitempty"`
+	Callback  string `json:"callback,omitempty"`
+	Secret    string `json:"secret,omitempty"`
+}
+
+// EventSubSubscription is an EventSub subscription as returned by Helix.
+type EventSubSubscription struct {
+	ID        string            `json:"id"`
+	Status    string            `json:"status"`
+	Type      string            `json:"type"`
+	Version   string            `json:"version"`
+	Condition map[string]string `json:"condition"`
+	Transport EventSubTransport `json:"transport"`
+	CreatedAt time.Time         `json:"created_at"`
+	Cost      int               `json:"cost"`
+}
+
+type createEventSubRequest struct {
+	Type      string            `json:"type"`
+	Version   string            `json:"version"`
+	Condition map[string]string `json:"condition"`
+	Transport EventSubTransport `json:"transport"`
+}
+
+type eventSubResponse struct {
+	Data []EventSubSubscription `json:"data"`
+}
+
+// CreateEventSubSubscription subscribes to an EventSub topic.
+// WebSocket transports require the client to use a user access token.
+func (c *Client) CreateEventSubSubscription(
+	ctx context.Context,
+	subType, version string,
+	condition map[string]string,
+	transport EventSubTransport,
+) (*EventSubSubscription, error) {
+	const path = "/eventsub/subscriptions"
+
+	body, err := json.Marshal(createEventSubRequest{
+		Type:      subType,
+		Version:   version,
+		Condition: condition,
+		Transport: transport,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal eventsub subscription: %w", err)
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, path, body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, c.apiError(resp, http.MethodPost, path)
+	}
+	defer resp.Body.Close()
+
+	var er eventSubResponse
+	if err := json.UnmarshalRead(resp.Body, &er); err != nil {
+		return nil, fmt.Errorf("decode eventsub response: %w", err)
+	}
+	if len(er.Data) == 0 {
+		return nil, fmt.Errorf("eventsub response contained no subscription")
+	}
+	return &er.Data[0], nil
+}
+
+// DeleteEventSubSubscription removes an EventSub subscription by ID.
+func (c *Client) DeleteEventSubSubscription(ctx context.Context, id string) error {
+	path := "/eventsub/subscriptions?" + url.Values{"id": {id}}.Encode()
+
+	resp, err := c.do(ctx, http.MethodDelete, path, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return c.apiError(resp, http.MethodDelete, path)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type listEventSubResponse struct {
+	Data       []EventSubSubscription `json:"data"`
+	Pagination struct {
+		Cursor string `json:"cursor"`
+	} `json:"pagination"`
+}
+
+// GetEventSubSubscriptions lists every EventSub subscription owned by the client.
+func (c *Client) GetEventSubSubscriptions(ctx context.Context) ([]EventSubSubscription, error) {
+	var all []EventSubSubscription
+	params := url.Values{}
+
+	for {
+		body, err := c.get(ctx, "/eventsub/subscriptions?"+params.Encode())
+		if err != nil {
+			return nil, err
+		}
+
+		var resp listEventSubResponse
+		err = json.UnmarshalRead(body, &resp)
+		body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode eventsub subscriptions: %w", err)
+		}
+
+		all = append(all, resp.Data...)
+
+		if resp.Pagination.Cursor == "" || len(resp.Data) == 0 {
+			break
+		}
+		params.Set("after", resp.Pagination.Cursor)
+	}
+
+	return all, nil
+}
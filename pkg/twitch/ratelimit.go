@@ -0,0 +1,200 @@
+package twitch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// errBodyNotRewindable is returned when a 429 response cannot be retried
+// because the request body has already been consumed.
+var errBodyNotRewindable = errors.New("helix request rate limited and body cannot be replayed")
+
+const (
+	// maxRateLimitRetries is how many times a request rejected with 429 is retried.
+	maxRateLimitRetries = 2
+
+	// defaultRateLimitWait is used when a 429 carries no usable Ratelimit-Reset header.
+	defaultRateLimitWait = time.Second
+
+	// defaultAttemptTimeout bounds one request to Helix, from sending it to
+	// closing its response body.
+	defaultAttemptTimeout = 15 * time.Second
+)
+
+// Budget is a snapshot of the Helix rate-limit bucket as last reported by Twitch.
+// Limit is zero until the first response has been seen.
+type Budget struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// Known reports whether the budget has been populated from a Helix response.
+func (b Budget) Known() bool {
+	return b.Limit > 0
+}
+
+// RateLimiter is an http.RoundTripper that tracks the Helix token bucket from
+// the Ratelimit-Limit, Ratelimit-Remaining and Ratelimit-Reset response headers.
+// It holds requests back while the bucket is empty and retries 429 responses
+// once the bucket has been refilled. Twitch applies the bucket per client ID,
+// so one RateLimiter should be shared by every Client using the same credentials.
+//
+// Each attempt has its own deadline, which starts once the bucket has room, so
+// time spent waiting for a reset never times a request out. Clients using a
+// RateLimiter should not set http.Client.Timeout, which would count it.
+type RateLimiter struct {
+	next    http.RoundTripper
+	timeout time.Duration // per attempt
+
+	mu        sync.Mutex
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// NewRateLimiter wraps next (http.DefaultTransport if nil) with Helix rate limiting.
+func NewRateLimiter(next http.RoundTripper) *RateLimiter {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &RateLimiter{next: next, timeout: defaultAttemptTimeout}
+}
+
+// Budget returns the current view of the rate-limit bucket.
+func (l *RateLimiter) Budget() Budget {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Budget{Limit: l.limit, Remaining: l.remaining, Reset: l.reset}
+}
+
+// RoundTrip implements http.RoundTripper. req is never modified: each retry
+// of a 429 is sent as a clone with a fresh body from req.GetBody.
+func (l *RateLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := l.wait(req); err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), l.timeout)
+		out := req.WithContext(ctx)
+		if attempt > 0 {
+			out = req.Clone(ctx)
+			if req.Body != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					cancel()
+					return nil, err
+				}
+				out.Body = body
+			}
+		}
+		resp, err := l.next.RoundTrip(out)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		l.update(resp.Header)
+
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= maxRateLimitRetries {
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		cancel()
+		l.exhaust(resp.Header)
+
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return nil, errBodyNotRewindable
+		}
+	}
+}
+
+// cancelOnClose ends an attempt's deadline once its response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// wait blocks until the bucket has room for one more request, then reserves it.
+// Reserving locally keeps concurrent callers from all spending the last point.
+func (l *RateLimiter) wait(req *http.Request) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		if !now.Before(l.reset) {
+			// The bucket is full again once the reset time has passed.
+			l.remaining = l.limit
+		}
+		if l.limit == 0 || l.remaining > 0 {
+			if l.remaining > 0 {
+				l.remaining--
+			}
+			l.mu.Unlock()
+			return nil
+		}
+		delay := l.reset.Sub(now)
+		l.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// update records the bucket state reported by a Helix response.
+func (l *RateLimiter) update(h http.Header) {
+	limit, errL := strconv.Atoi(h.Get("Ratelimit-Limit"))
+	remaining, errR := strconv.Atoi(h.Get("Ratelimit-Remaining"))
+	if errL != nil || errR != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.remaining = remaining
+	l.reset = parseReset(h)
+}
+
+// exhaust marks the bucket as empty after a 429, making sure there is a reset
+// time to wait for even when Twitch omitted the header.
+func (l *RateLimiter) exhaust(h http.Header) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit == 0 {
+		l.limit = 1
+	}
+	l.remaining = 0
+	if reset := parseReset(h); reset.After(time.Now()) {
+		l.reset = reset
+	} else {
+		l.reset = time.Now().Add(defaultRateLimitWait)
+	}
+}
+
+// parseReset reads Ratelimit-Reset, a Unix timestamp in seconds.
+func parseReset(h http.Header) time.Time {
+	sec, err := strconv.ParseInt(h.Get("Ratelimit-Reset"), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
@@ -0,0 +1,203 @@
+package twitch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func setRateLimitHeaders(w http.ResponseWriter, limit, remaining int, reset time.Time) {
+	w.Header().Set("Ratelimit-Limit", strconv.Itoa(limit))
+	w.Header().Set("Ratelimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("Ratelimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+}
+
+func TestRateLimiter_TracksHeaders(t *testing.T) {
+	reset := time.Now().Add(time.Minute).Truncate(time.Second)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setRateLimitHeaders(w, 800, 799, reset)
+	}))
+	defer srv.Close()
+
+	limiter := NewRateLimiter(srv.Client().Transport)
+	if limiter.Budget().Known() {
+		t.Fatal("budget should be unknown before the first response")
+	}
+
+	resp, err := (&http.Client{Transport: limiter}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	b := limiter.Budget()
+	if b.Limit != 800 || b.Remaining != 799 || !b.Reset.Equal(reset) {
+		t.Errorf("budget = %+v, want limit 800, remaining 799, reset %v", b, reset)
+	}
+}
+
+func TestRateLimiter_WaitsWhenExhausted(t *testing.T) {
+	limiter := NewRateLimiter(http.DefaultTransport)
+	limiter.limit = 800
+	limiter.remaining = 0
+	limiter.reset = time.Now().Add(200 * time.Millisecond)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	start := time.Now()
+	resp, err := (&http.Client{Transport: limiter}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("request sent after %v, expected to wait for the reset", elapsed)
+	}
+}
+
+func TestRateLimiter_WaitIsNotTimedOut(t *testing.T) {
+	limiter := NewRateLimiter(http.DefaultTransport)
+	limiter.timeout = 50 * time.Millisecond
+	limiter.limit = 800
+	limiter.remaining = 0
+	limiter.reset = time.Now().Add(200 * time.Millisecond)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	resp, err := (&http.Client{Transport: limiter}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("a request waiting for the reset timed out: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestRateLimiter_TimesOutSlowAttempt(t *testing.T) {
+	limiter := NewRateLimiter(http.DefaultTransport)
+	limiter.timeout = 50 * time.Millisecond
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	_, err := (&http.Client{Transport: limiter}).Get(srv.URL)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("gave up after %v, want about 50ms", elapsed)
+	}
+}
+
+func TestRateLimiter_WaitRespectsContext(t *testing.T) {
+	limiter := NewRateLimiter(http.DefaultTransport)
+	limiter.limit = 800
+	limiter.remaining = 0
+	limiter.reset = time.Now().Add(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://127.0.0.1:0", nil)
+	if _, err := limiter.RoundTrip(req); err != context.DeadlineExceeded {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestRateLimiter_Retries429(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			// Reset already passed: the retry should go out without a long wait.
+			setRateLimitHeaders(w, 800, 0, time.Now().Add(-time.Second))
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		setRateLimitHeaders(w, 800, 799, time.Now().Add(time.Minute))
+	}))
+	defer srv.Close()
+
+	limiter := NewRateLimiter(srv.Client().Transport)
+	resp, err := (&http.Client{Transport: limiter}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200 after retry", resp.StatusCode)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("calls = %d, want 2", got)
+	}
+}
+
+func TestRateLimiter_RetryLeavesRequestUntouched(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"type":"stream.online"}` {
+			t.Errorf("attempt %d body = %q", calls.Load()+1, body)
+		}
+		if calls.Add(1) == 1 {
+			setRateLimitHeaders(w, 800, 0, time.Now().Add(-time.Second))
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		setRateLimitHeaders(w, 800, 799, time.Now().Add(time.Minute))
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"type":"stream.online"}`))
+	body := req.Body
+	resp, err := NewRateLimiter(srv.Client().Transport).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if got := calls.Load(); got != 2 {
+		t.Errorf("calls = %d, want 2", got)
+	}
+	if req.Body != body || req.Context() != context.Background() {
+		t.Error("RoundTrip modified the caller's request")
+	}
+}
+
+func TestRateLimiter_GivesUpAfterMaxRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		setRateLimitHeaders(w, 800, 0, time.Now().Add(-time.Second))
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	limiter := NewRateLimiter(srv.Client().Transport)
+	resp, err := (&http.Client{Transport: limiter}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", resp.StatusCode)
+	}
+	if got := calls.Load(); got != maxRateLimitRetries+1 {
+		t.Errorf("calls = %d, want %d", got, maxRateLimitRetries+1)
+	}
+}
@@ -0,0 +1,59 @@
+package twitch
+
+import (
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Category is a game or other category as returned by Helix /search/categories.
+type Category struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Channel is a channel as returned by Helix /search/channels.
+type Channel struct {
+	ID               string `json:"id"`
+	BroadcasterLogin string `json:"broadcaster_login"`
+	DisplayName      string `json:"display_name"`
+}
+
+// SearchCategories returns up to first categories whose names match query, best match first.
+func (c *Client) SearchCategories(ctx context.Context, query string, first int) ([]Category, error) {
+	var resp struct {
+		Data []Category `json:"data"`
+	}
+	if err := c.search(ctx, "/search/categories", query, first, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// SearchChannels returns up to first channels whose names match query, best match first.
+func (c *Client) SearchChannels(ctx context.Context, query string, first int) ([]Channel, error) {
+	var resp struct {
+		Data []Channel `json:"data"`
+	}
+	if err := c.search(ctx, "/search/channels", query, first, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// search fetches the first page of a Helix search endpoint into out.
+func (c *Client) search(ctx context.Context, path, query string, first int, out any) error {
+	params := url.Values{"query": {query}, "first": {strconv.Itoa(first)}}
+	body, err := c.get(ctx, path+"?"+params.Encode())
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if err := json.UnmarshalRead(body, out); err != nil {
+		return fmt.Errorf("decode %s response: %w", path, err)
+	}
+	return nil
+}
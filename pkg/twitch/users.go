@@ -0,0 +1,47 @@
+package twitch
+
+import (
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"net/url"
+	"slices"
+)
+
+// User is a Twitch user as returned by Helix /users.
+type User struct {
+	ID              string `json:"id"`
+	Login           string `json:"login"`
+	DisplayName     string `json:"display_name"`
+	ProfileImageURL string `json:"profile_image_url"`
+}
+
+type usersResponse struct {
+	Data []User `json:"data"`
+}
+
+// GetUsers looks up users by login, 100 at a time.
+// Logins that do not exist are omitted from the result.
+func (c *Client) GetUsers(ctx context.Context, logins []string) ([]User, error) {
+	var all []User
+	for chunk := range slices.Chunk(logins, maxStreamFilters) {
+		params := url.Values{}
+		for _, login := range chunk {
+			params.Add("login", login)
+		}
+
+		body, err := c.get(ctx, "/users?"+params.Encode())
+		if err != nil {
+			return nil, err
+		}
+
+		var resp usersResponse
+		err = json.UnmarshalRead(body, &resp)
+		body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode users response: %w", err)
+		}
+		all = append(all, resp.Data...)
+	}
+	return all, nil
+}
@@ -9,9 +9,24 @@ import (
 
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
+	"github.com/redis/go-redis/v9"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
 	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/config"
 	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/consumer"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/digest"
 	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/discord"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/email"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/gotify"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/matrix"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/messages"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/ntfy"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/publisher"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/slack"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/subscription"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/teams"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/telegram"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/webhook"
 )
 
 func main() {
@@ -36,9 +51,48 @@ func main() {
 		os.Exit(1)
 	}
 
-	sender := discord.New()
+	rdb := redis.NewClient(&redis.Options{Addr: cfg.ValkeyAddr})
+	defer rdb.Close()
 
-	cons, err := consumer.New(js, sender, logger)
+	emailSender, err := email.New(email.Config{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.SMTPFrom,
+		TLS:      cfg.SMTPTLS,
+	})
+	if err != nil {
+		logger.Error("create email sender failed", "error", err)
+		os.Exit(1)
+	}
+
+	notifiers := notifier.NewRegistry()
+	notifiers.Register(models.DestinationDiscord, discord.New())
+	notifiers.Register(models.DestinationSlack, slack.New())
+	notifiers.Register(models.DestinationTeams, teams.New())
+	notifiers.Register(models.DestinationWebhook, webhook.New(notifier.RetryPolicy{
+		MaxAttempts:    cfg.WebhookMaxAttempts,
+		InitialBackoff: cfg.WebhookInitialBackoff,
+		MaxBackoff:     cfg.WebhookMaxBackoff,
+	}))
+	notifiers.Register(models.DestinationTelegram, telegram.New(cfg.TelegramAPIURL))
+	notifiers.Register(models.DestinationMatrix, matrix.New())
+	notifiers.Register(models.DestinationEmail, emailSender)
+	notifiers.Register(models.DestinationNtfy, ntfy.New())
+	notifiers.Register(models.DestinationGotify, gotify.New())
+
+	msgs := messages.New(rdb)
+	digests := digest.New(rdb)
+	subs := subscription.New(cfg.SubscriptionSvcURL, cfg.InternalAPIKey)
+
+	pub, err := publisher.New(nc)
+	if err != nil {
+		logger.Error("create publisher failed", "error", err)
+		os.Exit(1)
+	}
+
+	cons, err := consumer.New(js, notifiers, emailSender, msgs, digests, subs, pub, logger)
 	if err != nil {
 		logger.Error("create consumer failed", "error", err)
 		os.Exit(1)
@@ -3,15 +3,20 @@ module github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher
 go 1.25.0
 
 require (
+	github.com/alicebob/miniredis/v2 v2.36.1
 	github.com/khiemnguyen15/twitch-watcher/pkg v0.0.0-20260214045458-3c626ebe510c
 	github.com/nats-io/nats.go v1.48.0
+	github.com/redis/go-redis/v9 v9.17.3
 )
 
 require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/klauspost/compress v1.18.0 // indirect
 	github.com/nats-io/nkeys v0.4.11 // indirect
 	github.com/nats-io/nuid v1.0.1 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
 	golang.org/x/crypto v0.37.0 // indirect
 	golang.org/x/sys v0.32.0 // indirect
 )
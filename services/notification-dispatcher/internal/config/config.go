@@ -3,22 +3,71 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 )
 
 // Config holds all notification-dispatcher configuration.
 type Config struct {
-	NATSUrl string
+	NATSUrl        string
+	ValkeyAddr     string
+	TelegramAPIURL string
+
+	// subscription-service internal API, which serves the credentials kept
+	// out of published events.
+	SubscriptionSvcURL string
+	InternalAPIKey     string
+
+	// Retry policy for generic webhook deliveries.
+	WebhookMaxAttempts    int
+	WebhookInitialBackoff time.Duration
+	WebhookMaxBackoff     time.Duration
+
+	// SMTP server for email subscriptions; email is disabled if SMTPHost is empty.
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	SMTPTLS      string
 }
 
 // Load reads configuration from environment variables.
 func Load() (*Config, error) {
+	attempts, _ := strconv.Atoi(getEnv("WEBHOOK_MAX_ATTEMPTS", "5"))
+	backoffSec, _ := strconv.Atoi(getEnv("WEBHOOK_BACKOFF_SECONDS", "1"))
+	maxBackoffSec, _ := strconv.Atoi(getEnv("WEBHOOK_MAX_BACKOFF_SECONDS", "30"))
+	smtpPort, _ := strconv.Atoi(getEnv("SMTP_PORT", "587"))
+
 	cfg := &Config{
-		NATSUrl: getEnv("NATS_URL", "nats://localhost:4222"),
+		NATSUrl:        getEnv("NATS_URL", "nats://localhost:4222"),
+		ValkeyAddr:     getEnv("VALKEY_ADDR", "localhost:6379"),
+		TelegramAPIURL: getEnv("TELEGRAM_API_URL", "https://api.telegram.org"),
+
+		SubscriptionSvcURL: getEnv("SUBSCRIPTION_SVC_URL", "http://localhost:8080"),
+		InternalAPIKey:     os.Getenv("INTERNAL_API_KEY"),
+
+		WebhookMaxAttempts:    attempts,
+		WebhookInitialBackoff: time.Duration(backoffSec) * time.Second,
+		WebhookMaxBackoff:     time.Duration(maxBackoffSec) * time.Second,
+
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     smtpPort,
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:     os.Getenv("SMTP_FROM"),
+		SMTPTLS:      getEnv("SMTP_TLS", "starttls"),
 	}
 
 	if cfg.NATSUrl == "" {
 		return nil, fmt.Errorf("NATS_URL is required")
 	}
+	if cfg.InternalAPIKey == "" {
+		return nil, fmt.Errorf("INTERNAL_API_KEY is required")
+	}
+	if cfg.SMTPHost != "" && cfg.SMTPFrom == "" {
+		return nil, fmt.Errorf("SMTP_FROM is required when SMTP_HOST is set")
+	}
 
 	return cfg, nil
 }
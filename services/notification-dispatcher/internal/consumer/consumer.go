@@ -2,74 +2,675 @@ package consumer
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"time"
 
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/khiemnguyen15/twitch-watcher/pkg/messaging"
 	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
-	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/discord"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/digest"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/email"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/messages"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/publisher"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/subscription"
 )
 
-// Consumer pulls NotificationPayloads from twitch.streams.new and dispatches Discord webhooks.
+// streams maps each JetStream stream the dispatcher reads to its subject.
+var streams = map[string]string{
+	messaging.StreamTwitchStreamsNew:     messaging.SubjectStreamsNew,
+	messaging.StreamTwitchStreamsUpdated: messaging.SubjectStreamsUpdated,
+	messaging.StreamTwitchStreamsEnded:   messaging.SubjectStreamsEnded,
+	messaging.StreamTwitchEmailVerify:    messaging.SubjectEmailVerify,
+}
+
+const (
+	// digestInterval is how often email digests are sent.
+	digestInterval = time.Hour
+	// digestCheck is how often each replica tries to claim the next interval.
+	digestCheck = time.Minute
+)
+
+// Consumer pulls NotificationPayloads from twitch.streams.new and dispatches
+// them through the Notifier registered for each subscription's destination
+// type. Messages sent by an Editor (Discord) are kept current from
+// twitch.streams.updated and twitch.streams.ended; other destinations are not
+// edited, so they only get the opt-in ended message.
+// Email subscriptions choosing the hourly digest have their go-live
+// notifications queued and sent together; confirmation links for new email
+// subscriptions are read from twitch.email.verification.
+// Credentials (webhook secrets and destination tokens) are not published with
+// events; they are fetched from subscription-service just before delivering
+// to a destination that needs them, which also skips subscriptions deleted
+// or deactivated since.
+// Webhooks found unusable are published to twitch.webhooks.invalid once, so
+// subscription-service deactivates their subscriptions. Nothing is skipped
+// locally: a subscription the owner restores is delivered again at once.
 type Consumer struct {
-	js     jetstream.JetStream
-	sender *discord.Sender
-	logger *slog.Logger
-}
-
-// New creates a Consumer, ensuring the durable consumer exists on TWITCH_STREAMS_NEW.
-func New(js jetstream.JetStream, sender *discord.Sender, logger *slog.Logger) (*Consumer, error) {
-	_, err := js.CreateOrUpdateConsumer(context.Background(), messaging.StreamTwitchStreamsNew, jetstream.ConsumerConfig{
-		Durable:       messaging.ConsumerNotificationDispatcher,
-		AckPolicy:     jetstream.AckExplicitPolicy,
-		MaxDeliver:    3,
-		AckWait:       30 * time.Second,
-		FilterSubject: messaging.SubjectStreamsNew,
+	js        jetstream.JetStream
+	notifiers *notifier.Registry
+	email     *email.Sender // sends digests and confirmation links
+	msgs      *messages.Store
+	digests   *digest.Store
+	subs      Subscriptions
+	pub       *publisher.Publisher
+	queues    *webhookQueues
+	logger    *slog.Logger
+}
+
+// New creates a Consumer, ensuring a durable consumer exists on each stream it
+// reads. The twitch.email.verification stream is also created by
+// subscription-service, whichever service starts first.
+func New(
+	js jetstream.JetStream,
+	notifiers *notifier.Registry,
+	emailSender *email.Sender,
+	msgs *messages.Store,
+	digests *digest.Store,
+	subs Subscriptions,
+	pub *publisher.Publisher,
+	logger *slog.Logger,
+) (*Consumer, error) {
+	_, err := js.CreateOrUpdateStream(context.Background(), jetstream.StreamConfig{
+		Name:      messaging.StreamTwitchEmailVerify,
+		Subjects:  []string{messaging.SubjectEmailVerify},
+		Retention: jetstream.WorkQueuePolicy,
+		MaxAge:    48 * time.Hour,
+		Storage:   jetstream.FileStorage,
+		Replicas:  1, // set to 3 via Helm in production
 	})
 	if err != nil {
 		return nil, err
 	}
-	return &Consumer{js: js, sender: sender, logger: logger}, nil
+
+	for stream, subject := range streams {
+		_, err := js.CreateOrUpdateConsumer(context.Background(), stream, jetstream.ConsumerConfig{
+			Durable:       messaging.ConsumerNotificationDispatcher,
+			AckPolicy:     jetstream.AckExplicitPolicy,
+			MaxDeliver:    3,
+			AckWait:       ackWait, // extended by keepAlive while messages queue behind a slow webhook
+			FilterSubject: subject,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Consumer{
+		js:        js,
+		notifiers: notifiers,
+		email:     emailSender,
+		msgs:      msgs,
+		digests:   digests,
+		subs:      subs,
+		pub:       pub,
+		queues:    newWebhookQueues(),
+		logger:    logger,
+	}, nil
+}
+
+// Subscriptions looks subscriptions up with their credentials.
+// subscription.Client implements it.
+type Subscriptions interface {
+	Get(ctx context.Context, id string) (*models.Subscription, error)
 }
 
+// errInactive is returned by credentials for a subscription deleted or
+// deactivated since the event was published.
+var errInactive = errors.New("subscription no longer active")
+
 // Run starts consuming messages until ctx is cancelled.
 func (c *Consumer) Run(ctx context.Context) error {
-	cons, err := c.js.Consumer(ctx, messaging.StreamTwitchStreamsNew, messaging.ConsumerNotificationDispatcher)
-	if err != nil {
-		return err
+	handlers := map[string]func(context.Context, jetstream.Msg){
+		messaging.StreamTwitchStreamsNew:     c.handleNew,
+		messaging.StreamTwitchStreamsUpdated: c.handleUpdated,
+		messaging.StreamTwitchStreamsEnded:   c.handleEnded,
+		messaging.StreamTwitchEmailVerify:    c.handleVerification,
 	}
 
-	cc, err := cons.Consume(func(msg jetstream.Msg) {
-		env, err := messaging.Unmarshal[models.NotificationPayload](msg.Data())
+	for stream, handle := range handlers {
+		cons, err := c.js.Consumer(ctx, stream, messaging.ConsumerNotificationDispatcher)
+		if err != nil {
+			return err
+		}
+		cc, err := cons.Consume(func(msg jetstream.Msg) { handle(ctx, msg) })
 		if err != nil {
-			c.logger.Error("unmarshal notification payload failed", "error", err)
+			return err
+		}
+		defer cc.Stop()
+	}
+
+	go c.runDigests(ctx)
+
+	<-ctx.Done()
+	return nil
+}
+
+// handleNew queues the go-live message on its webhook, keeping the message
+// alive until it is sent.
+func (c *Consumer) handleNew(ctx context.Context, msg jetstream.Msg) {
+	env, err := messaging.Unmarshal[models.NotificationPayload](msg.Data())
+	if err != nil {
+		c.logger.Error("unmarshal notification payload failed", "error", err)
+		msg.Nak()
+		return
+	}
+
+	stop := keepAlive(msg)
+	c.queues.enqueue(env.Payload.WebhookURL, func() {
+		defer stop()
+		c.sendNew(ctx, msg, env)
+	})
+}
+
+// sendNew sends the go-live message and, if the destination's Notifier is an
+// Editor, remembers its ID for later edits. Go-live notifications of email
+// subscriptions choosing the hourly digest are queued instead.
+func (c *Consumer) sendNew(ctx context.Context, msg jetstream.Msg, env messaging.Envelope[models.NotificationPayload]) {
+	var messageID string
+	var err error
+	n, ok := c.notifiers.Lookup(env.Payload.DestinationType)
+	switch {
+	case !ok:
+		err = notifier.Permanent(fmt.Errorf("no notifier for destination type %q", env.Payload.DestinationType))
+	case hourly(env.Payload.DestinationConfig):
+		err = c.digests.Add(ctx, env.Payload.DestinationConfig.Email.Address, env.Payload)
+	default:
+		var payload models.NotificationPayload
+		if payload, err = c.payloadCredentials(ctx, env.Payload); err == nil {
+			messageID, err = send(ctx, n, payload)
+		}
+	}
+	if errors.Is(err, errInactive) {
+		c.logger.Info("subscription no longer active; notification dropped",
+			"subscription_id", env.Payload.SubscriptionID,
+			"stream_id", env.Payload.StreamID,
+		)
+		msg.Ack()
+		return
+	}
+	if c.reportInvalid(ctx, env.Payload.DestinationType, env.Payload.WebhookURL, err) {
+		msg.Term()
+		return
+	}
+	if err != nil {
+		retryable := notifier.Retryable(err)
+		c.logger.Error("send failed",
+			"destination_type", env.Payload.DestinationType,
+			"subscription_id", env.Payload.SubscriptionID,
+			"stream_id", env.Payload.StreamID,
+			"retryable", retryable,
+			"error", err,
+		)
+		if retryable {
 			msg.Nak()
-			return
+		} else {
+			msg.Term()
 		}
+		return
+	}
 
-		if err := c.sender.Send(ctx, env.Payload); err != nil {
-			c.logger.Error("discord send failed",
+	if messageID != "" {
+		if err := c.msgs.Save(ctx, env.Payload.SubscriptionID, env.Payload.StreamID, messageID); err != nil {
+			// The notification went out; it just won't be edited later.
+			c.logger.Warn("store message ID failed",
 				"subscription_id", env.Payload.SubscriptionID,
 				"stream_id", env.Payload.StreamID,
 				"error", err,
 			)
-			msg.Nak()
-			return
 		}
+	}
 
-		c.logger.Info("notification dispatched",
-			"subscription_id", env.Payload.SubscriptionID,
-			"stream_id", env.Payload.StreamID,
-			"user_login", env.Payload.UserLogin,
+	c.logger.Info("notification dispatched",
+		"destination_type", env.Payload.DestinationType,
+		"subscription_id", env.Payload.SubscriptionID,
+		"stream_id", env.Payload.StreamID,
+		"user_login", env.Payload.UserLogin,
+	)
+	msg.Ack()
+}
+
+// handleUpdated edits each editable subscription's go-live message with the stream's
+// new details. Updates are best effort: a failed edit is corrected by the
+// next update or by the ended edit, so the message is always acked.
+func (c *Consumer) handleUpdated(ctx context.Context, msg jetstream.Msg) {
+	env, err := messaging.Unmarshal[models.StreamEvent](msg.Data())
+	if err != nil {
+		c.logger.Error("unmarshal stream updated event failed", "error", err)
+		msg.Nak()
+		return
+	}
+	event := env.Payload
+
+	type edit struct {
+		ref    models.SubscriptionRef
+		editor notifier.Editor
+	}
+	var edits []edit
+	for _, ref := range event.Subscriptions {
+		if ed, ok := c.notifiers.Editor(ref.DestinationType); ok {
+			edits = append(edits, edit{ref, ed})
+		}
+	}
+
+	st := newSettle(msg, len(edits))
+	for _, e := range edits {
+		c.queues.enqueue(e.ref.WebhookURL, func() {
+			c.editLive(ctx, e.editor, e.ref, event)
+			st.done(true)
+		})
+	}
+}
+
+// editLive rewrites the go-live message for ref, if one was recorded.
+func (c *Consumer) editLive(ctx context.Context, ed notifier.Editor, ref models.SubscriptionRef, event models.StreamEvent) {
+	messageID, err := c.msgs.Get(ctx, ref.SubscriptionID, event.StreamID)
+	if err != nil {
+		c.logger.Warn("load message ID failed", "subscription_id", ref.SubscriptionID, "error", err)
+		return
+	}
+	if messageID == "" {
+		return
+	}
+
+	err = ed.EditLive(ctx, messageID, notificationPayload(event, ref))
+	if errors.Is(err, notifier.ErrUnknownMessage) || c.reportInvalid(ctx, ref.DestinationType, ref.WebhookURL, err) {
+		c.forget(ctx, ref.SubscriptionID, event.StreamID)
+		return
+	}
+	if err != nil {
+		c.logger.Warn("edit failed",
+			"destination_type", ref.DestinationType,
+			"subscription_id", ref.SubscriptionID,
+			"stream_id", event.StreamID,
+			"error", err,
 		)
-		msg.Ack()
-	})
+		return
+	}
+
+	c.logger.Info("notification updated",
+		"subscription_id", ref.SubscriptionID,
+		"stream_id", event.StreamID,
+	)
+}
+
+// handleEnded turns each editable subscription's go-live message into a
+// summary of the stream and, for subscriptions that opted in, sends a separate
+// "stream ended" message. Any failure redelivers the event, which then skips
+// the subscriptions it already succeeded for.
+func (c *Consumer) handleEnded(ctx context.Context, msg jetstream.Msg) {
+	env, err := messaging.Unmarshal[models.StreamEndedEvent](msg.Data())
 	if err != nil {
-		return err
+		c.logger.Error("unmarshal stream ended event failed", "error", err)
+		msg.Nak()
+		return
 	}
-	defer cc.Stop()
+	event := env.Payload
 
-	<-ctx.Done()
-	return nil
+	st := newSettle(msg, len(event.Subscriptions))
+	for _, ref := range event.Subscriptions {
+		c.queues.enqueue(ref.WebhookURL, func() {
+			st.done(c.endOnce(ctx, ref, event))
+		})
+	}
+}
+
+// endOnce runs endOne for ref unless an earlier delivery of event succeeded
+// for it, and records its success, so a redelivery caused by another
+// subscription's failure does not repeat the ended message.
+func (c *Consumer) endOnce(ctx context.Context, ref models.SubscriptionRef, event models.StreamEndedEvent) bool {
+	done, err := c.msgs.Ended(ctx, ref.SubscriptionID, event.StreamID)
+	if err != nil {
+		// Sending again beats not sending at all.
+		c.logger.Warn("load ended state failed", "subscription_id", ref.SubscriptionID, "error", err)
+	}
+	if done {
+		return true
+	}
+	if !c.endOne(ctx, ref, event) {
+		return false
+	}
+	if err := c.msgs.MarkEnded(ctx, ref.SubscriptionID, event.StreamID); err != nil {
+		c.logger.Warn("store ended state failed", "subscription_id", ref.SubscriptionID, "error", err)
+	}
+	return true
+}
+
+// endOne handles a StreamEndedEvent for one subscription and reports whether it succeeded.
+func (c *Consumer) endOne(ctx context.Context, ref models.SubscriptionRef, event models.StreamEndedEvent) bool {
+	ok := true
+	var messageID string
+	if ed, editable := c.notifiers.Editor(ref.DestinationType); editable {
+		var err error
+		if messageID, err = c.editEnded(ctx, ed, ref, event); err != nil {
+			c.logger.Error("edit failed",
+				"destination_type", ref.DestinationType,
+				"subscription_id", ref.SubscriptionID,
+				"stream_id", event.StreamID,
+				"error", err,
+			)
+			ok = false
+		}
+	}
+
+	// Digests only list streams that went live.
+	if !ref.NotifyOnEnd || hourly(ref.DestinationConfig) {
+		return ok
+	}
+	var err error
+	if n, found := c.notifiers.Lookup(ref.DestinationType); found {
+		if ref, err = c.refCredentials(ctx, ref); err == nil {
+			err = sendEnded(ctx, n, ref, messageID, event)
+		}
+	} else {
+		err = notifier.Permanent(fmt.Errorf("no notifier for destination type %q", ref.DestinationType))
+	}
+	if errors.Is(err, errInactive) {
+		return ok
+	}
+	if c.reportInvalid(ctx, ref.DestinationType, ref.WebhookURL, err) {
+		return ok
+	}
+	if err != nil {
+		retryable := notifier.Retryable(err)
+		c.logger.Error("send failed",
+			"destination_type", ref.DestinationType,
+			"subscription_id", ref.SubscriptionID,
+			"stream_id", event.StreamID,
+			"retryable", retryable,
+			"error", err,
+		)
+		return ok && !retryable
+	}
+
+	c.logger.Info("stream ended notification dispatched",
+		"subscription_id", ref.SubscriptionID,
+		"stream_id", event.StreamID,
+		"user_login", event.UserLogin,
+	)
+	return ok
+}
+
+// runDigests sends the email digests every digestInterval. Every replica
+// checks each digestCheck, but only the one that claims the interval sends.
+func (c *Consumer) runDigests(ctx context.Context) {
+	t := time.NewTicker(digestCheck)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		claimed, err := c.digests.Claim(ctx, digestInterval)
+		if err != nil {
+			c.logger.Warn("claim email digests failed", "error", err)
+			continue
+		}
+		if claimed {
+			c.sendDigests(ctx)
+		}
+	}
+}
+
+// sendDigests sends one digest to each address with queued notifications,
+// leaving out subscriptions deleted or deactivated since they were queued.
+// A digest that fails is queued again for the next interval, up to
+// digest.MaxFailures times.
+func (c *Consumer) sendDigests(ctx context.Context) {
+	addresses, err := c.digests.Addresses(ctx)
+	if err != nil {
+		c.logger.Error("list email digests failed", "error", err)
+		return
+	}
+
+	for _, address := range addresses {
+		webhook := "email:" + address
+		entries, err := c.digests.Take(ctx, address)
+		if err != nil {
+			c.logger.Error("load email digest failed", "error", err)
+			continue
+		}
+		entries = c.activeEntries(ctx, entries)
+		if len(entries) == 0 {
+			continue
+		}
+		payloads := make([]models.NotificationPayload, len(entries))
+		for i, e := range entries {
+			payloads[i] = e.Payload
+		}
+
+		err = c.email.SendDigest(ctx, address, payloads)
+		if c.reportInvalid(ctx, models.DestinationEmail, webhook, err) {
+			continue
+		}
+		if err != nil {
+			c.logger.Error("send email digest failed", "notifications", len(payloads), "error", err)
+			dropped, err := c.digests.Requeue(ctx, address, entries...)
+			if err != nil {
+				c.logger.Error("requeue email digest failed", "error", err)
+			}
+			if dropped > 0 {
+				c.logger.Warn("email digest notifications dropped after repeated failures", "notifications", dropped)
+			}
+			continue
+		}
+		c.logger.Info("email digest dispatched", "notifications", len(payloads))
+	}
+}
+
+// activeEntries returns the digest entries whose subscriptions are still
+// active. Entries are kept if subscription-service cannot be asked.
+func (c *Consumer) activeEntries(ctx context.Context, entries []digest.Entry) []digest.Entry {
+	active := make(map[string]bool)
+	var kept []digest.Entry
+	for _, e := range entries {
+		id := e.Payload.SubscriptionID
+		ok, known := active[id]
+		if !known {
+			sub, err := c.subs.Get(ctx, id)
+			switch {
+			case errors.Is(err, subscription.ErrNotFound):
+			case err != nil:
+				c.logger.Warn("load digest subscription failed", "subscription_id", id, "error", err)
+				ok = true
+			default:
+				ok = sub.Active
+			}
+			active[id] = ok
+		}
+		if ok {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// handleVerification emails the confirmation link of a new email subscription.
+func (c *Consumer) handleVerification(ctx context.Context, msg jetstream.Msg) {
+	env, err := messaging.Unmarshal[models.EmailVerificationEvent](msg.Data())
+	if err != nil {
+		c.logger.Error("unmarshal email verification event failed", "error", err)
+		msg.Nak()
+		return
+	}
+	event := env.Payload
+	if time.Now().After(event.ExpiresAt) {
+		msg.Term()
+		return
+	}
+
+	err = c.email.SendVerification(ctx, event)
+	if c.reportInvalid(ctx, models.DestinationEmail, "email:"+event.Address, err) {
+		msg.Term()
+		return
+	}
+	if err != nil {
+		c.logger.Error("send verification email failed", "subscription_id", event.SubscriptionID, "error", err)
+		msg.Nak()
+		return
+	}
+
+	c.logger.Info("verification email dispatched", "subscription_id", event.SubscriptionID)
+	msg.Ack()
+}
+
+// editEnded rewrites the go-live message for ref, if one was recorded, and
+// forgets it afterwards since the stream will not change again. It returns
+// the ID of the message, or "" if none was recorded.
+func (c *Consumer) editEnded(ctx context.Context, ed notifier.Editor, ref models.SubscriptionRef, event models.StreamEndedEvent) (string, error) {
+	messageID, err := c.msgs.Get(ctx, ref.SubscriptionID, event.StreamID)
+	if err != nil || messageID == "" {
+		return "", err
+	}
+
+	err = ed.EditEnded(ctx, ref, messageID, event)
+	if err != nil && !errors.Is(err, notifier.ErrUnknownMessage) && !c.reportInvalid(ctx, ref.DestinationType, ref.WebhookURL, err) {
+		return messageID, err
+	}
+	c.forget(ctx, ref.SubscriptionID, event.StreamID)
+	return messageID, nil
+}
+
+// reportInvalid reports whether err means webhook is permanently unusable.
+// A WebhookInvalidEvent is published so subscription-service deactivates its
+// subscriptions; the messages queued behind the first failure, on any
+// replica, do not publish it again.
+func (c *Consumer) reportInvalid(ctx context.Context, destination models.DestinationType, webhook string, err error) bool {
+	status, reason, ok := notifier.Invalid(err)
+	if !ok {
+		return false
+	}
+	claimed, err := c.msgs.ClaimInvalid(ctx, webhook)
+	if err != nil {
+		// Deactivating twice is harmless.
+		c.logger.Warn("claim webhook invalid report failed", "error", err)
+		claimed = true
+	}
+	if !claimed {
+		return true
+	}
+
+	if destination == "" {
+		destination = models.DestinationDiscord
+	}
+	event := models.WebhookInvalidEvent{
+		DestinationType: destination,
+		WebhookURL:      webhook,
+		StatusCode:      status,
+		Reason:          reason,
+		DetectedAt:      time.Now().UTC(),
+	}
+	if err := c.pub.PublishWebhookInvalid(ctx, event); err != nil {
+		c.logger.Error("publish webhook invalid event failed", "error", err)
+		// Let the next failure try again.
+		if err := c.msgs.ReleaseInvalid(ctx, webhook); err != nil {
+			c.logger.Warn("release webhook invalid report failed", "error", err)
+		}
+		return true
+	}
+
+	c.logger.Warn("webhook invalid; its subscriptions will be deactivated",
+		"destination_type", destination,
+		"status", status,
+		"reason", reason,
+	)
+	return true
+}
+
+// send delivers payload through n and returns the ID of the posted message if
+// n is an Editor.
+func send(ctx context.Context, n notifier.Notifier, payload models.NotificationPayload) (string, error) {
+	if ed, ok := n.(notifier.Editor); ok {
+		return ed.SendEditable(ctx, payload)
+	}
+	return "", n.Send(ctx, payload)
+}
+
+// sendEnded delivers the "stream ended" message for ref through n, following
+// the go-live message messageID if n is an Editor and it is known.
+func sendEnded(ctx context.Context, n notifier.Notifier, ref models.SubscriptionRef, messageID string, event models.StreamEndedEvent) error {
+	if ed, ok := n.(notifier.Editor); ok && messageID != "" {
+		return ed.ReplyEnded(ctx, ref, messageID, event)
+	}
+	return n.SendEnded(ctx, ref, event)
+}
+
+// withCredentials lists the destinations that need credentials kept out of
+// published events: the generic webhook's signing secret, and the tokens in
+// the destination config of the others.
+var withCredentials = map[models.DestinationType]bool{
+	models.DestinationWebhook:  true,
+	models.DestinationTelegram: true,
+	models.DestinationMatrix:   true,
+	models.DestinationNtfy:     true,
+	models.DestinationGotify:   true,
+}
+
+// credentials returns subscription id with its credentials if destination
+// needs any, nil if it does not, or errInactive if the subscription was
+// deleted or deactivated.
+func (c *Consumer) credentials(ctx context.Context, id string, destination models.DestinationType) (*models.Subscription, error) {
+	if !withCredentials[destination] {
+		return nil, nil
+	}
+	sub, err := c.subs.Get(ctx, id)
+	if errors.Is(err, subscription.ErrNotFound) || err == nil && !sub.Active {
+		return nil, errInactive
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load subscription credentials: %w", err)
+	}
+	return sub, nil
+}
+
+// payloadCredentials returns p with the credentials of its subscription.
+func (c *Consumer) payloadCredentials(ctx context.Context, p models.NotificationPayload) (models.NotificationPayload, error) {
+	sub, err := c.credentials(ctx, p.SubscriptionID, p.DestinationType)
+	if sub != nil {
+		p.WebhookSecret, p.DestinationConfig = sub.WebhookSecret, sub.DestinationConfig
+	}
+	return p, err
+}
+
+// refCredentials returns ref with the credentials of its subscription.
+func (c *Consumer) refCredentials(ctx context.Context, ref models.SubscriptionRef) (models.SubscriptionRef, error) {
+	sub, err := c.credentials(ctx, ref.SubscriptionID, ref.DestinationType)
+	if sub != nil {
+		ref.WebhookSecret, ref.DestinationConfig = sub.WebhookSecret, sub.DestinationConfig
+	}
+	return ref, err
+}
+
+// hourly reports whether an email subscription chose the hourly digest.
+func hourly(cfg *models.DestinationConfig) bool {
+	return cfg != nil && cfg.Email != nil && cfg.Email.Delivery == models.EmailHourly
+}
+
+func (c *Consumer) forget(ctx context.Context, subscriptionID, streamID string) {
+	if err := c.msgs.Delete(ctx, subscriptionID, streamID); err != nil {
+		c.logger.Warn("delete message ID failed", "subscription_id", subscriptionID, "error", err)
+	}
+}
+
+// notificationPayload builds the payload for one subscription of a StreamEvent.
+func notificationPayload(event models.StreamEvent, ref models.SubscriptionRef) models.NotificationPayload {
+	return models.NotificationPayload{
+		SubscriptionID:    ref.SubscriptionID,
+		DestinationType:   ref.DestinationType,
+		WebhookURL:        ref.WebhookURL,
+		DestinationConfig: ref.DestinationConfig,
+		StreamID:          event.StreamID,
+		UserLogin:         event.UserLogin,
+		UserName:          event.UserName,
+		GameName:          event.GameName,
+		Title:             event.Title,
+		ViewerCount:       event.ViewerCount,
+		StartedAt:         event.StartedAt,
+		ThumbnailURL:      event.ThumbnailURL,
+		StreamURL:         event.StreamURL,
+		ProfileImageURL:   event.ProfileImageURL,
+	}
 }
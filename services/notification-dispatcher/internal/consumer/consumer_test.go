@@ -0,0 +1,256 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/redis/go-redis/v9"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/messaging"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/digest"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/messages"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier/notifiertest"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/subscription"
+)
+
+// fakeMsg records how a message was settled.
+type fakeMsg struct {
+	jetstream.Msg
+	settled  string
+	progress atomic.Int32
+}
+
+func (m *fakeMsg) InProgress() error { m.progress.Add(1); return nil }
+func (m *fakeMsg) inProgress() int   { return int(m.progress.Load()) }
+
+func (m *fakeMsg) Ack() error  { m.settled = "ack"; return nil }
+func (m *fakeMsg) Nak() error  { m.settled = "nak"; return nil }
+func (m *fakeMsg) Term() error { m.settled = "term"; return nil }
+
+// fakeSubs serves subscriptions by ID.
+type fakeSubs map[string]*models.Subscription
+
+func (f fakeSubs) Get(_ context.Context, id string) (*models.Subscription, error) {
+	if sub, ok := f[id]; ok {
+		return sub, nil
+	}
+	return nil, subscription.ErrNotFound
+}
+
+func newTestConsumer(t models.DestinationType, n notifier.Notifier) *Consumer {
+	notifiers := notifier.NewRegistry()
+	notifiers.Register(t, n)
+	return &Consumer{
+		notifiers: notifiers,
+		queues:    newWebhookQueues(),
+		logger:    slog.New(slog.DiscardHandler),
+	}
+}
+
+func TestSendNew_Settles(t *testing.T) {
+	cases := []struct {
+		name        string
+		destination models.DestinationType
+		err         error
+		want        string
+	}{
+		{"sent", models.DestinationSlack, nil, "ack"},
+		{"retryable", models.DestinationSlack, errors.New("connection reset"), "nak"},
+		{"permanent", models.DestinationSlack, notifier.Permanent(errors.New("invalid_blocks")), "term"},
+		{"no notifier", "carrier-pigeon", nil, "term"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &notifiertest.Fake{Err: tc.err}
+			c := newTestConsumer(models.DestinationSlack, fake)
+			msg := &fakeMsg{}
+			env := messaging.Envelope[models.NotificationPayload]{Payload: models.NotificationPayload{
+				DestinationType: tc.destination,
+				SubscriptionID:  "sub-1",
+				StreamID:        "stream-1",
+			}}
+
+			c.sendNew(context.Background(), msg, env)
+			if msg.settled != tc.want {
+				t.Errorf("message settled with %q, want %q", msg.settled, tc.want)
+			}
+			if tc.destination == models.DestinationSlack && len(fake.Sent()) != 1 {
+				t.Errorf("notifier sent %d payloads, want 1", len(fake.Sent()))
+			}
+		})
+	}
+}
+
+func TestEndOne_PermanentErrorNotRedelivered(t *testing.T) {
+	ref := models.SubscriptionRef{SubscriptionID: "sub-1", DestinationType: models.DestinationSlack, NotifyOnEnd: true}
+	event := models.StreamEndedEvent{StreamID: "stream-1"}
+
+	fake := &notifiertest.Fake{Err: notifier.Permanent(errors.New("invalid_blocks"))}
+	if ok := newTestConsumer(models.DestinationSlack, fake).endOne(context.Background(), ref, event); !ok {
+		t.Error("a permanent failure asked for redelivery")
+	}
+	if len(fake.Ended()) != 1 {
+		t.Errorf("notifier sent %d ended messages, want 1", len(fake.Ended()))
+	}
+
+	fake = &notifiertest.Fake{Err: errors.New("connection reset")}
+	if ok := newTestConsumer(models.DestinationSlack, fake).endOne(context.Background(), ref, event); ok {
+		t.Error("a retryable failure did not ask for redelivery")
+	}
+}
+
+func TestEndOnce_SkipsSubscriptionsAlreadyEnded(t *testing.T) {
+	mr := miniredis.RunT(t)
+	msgs := messages.New(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ref := models.SubscriptionRef{SubscriptionID: "sub-1", DestinationType: models.DestinationSlack, NotifyOnEnd: true}
+	event := models.StreamEndedEvent{StreamID: "stream-1"}
+
+	failing := &notifiertest.Fake{Err: errors.New("connection reset")}
+	c := newTestConsumer(models.DestinationSlack, failing)
+	c.msgs = msgs
+	if c.endOnce(context.Background(), ref, event) {
+		t.Fatal("a retryable failure did not ask for redelivery")
+	}
+
+	// The redelivery succeeds; later ones must not send again.
+	fake := &notifiertest.Fake{}
+	c = newTestConsumer(models.DestinationSlack, fake)
+	c.msgs = msgs
+	for range 2 {
+		if !c.endOnce(context.Background(), ref, event) {
+			t.Error("endOnce failed")
+		}
+	}
+	if len(fake.Ended()) != 1 {
+		t.Errorf("notifier sent %d ended messages, want 1", len(fake.Ended()))
+	}
+}
+
+func TestEndOne_SkipsSubscriptionsNotOptedIn(t *testing.T) {
+	fake := &notifiertest.Fake{}
+	ref := models.SubscriptionRef{SubscriptionID: "sub-1", DestinationType: models.DestinationSlack}
+	if ok := newTestConsumer(models.DestinationSlack, fake).endOne(context.Background(), ref, models.StreamEndedEvent{}); !ok {
+		t.Error("endOne failed")
+	}
+	if len(fake.Ended()) != 0 {
+		t.Errorf("notifier sent %d ended messages, want 0", len(fake.Ended()))
+	}
+}
+
+func TestSendNew_DeliversToWebhookReportedInvalid(t *testing.T) {
+	mr := miniredis.RunT(t)
+	msgs := messages.New(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	env := messaging.Envelope[models.NotificationPayload]{Payload: models.NotificationPayload{
+		DestinationType: models.DestinationTelegram,
+		WebhookURL:      "telegram:42#abcdef012345",
+		SubscriptionID:  "sub-1",
+		StreamID:        "stream-1",
+	}}
+	if _, err := msgs.ClaimInvalid(context.Background(), env.Payload.WebhookURL); err != nil {
+		t.Fatal(err)
+	}
+
+	subs := fakeSubs{"sub-1": {ID: "sub-1", Active: true}}
+
+	// Another message queued behind the report fails the same way; it is
+	// terminated without reporting again (c.pub is nil).
+	gone := &notifiertest.Fake{Err: &notifier.InvalidWebhookError{Destination: "telegram chat", StatusCode: 403, Message: "bot was kicked"}}
+	c := newTestConsumer(models.DestinationTelegram, gone)
+	c.msgs, c.subs = msgs, subs
+	msg := &fakeMsg{}
+	c.sendNew(context.Background(), msg, env)
+	if msg.settled != "term" {
+		t.Errorf("message settled with %q, want term", msg.settled)
+	}
+
+	// The owner re-added the bot and restored the subscription.
+	fake := &notifiertest.Fake{}
+	c = newTestConsumer(models.DestinationTelegram, fake)
+	c.msgs, c.subs = msgs, subs
+	msg = &fakeMsg{}
+	c.sendNew(context.Background(), msg, env)
+	if msg.settled != "ack" || len(fake.Sent()) != 1 {
+		t.Errorf("message settled with %q after %d sends, want ack after 1", msg.settled, len(fake.Sent()))
+	}
+}
+
+func TestSendNew_FetchesCredentials(t *testing.T) {
+	env := messaging.Envelope[models.NotificationPayload]{Payload: models.NotificationPayload{
+		DestinationType: models.DestinationWebhook,
+		WebhookURL:      "https://example.com/hook",
+		SubscriptionID:  "sub-1",
+		StreamID:        "stream-1",
+	}}
+	cases := []struct {
+		name string
+		subs fakeSubs
+		sent int
+	}{
+		{"active", fakeSubs{"sub-1": {ID: "sub-1", Active: true, WebhookSecret: "whsec_test"}}, 1},
+		{"deactivated", fakeSubs{"sub-1": {ID: "sub-1", WebhookSecret: "whsec_test"}}, 0},
+		{"deleted", fakeSubs{}, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &notifiertest.Fake{}
+			c := newTestConsumer(models.DestinationWebhook, fake)
+			c.subs = tc.subs
+			msg := &fakeMsg{}
+			c.sendNew(context.Background(), msg, env)
+			if msg.settled != "ack" {
+				t.Errorf("message settled with %q, want ack", msg.settled)
+			}
+			sent := fake.Sent()
+			if len(sent) != tc.sent {
+				t.Fatalf("notifier sent %d payloads, want %d", len(sent), tc.sent)
+			}
+			if tc.sent > 0 && sent[0].WebhookSecret != "whsec_test" {
+				t.Errorf("WebhookSecret = %q, want the stored secret", sent[0].WebhookSecret)
+			}
+		})
+	}
+}
+
+func TestSendNew_FetchesDestinationTokens(t *testing.T) {
+	cfg := &models.DestinationConfig{Telegram: &models.TelegramConfig{BotToken: "123:secret", ChatID: "42"}}
+	fake := &notifiertest.Fake{}
+	c := newTestConsumer(models.DestinationTelegram, fake)
+	c.subs = fakeSubs{"sub-1": {ID: "sub-1", Active: true, DestinationConfig: cfg}}
+	env := messaging.Envelope[models.NotificationPayload]{Payload: models.NotificationPayload{
+		DestinationType:   models.DestinationTelegram,
+		DestinationConfig: &models.DestinationConfig{Telegram: &models.TelegramConfig{ChatID: "42"}},
+		SubscriptionID:    "sub-1",
+		StreamID:          "stream-1",
+	}}
+
+	c.sendNew(context.Background(), &fakeMsg{}, env)
+	sent := fake.Sent()
+	if len(sent) != 1 || sent[0].DestinationConfig != cfg {
+		t.Errorf("sent %+v, want the stored destination config", sent)
+	}
+}
+
+func TestActiveEntries_LeavesOutInactiveSubscriptions(t *testing.T) {
+	c := newTestConsumer(models.DestinationEmail, &notifiertest.Fake{})
+	c.subs = fakeSubs{
+		"active":      {ID: "active", Active: true},
+		"deactivated": {ID: "deactivated"},
+	}
+	entries := []digest.Entry{
+		{Payload: models.NotificationPayload{SubscriptionID: "active", StreamID: "1"}},
+		{Payload: models.NotificationPayload{SubscriptionID: "deactivated", StreamID: "2"}},
+		{Payload: models.NotificationPayload{SubscriptionID: "deleted", StreamID: "3"}},
+		{Payload: models.NotificationPayload{SubscriptionID: "active", StreamID: "4"}},
+	}
+
+	kept := c.activeEntries(context.Background(), entries)
+	if len(kept) != 2 || kept[0].Payload.StreamID != "1" || kept[1].Payload.StreamID != "4" {
+		t.Errorf("kept %+v, want the active subscription's entries", kept)
+	}
+}
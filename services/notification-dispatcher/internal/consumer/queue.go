@@ -0,0 +1,123 @@
+package consumer
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ackWait is how long JetStream waits for a message to be settled before
+// redelivering it.
+const ackWait = 2 * time.Minute
+
+// progressInterval is how often the ack deadline of a message waiting in or
+// running from a webhook queue is extended. A variable so tests can shorten it.
+var progressInterval = ackWait / 4
+
+// keepAlive tells JetStream msg is being worked on now and every
+// progressInterval until stop is called, so a message queued behind a slow or
+// rate-limited webhook is not redelivered and sent twice. Once stop returns,
+// msg is not touched again.
+func keepAlive(msg jetstream.Msg) (stop func()) {
+	msg.InProgress()
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		t := time.NewTicker(progressInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				msg.InProgress()
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-exited
+		})
+	}
+}
+
+// webhookQueues runs jobs one at a time per webhook, so a webhook that is
+// being rate limited holds back only its own messages while other webhooks
+// keep being served. A webhook's worker goroutine exits once its queue drains.
+type webhookQueues struct {
+	mu     sync.Mutex
+	queues map[string][]func()
+}
+
+func newWebhookQueues() *webhookQueues {
+	return &webhookQueues{queues: make(map[string][]func())}
+}
+
+// enqueue schedules job to run after every job already queued for webhook.
+func (q *webhookQueues) enqueue(webhook string, job func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending, running := q.queues[webhook]
+	q.queues[webhook] = append(pending, job)
+	if !running {
+		go q.run(webhook)
+	}
+}
+
+func (q *webhookQueues) run(webhook string) {
+	for {
+		q.mu.Lock()
+		pending := q.queues[webhook]
+		if len(pending) == 0 {
+			delete(q.queues, webhook)
+			q.mu.Unlock()
+			return
+		}
+		job := pending[0]
+		q.queues[webhook] = pending[1:]
+		q.mu.Unlock()
+
+		job()
+	}
+}
+
+// settle acks msg once n jobs have called done, or naks it if any of them
+// reported a failure. Until then msg is kept alive.
+type settle struct {
+	msg       jetstream.Msg
+	stop      func()
+	remaining atomic.Int32
+	failed    atomic.Bool
+}
+
+func newSettle(msg jetstream.Msg, n int) *settle {
+	s := &settle{msg: msg}
+	s.remaining.Store(int32(n))
+	if n == 0 {
+		msg.Ack()
+		return s
+	}
+	s.stop = keepAlive(msg)
+	return s
+}
+
+func (s *settle) done(ok bool) {
+	if !ok {
+		s.failed.Store(true)
+	}
+	if s.remaining.Add(-1) != 0 {
+		return
+	}
+	s.stop()
+	if s.failed.Load() {
+		s.msg.Nak()
+		return
+	}
+	s.msg.Ack()
+}
@@ -0,0 +1,29 @@
+package consumer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSettle_KeepsMessageAliveUntilSettled(t *testing.T) {
+	defer func(d time.Duration) { progressInterval = d }(progressInterval)
+	progressInterval = time.Millisecond
+
+	msg := &fakeMsg{}
+	st := newSettle(msg, 2)
+	st.done(true)
+	time.Sleep(20 * time.Millisecond)
+	if msg.inProgress() < 2 {
+		t.Errorf("InProgress called %d times while waiting, want the deadline extended repeatedly", msg.inProgress())
+	}
+
+	st.done(true)
+	if msg.settled != "ack" {
+		t.Errorf("message settled with %q, want ack", msg.settled)
+	}
+	n := msg.inProgress()
+	time.Sleep(20 * time.Millisecond)
+	if msg.inProgress() != n {
+		t.Error("InProgress still called after the message was settled")
+	}
+}
@@ -0,0 +1,138 @@
+package digest
+
+import (
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+)
+
+const (
+	pendingKey = "email:digest:pending" // set of addresses with queued notifications
+	lockKey    = "email:digest:lock"
+)
+
+// queueTTL drops a queue that was never sent, e.g. because email delivery was
+// switched off.
+const queueTTL = 24 * time.Hour
+
+// MaxFailures is how many digests carrying a notification may fail before
+// it is dropped, so an address that keeps bouncing is not retried forever.
+const MaxFailures = 3
+
+// Entry is a queued notification.
+type Entry struct {
+	Payload  models.NotificationPayload `json:"payload"`
+	Failures int                        `json:"failures,omitzero"` // digests carrying it that failed
+}
+
+// Store queues go-live notifications for hourly email digests, one queue per
+// address, so that every dispatcher replica adds to the same digest.
+type Store struct {
+	cache *redis.Client
+}
+
+// New creates a Store.
+func New(cache *redis.Client) *Store {
+	return &Store{cache: cache}
+}
+
+func key(address string) string {
+	return "email:digest:" + address
+}
+
+// Add queues payloads for the next digest sent to address.
+func (s *Store) Add(ctx context.Context, address string, payloads ...models.NotificationPayload) error {
+	entries := make([]Entry, len(payloads))
+	for i, p := range payloads {
+		entries[i] = Entry{Payload: p}
+	}
+	return s.push(ctx, address, entries)
+}
+
+// Requeue queues entries of a digest that failed for the next digest sent to
+// address, dropping those that failed MaxFailures times. It returns how many
+// were dropped.
+func (s *Store) Requeue(ctx context.Context, address string, entries ...Entry) (int, error) {
+	var kept []Entry
+	for _, e := range entries {
+		if e.Failures++; e.Failures < MaxFailures {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) == 0 {
+		return len(entries), nil
+	}
+	return len(entries) - len(kept), s.push(ctx, address, kept)
+}
+
+func (s *Store) push(ctx context.Context, address string, entries []Entry) error {
+	values := make([]any, len(entries))
+	for i, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("marshal digest entry: %w", err)
+		}
+		values[i] = data
+	}
+
+	k := key(address)
+	_, err := s.cache.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, k, values...)
+		pipe.Expire(ctx, k, queueTTL)
+		pipe.SAdd(ctx, pendingKey, address)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("valkey RPUSH %s: %w", k, err)
+	}
+	return nil
+}
+
+// Addresses returns the addresses with queued notifications.
+func (s *Store) Addresses(ctx context.Context) ([]string, error) {
+	addresses, err := s.cache.SMembers(ctx, pendingKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("valkey SMEMBERS %s: %w", pendingKey, err)
+	}
+	return addresses, nil
+}
+
+// Take removes and returns the notifications queued for address. Entries
+// that cannot be decoded are dropped.
+func (s *Store) Take(ctx context.Context, address string) ([]Entry, error) {
+	k := key(address)
+	var entries *redis.StringSliceCmd
+	_, err := s.cache.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		entries = pipe.LRange(ctx, k, 0, -1)
+		pipe.Del(ctx, k)
+		pipe.SRem(ctx, pendingKey, address)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("valkey LRANGE %s: %w", k, err)
+	}
+
+	queued := make([]Entry, 0, len(entries.Val()))
+	for _, entry := range entries.Val() {
+		var e Entry
+		if err := json.Unmarshal([]byte(entry), &e); err != nil || e.Payload.SubscriptionID == "" {
+			continue
+		}
+		queued = append(queued, e)
+	}
+	return queued, nil
+}
+
+// Claim reports whether the caller may send the digests of the current
+// interval. Only one replica succeeds per interval.
+func (s *Store) Claim(ctx context.Context, interval time.Duration) (bool, error) {
+	ok, err := s.cache.SetNX(ctx, lockKey, time.Now().UTC().Format(time.RFC3339), interval).Result()
+	if err != nil {
+		return false, fmt.Errorf("valkey SET %s: %w", lockKey, err)
+	}
+	return ok, nil
+}
@@ -0,0 +1,89 @@
+package digest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return New(rdb)
+}
+
+func TestAddTake(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	if err := s.Add(ctx, "a@example.com", models.NotificationPayload{SubscriptionID: "sub-1", StreamID: "1"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := s.Add(ctx, "a@example.com", models.NotificationPayload{SubscriptionID: "sub-1", StreamID: "2"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	addresses, err := s.Addresses(ctx)
+	if err != nil || len(addresses) != 1 || addresses[0] != "a@example.com" {
+		t.Fatalf("Addresses = %v, %v", addresses, err)
+	}
+
+	entries, err := s.Take(ctx, "a@example.com")
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Payload.StreamID != "1" || entries[1].Payload.StreamID != "2" {
+		t.Errorf("Take = %+v", entries)
+	}
+
+	entries, _ = s.Take(ctx, "a@example.com")
+	addresses, _ = s.Addresses(ctx)
+	if len(entries) != 0 || len(addresses) != 0 {
+		t.Errorf("digest not emptied: %v %v", entries, addresses)
+	}
+}
+
+func TestRequeue_DropsAfterMaxFailures(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	if err := s.Add(ctx, "a@example.com", models.NotificationPayload{SubscriptionID: "sub-1", StreamID: "1"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	for failure := 1; failure <= MaxFailures; failure++ {
+		entries, err := s.Take(ctx, "a@example.com")
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("Take after %d failures = %v, %v", failure-1, entries, err)
+		}
+		dropped, err := s.Requeue(ctx, "a@example.com", entries...)
+		if err != nil {
+			t.Fatalf("Requeue: %v", err)
+		}
+		if want := failure / MaxFailures; dropped != want {
+			t.Errorf("failure %d dropped %d entries, want %d", failure, dropped, want)
+		}
+	}
+
+	if entries, _ := s.Take(ctx, "a@example.com"); len(entries) != 0 {
+		t.Errorf("entries still queued after %d failures: %+v", MaxFailures, entries)
+	}
+}
+
+func TestClaim_OncePerInterval(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	first, err := s.Claim(ctx, time.Hour)
+	if err != nil || !first {
+		t.Fatalf("first claim = %v, %v", first, err)
+	}
+	if second, _ := s.Claim(ctx, time.Hour); second {
+		t.Error("interval claimed twice")
+	}
+}
@@ -0,0 +1,57 @@
+package discord
+
+import (
+	"strings"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/templates"
+)
+
+// zeroWidthSpace is put after the @ of @everyone and @here in text that does
+// not come from the subscription's mentions, so Discord does not read them as
+// mentions.
+const zeroWidthSpace = "\u200b"
+
+// mentions returns the line pinging m's roles and users, and the
+// allowed_mentions that lets exactly those pings through. Every other mention
+// in the message, such as one in a stream title, notifies no one.
+func mentions(m *models.DiscordMentions) (string, *allowedMentions) {
+	allowed := &allowedMentions{Parse: []string{}}
+	if m == nil {
+		return "", allowed
+	}
+
+	var parts []string
+	for _, id := range m.Roles {
+		parts = append(parts, "<@&"+id+">")
+	}
+	for _, id := range m.Users {
+		parts = append(parts, "<@"+id+">")
+	}
+	switch {
+	case m.Everyone:
+		parts = append(parts, "@everyone")
+		allowed.Parse = append(allowed.Parse, "everyone")
+	case m.Here:
+		parts = append(parts, "@here")
+		allowed.Parse = append(allowed.Parse, "everyone")
+	}
+	allowed.Roles = m.Roles
+	allowed.Users = m.Users
+	return strings.Join(parts, " "), allowed
+}
+
+// withMentions puts the mention line above content. @everyone and @here in
+// content are defused, since allowing them for the mention line would
+// otherwise let a stream title ping the whole server.
+func withMentions(line, content string) string {
+	content = strings.ReplaceAll(content, "@everyone", "@"+zeroWidthSpace+"everyone")
+	content = strings.ReplaceAll(content, "@here", "@"+zeroWidthSpace+"here")
+	switch {
+	case line == "":
+		return content
+	case content == "":
+		return line
+	}
+	return templates.Truncate(templates.MaxContent, line+"\n"+content)
+}
@@ -0,0 +1,195 @@
+package discord
+
+import (
+	"context"
+	"encoding/json/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Discord rate limit response headers.
+const (
+	headerBucket     = "X-RateLimit-Bucket"
+	headerRemaining  = "X-RateLimit-Remaining"
+	headerResetAfter = "X-RateLimit-Reset-After"
+	headerGlobal     = "X-RateLimit-Global"
+	headerRetryAfter = "Retry-After"
+)
+
+// defaultRetryAfter is used when a 429 carries no usable retry hint.
+const defaultRetryAfter = time.Second
+
+// pruneInterval is how often buckets whose window has passed are dropped.
+const pruneInterval = time.Minute
+
+// rateLimitBody is the JSON body Discord sends with a 429.
+type rateLimitBody struct {
+	RetryAfter float64 `json:"retry_after"`
+	Global     bool    `json:"global"`
+}
+
+// bucket is the last known state of one route's rate limit.
+type bucket struct {
+	remaining int // -1 when unknown
+	reset     time.Time
+}
+
+// rateLimiter tracks Discord's buckets, reported through the X-RateLimit-*
+// headers, and the global limit announced by global 429s. Requests wait until
+// their bucket has room instead of being sent to be rejected. A route's
+// bucket is keyed by its own route until Discord names it in
+// X-RateLimit-Bucket, so routes Discord limits together share one.
+type rateLimiter struct {
+	mu          sync.Mutex
+	routes      map[string]string  // route → named bucket key
+	buckets     map[string]*bucket // by named bucket key or route
+	globalReset time.Time
+	pruned      time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{routes: make(map[string]string), buckets: make(map[string]*bucket)}
+}
+
+// route identifies the rate limit bucket a request falls into: one per
+// method and webhook, with all of a webhook's message edits sharing one.
+func route(method, target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return method + " " + target
+	}
+	path := u.Path
+	if i := strings.Index(path, "/messages/"); i >= 0 {
+		path = path[:i] + "/messages/:id"
+	}
+	return method + " " + u.Host + path
+}
+
+// webhookID returns the webhook ID in route, the major parameter Discord
+// splits a named bucket by.
+func webhookID(route string) string {
+	_, rest, ok := strings.Cut(route, "/webhooks/")
+	if !ok {
+		return route
+	}
+	id, _, _ := strings.Cut(rest, "/")
+	return id
+}
+
+// bucketKey returns the key of route's bucket. l.mu must be held.
+func (l *rateLimiter) bucketKey(route string) string {
+	if k, ok := l.routes[route]; ok {
+		return k
+	}
+	return route
+}
+
+// prune drops the buckets whose window has passed, which behave like unknown
+// ones, and the routes naming them, at most once per pruneInterval. l.mu must
+// be held.
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < pruneInterval {
+		return
+	}
+	l.pruned = now
+	for k, b := range l.buckets {
+		if !b.reset.After(now) {
+			delete(l.buckets, k)
+		}
+	}
+	for r, k := range l.routes {
+		if _, ok := l.buckets[k]; !ok {
+			delete(l.routes, r)
+		}
+	}
+}
+
+// wait blocks until a request on route may be sent, then reserves it.
+func (l *rateLimiter) wait(ctx context.Context, route string) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		until := l.globalReset
+		b := l.buckets[l.bucketKey(route)]
+		if b != nil && !b.reset.After(now) {
+			// Window over; the next response reports the new state.
+			b.remaining = -1
+		}
+		if b != nil && b.remaining == 0 && b.reset.After(until) {
+			until = b.reset
+		}
+		if !until.After(now) {
+			if b != nil && b.remaining > 0 {
+				b.remaining--
+			}
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+
+		t := time.NewTimer(time.Until(until))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// update records the rate limit state from a response on route. A 429 blocks
+// the route, or every route if it was global, for as long as Discord asks.
+func (l *rateLimiter) update(route string, resp *http.Response, body []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+	if name := resp.Header.Get(headerBucket); name != "" {
+		l.routes[route] = name + " " + webhookID(route)
+	}
+	k := l.bucketKey(route)
+	b := l.buckets[k]
+	if b == nil {
+		b = &bucket{remaining: -1}
+		l.buckets[k] = b
+	}
+
+	remaining, errRemaining := strconv.Atoi(resp.Header.Get(headerRemaining))
+	resetAfter, errReset := strconv.ParseFloat(resp.Header.Get(headerResetAfter), 64)
+	if errRemaining == nil && errReset == nil {
+		b.remaining = remaining
+		b.reset = now.Add(seconds(resetAfter))
+	}
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+
+	var rl rateLimitBody
+	_ = json.Unmarshal(body, &rl)
+	retryAfter := seconds(rl.RetryAfter)
+	if retryAfter <= 0 {
+		if s, err := strconv.ParseFloat(resp.Header.Get(headerRetryAfter), 64); err == nil {
+			retryAfter = seconds(s)
+		}
+	}
+	if retryAfter <= 0 {
+		retryAfter = defaultRetryAfter
+	}
+
+	if rl.Global || resp.Header.Get(headerGlobal) == "true" {
+		l.globalReset = now.Add(retryAfter)
+	} else {
+		b.remaining = 0
+		b.reset = now.Add(retryAfter)
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,151 @@
+package discord
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+)
+
+func TestRoute_GroupsMessageEdits(t *testing.T) {
+	a := route(http.MethodPatch, "https://discord.com/api/webhooks/1/a/messages/111")
+	b := route(http.MethodPatch, "https://discord.com/api/webhooks/1/a/messages/222")
+	if a != b {
+		t.Errorf("edits of one webhook should share a route: %q != %q", a, b)
+	}
+	if c := route(http.MethodPost, "https://discord.com/api/webhooks/2/b?wait=true"); c == route(http.MethodPost, "https://discord.com/api/webhooks/1/a") {
+		t.Errorf("different webhooks share route %q", c)
+	}
+}
+
+func TestSend_WaitsForExhaustedBucket(t *testing.T) {
+	var last atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last.Store(time.Now().UnixNano())
+		w.Header().Set(headerRemaining, "0")
+		w.Header().Set(headerResetAfter, "0.2")
+		io.WriteString(w, `{"id":"1"}`)
+	}))
+	defer srv.Close()
+
+	s := New()
+	payload := models.NotificationPayload{WebhookURL: srv.URL + "/api/webhooks/1/a"}
+
+	if _, err := s.SendEditable(context.Background(), payload); err != nil {
+		t.Fatalf("first send: %v", err)
+	}
+	first := time.Unix(0, last.Load())
+	if _, err := s.SendEditable(context.Background(), payload); err != nil {
+		t.Fatalf("second send: %v", err)
+	}
+
+	if gap := time.Unix(0, last.Load()).Sub(first); gap < 150*time.Millisecond {
+		t.Errorf("second request sent %v after the first, expected to wait for the bucket reset", gap)
+	}
+}
+
+func TestSend_RetriesAfter429(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, `{"message":"You are being rate limited.","retry_after":0.1,"global":false}`)
+			return
+		}
+		io.WriteString(w, `{"id":"1"}`)
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	_, err := New().SendEditable(context.Background(), models.NotificationPayload{WebhookURL: srv.URL + "/api/webhooks/1/a"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("calls = %d, want 2", got)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond || elapsed > time.Second {
+		t.Errorf("retry after %v, want about retry_after (100ms) without the failure backoff", elapsed)
+	}
+}
+
+func TestRateLimiter_GlobalLimitBlocksOtherRoutes(t *testing.T) {
+	l := newRateLimiter()
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	l.update("POST discord.com/api/webhooks/1/a", resp, []byte(`{"retry_after":0.2,"global":true}`))
+
+	start := time.Now()
+	if err := l.wait(context.Background(), "POST discord.com/api/webhooks/2/b"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("waited %v, expected the global limit to apply to every route", elapsed)
+	}
+}
+
+func TestRateLimiter_WaitRespectsContext(t *testing.T) {
+	l := newRateLimiter()
+	l.buckets["r"] = &bucket{remaining: 0, reset: time.Now().Add(time.Hour)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx, "r"); err != context.DeadlineExceeded {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestRateLimiter_NamedBucketIsShared(t *testing.T) {
+	l := newRateLimiter()
+	h := http.Header{}
+	h.Set(headerBucket, "abcd1234")
+	h.Set(headerRemaining, "0")
+	h.Set(headerResetAfter, "0.2")
+	l.update("POST discord.com/api/webhooks/1/a", &http.Response{StatusCode: http.StatusOK, Header: h}, nil)
+	l.update("PATCH discord.com/api/webhooks/1/a/messages/:id", &http.Response{StatusCode: http.StatusOK, Header: h}, nil)
+
+	start := time.Now()
+	if err := l.wait(context.Background(), "PATCH discord.com/api/webhooks/1/a/messages/:id"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("waited %v, expected routes in one bucket to share its limit", elapsed)
+	}
+	if len(l.buckets) != 1 {
+		t.Errorf("%d buckets, want 1 shared by both routes", len(l.buckets))
+	}
+
+	// The same bucket name on another webhook is a separate limit.
+	start = time.Now()
+	l.update("POST discord.com/api/webhooks/2/b", &http.Response{StatusCode: http.StatusOK, Header: http.Header{headerBucket: {"abcd1234"}}}, nil)
+	if err := l.wait(context.Background(), "POST discord.com/api/webhooks/2/b"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("waited %v for another webhook's bucket", elapsed)
+	}
+}
+
+func TestRateLimiter_PrunesExpiredBuckets(t *testing.T) {
+	l := newRateLimiter()
+	l.buckets["POST discord.com/api/webhooks/1/a"] = &bucket{remaining: 3, reset: time.Now().Add(-time.Second)}
+	l.routes["PATCH discord.com/api/webhooks/1/a/messages/:id"] = "gone 1"
+	l.buckets["gone 1"] = &bucket{remaining: 0, reset: time.Now().Add(-time.Second)}
+
+	h := http.Header{}
+	h.Set(headerRemaining, "4")
+	h.Set(headerResetAfter, "2")
+	l.update("POST discord.com/api/webhooks/2/b", &http.Response{StatusCode: http.StatusOK, Header: h}, nil)
+
+	if len(l.buckets) != 1 || l.buckets["POST discord.com/api/webhooks/2/b"] == nil {
+		t.Errorf("buckets = %v, want only the live one", l.buckets)
+	}
+	if len(l.routes) != 0 {
+		t.Errorf("routes = %v, want the pruned bucket's route dropped", l.routes)
+	}
+}
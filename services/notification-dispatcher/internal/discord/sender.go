@@ -5,10 +5,17 @@ import (
 	"context"
 	"encoding/json/v2"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/templates"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/format"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
 )
 
 // embed represents a Discord rich embed.
@@ -38,65 +45,359 @@ type field struct {
 }
 
 type webhookPayload struct {
-	Embeds []embed `json:"embeds"`
+	Content         string           `json:"content,omitempty"`
+	Embeds          []embed          `json:"embeds"`
+	AllowedMentions *allowedMentions `json:"allowed_mentions,omitempty"`
+	ThreadName      string           `json:"thread_name,omitempty"` // creates a forum post
+	Username        string           `json:"username,omitempty"`    // posts only; edits keep the name
+	AvatarURL       string           `json:"avatar_url,omitempty"`  // posts only
+}
+
+// allowedMentions limits which mentions in content notify anyone.
+type allowedMentions struct {
+	Parse []string `json:"parse"`
+	Roles []string `json:"roles,omitempty"`
+	Users []string `json:"users,omitempty"`
+}
+
+// message is the part of a Discord message object the sender needs.
+type message struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"` // the thread, for messages in one
+}
+
+const (
+	maxAttempts         = 3
+	maxRateLimitRetries = 5
+)
+
+// Discord JSON error codes used to tell a missing message or thread from a
+// missing webhook.
+const (
+	codeUnknownChannel = 10003
+	codeUnknownMessage = 10008
+	codeUnknownWebhook = 10015
+)
+
+var _ notifier.Editor = (*Sender)(nil)
+
+// apiError is the JSON error body Discord returns with 4xx responses.
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
 
 // Sender sends Discord webhook notifications.
 type Sender struct {
 	httpClient *http.Client
+	limiter    *rateLimiter
 }
 
 // New creates a Sender.
 func New() *Sender {
 	return &Sender{
 		httpClient: &http.Client{Timeout: 10 * time.Second},
+		limiter:    newRateLimiter(),
 	}
 }
 
 // Send posts a rich embed to the given Discord webhook URL.
-// Retries up to 3 times with exponential backoff on non-2xx responses.
 func (s *Sender) Send(ctx context.Context, payload models.NotificationPayload) error {
-	e := buildEmbed(payload)
-	body, err := json.Marshal(webhookPayload{Embeds: []embed{e}})
+	_, err := s.SendEditable(ctx, payload)
+	return err
+}
+
+// SendEditable posts a rich embed to the given Discord webhook URL and returns
+// the ID of the created message. Messages posted in a thread, including a new
+// forum post, get an ID naming the thread too, so they can be edited.
+func (s *Sender) SendEditable(ctx context.Context, payload models.NotificationPayload) (string, error) {
+	msg := buildMessage(payload)
+	cfg := discordConfig(payload.DestinationConfig)
+	msg.Username, msg.AvatarURL = identity(cfg, payload.UserName, payload.ProfileImageURL)
+	threadID := ""
+	if cfg.ThreadID != "" {
+		threadID = cfg.ThreadID
+	} else if cfg.ThreadName != "" {
+		msg.ThreadName = threadName(cfg.ThreadName, templates.FromPayload(payload), payload.UserName+" is live on Twitch!")
+	}
+
+	created, err := s.create(ctx, payload.WebhookURL, threadID, msg)
 	if err != nil {
-		return fmt.Errorf("marshal discord payload: %w", err)
+		return "", err
 	}
+	if threadID == "" && msg.ThreadName == "" {
+		return created.ID, nil
+	}
+	return messageRef(created.ChannelID, created.ID), nil
+}
 
-	var lastErr error
-	for attempt := 0; attempt < 3; attempt++ {
-		if attempt > 0 {
-			wait := time.Duration(1<<uint(attempt)) * time.Second
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(wait):
-			}
+// SendEnded posts a "stream ended" embed to the subscription's webhook, in its
+// thread or, for subscriptions creating forum posts, in a new one.
+func (s *Sender) SendEnded(ctx context.Context, ref models.SubscriptionRef, event models.StreamEndedEvent) error {
+	cfg := discordConfig(ref.DestinationConfig)
+	msg := buildEndedMessage(cfg, event)
+	if cfg.ThreadName != "" {
+		msg.ThreadName = threadName(cfg.ThreadName, templates.FromEnded(event), event.UserName+" was live on Twitch")
+	}
+	_, err := s.create(ctx, ref.WebhookURL, cfg.ThreadID, msg)
+	return err
+}
+
+// ReplyEnded posts a "stream ended" embed in the thread of the message sent by
+// Send, or like SendEnded if it was not posted in a thread.
+func (s *Sender) ReplyEnded(ctx context.Context, ref models.SubscriptionRef, messageID string, event models.StreamEndedEvent) error {
+	threadID, _ := parseMessageRef(messageID)
+	if threadID == "" {
+		return s.SendEnded(ctx, ref, event)
+	}
+	_, err := s.create(ctx, ref.WebhookURL, threadID, buildEndedMessage(discordConfig(ref.DestinationConfig), event))
+	return err
+}
+
+// EditLive replaces the message sent by Send with the stream's current details.
+func (s *Sender) EditLive(ctx context.Context, messageID string, payload models.NotificationPayload) error {
+	return s.edit(ctx, payload.WebhookURL, messageID, buildMessage(payload))
+}
+
+// EditEnded replaces the embed of a message sent by Send with a "was live for"
+// summary. Its content, if any, is left as it is.
+func (s *Sender) EditEnded(ctx context.Context, ref models.SubscriptionRef, messageID string, event models.StreamEndedEvent) error {
+	return s.edit(ctx, ref.WebhookURL, messageID, webhookPayload{Embeds: []embed{buildEndedEmbed(event)}})
+}
+
+// create posts msg to the webhook, in threadID if it is set. wait=true makes
+// Discord return the created message instead of 204 No Content.
+func (s *Sender) create(ctx context.Context, webhook, threadID string, msg webhookPayload) (message, error) {
+	u, err := url.Parse(webhook)
+	if err != nil {
+		return message{}, fmt.Errorf("parse discord webhook URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("wait", "true")
+	if threadID != "" {
+		q.Set("thread_id", threadID)
+	}
+	u.RawQuery = q.Encode()
+
+	respBody, err := s.do(ctx, http.MethodPost, u.String(), msg)
+	if err != nil {
+		return message{}, err
+	}
+
+	var created message
+	if err := json.Unmarshal(respBody, &created); err != nil {
+		return message{}, fmt.Errorf("decode discord message: %w", err)
+	}
+	return created, nil
+}
+
+// edit replaces the embeds of a message previously sent through the webhook.
+// ref is a message ID returned by SendEditable.
+func (s *Sender) edit(ctx context.Context, webhook, ref string, msg webhookPayload) error {
+	u, err := url.Parse(webhook)
+	if err != nil {
+		return fmt.Errorf("parse discord webhook URL: %w", err)
+	}
+	threadID, messageID := parseMessageRef(ref)
+	u = u.JoinPath("messages", messageID)
+	if threadID != "" {
+		q := u.Query()
+		q.Set("thread_id", threadID)
+		u.RawQuery = q.Encode()
+	}
+
+	_, err = s.do(ctx, http.MethodPatch, u.String(), msg)
+	return err
+}
+
+// messageRef returns the message ID SendEditable hands out for a message in a thread.
+func messageRef(threadID, messageID string) string {
+	return threadID + "/" + messageID
+}
+
+// parseMessageRef splits a message ID returned by SendEditable into the
+// thread the message is in, if any, and its Discord message ID.
+func parseMessageRef(ref string) (threadID, messageID string) {
+	if threadID, messageID, ok := strings.Cut(ref, "/"); ok {
+		return threadID, messageID
+	}
+	return "", ref
+}
+
+// do sends msg and returns the response body. Each attempt first
+// waits for the route's rate limit bucket. 429s are retried after the delay
+// Discord asks for, up to maxRateLimitRetries times; 408, 5xx responses and
+// network errors are retried up to maxAttempts times with exponential
+// backoff. 401 and 404 mean the webhook or message is gone, and other 4xx
+// mean Discord rejected the request; neither is retried.
+func (s *Sender) do(ctx context.Context, method, target string, msg webhookPayload) ([]byte, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("marshal discord payload: %w", err)
+	}
+
+	rt := route(method, target)
+	failures, limited := 0, 0
+	for {
+		if err := s.limiter.wait(ctx, rt); err != nil {
+			return nil, err
 		}
 
-		req, err := http.NewRequestWithContext(ctx, http.MethodPost, payload.DiscordWebhook,
-			bytes.NewReader(body))
+		req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
 		if err != nil {
-			return fmt.Errorf("build discord request: %w", err)
+			return nil, fmt.Errorf("build discord request: %w", err)
 		}
 		req.Header.Set("Content-Type", "application/json")
 
+		var lastErr error
 		resp, err := s.httpClient.Do(req)
 		if err != nil {
-			lastErr = fmt.Errorf("discord webhook POST: %w", err)
-			continue
+			lastErr = fmt.Errorf("discord webhook %s: %w", method, err)
+		} else {
+			respBody, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			s.limiter.update(rt, resp, respBody)
+
+			switch {
+			case resp.StatusCode >= 200 && resp.StatusCode < 300:
+				if err != nil {
+					return nil, fmt.Errorf("read discord response: %w", err)
+				}
+				return respBody, nil
+			case resp.StatusCode == http.StatusTooManyRequests:
+				limited++
+				if limited > maxRateLimitRetries {
+					return nil, fmt.Errorf("discord webhook still rate limited after %d retries", maxRateLimitRetries)
+				}
+				// wait holds the next attempt until the bucket or global limit resets.
+				continue
+			case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUnauthorized:
+				return nil, classify(method, resp.StatusCode, respBody)
+			case resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode < 500:
+				var apiErr apiError
+				_ = json.Unmarshal(respBody, &apiErr)
+				return nil, notifier.Permanent(fmt.Errorf("discord webhook returned %d: %s", resp.StatusCode, apiErr.Message))
+			}
+			lastErr = fmt.Errorf("discord webhook returned %d", resp.StatusCode)
 		}
-		resp.Body.Close()
 
-		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			return nil
+		failures++
+		if failures >= maxAttempts {
+			return nil, lastErr
+		}
+		backoff := time.Duration(1<<uint(failures)) * time.Second
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// classify turns a 401 or 404 into notifier.ErrUnknownMessage or a
+// notifier.InvalidWebhookError.
+// A 404 without a recognised error code is blamed on the message for edits
+// and on the webhook for posts. Posting to a deleted thread fails permanently
+// without blaming the webhook.
+func classify(method string, status int, body []byte) error {
+	var apiErr apiError
+	_ = json.Unmarshal(body, &apiErr)
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(status)
+	}
+
+	if status == http.StatusNotFound && apiErr.Code == codeUnknownChannel && method == http.MethodPost {
+		return notifier.Permanent(fmt.Errorf("discord thread not found: %s", apiErr.Message))
+	}
+
+	if status == http.StatusNotFound && apiErr.Code != codeUnknownWebhook &&
+		(apiErr.Code == codeUnknownMessage || method == http.MethodPatch) {
+		return notifier.ErrUnknownMessage
+	}
+	return &notifier.InvalidWebhookError{Destination: "discord webhook", StatusCode: status, Message: apiErr.Message}
+}
+
+// buildMessage constructs the go-live message for a stream notification from
+// the subscription's template, or the default embed if it has none or the
+// template fails to render, and prefixes the subscription's mentions.
+func buildMessage(p models.NotificationPayload) webhookPayload {
+	msg := webhookPayload{Embeds: []embed{buildEmbed(p)}}
+	if p.DestinationConfig == nil || p.DestinationConfig.Discord == nil {
+		return msg
+	}
+	cfg := p.DestinationConfig.Discord
+
+	if cfg.Template != nil {
+		// Templates are validated when the subscription is created; rendering
+		// only fails if the template language changed since.
+		if rendered, err := templates.Render(cfg.Template, templates.FromPayload(p)); err == nil {
+			e := &msg.Embeds[0]
+			e.Title, e.Description, e.Color = rendered.Title, rendered.Description, rendered.Color
+			e.Fields = make([]field, len(rendered.Fields))
+			for i, f := range rendered.Fields {
+				e.Fields[i] = field{Name: f.Name, Value: f.Value, Inline: f.Inline}
+			}
+			msg.Content = rendered.Content
 		}
-		lastErr = fmt.Errorf("discord webhook returned %d", resp.StatusCode)
 	}
 
-	return lastErr
+	line, allowed := mentions(cfg.Mentions)
+	msg.Content = withMentions(line, msg.Content)
+	if msg.Content != "" {
+		msg.AllowedMentions = allowed
+	}
+	return msg
+}
+
+// discordConfig returns the Discord settings in cfg, or the zero settings.
+func discordConfig(cfg *models.DestinationConfig) models.DiscordConfig {
+	if cfg == nil || cfg.Discord == nil {
+		return models.DiscordConfig{}
+	}
+	return *cfg.Discord
+}
+
+// threadName renders the name of a new forum post. Templates are validated
+// when the subscription is created, but may still render empty, e.g. for a
+// stream without a game; the post is then named fallback.
+func threadName(src string, d templates.Data, fallback string) string {
+	if name, err := templates.ThreadName(src, d); err == nil {
+		return name
+	}
+	return templates.Truncate(templates.MaxThreadName, fallback)
+}
+
+// buildEndedMessage constructs a separate "stream ended" message.
+func buildEndedMessage(cfg models.DiscordConfig, e models.StreamEndedEvent) webhookPayload {
+	msg := webhookPayload{Embeds: []embed{buildEndedEmbed(e)}}
+	msg.Username, msg.AvatarURL = identity(cfg, e.UserName, e.ProfileImageURL)
+	return msg
 }
 
-// buildEmbed constructs the Discord rich embed for a stream notification.
+// identity returns the name and avatar a subscription's messages are posted
+// with; empty means the webhook's own.
+func identity(cfg models.DiscordConfig, userName, profileImageURL string) (username, avatarURL string) {
+	username, avatarURL = cfg.Username, cfg.AvatarURL
+	if !cfg.AsStreamer {
+		return username, avatarURL
+	}
+	if validUsername(userName) {
+		username = userName
+	}
+	if profileImageURL != "" {
+		avatarURL = profileImageURL
+	}
+	return username, avatarURL
+}
+
+// validUsername reports whether Discord accepts name as a webhook username.
+func validUsername(name string) bool {
+	lower := strings.ToLower(name)
+	return name != "" && utf8.RuneCountInString(name) <= 80 &&
+		!strings.Contains(lower, "discord") && !strings.Contains(lower, "clyde")
+}
+
+// buildEmbed constructs the default Discord rich embed for a stream notification.
 func buildEmbed(p models.NotificationPayload) embed {
 	return embed{
 		Title:       fmt.Sprintf("%s is live on Twitch!", p.UserName),
@@ -112,3 +413,19 @@ func buildEmbed(p models.NotificationPayload) embed {
 		},
 	}
 }
+
+// buildEndedEmbed constructs the Discord rich embed for a stream that went offline.
+func buildEndedEmbed(e models.StreamEndedEvent) embed {
+	return embed{
+		Title:       fmt.Sprintf("%s was live for %s", e.UserName, format.Duration(time.Duration(e.DurationSeconds)*time.Second)),
+		Description: e.Title,
+		URL:         e.StreamURL,
+		Color:       0x808080, // offline grey
+		Timestamp:   e.EndedAt,
+		Footer:      &footer{Text: "Twitch Watcher"},
+		Fields: []field{
+			{Name: "Game", Value: e.GameName, Inline: true},
+			{Name: "Peak viewers", Value: fmt.Sprintf("%d", e.PeakViewers), Inline: true},
+		},
+	}
+}
@@ -0,0 +1,351 @@
+package discord
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+)
+
+func TestSendEditable_ReturnsMessageID(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/webhooks/1/a" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.URL.Query().Get("wait") != "true" {
+			t.Errorf("wait = %q, want true", r.URL.Query().Get("wait"))
+		}
+		io.WriteString(w, `{"id":"123456","channel_id":"42"}`)
+	}))
+	defer srv.Close()
+
+	id, err := New().SendEditable(context.Background(), models.NotificationPayload{
+		WebhookURL: srv.URL + "/api/webhooks/1/a",
+		UserName:   "Streamer",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != "123456" {
+		t.Errorf("message ID = %q, want 123456", id)
+	}
+}
+
+func TestEditEnded_PatchesMessage(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch || r.URL.Path != "/api/webhooks/1/a/messages/123456" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		io.WriteString(w, `{"id":"123456"}`)
+	}))
+	defer srv.Close()
+
+	err := New().EditEnded(context.Background(), models.SubscriptionRef{WebhookURL: srv.URL + "/api/webhooks/1/a"}, "123456", models.StreamEndedEvent{
+		UserName:        "Streamer",
+		DurationSeconds: int64((3*time.Hour + 12*time.Minute).Seconds()),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(body, "Streamer was live for 3h 12m") {
+		t.Errorf("body %s does not contain the ended title", body)
+	}
+}
+
+func TestEdit_UnknownMessage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	err := New().EditLive(context.Background(), "123456", models.NotificationPayload{
+		WebhookURL: srv.URL + "/api/webhooks/1/a",
+	})
+	if !errors.Is(err, notifier.ErrUnknownMessage) {
+		t.Errorf("err = %v, want ErrUnknownMessage", err)
+	}
+}
+
+func TestSend_InvalidWebhook(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"unknown webhook", http.StatusNotFound, `{"message":"Unknown Webhook","code":10015}`},
+		{"bare 404", http.StatusNotFound, ""},
+		{"invalid token", http.StatusUnauthorized, `{"message":"Invalid Webhook Token","code":50027}`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(tc.status)
+				io.WriteString(w, tc.body)
+			}))
+			defer srv.Close()
+
+			_, err := New().SendEditable(context.Background(), models.NotificationPayload{
+				WebhookURL: srv.URL + "/api/webhooks/1/a",
+			})
+			var invalid *notifier.InvalidWebhookError
+			if !errors.As(err, &invalid) || invalid.StatusCode != tc.status {
+				t.Fatalf("err = %v, want InvalidWebhookError with status %d", err, tc.status)
+			}
+			if got := calls.Load(); got != 1 {
+				t.Errorf("calls = %d, want 1 (no retries)", got)
+			}
+		})
+	}
+}
+
+func TestEdit_UnknownWebhook(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"message":"Unknown Webhook","code":10015}`)
+	}))
+	defer srv.Close()
+
+	err := New().EditLive(context.Background(), "123456", models.NotificationPayload{
+		WebhookURL: srv.URL + "/api/webhooks/1/a",
+	})
+	var invalid *notifier.InvalidWebhookError
+	if !errors.As(err, &invalid) {
+		t.Errorf("err = %v, want InvalidWebhookError", err)
+	}
+}
+
+func TestBuildMessage_Template(t *testing.T) {
+	p := models.NotificationPayload{
+		UserName:     "Streamer",
+		GameName:     "Fortnite",
+		Title:        "Ranked @everyone",
+		ViewerCount:  42,
+		ThumbnailURL: "https://example.com/thumb.jpg",
+		DestinationConfig: &models.DestinationConfig{Discord: &models.DiscordConfig{Template: &models.MessageTemplate{
+			Content: "{{.UserName}} is on! {{.Title}}",
+			Title:   "{{.GameName}} time",
+			Color:   "#FF0000",
+			Fields:  []models.TemplateField{{Name: "Watching", Value: "{{.ViewerCount}}"}},
+		}}},
+	}
+
+	msg := buildMessage(p)
+	if msg.Content != "Streamer is on! Ranked @\u200beveryone" {
+		t.Errorf("content = %q", msg.Content)
+	}
+	if msg.AllowedMentions == nil || len(msg.AllowedMentions.Parse) != 0 {
+		t.Errorf("allowed_mentions = %+v, want no mentions parsed", msg.AllowedMentions)
+	}
+	e := msg.Embeds[0]
+	if e.Title != "Fortnite time" || e.Color != 0xFF0000 || len(e.Fields) != 1 || e.Fields[0].Value != "42" {
+		t.Errorf("embed = %+v", e)
+	}
+	if e.Image == nil || e.Image.URL != "https://example.com/thumb.jpg" {
+		t.Errorf("image = %+v, want the stream thumbnail", e.Image)
+	}
+
+	p.DestinationConfig = nil
+	if msg := buildMessage(p); msg.Content != "" || msg.Embeds[0].Title != "Streamer is live on Twitch!" {
+		t.Errorf("without a template got %+v, want the default embed", msg)
+	}
+}
+
+func TestBuildMessage_Mentions(t *testing.T) {
+	p := models.NotificationPayload{
+		UserName: "Streamer",
+		Title:    "Ranked @here",
+		DestinationConfig: &models.DestinationConfig{Discord: &models.DiscordConfig{
+			Template: &models.MessageTemplate{Content: "{{.Title}}"},
+			Mentions: &models.DiscordMentions{Roles: []string{"111111111111111111"}, Users: []string{"222222222222222222"}, Here: true},
+		}},
+	}
+
+	msg := buildMessage(p)
+	if msg.Content != "<@&111111111111111111> <@222222222222222222> @here\nRanked @\u200bhere" {
+		t.Errorf("content = %q", msg.Content)
+	}
+	am := msg.AllowedMentions
+	if am == nil || len(am.Parse) != 1 || am.Parse[0] != "everyone" ||
+		len(am.Roles) != 1 || am.Roles[0] != "111111111111111111" ||
+		len(am.Users) != 1 || am.Users[0] != "222222222222222222" {
+		t.Errorf("allowed_mentions = %+v", am)
+	}
+
+	p.DestinationConfig.Discord.Template = nil
+	p.DestinationConfig.Discord.Mentions = &models.DiscordMentions{Roles: []string{"111111111111111111"}}
+	msg = buildMessage(p)
+	if msg.Content != "<@&111111111111111111>" || len(msg.AllowedMentions.Parse) != 0 {
+		t.Errorf("got content %q, allowed_mentions %+v", msg.Content, msg.AllowedMentions)
+	}
+	if msg.Embeds[0].Title != "Streamer is live on Twitch!" {
+		t.Errorf("title = %q, want the default embed", msg.Embeds[0].Title)
+	}
+}
+
+func TestSendEditable_ForumPost(t *testing.T) {
+	var threadName string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body webhookPayload
+		b, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		threadName = body.ThreadName
+		if r.URL.Query().Has("thread_id") {
+			t.Errorf("thread_id = %q, want none for a new post", r.URL.Query().Get("thread_id"))
+		}
+		io.WriteString(w, `{"id":"123456","channel_id":"777"}`)
+	}))
+	defer srv.Close()
+
+	id, err := New().SendEditable(context.Background(), models.NotificationPayload{
+		WebhookURL: srv.URL + "/api/webhooks/1/a",
+		UserName:   "Streamer",
+		GameName:   "Fortnite",
+		DestinationConfig: &models.DestinationConfig{Discord: &models.DiscordConfig{
+			ThreadName: "{{.UserName}} - {{.GameName}}",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if threadName != "Streamer - Fortnite" {
+		t.Errorf("thread_name = %q", threadName)
+	}
+	if id != "777/123456" {
+		t.Errorf("message ID = %q, want the thread and message", id)
+	}
+}
+
+func TestThread_FollowUpsStayInThread(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.URL.Query().Get("thread_id"))
+		io.WriteString(w, `{"id":"123456","channel_id":"777"}`)
+	}))
+	defer srv.Close()
+
+	ref := models.SubscriptionRef{
+		WebhookURL:        srv.URL + "/api/webhooks/1/a",
+		DestinationConfig: &models.DestinationConfig{Discord: &models.DiscordConfig{ThreadName: "{{.UserName}}"}},
+	}
+	s := New()
+	if err := s.EditLive(context.Background(), "777/123456", models.NotificationPayload{WebhookURL: ref.WebhookURL}); err != nil {
+		t.Fatalf("EditLive: %v", err)
+	}
+	if err := s.EditEnded(context.Background(), ref, "777/123456", models.StreamEndedEvent{}); err != nil {
+		t.Fatalf("EditEnded: %v", err)
+	}
+	if err := s.ReplyEnded(context.Background(), ref, "777/123456", models.StreamEndedEvent{}); err != nil {
+		t.Fatalf("ReplyEnded: %v", err)
+	}
+
+	want := []string{
+		"PATCH /api/webhooks/1/a/messages/123456 777",
+		"PATCH /api/webhooks/1/a/messages/123456 777",
+		"POST /api/webhooks/1/a 777",
+	}
+	if strings.Join(requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests:\n%s\nwant:\n%s", strings.Join(requests, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSend_DeletedThread(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("thread_id") != "123456789012345678" {
+			t.Errorf("thread_id = %q", r.URL.Query().Get("thread_id"))
+		}
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"message":"Unknown Channel","code":10003}`)
+	}))
+	defer srv.Close()
+
+	err := New().Send(context.Background(), models.NotificationPayload{
+		WebhookURL:        srv.URL + "/api/webhooks/1/a",
+		DestinationConfig: &models.DestinationConfig{Discord: &models.DiscordConfig{ThreadID: "123456789012345678"}},
+	})
+	if _, _, invalid := notifier.Invalid(err); invalid || notifier.Retryable(err) {
+		t.Errorf("err = %v, want a permanent error that keeps the webhook", err)
+	}
+}
+
+func TestSend_RejectedPayloadIsNotRetried(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusForbidden} {
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(status)
+			io.WriteString(w, `{"message":"Invalid Form Body","code":50035}`)
+		}))
+
+		err := New().Send(context.Background(), models.NotificationPayload{WebhookURL: srv.URL + "/api/webhooks/1/a"})
+		srv.Close()
+		if _, _, invalid := notifier.Invalid(err); invalid || notifier.Retryable(err) {
+			t.Errorf("status %d: err = %v, want a permanent error that keeps the webhook", status, err)
+		}
+		if n := calls.Load(); n != 1 {
+			t.Errorf("status %d: %d calls, want 1", status, n)
+		}
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	cfg := models.DiscordConfig{Username: "Stream Alerts", AvatarURL: "https://example.com/bot.png"}
+	if name, avatar := identity(cfg, "Streamer", "https://example.com/streamer.png"); name != "Stream Alerts" || avatar != "https://example.com/bot.png" {
+		t.Errorf("got %q, %q, want the configured identity", name, avatar)
+	}
+
+	cfg.AsStreamer = true
+	if name, avatar := identity(cfg, "Streamer", "https://example.com/streamer.png"); name != "Streamer" || avatar != "https://example.com/streamer.png" {
+		t.Errorf("got %q, %q, want the streamer's", name, avatar)
+	}
+	// Discord rejects webhook names containing "discord".
+	if name, avatar := identity(cfg, "DiscordFan", ""); name != "Stream Alerts" || avatar != "https://example.com/bot.png" {
+		t.Errorf("got %q, %q, want the configured fallbacks", name, avatar)
+	}
+}
+
+func TestEditLive_KeepsIdentity(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		io.WriteString(w, `{"id":"123456"}`)
+	}))
+	defer srv.Close()
+
+	payload := models.NotificationPayload{
+		WebhookURL:        srv.URL + "/api/webhooks/1/a",
+		UserName:          "Streamer",
+		ProfileImageURL:   "https://example.com/streamer.png",
+		DestinationConfig: &models.DestinationConfig{Discord: &models.DiscordConfig{AsStreamer: true}},
+	}
+	if _, err := New().SendEditable(context.Background(), payload); err != nil {
+		t.Fatalf("SendEditable: %v", err)
+	}
+	if !strings.Contains(body, `"username":"Streamer"`) || !strings.Contains(body, `"avatar_url":"https://example.com/streamer.png"`) {
+		t.Errorf("post body = %s, want the streamer's name and avatar", body)
+	}
+
+	if err := New().EditLive(context.Background(), "123456", payload); err != nil {
+		t.Fatalf("EditLive: %v", err)
+	}
+	if strings.Contains(body, "username") || strings.Contains(body, "avatar_url") {
+		t.Errorf("edit body = %s, want no username or avatar_url", body)
+	}
+}
@@ -0,0 +1,149 @@
+package email
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/format"
+)
+
+// message is a rendered email.
+type message struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// templatePair renders the same data as plain text and as HTML.
+type templatePair struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+func newTemplate(text, html string) templatePair {
+	return templatePair{
+		text: texttemplate.Must(texttemplate.New("text").Parse(text)),
+		html: htmltemplate.Must(htmltemplate.New("html").Parse(htmlHead + html + htmlFoot)),
+	}
+}
+
+func (t templatePair) render(subject string, data any) (message, error) {
+	var text, html strings.Builder
+	if err := t.text.Execute(&text, data); err != nil {
+		return message{}, fmt.Errorf("render email text: %w", err)
+	}
+	if err := t.html.Execute(&html, data); err != nil {
+		return message{}, fmt.Errorf("render email html: %w", err)
+	}
+	return message{Subject: subject, Text: text.String(), HTML: html.String()}, nil
+}
+
+const (
+	htmlHead = `<!DOCTYPE html>
+<html><body style="margin:0;padding:24px;font-family:Helvetica,Arial,sans-serif;color:#0e0e10">
+<div style="max-width:480px">
+`
+	htmlFoot = `
+<p style="margin:24px 0 0;color:#53535f;font-size:12px">Twitch Watcher</p>
+</div>
+</body></html>
+`
+)
+
+var liveTemplate = newTemplate(`{{.UserName}} is live on Twitch!
+{{.StreamURL}}
+
+{{.Title}}
+
+Game: {{.GameName}}
+Viewers: {{.ViewerCount}}
+`, `<h2 style="margin:0 0 8px"><a href="{{.StreamURL}}" style="color:#9146ff;text-decoration:none">{{.UserName}} is live on Twitch!</a></h2>
+<p style="margin:0 0 12px">{{.Title}}</p>
+<p style="margin:0 0 12px"><strong>Game:</strong> {{.GameName}}<br><strong>Viewers:</strong> {{.ViewerCount}}</p>
+{{if .ThumbnailURL}}<a href="{{.StreamURL}}"><img src="{{.ThumbnailURL}}" alt="" width="440" style="max-width:100%;border:0"></a>{{end}}`)
+
+var endedTemplate = newTemplate(`{{.Event.UserName}} was live for {{.Duration}}
+{{.Event.StreamURL}}
+
+{{.Event.Title}}
+
+Game: {{.Event.GameName}}
+Peak viewers: {{.Event.PeakViewers}}
+`, `<h2 style="margin:0 0 8px"><a href="{{.Event.StreamURL}}" style="color:#53535f;text-decoration:none">{{.Event.UserName}} was live for {{.Duration}}</a></h2>
+<p style="margin:0 0 12px">{{.Event.Title}}</p>
+<p style="margin:0"><strong>Game:</strong> {{.Event.GameName}}<br><strong>Peak viewers:</strong> {{.Event.PeakViewers}}</p>`)
+
+var digestTemplate = newTemplate(`Went live in the last hour:
+{{range .}}
+{{.UserName}} - {{.GameName}}
+{{.Title}}
+{{.StreamURL}}
+{{end}}`, `<h2 style="margin:0 0 16px">Went live in the last hour</h2>
+{{range .}}<p style="margin:0 0 16px"><a href="{{.StreamURL}}" style="color:#9146ff;font-weight:bold;text-decoration:none">{{.UserName}}</a> &middot; {{.GameName}}<br>{{.Title}}</p>
+{{end}}`)
+
+var verifyTemplate = newTemplate(`Confirm that you want Twitch Watcher to email this address when {{.Target}} goes live:
+
+{{.VerifyURL}}
+
+The link expires on {{.Expires}}. If you did not ask for these alerts, ignore this email and nothing will be sent.
+`, `<h2 style="margin:0 0 8px">Confirm your email alerts</h2>
+<p style="margin:0 0 16px">Confirm that you want Twitch Watcher to email this address when {{.Target}} goes live.</p>
+<p style="margin:0 0 16px"><a href="{{.VerifyURL}}" style="display:inline-block;padding:10px 16px;background:#9146ff;color:#ffffff;text-decoration:none;border-radius:4px">Confirm</a></p>
+<p style="margin:0;color:#53535f">The link expires on {{.Expires}}. If you did not ask for these alerts, ignore this email and nothing will be sent.</p>`)
+
+// renderLive renders the email for a stream notification, carrying the same
+// details as the Discord embed.
+func renderLive(p models.NotificationPayload) (message, error) {
+	return liveTemplate.render(fmt.Sprintf("%s is live on Twitch!", p.UserName), p)
+}
+
+// renderEnded renders the email for a stream that went offline.
+func renderEnded(e models.StreamEndedEvent) (message, error) {
+	duration := format.Duration(time.Duration(e.DurationSeconds) * time.Second)
+	data := struct {
+		Event    models.StreamEndedEvent
+		Duration string
+	}{e, duration}
+	return endedTemplate.render(fmt.Sprintf("%s was live for %s", e.UserName, duration), data)
+}
+
+// renderDigest renders one email listing the streams in payloads, oldest
+// first. A stream matched by several subscriptions is listed once.
+func renderDigest(payloads []models.NotificationPayload) (message, error) {
+	var streams []models.NotificationPayload
+	for _, p := range payloads {
+		i := slices.IndexFunc(streams, func(s models.NotificationPayload) bool { return s.StreamID == p.StreamID })
+		if i >= 0 {
+			streams[i] = p
+			continue
+		}
+		streams = append(streams, p)
+	}
+	slices.SortStableFunc(streams, func(a, b models.NotificationPayload) int { return a.StartedAt.Compare(b.StartedAt) })
+
+	subject := fmt.Sprintf("%d streams went live", len(streams))
+	if len(streams) == 1 {
+		subject = fmt.Sprintf("%s went live", streams[0].UserName)
+	}
+	return digestTemplate.render(subject, streams)
+}
+
+// renderVerification renders the email carrying a subscription's confirmation link.
+func renderVerification(e models.EmailVerificationEvent) (message, error) {
+	target := e.WatchTarget
+	if e.WatchType == models.WatchTypeGame {
+		target = "a stream of " + e.WatchTarget
+	}
+	data := struct {
+		Target    string
+		VerifyURL string
+		Expires   string
+	}{target, e.VerifyURL, e.ExpiresAt.UTC().Format("2 Jan 2006 15:04 MST")}
+	return verifyTemplate.render("Confirm your Twitch Watcher email alerts", data)
+}
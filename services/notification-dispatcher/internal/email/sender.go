@@ -0,0 +1,287 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+)
+
+// TLS modes for the connection to the SMTP server.
+const (
+	TLSStartTLS = "starttls" // upgrade a plain connection; fails if the server does not offer STARTTLS
+	TLSImplicit = "tls"      // TLS from the first byte, usually on port 465
+	TLSNone     = "none"     // plain text, only for a relay on the same host or network
+)
+
+// sessionTimeout bounds one SMTP session, from dialling to QUIT.
+const sessionTimeout = 30 * time.Second
+
+// Kinds of message, mixed into Message-IDs.
+const (
+	kindLive  = "live"
+	kindEnded = "ended"
+)
+
+// Config describes the SMTP server mail is submitted to.
+type Config struct {
+	Host     string
+	Port     int
+	Username string // no authentication if empty
+	Password string
+	From     string // e.g. "Twitch Watcher <alerts@example.com>"
+	TLS      string // one of TLSStartTLS, TLSImplicit or TLSNone
+}
+
+// errNotConfigured is returned for every send when no SMTP server is set.
+var errNotConfigured = errors.New("email delivery is not configured")
+
+// Sender sends notification emails through an SMTP server. Each email is
+// multipart/alternative with a plain-text and an HTML rendering.
+type Sender struct {
+	cfg       Config
+	from      *mail.Address
+	tlsConfig *tls.Config
+}
+
+// New creates a Sender. A Sender with no Host is valid but fails every send,
+// so the dispatcher can run without email support.
+func New(cfg Config) (*Sender, error) {
+	s := &Sender{cfg: cfg, tlsConfig: &tls.Config{ServerName: cfg.Host}}
+	if cfg.Host == "" {
+		return s, nil
+	}
+	if cfg.TLS == "" {
+		s.cfg.TLS = TLSStartTLS
+	}
+	if s.cfg.TLS != TLSStartTLS && s.cfg.TLS != TLSImplicit && s.cfg.TLS != TLSNone {
+		return nil, fmt.Errorf("unknown SMTP TLS mode %q", cfg.TLS)
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("parse SMTP from address: %w", err)
+	}
+	s.from = from
+	return s, nil
+}
+
+// Send emails a go-live notification.
+func (s *Sender) Send(ctx context.Context, payload models.NotificationPayload) error {
+	to, err := address(payload.DestinationConfig)
+	if err != nil {
+		return err
+	}
+	msg, err := renderLive(payload)
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, to, messageID(payload.SubscriptionID, payload.StreamID, kindLive), msg)
+}
+
+// SendEnded emails a "was live for" summary of a stream that went offline.
+func (s *Sender) SendEnded(ctx context.Context, ref models.SubscriptionRef, event models.StreamEndedEvent) error {
+	to, err := address(ref.DestinationConfig)
+	if err != nil {
+		return err
+	}
+	msg, err := renderEnded(event)
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, to, messageID(ref.SubscriptionID, event.StreamID, kindEnded), msg)
+}
+
+// SendDigest emails one summary of the streams in payloads, which may come
+// from several subscriptions to the same address.
+func (s *Sender) SendDigest(ctx context.Context, to string, payloads []models.NotificationPayload) error {
+	msg, err := renderDigest(payloads)
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, to, "", msg)
+}
+
+// SendVerification emails the confirmation link of a new email subscription.
+func (s *Sender) SendVerification(ctx context.Context, event models.EmailVerificationEvent) error {
+	msg, err := renderVerification(event)
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, event.Address, "", msg)
+}
+
+// messageID derives the local part of a Message-ID from the subscription,
+// the stream and the kind of message, so a notification redelivered by
+// JetStream carries the same Message-ID and mail clients can drop it.
+func messageID(subscriptionID, streamID, kind string) string {
+	sum := sha256.Sum256([]byte(subscriptionID + "\x00" + streamID + "\x00" + kind))
+	return "tw-" + hex.EncodeToString(sum[:16])
+}
+
+// send submits msg to the SMTP server with notifier.Retry. Network errors and
+// 4xx replies are retried with exponential backoff; 5xx replies are not
+// retried, and a 5xx rejecting the recipient is a notifier.InvalidWebhookError.
+func (s *Sender) send(ctx context.Context, to, localID string, msg message) error {
+	if s.cfg.Host == "" {
+		return errNotConfigured
+	}
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return &notifier.InvalidWebhookError{Destination: "email address", Message: "malformed address"}
+	}
+	data, err := s.compose(rcpt, localID, msg)
+	if err != nil {
+		return err
+	}
+
+	return notifier.Retry(ctx, func() error {
+		err := s.transmit(ctx, rcpt.Address, data)
+		var reply *textproto.Error
+		if errors.As(err, &reply) && reply.Code >= 500 {
+			return notifier.Permanent(err)
+		}
+		return err
+	})
+}
+
+// transmit runs one SMTP session delivering data to rcpt.
+func (s *Sender) transmit(ctx context.Context, rcpt string, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, sessionTimeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	var err error
+	if s.cfg.TLS == TLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: s.tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("smtp dial: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp greeting: %w", err)
+	}
+	defer c.Close()
+
+	if s.cfg.TLS == TLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not offer STARTTLS")
+		}
+		if err := c.StartTLS(s.tlsConfig); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+	if s.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := c.Mail(s.from.Address); err != nil {
+		return fmt.Errorf("smtp MAIL FROM: %w", err)
+	}
+	if err := c.Rcpt(rcpt); err != nil {
+		var reply *textproto.Error
+		if errors.As(err, &reply) && rejectsMailbox(reply.Code) {
+			return &notifier.InvalidWebhookError{Destination: "email address", StatusCode: reply.Code, Message: reply.Msg}
+		}
+		return fmt.Errorf("smtp RCPT TO: %w", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	return c.Quit()
+}
+
+// rejectsMailbox reports whether an RCPT reply code means the mailbox does
+// not exist or will never accept mail: 550 (unavailable), 551 (not local)
+// or 553 (name not allowed).
+func rejectsMailbox(code int) bool {
+	return code == 550 || code == 551 || code == 553
+}
+
+// compose renders msg as a MIME message to rcpt. localID, if set, becomes the
+// local part of the Message-ID; otherwise a random one is used.
+func (s *Sender) compose(rcpt *mail.Address, localID string, msg message) ([]byte, error) {
+	domain := s.from.Address[strings.LastIndexByte(s.from.Address, '@')+1:]
+	if localID == "" {
+		localID = strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	header := func(key, value string) { fmt.Fprintf(&b, "%s: %s\r\n", key, value) }
+	header("From", s.from.String())
+	header("To", rcpt.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+localID+"@"+domain+">")
+	header("Auto-Submitted", "auto-generated")
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	b.WriteString("\r\n")
+
+	// Clients show the last alternative they can render, so HTML goes last.
+	parts := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	}
+	for _, part := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("compose email: %w", err)
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, fmt.Errorf("compose email: %w", err)
+		}
+		if err := qp.Close(); err != nil {
+			return nil, fmt.Errorf("compose email: %w", err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("compose email: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// address returns the mailbox of an email subscription.
+func address(cfg *models.DestinationConfig) (string, error) {
+	if cfg == nil || cfg.Email == nil || cfg.Email.Address == "" {
+		return "", notifier.Permanent(errors.New("email subscription has no address"))
+	}
+	return cfg.Email.Address, nil
+}
@@ -0,0 +1,227 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+)
+
+func testPayload() models.NotificationPayload {
+	return models.NotificationPayload{
+		SubscriptionID:    "sub-1",
+		DestinationType:   models.DestinationEmail,
+		DestinationConfig: &models.DestinationConfig{Email: &models.EmailConfig{Address: "viewer@example.com"}},
+		StreamID:          "stream-1",
+		UserName:          "Streamer",
+		GameName:          "Fortnite",
+		Title:             "Ranked <3",
+		ViewerCount:       42,
+		StreamURL:         "https://twitch.tv/streamer",
+		ThumbnailURL:      "https://static-cdn.jtvnw.net/previews-ttv/live_user_streamer-440x248.jpg",
+	}
+}
+
+// smtpServer is a minimal SMTP server that answers RCPT with rcptReply and
+// records the message data it receives.
+type smtpServer struct {
+	addr      string
+	rcptReply string
+	data      chan string
+}
+
+func newSMTPServer(t *testing.T, rcptReply string) *smtpServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &smtpServer{addr: ln.Addr().String(), rcptReply: rcptReply, data: make(chan string, 1)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	tc := textproto.NewConn(conn)
+	tc.PrintfLine("220 localhost ready")
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		switch verb, _, _ := strings.Cut(line, " "); strings.ToUpper(verb) {
+		case "EHLO":
+			tc.PrintfLine("250 localhost")
+		case "MAIL":
+			tc.PrintfLine("250 OK")
+		case "RCPT":
+			tc.PrintfLine("%s", s.rcptReply)
+		case "DATA":
+			tc.PrintfLine("354 go ahead")
+			body, _ := io.ReadAll(tc.DotReader())
+			s.data <- string(body)
+			tc.PrintfLine("250 queued")
+		case "QUIT":
+			tc.PrintfLine("221 bye")
+			return
+		default:
+			tc.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func newTestSender(t *testing.T, addr string) *Sender {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(addr)
+	p, _ := strconv.Atoi(port)
+	s, err := New(Config{Host: host, Port: p, From: "Twitch Watcher <alerts@example.com>", TLS: TLSNone})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return s
+}
+
+func TestSend_MultipartAlternative(t *testing.T) {
+	srv := newSMTPServer(t, "250 OK")
+
+	if err := newTestSender(t, srv.addr).Send(context.Background(), testPayload()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var raw string
+	select {
+	case raw = <-srv.data:
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	if got := msg.Header.Get("Subject"); got != "Streamer is live on Twitch!" {
+		t.Errorf("Subject = %q", got)
+	}
+	if got, want := msg.Header.Get("Message-ID"), "<"+messageID("sub-1", "stream-1", kindLive)+"@example.com>"; got != want {
+		t.Errorf("Message-ID = %q, want %q", got, want)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q", msg.Header.Get("Content-Type"))
+	}
+	parts := map[string]string{}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		body, _ := io.ReadAll(p) // quoted-printable is decoded by the reader
+		ct, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		parts[ct] = string(body)
+	}
+	if !strings.Contains(parts["text/plain"], "Ranked <3") || !strings.Contains(parts["text/plain"], "Viewers: 42") {
+		t.Errorf("text part = %q", parts["text/plain"])
+	}
+	if !strings.Contains(parts["text/html"], "Ranked &lt;3") || !strings.Contains(parts["text/html"], "live_user_streamer-440x248.jpg") {
+		t.Errorf("html part = %q", parts["text/html"])
+	}
+}
+
+func TestSend_RejectedMailbox(t *testing.T) {
+	srv := newSMTPServer(t, "550 5.1.1 mailbox unavailable")
+
+	err := newTestSender(t, srv.addr).Send(context.Background(), testPayload())
+	var invalid *notifier.InvalidWebhookError
+	if !errors.As(err, &invalid) || invalid.StatusCode != 550 {
+		t.Fatalf("got error %v, want InvalidWebhookError 550", err)
+	}
+}
+
+func TestSend_NotConfigured(t *testing.T) {
+	s, err := New(Config{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := s.Send(context.Background(), testPayload()); !errors.Is(err, errNotConfigured) {
+		t.Errorf("got error %v, want errNotConfigured", err)
+	}
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	if _, err := New(Config{Host: "smtp.example.com", From: "not an address"}); err == nil {
+		t.Error("accepted a malformed from address")
+	}
+	if _, err := New(Config{Host: "smtp.example.com", From: "alerts@example.com", TLS: "ssl"}); err == nil {
+		t.Error("accepted an unknown TLS mode")
+	}
+}
+
+func TestRenderDigest_DedupesStreams(t *testing.T) {
+	early, late := testPayload(), testPayload()
+	late.StreamID, late.UserName, late.StartedAt = "stream-2", "Later", time.Unix(200, 0)
+	early.StartedAt = time.Unix(100, 0)
+	again := early
+	again.SubscriptionID, again.ViewerCount = "sub-2", 99
+
+	msg, err := renderDigest([]models.NotificationPayload{late, early, again})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Subject != "2 streams went live" {
+		t.Errorf("Subject = %q", msg.Subject)
+	}
+	if strings.Count(msg.Text, "Streamer - Fortnite") != 1 {
+		t.Errorf("stream listed more than once:\n%s", msg.Text)
+	}
+	if strings.Index(msg.Text, "Streamer") > strings.Index(msg.Text, "Later") {
+		t.Errorf("streams not in start order:\n%s", msg.Text)
+	}
+}
+
+func TestRenderVerification(t *testing.T) {
+	msg, err := renderVerification(models.EmailVerificationEvent{
+		Address:     "viewer@example.com",
+		WatchType:   models.WatchTypeStreamer,
+		WatchTarget: "streamer",
+		VerifyURL:   "https://watcher.example.com/v1/email/verify?token=abc",
+		ExpiresAt:   time.Date(2026, 1, 2, 3, 4, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(msg.Text, "https://watcher.example.com/v1/email/verify?token=abc") {
+		t.Errorf("text = %q", msg.Text)
+	}
+	if !strings.Contains(msg.HTML, `href="https://watcher.example.com/v1/email/verify?token=abc"`) {
+		t.Errorf("html = %q", msg.HTML)
+	}
+	if !strings.Contains(msg.Text, "2 Jan 2026 03:04 UTC") {
+		t.Errorf("expiry missing from %q", msg.Text)
+	}
+}
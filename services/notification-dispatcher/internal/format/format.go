@@ -0,0 +1,17 @@
+// Package format holds the text formatting shared by the notification senders.
+package format
+
+import (
+	"fmt"
+	"time"
+)
+
+// Duration renders d as e.g. "3h 12m", or "45m" under an hour.
+func Duration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	h, m := int(d.Hours()), int(d.Minutes())%60
+	if h == 0 {
+		return fmt.Sprintf("%dm", m)
+	}
+	return fmt.Sprintf("%dh %dm", h, m)
+}
@@ -0,0 +1,20 @@
+package format
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDuration(t *testing.T) {
+	cases := map[time.Duration]string{
+		45 * time.Minute:                              "45m",
+		3*time.Hour + 12*time.Minute:                  "3h 12m",
+		time.Hour + 29*time.Second:                    "1h 0m",
+		2*time.Hour + 59*time.Minute + 31*time.Second: "3h 0m",
+	}
+	for d, want := range cases {
+		if got := Duration(d); got != want {
+			t.Errorf("Duration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
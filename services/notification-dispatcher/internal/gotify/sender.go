@@ -0,0 +1,170 @@
+package gotify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/netguard"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/format"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+)
+
+// priorityLow is used for ended messages; Gotify clients stay silent below 4.
+const priorityLow = 2
+
+// message is the body of a POST /message request.
+type message struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority,omitzero"`
+	Extras   extras `json:"extras"`
+}
+
+// extras are the message extras understood by the Gotify clients.
+type extras struct {
+	Display      display      `json:"client::display"`
+	Notification notification `json:"client::notification"`
+}
+
+type display struct {
+	ContentType string `json:"contentType"`
+}
+
+type notification struct {
+	Click       click  `json:"click"`
+	BigImageURL string `json:"bigImageUrl,omitempty"`
+}
+
+type click struct {
+	URL string `json:"url"`
+}
+
+// apiError is the JSON error body Gotify returns.
+type apiError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"errorDescription"`
+}
+
+// Sender pushes notifications to Gotify applications.
+type Sender struct {
+	httpClient *http.Client
+}
+
+// New creates a Sender. It only connects to publicly routable addresses
+// unless an option replaces its transport.
+func New(opts ...notifier.Option) *Sender {
+	return &Sender{httpClient: notifier.NewHTTPClient(opts...)}
+}
+
+// Send pushes a go-live notification. Tapping it opens the stream.
+func (s *Sender) Send(ctx context.Context, payload models.NotificationPayload) error {
+	cfg, err := config(payload.DestinationConfig)
+	if err != nil {
+		return err
+	}
+	return s.push(ctx, cfg, buildMessage(cfg, payload))
+}
+
+// SendEnded pushes a low-priority "was live for" summary of a stream that went offline.
+func (s *Sender) SendEnded(ctx context.Context, ref models.SubscriptionRef, event models.StreamEndedEvent) error {
+	cfg, err := config(ref.DestinationConfig)
+	if err != nil {
+		return err
+	}
+	return s.push(ctx, cfg, buildEndedMessage(event))
+}
+
+// push POSTs msg to the server's message endpoint with notifier.Retry. Gotify
+// sends no Retry-After, so 429s are retried like 5xx responses and network
+// errors, with exponential backoff.
+func (s *Sender) push(ctx context.Context, cfg *models.GotifyConfig, msg message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal gotify message: %w", err)
+	}
+	base, err := url.Parse(cfg.ServerURL)
+	if err != nil {
+		return fmt.Errorf("parse gotify server URL: %w", err)
+	}
+	target := base.JoinPath("message").String()
+
+	return notifier.Retry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+		if err != nil {
+			return notifier.Permanent(fmt.Errorf("build gotify request: %w", err))
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Gotify-Key", cfg.AppToken)
+
+		resp, err := s.httpClient.Do(req)
+		if errors.Is(err, netguard.ErrForbidden) {
+			return notifier.Permanent(fmt.Errorf("gotify push: %w", err))
+		}
+		if err != nil {
+			return fmt.Errorf("gotify push: %w", err)
+		}
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		var apiErr apiError
+		_ = json.Unmarshal(respBody, &apiErr)
+		reason := apiErr.ErrorDescription
+		if reason == "" {
+			reason = http.StatusText(resp.StatusCode)
+		}
+
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			return nil
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			return &notifier.InvalidWebhookError{Destination: "gotify application", StatusCode: resp.StatusCode, Message: reason}
+		case resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500:
+			return notifier.Permanent(fmt.Errorf("gotify server returned %d: %s", resp.StatusCode, reason))
+		}
+		return fmt.Errorf("gotify server returned %d", resp.StatusCode)
+	})
+}
+
+// config returns the Gotify settings of a subscription.
+func config(cfg *models.DestinationConfig) (*models.GotifyConfig, error) {
+	if cfg == nil || cfg.Gotify == nil || cfg.Gotify.ServerURL == "" || cfg.Gotify.AppToken == "" {
+		return nil, notifier.Permanent(errors.New("gotify subscription has no server URL or application token"))
+	}
+	return cfg.Gotify, nil
+}
+
+// buildMessage constructs the message for a stream notification, carrying the
+// same details as the Discord embed. The thumbnail is shown in the expanded
+// Android notification.
+func buildMessage(cfg *models.GotifyConfig, p models.NotificationPayload) message {
+	return message{
+		Title:    fmt.Sprintf("%s is live on Twitch!", p.UserName),
+		Message:  fmt.Sprintf("%s\nGame: %s · Viewers: %d\n%s", p.Title, p.GameName, p.ViewerCount, p.StreamURL),
+		Priority: cfg.Priority,
+		Extras: extras{
+			Display:      display{ContentType: "text/plain"},
+			Notification: notification{Click: click{URL: p.StreamURL}, BigImageURL: p.ThumbnailURL},
+		},
+	}
+}
+
+// buildEndedMessage constructs the message for a stream that went offline.
+func buildEndedMessage(e models.StreamEndedEvent) message {
+	return message{
+		Title: fmt.Sprintf("%s was live for %s", e.UserName, format.Duration(time.Duration(e.DurationSeconds)*time.Second)),
+		Message: fmt.Sprintf("%s\nGame: %s · Peak viewers: %d\n%s",
+			e.Title, e.GameName, e.PeakViewers, e.StreamURL),
+		Priority: priorityLow,
+		Extras: extras{
+			Display:      display{ContentType: "text/plain"},
+			Notification: notification{Click: click{URL: e.StreamURL}},
+		},
+	}
+}
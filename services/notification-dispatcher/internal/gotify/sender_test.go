@@ -0,0 +1,70 @@
+package gotify
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier/notifiertest"
+)
+
+func testPayload(server string) models.NotificationPayload {
+	p := notifiertest.Payload()
+	p.DestinationType = models.DestinationGotify
+	p.DestinationConfig = &models.DestinationConfig{Gotify: &models.GotifyConfig{
+		ServerURL: server + "/gotify",
+		AppToken:  "AbCdEf.GhIjKlMn",
+	}}
+	return p
+}
+
+func TestSend_PostsMessageWithExtras(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/gotify/message" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if key := r.Header.Get("X-Gotify-Key"); key != "AbCdEf.GhIjKlMn" {
+			t.Errorf("X-Gotify-Key = %q", key)
+		}
+		_ = json.UnmarshalRead(r.Body, &got)
+		io.WriteString(w, `{"id":1}`)
+	}))
+	defer srv.Close()
+
+	if err := New(notifiertest.AllowLoopback).Send(context.Background(), testPayload(srv.URL)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got["title"] != "Streamer is live on Twitch!" {
+		t.Errorf("title = %v", got["title"])
+	}
+	if _, ok := got["priority"]; ok {
+		t.Error("priority sent although the subscription left it to the application default")
+	}
+	extras, _ := got["extras"].(map[string]any)
+	notification, _ := extras["client::notification"].(map[string]any)
+	click, _ := notification["click"].(map[string]any)
+	if click["url"] != "https://twitch.tv/streamer" || notification["bigImageUrl"] == nil {
+		t.Errorf("extras = %v", extras)
+	}
+}
+
+func TestSend_Unauthorized(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error":"Unauthorized","errorCode":401,"errorDescription":"you need to provide a valid access token or user credentials to access this api"}`)
+	}))
+	defer srv.Close()
+
+	err := New(notifiertest.AllowLoopback).Send(context.Background(), testPayload(srv.URL))
+	var invalid *notifier.InvalidWebhookError
+	if !errors.As(err, &invalid) || invalid.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("got error %v, want InvalidWebhookError", err)
+	}
+}
@@ -0,0 +1,185 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/netguard"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/format"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+)
+
+// Kinds of message, mixed into transaction IDs so a stream's go-live and
+// ended messages are distinct events.
+const (
+	kindLive  = "live"
+	kindEnded = "ended"
+)
+
+// roomMessage is the content of an m.room.message event.
+type roomMessage struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format"`
+	FormattedBody string `json:"formatted_body"`
+}
+
+// apiError is the JSON error body of the client-server API.
+type apiError struct {
+	ErrCode      string `json:"errcode"`
+	Error        string `json:"error"`
+	RetryAfterMS int64  `json:"retry_after_ms"`
+}
+
+// Sender posts notifications into Matrix rooms through the client-server API.
+type Sender struct {
+	httpClient *http.Client
+}
+
+// New creates a Sender. It only connects to publicly routable addresses
+// unless an option replaces its transport.
+func New(opts ...notifier.Option) *Sender {
+	return &Sender{httpClient: notifier.NewHTTPClient(opts...)}
+}
+
+// Send posts a go-live message to the subscription's room.
+func (s *Sender) Send(ctx context.Context, payload models.NotificationPayload) error {
+	cfg, err := config(payload.DestinationConfig)
+	if err != nil {
+		return err
+	}
+	txnID := TxnID(payload.SubscriptionID, payload.StreamID, kindLive)
+	return s.send(ctx, cfg, txnID, buildMessage(payload))
+}
+
+// SendEnded posts a "was live for" summary of a stream that went offline.
+func (s *Sender) SendEnded(ctx context.Context, ref models.SubscriptionRef, event models.StreamEndedEvent) error {
+	cfg, err := config(ref.DestinationConfig)
+	if err != nil {
+		return err
+	}
+	txnID := TxnID(ref.SubscriptionID, event.StreamID, kindEnded)
+	return s.send(ctx, cfg, txnID, buildEndedMessage(event))
+}
+
+// TxnID derives the transaction ID of a message from the subscription, the
+// stream and the kind of message. Homeservers return the original event for
+// a repeated transaction ID, so a message redelivered by JetStream is not
+// posted twice.
+func TxnID(subscriptionID, streamID, kind string) string {
+	sum := sha256.Sum256([]byte(subscriptionID + "\x00" + streamID + "\x00" + kind))
+	return "tw-" + hex.EncodeToString(sum[:16])
+}
+
+// send PUTs msg as an m.room.message event with notifier.Retry: 429s are
+// retried after the retry_after_ms the homeserver asks for, 5xx responses and
+// network errors with exponential backoff. Retries reuse txnID, so they are
+// idempotent.
+func (s *Sender) send(ctx context.Context, cfg *models.MatrixConfig, txnID string, msg roomMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal matrix message: %w", err)
+	}
+	base, err := url.Parse(cfg.HomeserverURL)
+	if err != nil {
+		return fmt.Errorf("parse matrix homeserver URL: %w", err)
+	}
+	target := base.JoinPath("_matrix/client/v3/rooms", cfg.RoomID, "send/m.room.message", txnID).String()
+
+	return notifier.Retry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, bytes.NewReader(body))
+		if err != nil {
+			return notifier.Permanent(fmt.Errorf("build matrix request: %w", err))
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+cfg.AccessToken)
+
+		resp, err := s.httpClient.Do(req)
+		if errors.Is(err, netguard.ErrForbidden) {
+			return notifier.Permanent(fmt.Errorf("matrix send: %w", err))
+		}
+		if err != nil {
+			return fmt.Errorf("matrix send: %w", err)
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		var apiErr apiError
+		_ = json.Unmarshal(respBody, &apiErr)
+
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			return nil
+		case resp.StatusCode == http.StatusTooManyRequests:
+			return &notifier.RateLimitedError{
+				Destination: "matrix homeserver",
+				After:       time.Duration(apiErr.RetryAfterMS) * time.Millisecond,
+			}
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden ||
+			resp.StatusCode == http.StatusNotFound:
+			return &notifier.InvalidWebhookError{Destination: "matrix room", StatusCode: resp.StatusCode, Message: describe(resp.StatusCode, apiErr)}
+		case resp.StatusCode < 500:
+			return notifier.Permanent(fmt.Errorf("matrix homeserver returned %d: %s", resp.StatusCode, describe(resp.StatusCode, apiErr)))
+		}
+		return fmt.Errorf("matrix homeserver returned %d", resp.StatusCode)
+	})
+}
+
+// describe renders an API error as e.g. "M_FORBIDDEN: User not in room".
+func describe(status int, e apiError) string {
+	switch {
+	case e.ErrCode != "" && e.Error != "":
+		return e.ErrCode + ": " + e.Error
+	case e.ErrCode != "":
+		return e.ErrCode
+	}
+	return http.StatusText(status)
+}
+
+// config returns the Matrix settings of a subscription.
+func config(cfg *models.DestinationConfig) (*models.MatrixConfig, error) {
+	if cfg == nil || cfg.Matrix == nil || cfg.Matrix.HomeserverURL == "" || cfg.Matrix.RoomID == "" {
+		return nil, notifier.Permanent(errors.New("matrix subscription has no homeserver or room ID"))
+	}
+	return cfg.Matrix, nil
+}
+
+// buildMessage constructs the message for a stream notification, carrying
+// the same details as the Discord embed. Inline images must be uploaded to
+// the homeserver first, so the thumbnail is left out.
+func buildMessage(p models.NotificationPayload) roomMessage {
+	headline := fmt.Sprintf("%s is live on Twitch!", p.UserName)
+	return roomMessage{
+		MsgType: "m.text",
+		Body: fmt.Sprintf("%s %s\n%s\nGame: %s\nViewers: %d",
+			headline, p.StreamURL, p.Title, p.GameName, p.ViewerCount),
+		Format: "org.matrix.custom.html",
+		FormattedBody: fmt.Sprintf(`<strong><a href="%s">%s</a></strong><br>%s<br><strong>Game:</strong> %s<br><strong>Viewers:</strong> %d`,
+			html.EscapeString(p.StreamURL), html.EscapeString(headline), html.EscapeString(p.Title),
+			html.EscapeString(p.GameName), p.ViewerCount),
+	}
+}
+
+// buildEndedMessage constructs the message for a stream that went offline.
+func buildEndedMessage(e models.StreamEndedEvent) roomMessage {
+	headline := fmt.Sprintf("%s was live for %s", e.UserName, format.Duration(time.Duration(e.DurationSeconds)*time.Second))
+	return roomMessage{
+		MsgType: "m.text",
+		Body: fmt.Sprintf("%s %s\n%s\nGame: %s\nPeak viewers: %d",
+			headline, e.StreamURL, e.Title, e.GameName, e.PeakViewers),
+		Format: "org.matrix.custom.html",
+		FormattedBody: fmt.Sprintf(`<strong><a href="%s">%s</a></strong><br>%s<br><strong>Game:</strong> %s<br><strong>Peak viewers:</strong> %d`,
+			html.EscapeString(e.StreamURL), html.EscapeString(headline), html.EscapeString(e.Title),
+			html.EscapeString(e.GameName), e.PeakViewers),
+	}
+}
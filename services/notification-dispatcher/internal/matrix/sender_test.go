@@ -0,0 +1,103 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier/notifiertest"
+)
+
+func testPayload(homeserver string) models.NotificationPayload {
+	p := notifiertest.Payload()
+	p.DestinationType = models.DestinationMatrix
+	p.DestinationConfig = &models.DestinationConfig{Matrix: &models.MatrixConfig{
+		HomeserverURL: homeserver,
+		RoomID:        "!room:example.org",
+		AccessToken:   "syt_token",
+	}}
+	p.Title = "Ranked <3"
+	return p
+}
+
+func TestSend_PutsRoomMessage(t *testing.T) {
+	var got roomMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want := "/_matrix/client/v3/rooms/!room:example.org/send/m.room.message/" + TxnID("sub-1", "stream-1", kindLive)
+		if r.Method != http.MethodPut || r.URL.Path != want {
+			t.Errorf("unexpected request %s %s, want PUT %s", r.Method, r.URL.Path, want)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer syt_token" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		_ = json.UnmarshalRead(r.Body, &got)
+		io.WriteString(w, `{"event_id":"$abc"}`)
+	}))
+	defer srv.Close()
+
+	if err := New(notifiertest.AllowLoopback).Send(context.Background(), testPayload(srv.URL)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Format != "org.matrix.custom.html" || !strings.Contains(got.FormattedBody, "Ranked &lt;3") {
+		t.Errorf("formatted body = %q", got.FormattedBody)
+	}
+	if !strings.Contains(got.Body, "Streamer is live on Twitch!") {
+		t.Errorf("body = %q", got.Body)
+	}
+}
+
+func TestSend_RetriesReuseTxnID(t *testing.T) {
+	var calls atomic.Int32
+	var first atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			first.Store(r.URL.Path)
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, `{"errcode":"M_LIMIT_EXCEEDED","error":"Too many requests","retry_after_ms":50}`)
+			return
+		}
+		if r.URL.Path != first.Load() {
+			t.Errorf("retry path %s, want %s", r.URL.Path, first.Load())
+		}
+		io.WriteString(w, `{"event_id":"$abc"}`)
+	}))
+	defer srv.Close()
+
+	if err := New(notifiertest.AllowLoopback).Send(context.Background(), testPayload(srv.URL)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("calls = %d, want 2", got)
+	}
+}
+
+func TestSend_UnusableRoom(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"errcode":"M_FORBIDDEN","error":"User @bot:example.org not in room"}`)
+	}))
+	defer srv.Close()
+
+	err := New(notifiertest.AllowLoopback).Send(context.Background(), testPayload(srv.URL))
+	var invalid *notifier.InvalidWebhookError
+	if !errors.As(err, &invalid) || invalid.Message != "M_FORBIDDEN: User @bot:example.org not in room" {
+		t.Errorf("err = %v, want InvalidWebhookError", err)
+	}
+}
+
+func TestTxnID_DistinguishesKinds(t *testing.T) {
+	if TxnID("sub-1", "stream-1", kindLive) == TxnID("sub-1", "stream-1", kindEnded) {
+		t.Error("live and ended messages share a transaction ID")
+	}
+	if TxnID("sub-1", "stream-1", kindLive) != TxnID("sub-1", "stream-1", kindLive) {
+		t.Error("transaction ID is not stable")
+	}
+}
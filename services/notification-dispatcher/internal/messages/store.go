@@ -0,0 +1,118 @@
+package messages
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// messageTTL outlives any realistic stream; the key is deleted when the stream ends.
+const messageTTL = 72 * time.Hour
+
+// endedTTL outlives JetStream's redeliveries of a StreamEndedEvent.
+const endedTTL = 24 * time.Hour
+
+// invalidTTL is how long one report of an unusable webhook stands for the
+// messages still queued for it, on every replica.
+const invalidTTL = 10 * time.Minute
+
+// Store remembers which message announced a stream to a subscription, so the
+// message can be edited as the stream changes. IDs are those returned by a
+// notifier.Editor.
+type Store struct {
+	cache *redis.Client
+}
+
+// New creates a Store.
+func New(cache *redis.Client) *Store {
+	return &Store{cache: cache}
+}
+
+func key(subscriptionID, streamID string) string {
+	return fmt.Sprintf("discord:msg:%s:%s", subscriptionID, streamID)
+}
+
+// Save records the message ID for a subscription's stream announcement.
+func (s *Store) Save(ctx context.Context, subscriptionID, streamID, messageID string) error {
+	k := key(subscriptionID, streamID)
+	if err := s.cache.Set(ctx, k, messageID, messageTTL).Err(); err != nil {
+		return fmt.Errorf("valkey SET %s: %w", k, err)
+	}
+	return nil
+}
+
+// Get returns the stored message ID, or "" if there is none.
+func (s *Store) Get(ctx context.Context, subscriptionID, streamID string) (string, error) {
+	k := key(subscriptionID, streamID)
+	id, err := s.cache.Get(ctx, k).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("valkey GET %s: %w", k, err)
+	}
+	return id, nil
+}
+
+func endedKey(subscriptionID, streamID string) string {
+	return fmt.Sprintf("ended:%s:%s", subscriptionID, streamID)
+}
+
+// MarkEnded records that a subscription has been told its stream ended, so a
+// redelivered StreamEndedEvent is not sent to it again.
+func (s *Store) MarkEnded(ctx context.Context, subscriptionID, streamID string) error {
+	k := endedKey(subscriptionID, streamID)
+	if err := s.cache.Set(ctx, k, 1, endedTTL).Err(); err != nil {
+		return fmt.Errorf("valkey SET %s: %w", k, err)
+	}
+	return nil
+}
+
+// Ended reports whether MarkEnded was called for a subscription's stream.
+func (s *Store) Ended(ctx context.Context, subscriptionID, streamID string) (bool, error) {
+	k := endedKey(subscriptionID, streamID)
+	n, err := s.cache.Exists(ctx, k).Result()
+	if err != nil {
+		return false, fmt.Errorf("valkey EXISTS %s: %w", k, err)
+	}
+	return n > 0, nil
+}
+
+// invalidKey hashes webhook, which may carry a token, out of the key.
+func invalidKey(webhook string) string {
+	sum := sha256.Sum256([]byte(webhook))
+	return "invalid:" + hex.EncodeToString(sum[:16])
+}
+
+// ClaimInvalid reports whether the caller is the first within invalidTTL to
+// find webhook unusable, and so the one to report it.
+func (s *Store) ClaimInvalid(ctx context.Context, webhook string) (bool, error) {
+	k := invalidKey(webhook)
+	ok, err := s.cache.SetNX(ctx, k, 1, invalidTTL).Result()
+	if err != nil {
+		return false, fmt.Errorf("valkey SET NX %s: %w", k, err)
+	}
+	return ok, nil
+}
+
+// ReleaseInvalid undoes ClaimInvalid, so the next failure reports webhook.
+func (s *Store) ReleaseInvalid(ctx context.Context, webhook string) error {
+	k := invalidKey(webhook)
+	if err := s.cache.Del(ctx, k).Err(); err != nil {
+		return fmt.Errorf("valkey DEL %s: %w", k, err)
+	}
+	return nil
+}
+
+// Delete forgets the message ID once the message no longer needs editing.
+func (s *Store) Delete(ctx context.Context, subscriptionID, streamID string) error {
+	k := key(subscriptionID, streamID)
+	if err := s.cache.Del(ctx, k).Err(); err != nil {
+		return fmt.Errorf("valkey DEL %s: %w", k, err)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package notifier
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/netguard"
+)
+
+// Option configures the HTTP client a sender builds with NewHTTPClient.
+type Option func(*http.Client)
+
+// WithTransport makes the client send through rt instead of a transport that
+// only connects to publicly routable addresses.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *http.Client) { c.Transport = rt }
+}
+
+// NewHTTPClient returns the client of a sender posting to user-supplied
+// destinations: it times out after 10 seconds and refuses internal addresses.
+func NewHTTPClient(opts ...Option) *http.Client {
+	c := &http.Client{Timeout: 10 * time.Second, Transport: netguard.Transport()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
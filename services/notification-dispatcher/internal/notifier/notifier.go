@@ -0,0 +1,121 @@
+// Package notifier defines how the dispatcher talks to a destination, so the
+// consumer can pick the implementation for each subscription's destination type.
+package notifier
+
+import (
+	"context"
+	"errors"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+)
+
+// Notifier delivers notifications to one type of destination.
+//
+// Errors returned by its methods are retried by redelivering the message,
+// unless they are Permanent or an InvalidError.
+type Notifier interface {
+	// Send delivers the notification for a stream that went live.
+	Send(ctx context.Context, payload models.NotificationPayload) error
+	// SendEnded delivers a separate "stream ended" message to ref.
+	SendEnded(ctx context.Context, ref models.SubscriptionRef, event models.StreamEndedEvent) error
+}
+
+// Editor is a Notifier that can rewrite the go-live message it sent as the
+// stream changes and when it ends. Message IDs are opaque to the consumer; an
+// Editor may encode whatever it needs to find the message again in them.
+type Editor interface {
+	Notifier
+	// SendEditable is Send, returning the ID of the message it posted.
+	SendEditable(ctx context.Context, payload models.NotificationPayload) (messageID string, err error)
+	// ReplyEnded is SendEnded for a subscription whose go-live message is
+	// messageID, so the ended message follows it, e.g. into its thread.
+	ReplyEnded(ctx context.Context, ref models.SubscriptionRef, messageID string, event models.StreamEndedEvent) error
+	// EditLive rewrites a message with the stream's current details.
+	EditLive(ctx context.Context, messageID string, payload models.NotificationPayload) error
+	// EditEnded rewrites a message with a "was live for" summary.
+	EditEnded(ctx context.Context, ref models.SubscriptionRef, messageID string, event models.StreamEndedEvent) error
+}
+
+// ErrUnknownMessage is returned by an Editor when the message being edited no
+// longer exists.
+var ErrUnknownMessage = errors.New("message not found")
+
+// InvalidError is implemented by errors meaning the destination itself is
+// permanently unusable, such as a deleted webhook or a revoked token. The
+// consumer stops sending to it and has its subscriptions deactivated.
+type InvalidError interface {
+	error
+	// Invalid returns the status code and reason the destination gave.
+	Invalid() (status int, reason string)
+}
+
+// Invalid unpacks the InvalidError in err's chain, if any.
+func Invalid(err error) (status int, reason string, ok bool) {
+	var invalid InvalidError
+	if !errors.As(err, &invalid) {
+		return 0, "", false
+	}
+	status, reason = invalid.Invalid()
+	return status, reason, true
+}
+
+// permanentError marks an error that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, such as a payload the destination
+// rejected. A nil err stays nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Retryable reports whether redelivering the notification that failed with
+// err could succeed: err is neither Permanent nor an InvalidError.
+func Retryable(err error) bool {
+	var permanent *permanentError
+	var invalid InvalidError
+	return !errors.As(err, &permanent) && !errors.As(err, &invalid)
+}
+
+// Registry maps destination types to their Notifier. Notifiers are registered
+// at startup; lookups are safe for concurrent use once registration is done.
+type Registry struct {
+	notifiers map[models.DestinationType]Notifier
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{notifiers: make(map[models.DestinationType]Notifier)}
+}
+
+// Register makes n the Notifier for destination type t, replacing any other.
+func (r *Registry) Register(t models.DestinationType, n Notifier) {
+	r.notifiers[t] = n
+}
+
+// Lookup returns the Notifier for destination type t. Subscriptions from before
+// destination types were added have none and are Discord's.
+func (r *Registry) Lookup(t models.DestinationType) (Notifier, bool) {
+	if t == "" {
+		t = models.DestinationDiscord
+	}
+	n, ok := r.notifiers[t]
+	return n, ok
+}
+
+// Editor returns the Notifier for destination type t if it is an Editor.
+func (r *Registry) Editor(t models.DestinationType) (Editor, bool) {
+	n, ok := r.Lookup(t)
+	if !ok {
+		return nil, false
+	}
+	e, ok := n.(Editor)
+	return e, ok
+}
@@ -0,0 +1,81 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+)
+
+type invalidErr struct{}
+
+func (invalidErr) Error() string          { return "webhook deleted" }
+func (invalidErr) Invalid() (int, string) { return 404, "Unknown Webhook" }
+
+func TestRetryable(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"plain", errors.New("connection reset"), true},
+		{"permanent", Permanent(errors.New("bad payload")), false},
+		{"wrapped permanent", fmt.Errorf("send: %w", Permanent(errors.New("bad payload"))), false},
+		{"invalid", fmt.Errorf("send: %w", invalidErr{}), false},
+	}
+	for _, tc := range cases {
+		if got := Retryable(tc.err); got != tc.want {
+			t.Errorf("%s: Retryable = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPermanent_KeepsChain(t *testing.T) {
+	base := errors.New("bad payload")
+	if !errors.Is(Permanent(base), base) {
+		t.Error("Permanent hides the wrapped error")
+	}
+	if Permanent(nil) != nil {
+		t.Error("Permanent(nil) is not nil")
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	status, reason, ok := Invalid(fmt.Errorf("send: %w", invalidErr{}))
+	if !ok || status != 404 || reason != "Unknown Webhook" {
+		t.Errorf("Invalid = %d, %q, %v", status, reason, ok)
+	}
+	if _, _, ok := Invalid(Permanent(errors.New("bad payload"))); ok {
+		t.Error("a permanent error is not an invalid destination")
+	}
+}
+
+// nopNotifier sends nothing; notifiertest.Fake would import this package.
+type nopNotifier struct{ _ byte }
+
+func (*nopNotifier) Send(context.Context, models.NotificationPayload) error { return nil }
+func (*nopNotifier) SendEnded(context.Context, models.SubscriptionRef, models.StreamEndedEvent) error {
+	return nil
+}
+
+func TestRegistry_Lookup(t *testing.T) {
+	discord, slack := &nopNotifier{}, &nopNotifier{}
+	r := NewRegistry()
+	r.Register(models.DestinationDiscord, discord)
+	r.Register(models.DestinationSlack, slack)
+
+	if n, ok := r.Lookup(models.DestinationSlack); !ok || n != slack {
+		t.Error("slack lookup did not return the slack notifier")
+	}
+	if n, ok := r.Lookup(""); !ok || n != discord {
+		t.Error("subscriptions without a destination type should use the discord notifier")
+	}
+	if _, ok := r.Lookup(models.DestinationMatrix); ok {
+		t.Error("found a notifier for an unregistered destination type")
+	}
+	if _, ok := r.Editor(models.DestinationSlack); ok {
+		t.Error("nopNotifier is not an Editor")
+	}
+}
@@ -0,0 +1,48 @@
+package notifiertest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+)
+
+// Fake is a notifier.Notifier for tests. It records what it is asked to
+// send and answers every call with Err.
+type Fake struct {
+	Err error
+
+	mu    sync.Mutex
+	sent  []models.NotificationPayload
+	ended []models.StreamEndedEvent
+}
+
+// Send records payload.
+func (f *Fake) Send(_ context.Context, payload models.NotificationPayload) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, payload)
+	return f.Err
+}
+
+// SendEnded records event.
+func (f *Fake) SendEnded(_ context.Context, _ models.SubscriptionRef, event models.StreamEndedEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ended = append(f.ended, event)
+	return f.Err
+}
+
+// Sent returns the payloads passed to Send.
+func (f *Fake) Sent() []models.NotificationPayload {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]models.NotificationPayload(nil), f.sent...)
+}
+
+// Ended returns the events passed to SendEnded.
+func (f *Fake) Ended() []models.StreamEndedEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]models.StreamEndedEvent(nil), f.ended...)
+}
@@ -0,0 +1,31 @@
+// Package notifiertest provides test helpers for notifiers and their callers.
+package notifiertest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+)
+
+// AllowLoopback lets a sender reach httptest servers, which listen on
+// loopback addresses its default transport refuses.
+var AllowLoopback = notifier.WithTransport(http.DefaultTransport)
+
+// Payload returns a go-live notification for subscription "sub-1" with every
+// stream detail set. Tests add the destination.
+func Payload() models.NotificationPayload {
+	return models.NotificationPayload{
+		SubscriptionID: "sub-1",
+		StreamID:       "stream-1",
+		UserLogin:      "streamer",
+		UserName:       "Streamer",
+		GameName:       "Fortnite",
+		Title:          "Ranked",
+		ViewerCount:    42,
+		StartedAt:      time.Unix(1700000000, 0).UTC(),
+		StreamURL:      "https://twitch.tv/streamer",
+		ThumbnailURL:   "https://static-cdn.jtvnw.net/previews-ttv/live_user_streamer-440x248.jpg",
+	}
+}
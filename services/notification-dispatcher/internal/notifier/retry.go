@@ -0,0 +1,151 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// MaxRateLimitRetries is how many rate limits Retry waits out.
+const MaxRateLimitRetries = 5
+
+// RetryPolicy controls how RetryPolicy.Retry retries failed attempts. The
+// delay starts at InitialBackoff and doubles up to MaxBackoff.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy is used by Retry.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 2 * time.Second,
+	MaxBackoff:     30 * time.Second,
+}
+
+// DefaultRetryAfter is waited after a rate limit that carries no usable delay.
+const DefaultRetryAfter = time.Second
+
+// InvalidWebhookError is returned by senders when the destination rejects
+// the credentials, or the webhook, chat, room, topic or mailbox no longer
+// exists. Retrying cannot succeed.
+type InvalidWebhookError struct {
+	Destination string // what was unusable, e.g. "slack webhook"
+	StatusCode  int
+	Message     string
+}
+
+func (e *InvalidWebhookError) Error() string {
+	return fmt.Sprintf("%s unusable (%d): %s", e.Destination, e.StatusCode, e.Message)
+}
+
+// Invalid implements InvalidError.
+func (e *InvalidWebhookError) Invalid() (int, string) {
+	return e.StatusCode, e.Message
+}
+
+// RateLimitedError is returned by an attempt the destination rate limited.
+type RateLimitedError struct {
+	Destination string        // what was rate limiting, e.g. "slack webhook"
+	After       time.Duration // how long it asked to wait; DefaultRetryAfter if zero
+}
+
+func (e *RateLimitedError) Error() string {
+	return e.Destination + " rate limited"
+}
+
+// delayedError carries the delay the destination asked for before the next
+// attempt.
+type delayedError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *delayedError) Error() string { return e.err.Error() }
+func (e *delayedError) Unwrap() error { return e.err }
+
+// Delayed asks Retry to wait d, up to the policy's MaxBackoff, instead of its
+// backoff before the next attempt. A nil err stays nil, and so does err if d
+// is not positive.
+func Delayed(err error, d time.Duration) error {
+	if err == nil || d <= 0 {
+		return err
+	}
+	return &delayedError{err: err, after: d}
+}
+
+// Retry calls attempt until it succeeds, following DefaultRetryPolicy.
+func Retry(ctx context.Context, attempt func() error) error {
+	return DefaultRetryPolicy.Retry(ctx, attempt)
+}
+
+// Retry calls attempt until it succeeds. A RateLimitedError is retried after
+// the delay it carries, up to MaxRateLimitRetries times; other errors are
+// retried up to p.MaxAttempts times with exponential backoff, unless they are
+// Permanent or an InvalidError.
+func (p RetryPolicy) Retry(ctx context.Context, attempt func() error) error {
+	failures, limited := 0, 0
+	backoff := p.InitialBackoff
+	for {
+		err := attempt()
+		if err == nil || !Retryable(err) {
+			return err
+		}
+
+		var rl *RateLimitedError
+		if errors.As(err, &rl) {
+			limited++
+			if limited > MaxRateLimitRetries {
+				return fmt.Errorf("%s still rate limited after %d retries", rl.Destination, MaxRateLimitRetries)
+			}
+			wait := rl.After
+			if wait <= 0 {
+				wait = DefaultRetryAfter
+			}
+			if err := Sleep(ctx, wait); err != nil {
+				return err
+			}
+			continue
+		}
+
+		failures++
+		if failures >= p.MaxAttempts {
+			return err
+		}
+		wait := backoff
+		var delayed *delayedError
+		if errors.As(err, &delayed) {
+			wait = delayed.after
+		}
+		if err := Sleep(ctx, min(wait, p.MaxBackoff)); err != nil {
+			return err
+		}
+		backoff = min(2*backoff, p.MaxBackoff)
+	}
+}
+
+// RetryAfter reads the delay a 429 asks for from its Retry-After header, in
+// possibly fractional seconds. It returns zero if there is none.
+func RetryAfter(h http.Header) time.Duration {
+	secs, err := strconv.ParseFloat(h.Get("Retry-After"), 64)
+	if err != nil || secs <= 0 {
+		return 0
+	}
+	return time.Duration(secs * float64(time.Second))
+}
+
+// Sleep waits for d, or until ctx is done.
+func Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,100 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetry_StopsOnFinalErrors(t *testing.T) {
+	cases := []error{
+		Permanent(errors.New("bad payload")),
+		&InvalidWebhookError{Destination: "slack webhook", StatusCode: 404, Message: "no_service"},
+	}
+	for _, want := range cases {
+		calls := 0
+		err := Retry(context.Background(), func() error {
+			calls++
+			return want
+		})
+		if err != want || calls != 1 {
+			t.Errorf("Retry(%v): err = %v after %d calls, want the error after 1", want, err, calls)
+		}
+	}
+}
+
+func TestRetry_WaitsOutRateLimits(t *testing.T) {
+	calls := 0
+	err := Retry(context.Background(), func() error {
+		calls++
+		if calls <= MaxRateLimitRetries {
+			return &RateLimitedError{Destination: "slack webhook", After: time.Millisecond}
+		}
+		return nil
+	})
+	if err != nil || calls != MaxRateLimitRetries+1 {
+		t.Fatalf("err = %v after %d calls, want success after %d", err, calls, MaxRateLimitRetries+1)
+	}
+
+	calls = 0
+	err = Retry(context.Background(), func() error {
+		calls++
+		return &RateLimitedError{Destination: "slack webhook", After: time.Millisecond}
+	})
+	if err == nil || err.Error() != "slack webhook still rate limited after 5 retries" {
+		t.Errorf("err = %v, want the rate limit to be given up on", err)
+	}
+}
+
+func TestRetry_StopsWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := Retry(ctx, func() error {
+		calls++
+		cancel()
+		return errors.New("connection refused")
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("err = %v after %d calls, want context.Canceled after 1", err, calls)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	cases := map[string]time.Duration{
+		"":     0,
+		"2":    2 * time.Second,
+		"0.5":  500 * time.Millisecond,
+		"-1":   0,
+		"soon": 0,
+	}
+	for value, want := range cases {
+		h := http.Header{}
+		if value != "" {
+			h.Set("Retry-After", value)
+		}
+		if got := RetryAfter(h); got != want {
+			t.Errorf("RetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestRetryPolicy_FollowsDelayUpToMaxBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: 100 * time.Millisecond}
+	for _, tc := range []struct {
+		delay    time.Duration
+		min, max time.Duration
+	}{
+		{50 * time.Millisecond, 40 * time.Millisecond, 90 * time.Millisecond},
+		{time.Hour, 90 * time.Millisecond, time.Second},
+	} {
+		start := time.Now()
+		_ = p.Retry(context.Background(), func() error {
+			return Delayed(errors.New("webhook returned 503"), tc.delay)
+		})
+		if elapsed := time.Since(start); elapsed < tc.min || elapsed > tc.max {
+			t.Errorf("delay %v: retried after %v, want between %v and %v", tc.delay, elapsed, tc.min, tc.max)
+		}
+	}
+}
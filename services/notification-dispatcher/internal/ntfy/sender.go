@@ -0,0 +1,171 @@
+package ntfy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/netguard"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/format"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+)
+
+// rateLimitWait is how long to wait after a 429; ntfy sends no Retry-After.
+const rateLimitWait = 2 * time.Second
+
+// priorityLow is ntfy's "low" priority, used for ended messages.
+const priorityLow = 2
+
+// message is the body of a JSON publish request.
+type message struct {
+	Topic    string   `json:"topic"`
+	Title    string   `json:"title"`
+	Message  string   `json:"message"`
+	Tags     []string `json:"tags,omitempty"`
+	Priority int      `json:"priority,omitzero"`
+	Click    string   `json:"click,omitempty"`
+	Attach   string   `json:"attach,omitempty"`
+	Filename string   `json:"filename,omitempty"`
+}
+
+// apiError is the JSON error body ntfy returns.
+type apiError struct {
+	Code  int    `json:"code"`
+	Error string `json:"error"`
+}
+
+// Sender publishes notifications to ntfy topics.
+type Sender struct {
+	httpClient *http.Client
+}
+
+// New creates a Sender. It only connects to publicly routable addresses
+// unless an option replaces its transport.
+func New(opts ...notifier.Option) *Sender {
+	return &Sender{httpClient: notifier.NewHTTPClient(opts...)}
+}
+
+// Send publishes a go-live notification. Tapping it opens the stream, and the
+// stream's thumbnail is attached.
+func (s *Sender) Send(ctx context.Context, payload models.NotificationPayload) error {
+	cfg, err := config(payload.DestinationConfig)
+	if err != nil {
+		return err
+	}
+	return s.publish(ctx, cfg, buildMessage(cfg, payload))
+}
+
+// SendEnded publishes a low-priority "was live for" summary of a stream that
+// went offline.
+func (s *Sender) SendEnded(ctx context.Context, ref models.SubscriptionRef, event models.StreamEndedEvent) error {
+	cfg, err := config(ref.DestinationConfig)
+	if err != nil {
+		return err
+	}
+	return s.publish(ctx, cfg, buildEndedMessage(cfg, event))
+}
+
+// publish POSTs msg to the server's JSON publishing endpoint with
+// notifier.Retry: 429s are retried after rateLimitWait, 5xx responses and
+// network errors with exponential backoff.
+func (s *Sender) publish(ctx context.Context, cfg *models.NtfyConfig, msg message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal ntfy message: %w", err)
+	}
+	target := strings.TrimRight(cfg.ServerURL, "/") + "/"
+
+	return notifier.Retry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+		if err != nil {
+			return notifier.Permanent(fmt.Errorf("build ntfy request: %w", err))
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if cfg.AccessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+cfg.AccessToken)
+		}
+
+		resp, err := s.httpClient.Do(req)
+		if errors.Is(err, netguard.ErrForbidden) {
+			return notifier.Permanent(fmt.Errorf("ntfy publish: %w", err))
+		}
+		if err != nil {
+			return fmt.Errorf("ntfy publish: %w", err)
+		}
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		var apiErr apiError
+		_ = json.Unmarshal(respBody, &apiErr)
+		reason := apiErr.Error
+		if reason == "" {
+			reason = http.StatusText(resp.StatusCode)
+		}
+
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			return nil
+		case resp.StatusCode == http.StatusTooManyRequests:
+			return &notifier.RateLimitedError{Destination: "ntfy server", After: rateLimitWait}
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			return &notifier.InvalidWebhookError{Destination: "ntfy topic", StatusCode: resp.StatusCode, Message: reason}
+		case resp.StatusCode < 500:
+			return notifier.Permanent(fmt.Errorf("ntfy server returned %d: %s", resp.StatusCode, reason))
+		}
+		return fmt.Errorf("ntfy server returned %d", resp.StatusCode)
+	})
+}
+
+// config returns the ntfy settings of a subscription.
+func config(cfg *models.DestinationConfig) (*models.NtfyConfig, error) {
+	if cfg == nil || cfg.Ntfy == nil || cfg.Ntfy.ServerURL == "" || cfg.Ntfy.Topic == "" {
+		return nil, notifier.Permanent(errors.New("ntfy subscription has no server URL or topic"))
+	}
+	return cfg.Ntfy, nil
+}
+
+// buildMessage constructs the message for a stream notification, carrying the
+// same details as the Discord embed. The game is also added as a tag.
+func buildMessage(cfg *models.NtfyConfig, p models.NotificationPayload) message {
+	msg := message{
+		Topic:    cfg.Topic,
+		Title:    fmt.Sprintf("%s is live on Twitch!", p.UserName),
+		Message:  fmt.Sprintf("%s\nGame: %s · Viewers: %d", p.Title, p.GameName, p.ViewerCount),
+		Tags:     tags("red_circle", p.GameName),
+		Priority: cfg.Priority,
+		Click:    p.StreamURL,
+	}
+	if p.ThumbnailURL != "" {
+		msg.Attach = p.ThumbnailURL
+		msg.Filename = p.UserLogin + ".jpg"
+	}
+	return msg
+}
+
+// buildEndedMessage constructs the message for a stream that went offline.
+func buildEndedMessage(cfg *models.NtfyConfig, e models.StreamEndedEvent) message {
+	return message{
+		Topic:    cfg.Topic,
+		Title:    fmt.Sprintf("%s was live for %s", e.UserName, format.Duration(time.Duration(e.DurationSeconds)*time.Second)),
+		Message:  fmt.Sprintf("%s\nGame: %s · Peak viewers: %d", e.Title, e.GameName, e.PeakViewers),
+		Tags:     tags("white_circle", e.GameName),
+		Priority: priorityLow,
+		Click:    e.StreamURL,
+	}
+}
+
+// tags returns the emoji tag followed by the game, if any. ntfy splits tags on
+// commas, so they are removed from the game name.
+func tags(emoji, game string) []string {
+	game = strings.TrimSpace(strings.ReplaceAll(game, ",", ""))
+	if game == "" {
+		return []string{emoji}
+	}
+	return []string{emoji, game}
+}
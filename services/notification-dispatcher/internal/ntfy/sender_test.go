@@ -0,0 +1,85 @@
+package ntfy
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier/notifiertest"
+)
+
+func testPayload(server string) models.NotificationPayload {
+	p := notifiertest.Payload()
+	p.DestinationType = models.DestinationNtfy
+	p.DestinationConfig = &models.DestinationConfig{Ntfy: &models.NtfyConfig{
+		ServerURL:   server,
+		Topic:       "twitch",
+		AccessToken: "tk_token",
+		Priority:    4,
+	}}
+	p.GameName = "Counter-Strike, Global Offensive"
+	return p
+}
+
+func TestSend_PublishesJSON(t *testing.T) {
+	var got message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer tk_token" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		_ = json.UnmarshalRead(r.Body, &got)
+		io.WriteString(w, `{"id":"abc"}`)
+	}))
+	defer srv.Close()
+
+	if err := New(notifiertest.AllowLoopback).Send(context.Background(), testPayload(srv.URL)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Topic != "twitch" || got.Title != "Streamer is live on Twitch!" || got.Priority != 4 {
+		t.Errorf("message = %+v", got)
+	}
+	if got.Click != "https://twitch.tv/streamer" || got.Attach == "" {
+		t.Errorf("click = %q, attach = %q", got.Click, got.Attach)
+	}
+	if len(got.Tags) != 2 || got.Tags[1] != "Counter-Strike Global Offensive" {
+		t.Errorf("tags = %q", got.Tags)
+	}
+}
+
+func TestSend_Forbidden(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"code":40301,"http":403,"error":"forbidden"}`)
+	}))
+	defer srv.Close()
+
+	err := New(notifiertest.AllowLoopback).Send(context.Background(), testPayload(srv.URL))
+	var invalid *notifier.InvalidWebhookError
+	if !errors.As(err, &invalid) || invalid.Message != "forbidden" {
+		t.Fatalf("got error %v, want InvalidWebhookError", err)
+	}
+}
+
+func TestSend_BadRequestNotRetried(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	err := New(notifiertest.AllowLoopback).Send(context.Background(), testPayload(srv.URL))
+	var invalid *notifier.InvalidWebhookError
+	if err == nil || errors.As(err, &invalid) || calls != 1 {
+		t.Errorf("got error %v after %d calls", err, calls)
+	}
+}
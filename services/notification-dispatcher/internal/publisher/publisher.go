@@ -0,0 +1,54 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/messaging"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+)
+
+// Publisher publishes WebhookInvalidEvents to NATS JetStream.
+type Publisher struct {
+	js jetstream.JetStream
+}
+
+// New creates a Publisher, ensuring the twitch.webhooks.invalid stream exists.
+func New(nc *nats.Conn) (*Publisher, error) {
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, fmt.Errorf("create jetstream context: %w", err)
+	}
+
+	_, err = js.CreateOrUpdateStream(context.Background(), jetstream.StreamConfig{
+		Name:      messaging.StreamTwitchWebhooksInvalid,
+		Subjects:  []string{messaging.SubjectWebhooksInvalid},
+		Retention: jetstream.WorkQueuePolicy,
+		MaxAge:    7 * 24 * time.Hour, // keep until subscription-service is back
+		Storage:   jetstream.FileStorage,
+		Replicas:  1, // set to 3 via Helm in production
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create stream %s: %w", messaging.StreamTwitchWebhooksInvalid, err)
+	}
+
+	return &Publisher{js: js}, nil
+}
+
+// PublishWebhookInvalid serialises and publishes a WebhookInvalidEvent envelope.
+func (p *Publisher) PublishWebhookInvalid(ctx context.Context, event models.WebhookInvalidEvent) error {
+	env := messaging.NewEnvelope(event)
+	data, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("marshal webhook invalid event: %w", err)
+	}
+
+	if _, err := p.js.Publish(ctx, messaging.SubjectWebhooksInvalid, data); err != nil {
+		return fmt.Errorf("publish webhook invalid event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/format"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+)
+
+// block is a Slack Block Kit layout block. Only the fields used by the
+// section, image and context blocks are modelled.
+type block struct {
+	Type     string `json:"type"`
+	Text     *text  `json:"text,omitempty"`
+	Fields   []text `json:"fields,omitempty"`
+	Elements []text `json:"elements,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	AltText  string `json:"alt_text,omitempty"`
+}
+
+// text is a Block Kit text object.
+type text struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// webhookPayload is the body of an incoming webhook post. Text is shown in
+// notifications and by clients that cannot render blocks.
+type webhookPayload struct {
+	Text   string  `json:"text"`
+	Blocks []block `json:"blocks"`
+}
+
+// Sender sends Slack incoming webhook notifications. Incoming webhooks cannot
+// edit what they posted, so unlike Discord each notification is final.
+type Sender struct {
+	httpClient *http.Client
+}
+
+// New creates a Sender.
+func New() *Sender {
+	return &Sender{httpClient: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Send posts a Block Kit message for a stream that went live.
+func (s *Sender) Send(ctx context.Context, payload models.NotificationPayload) error {
+	return s.post(ctx, payload.WebhookURL, buildMessage(payload))
+}
+
+// SendEnded posts a "was live for" summary of a stream that went offline.
+func (s *Sender) SendEnded(ctx context.Context, ref models.SubscriptionRef, event models.StreamEndedEvent) error {
+	return s.post(ctx, ref.WebhookURL, buildEndedMessage(event))
+}
+
+// post sends msg to the webhook with notifier.Retry: 429s are retried after
+// the Retry-After delay, 5xx responses and network errors with exponential
+// backoff. 403, 404 and 410 mean the webhook is gone and other 4xx mean the
+// payload was rejected; neither is retried.
+func (s *Sender) post(ctx context.Context, webhook string, msg webhookPayload) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal slack payload: %w", err)
+	}
+
+	return notifier.Retry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+		if err != nil {
+			return notifier.Permanent(fmt.Errorf("build slack request: %w", err))
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := s.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("slack webhook post: %w", err)
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		reason := strings.TrimSpace(string(respBody))
+
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			return nil
+		case resp.StatusCode == http.StatusTooManyRequests:
+			return &notifier.RateLimitedError{Destination: "slack webhook", After: notifier.RetryAfter(resp.Header)}
+		case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound ||
+			resp.StatusCode == http.StatusGone:
+			if reason == "" {
+				reason = http.StatusText(resp.StatusCode)
+			}
+			return &notifier.InvalidWebhookError{Destination: "slack webhook", StatusCode: resp.StatusCode, Message: reason}
+		case resp.StatusCode < 500:
+			return notifier.Permanent(fmt.Errorf("slack webhook returned %d: %s", resp.StatusCode, reason))
+		}
+		return fmt.Errorf("slack webhook returned %d", resp.StatusCode)
+	})
+}
+
+// buildMessage constructs the Block Kit message for a stream notification,
+// carrying the same details as the Discord embed.
+func buildMessage(p models.NotificationPayload) webhookPayload {
+	headline := fmt.Sprintf("%s is live on Twitch!", p.UserName)
+	blocks := []block{
+		{Type: "section", Text: mrkdwn(fmt.Sprintf("*<%s|%s>*\n%s", p.StreamURL, escape(headline), escape(p.Title)))},
+		{Type: "section", Fields: []text{
+			*mrkdwn("*Game*\n" + escape(p.GameName)),
+			*mrkdwn(fmt.Sprintf("*Viewers*\n%d", p.ViewerCount)),
+		}},
+	}
+	if p.ThumbnailURL != "" {
+		blocks = append(blocks, block{Type: "image", ImageURL: p.ThumbnailURL, AltText: headline})
+	}
+	blocks = append(blocks, footer(p.StartedAt))
+	return webhookPayload{Text: headline, Blocks: blocks}
+}
+
+// buildEndedMessage constructs the Block Kit message for a stream that went offline.
+func buildEndedMessage(e models.StreamEndedEvent) webhookPayload {
+	headline := fmt.Sprintf("%s was live for %s", e.UserName, format.Duration(time.Duration(e.DurationSeconds)*time.Second))
+	return webhookPayload{
+		Text: headline,
+		Blocks: []block{
+			{Type: "section", Text: mrkdwn(fmt.Sprintf("*<%s|%s>*\n%s", e.StreamURL, escape(headline), escape(e.Title)))},
+			{Type: "section", Fields: []text{
+				*mrkdwn("*Game*\n" + escape(e.GameName)),
+				*mrkdwn(fmt.Sprintf("*Peak viewers*\n%d", e.PeakViewers)),
+			}},
+			footer(e.EndedAt),
+		},
+	}
+}
+
+// footer renders "Twitch Watcher" and t in the reader's own time zone.
+func footer(t time.Time) block {
+	date := fmt.Sprintf("<!date^%d^{date_short_pretty} {time}|%s>", t.Unix(), t.UTC().Format(time.RFC1123))
+	return block{Type: "context", Elements: []text{*mrkdwn("Twitch Watcher · " + date)}}
+}
+
+func mrkdwn(s string) *text {
+	return &text{Type: "mrkdwn", Text: s}
+}
+
+// escape encodes the characters Slack's mrkdwn treats as control sequences.
+var escape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
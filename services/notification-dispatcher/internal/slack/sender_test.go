@@ -0,0 +1,138 @@
+package slack
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+)
+
+func TestSend_PostsBlocks(t *testing.T) {
+	var got webhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/services/T000/B000/XXXX" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if err := json.UnmarshalRead(r.Body, &got); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	err := New().Send(context.Background(), models.NotificationPayload{
+		WebhookURL:   srv.URL + "/services/T000/B000/XXXX",
+		UserName:     "Streamer",
+		GameName:     "Fortnite",
+		Title:        "Ranked <3 & chill",
+		ViewerCount:  42,
+		StartedAt:    time.Now(),
+		ThumbnailURL: "https://example.com/thumb.jpg",
+		StreamURL:    "https://twitch.tv/streamer",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got.Text != "Streamer is live on Twitch!" {
+		t.Errorf("text = %q", got.Text)
+	}
+	if len(got.Blocks) != 4 {
+		t.Fatalf("got %d blocks, want 4", len(got.Blocks))
+	}
+	if head := got.Blocks[0].Text.Text; !strings.Contains(head, "<https://twitch.tv/streamer|") ||
+		!strings.Contains(head, "Ranked &lt;3 &amp; chill") {
+		t.Errorf("headline block = %q, want a link and an escaped title", head)
+	}
+	if viewers := got.Blocks[1].Fields[1].Text; viewers != "*Viewers*\n42" {
+		t.Errorf("viewers field = %q", viewers)
+	}
+	if got.Blocks[2].ImageURL != "https://example.com/thumb.jpg" {
+		t.Errorf("image block = %+v", got.Blocks[2])
+	}
+}
+
+func TestSend_InvalidWebhook(t *testing.T) {
+	for _, status := range []int{http.StatusForbidden, http.StatusNotFound, http.StatusGone} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			io.WriteString(w, "no_service")
+		}))
+
+		err := New().Send(context.Background(), models.NotificationPayload{WebhookURL: srv.URL})
+		var invalid *notifier.InvalidWebhookError
+		if !errors.As(err, &invalid) || invalid.StatusCode != status || invalid.Message != "no_service" {
+			t.Errorf("status %d: err = %v, want InvalidWebhookError", status, err)
+		}
+		srv.Close()
+	}
+}
+
+func TestSend_BadPayloadNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "invalid_blocks")
+	}))
+	defer srv.Close()
+
+	err := New().Send(context.Background(), models.NotificationPayload{WebhookURL: srv.URL})
+	var invalid *notifier.InvalidWebhookError
+	if err == nil || errors.As(err, &invalid) {
+		t.Errorf("err = %v, want a plain error", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("calls = %d, want 1", got)
+	}
+}
+
+func TestSend_RetriesAfter429(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0.1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	if err := New().Send(context.Background(), models.NotificationPayload{WebhookURL: srv.URL}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("calls = %d, want 2", got)
+	}
+}
+
+func TestSendEnded_Summary(t *testing.T) {
+	var got webhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.UnmarshalRead(r.Body, &got)
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	err := New().SendEnded(context.Background(), models.SubscriptionRef{WebhookURL: srv.URL}, models.StreamEndedEvent{
+		UserName:        "Streamer",
+		DurationSeconds: int64((3*time.Hour + 12*time.Minute).Seconds()),
+		PeakViewers:     1200,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Text != "Streamer was live for 3h 12m" {
+		t.Errorf("text = %q", got.Text)
+	}
+}
@@ -0,0 +1,63 @@
+package subscription
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+)
+
+// ErrNotFound is returned by Get for a subscription that does not exist.
+var ErrNotFound = errors.New("subscription not found")
+
+// Client fetches subscriptions, with their credentials, from the
+// subscription-service internal API. Credentials are never published on NATS.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// New creates a subscription service client.
+func New(baseURL, apiKey string) *Client {
+	return &Client{
+		baseURL:    baseURL,
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Get fetches the subscription with the given ID, including deleted and
+// deactivated ones.
+func (c *Client) Get(ctx context.Context, id string) (*models.Subscription, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/internal/subscriptions/"+url.PathEscape(id), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Internal-API-Key", c.apiKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch subscription %s: %w", id, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusBadRequest:
+		return nil, ErrNotFound
+	default:
+		return nil, fmt.Errorf("subscription-service returned %d", resp.StatusCode)
+	}
+
+	var sub models.Subscription
+	if err := json.UnmarshalRead(resp.Body, &sub); err != nil {
+		return nil, fmt.Errorf("decode subscription %s: %w", id, err)
+	}
+	return &sub, nil
+}
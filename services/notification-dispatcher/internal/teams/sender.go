@@ -0,0 +1,175 @@
+package teams
+
+import (
+	"bytes"
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/format"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+)
+
+// webhookPayload is the message envelope Teams workflows and connectors accept.
+type webhookPayload struct {
+	Type        string       `json:"type"`
+	Attachments []attachment `json:"attachments"`
+}
+
+type attachment struct {
+	ContentType string `json:"contentType"`
+	Content     card   `json:"content"`
+}
+
+// card is an Adaptive Card. Only the elements the sender uses are modelled.
+type card struct {
+	Schema  string    `json:"$schema"`
+	Type    string    `json:"type"`
+	Version string    `json:"version"`
+	Body    []element `json:"body"`
+	Actions []action  `json:"actions,omitempty"`
+}
+
+// element is an Adaptive Card TextBlock, FactSet or Image.
+type element struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Size     string `json:"size,omitempty"`
+	Weight   string `json:"weight,omitempty"`
+	Color    string `json:"color,omitempty"`
+	IsSubtle bool   `json:"isSubtle,omitzero"`
+	Wrap     bool   `json:"wrap,omitzero"`
+	Facts    []fact `json:"facts,omitempty"`
+	URL      string `json:"url,omitempty"`
+	AltText  string `json:"altText,omitempty"`
+}
+
+type fact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+type action struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// Sender posts Adaptive Cards to Microsoft Teams through Workflows webhooks
+// (or legacy incoming webhook connectors). Like Slack, Teams webhooks cannot
+// edit what they posted.
+type Sender struct {
+	httpClient *http.Client
+}
+
+// New creates a Sender.
+func New() *Sender {
+	return &Sender{httpClient: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Send posts an Adaptive Card for a stream that went live.
+func (s *Sender) Send(ctx context.Context, payload models.NotificationPayload) error {
+	return s.post(ctx, payload.WebhookURL, buildCard(payload))
+}
+
+// SendEnded posts a "was live for" summary of a stream that went offline.
+func (s *Sender) SendEnded(ctx context.Context, ref models.SubscriptionRef, event models.StreamEndedEvent) error {
+	return s.post(ctx, ref.WebhookURL, buildEndedCard(event))
+}
+
+// post sends c to the webhook with notifier.Retry, like the Discord sender:
+// 429s are retried after the Retry-After delay, other non-2xx responses and
+// network errors with exponential backoff. 401, 403, 404 and 410 mean the
+// workflow is gone or the URL's signature is no longer accepted, and are not
+// retried.
+func (s *Sender) post(ctx context.Context, webhook string, c card) error {
+	body, err := json.Marshal(webhookPayload{
+		Type:        "message",
+		Attachments: []attachment{{ContentType: "application/vnd.microsoft.card.adaptive", Content: c}},
+	})
+	if err != nil {
+		return fmt.Errorf("marshal teams payload: %w", err)
+	}
+
+	return notifier.Retry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+		if err != nil {
+			return notifier.Permanent(fmt.Errorf("build teams request: %w", err))
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := s.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("teams webhook post: %w", err)
+		}
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			return nil
+		case resp.StatusCode == http.StatusTooManyRequests:
+			return &notifier.RateLimitedError{Destination: "teams webhook", After: notifier.RetryAfter(resp.Header)}
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden ||
+			resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+			reason := strings.TrimSpace(string(respBody))
+			if reason == "" {
+				reason = http.StatusText(resp.StatusCode)
+			}
+			return &notifier.InvalidWebhookError{Destination: "teams webhook", StatusCode: resp.StatusCode, Message: reason}
+		}
+		return fmt.Errorf("teams webhook returned %d", resp.StatusCode)
+	})
+}
+
+// buildCard constructs the Adaptive Card for a stream notification, carrying
+// the same details as the Discord embed.
+func buildCard(p models.NotificationPayload) card {
+	body := []element{
+		{Type: "TextBlock", Text: fmt.Sprintf("%s is live on Twitch!", p.UserName), Size: "Large", Weight: "Bolder", Color: "Accent", Wrap: true},
+		{Type: "TextBlock", Text: p.Title, Wrap: true},
+		{Type: "FactSet", Facts: []fact{
+			{Title: "Game", Value: p.GameName},
+			{Title: "Viewers", Value: strconv.Itoa(p.ViewerCount)},
+		}},
+	}
+	if p.ThumbnailURL != "" {
+		body = append(body, element{Type: "Image", URL: p.ThumbnailURL, Size: "Stretch", AltText: p.UserName})
+	}
+	body = append(body, footer())
+	return newCard(body, p.StreamURL)
+}
+
+// buildEndedCard constructs the Adaptive Card for a stream that went offline.
+func buildEndedCard(e models.StreamEndedEvent) card {
+	title := fmt.Sprintf("%s was live for %s", e.UserName, format.Duration(time.Duration(e.DurationSeconds)*time.Second))
+	return newCard([]element{
+		{Type: "TextBlock", Text: title, Size: "Large", Weight: "Bolder", IsSubtle: true, Wrap: true},
+		{Type: "TextBlock", Text: e.Title, Wrap: true},
+		{Type: "FactSet", Facts: []fact{
+			{Title: "Game", Value: e.GameName},
+			{Title: "Peak viewers", Value: strconv.Itoa(e.PeakViewers)},
+		}},
+		footer(),
+	}, e.StreamURL)
+}
+
+func newCard(body []element, streamURL string) card {
+	return card{
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Type:    "AdaptiveCard",
+		Version: "1.4",
+		Body:    body,
+		Actions: []action{{Type: "Action.OpenUrl", Title: "Watch", URL: streamURL}},
+	}
+}
+
+func footer() element {
+	return element{Type: "TextBlock", Text: "Twitch Watcher", Size: "Small", IsSubtle: true}
+}
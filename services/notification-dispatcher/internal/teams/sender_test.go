@@ -0,0 +1,144 @@
+package teams
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+)
+
+func TestSend_PostsAdaptiveCard(t *testing.T) {
+	var got webhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/workflows/abc/triggers/manual/paths/invoke" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if err := json.UnmarshalRead(r.Body, &got); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	err := New().Send(context.Background(), models.NotificationPayload{
+		WebhookURL:   srv.URL + "/workflows/abc/triggers/manual/paths/invoke",
+		UserName:     "Streamer",
+		GameName:     "Fortnite",
+		Title:        "Ranked",
+		ViewerCount:  42,
+		ThumbnailURL: "https://example.com/thumb.jpg",
+		StreamURL:    "https://twitch.tv/streamer",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got.Type != "message" || len(got.Attachments) != 1 ||
+		got.Attachments[0].ContentType != "application/vnd.microsoft.card.adaptive" {
+		t.Fatalf("envelope = %+v", got)
+	}
+	c := got.Attachments[0].Content
+	if c.Type != "AdaptiveCard" || len(c.Body) != 5 {
+		t.Fatalf("card = %+v", c)
+	}
+	if c.Body[0].Text != "Streamer is live on Twitch!" {
+		t.Errorf("heading = %q", c.Body[0].Text)
+	}
+	if viewers := c.Body[2].Facts[1]; viewers.Title != "Viewers" || viewers.Value != "42" {
+		t.Errorf("viewers fact = %+v", viewers)
+	}
+	if c.Body[3].Type != "Image" || c.Body[3].URL != "https://example.com/thumb.jpg" {
+		t.Errorf("image = %+v", c.Body[3])
+	}
+	if len(c.Actions) != 1 || c.Actions[0].Title != "Watch" || c.Actions[0].URL != "https://twitch.tv/streamer" {
+		t.Errorf("actions = %+v", c.Actions)
+	}
+}
+
+func TestSend_InvalidWebhook(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusNotFound} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			io.WriteString(w, "WorkflowNotFound")
+		}))
+
+		err := New().Send(context.Background(), models.NotificationPayload{WebhookURL: srv.URL})
+		var invalid *notifier.InvalidWebhookError
+		if !errors.As(err, &invalid) || invalid.StatusCode != status || invalid.Message != "WorkflowNotFound" {
+			t.Errorf("status %d: err = %v, want InvalidWebhookError", status, err)
+		}
+		srv.Close()
+	}
+}
+
+func TestSend_RetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	if err := New().Send(context.Background(), models.NotificationPayload{WebhookURL: srv.URL}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("calls = %d, want 2", got)
+	}
+}
+
+func TestSend_RetriesAfter429(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0.1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	if err := New().Send(context.Background(), models.NotificationPayload{WebhookURL: srv.URL}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("calls = %d, want 2", got)
+	}
+}
+
+func TestSendEnded_Summary(t *testing.T) {
+	var got webhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.UnmarshalRead(r.Body, &got)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	err := New().SendEnded(context.Background(), models.SubscriptionRef{WebhookURL: srv.URL}, models.StreamEndedEvent{
+		UserName:        "Streamer",
+		DurationSeconds: int64((3*time.Hour + 12*time.Minute).Seconds()),
+		PeakViewers:     1200,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := got.Attachments[0].Content
+	if c.Body[0].Text != "Streamer was live for 3h 12m" {
+		t.Errorf("heading = %q", c.Body[0].Text)
+	}
+	if peak := c.Body[2].Facts[1]; peak.Value != "1200" {
+		t.Errorf("peak fact = %+v", peak)
+	}
+}
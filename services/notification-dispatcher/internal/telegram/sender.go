@@ -0,0 +1,230 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/format"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+)
+
+// maxTitleRunes keeps captions under Telegram's 1024 character limit.
+const maxTitleRunes = 700
+
+// sendPhotoRequest is the body of a sendPhoto call.
+type sendPhotoRequest struct {
+	ChatID    string `json:"chat_id"`
+	Photo     string `json:"photo"`
+	Caption   string `json:"caption"`
+	ParseMode string `json:"parse_mode"`
+}
+
+// sendMessageRequest is the body of a sendMessage call.
+type sendMessageRequest struct {
+	ChatID             string             `json:"chat_id"`
+	Text               string             `json:"text"`
+	ParseMode          string             `json:"parse_mode"`
+	LinkPreviewOptions linkPreviewOptions `json:"link_preview_options"`
+}
+
+type linkPreviewOptions struct {
+	IsDisabled bool `json:"is_disabled"`
+}
+
+// apiResponse is the envelope of every Bot API response.
+type apiResponse struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter      int   `json:"retry_after"`
+		MigrateToChatID int64 `json:"migrate_to_chat_id"`
+	} `json:"parameters"`
+}
+
+// errBadRequest marks a 400 that is about the request itself, such as a
+// thumbnail Telegram could not fetch.
+var errBadRequest = errors.New("telegram rejected the request")
+
+// Sender sends notifications through the Telegram Bot API.
+type Sender struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+// New creates a Sender calling the Bot API at baseURL, normally
+// https://api.telegram.org.
+func New(baseURL string) *Sender {
+	return &Sender{
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		baseURL:    strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// Send posts the stream's thumbnail with an HTML caption. If Telegram cannot
+// use the thumbnail the caption is sent as a plain message instead.
+func (s *Sender) Send(ctx context.Context, payload models.NotificationPayload) error {
+	cfg, err := config(payload.DestinationConfig)
+	if err != nil {
+		return err
+	}
+	caption := buildCaption(payload)
+
+	if payload.ThumbnailURL != "" {
+		err := s.call(ctx, cfg.BotToken, "sendPhoto", sendPhotoRequest{
+			ChatID:    cfg.ChatID,
+			Photo:     thumbnail(payload.ThumbnailURL, payload.StartedAt),
+			Caption:   caption,
+			ParseMode: "HTML",
+		})
+		if !errors.Is(err, errBadRequest) {
+			return err
+		}
+	}
+	return s.sendMessage(ctx, cfg, caption)
+}
+
+// SendEnded posts a "was live for" summary of a stream that went offline.
+func (s *Sender) SendEnded(ctx context.Context, ref models.SubscriptionRef, event models.StreamEndedEvent) error {
+	cfg, err := config(ref.DestinationConfig)
+	if err != nil {
+		return err
+	}
+	return s.sendMessage(ctx, cfg, buildEndedText(event))
+}
+
+func (s *Sender) sendMessage(ctx context.Context, cfg *models.TelegramConfig, text string) error {
+	return s.call(ctx, cfg.BotToken, "sendMessage", sendMessageRequest{
+		ChatID:             cfg.ChatID,
+		Text:               text,
+		ParseMode:          "HTML",
+		LinkPreviewOptions: linkPreviewOptions{IsDisabled: true},
+	})
+}
+
+// call invokes a Bot API method with notifier.Retry: 429s are retried after
+// the retry_after Telegram asks for, 5xx responses and network errors with
+// exponential backoff. Errors never include the request URL, which carries
+// the bot token.
+func (s *Sender) call(ctx context.Context, token, method string, params any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("marshal telegram %s: %w", method, err)
+	}
+	target := s.baseURL + "/bot" + token + "/" + method
+
+	return notifier.Retry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+		if err != nil {
+			return notifier.Permanent(fmt.Errorf("build telegram %s request", method))
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := s.httpClient.Do(req)
+		if err != nil {
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			return fmt.Errorf("telegram %s: %w", method, err)
+		}
+		var result apiResponse
+		decodeErr := json.UnmarshalRead(resp.Body, &result)
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusOK && decodeErr == nil && result.OK:
+			return nil
+		case resp.StatusCode == http.StatusTooManyRequests:
+			return &notifier.RateLimitedError{
+				Destination: "telegram " + method,
+				After:       time.Duration(result.Parameters.RetryAfter) * time.Second,
+			}
+		case resp.StatusCode >= 400 && resp.StatusCode < 500:
+			return classify(resp.StatusCode, result)
+		}
+		return fmt.Errorf("telegram %s returned %d", method, resp.StatusCode)
+	})
+}
+
+// classify turns a 4xx Bot API error into a notifier.InvalidWebhookError when
+// the bot or chat is unusable, or an errBadRequest otherwise.
+func classify(status int, result apiResponse) error {
+	desc := result.Description
+	if desc == "" {
+		desc = http.StatusText(status)
+	}
+
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return &notifier.InvalidWebhookError{Destination: "telegram chat", StatusCode: status, Message: desc}
+	case result.Parameters.MigrateToChatID != 0:
+		// The group became a supergroup with a new ID; the subscription must be recreated.
+		return &notifier.InvalidWebhookError{Destination: "telegram chat", StatusCode: status, Message: desc}
+	case strings.Contains(strings.ToLower(desc), "chat not found"):
+		return &notifier.InvalidWebhookError{Destination: "telegram chat", StatusCode: status, Message: desc}
+	}
+	return notifier.Permanent(fmt.Errorf("%w (%d): %s", errBadRequest, status, desc))
+}
+
+// config returns the Telegram settings of a subscription.
+func config(cfg *models.DestinationConfig) (*models.TelegramConfig, error) {
+	if cfg == nil || cfg.Telegram == nil || cfg.Telegram.BotToken == "" || cfg.Telegram.ChatID == "" {
+		return nil, notifier.Permanent(errors.New("telegram subscription has no bot token or chat ID"))
+	}
+	return cfg.Telegram, nil
+}
+
+// thumbnail adds the stream's start time to url so Telegram, which caches
+// photos by URL, fetches a fresh preview for each stream.
+func thumbnail(raw string, startedAt time.Time) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	q := u.Query()
+	q.Set("t", strconv.FormatInt(startedAt.Unix(), 10))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// buildCaption constructs the HTML caption for a stream notification,
+// carrying the same details as the Discord embed.
+func buildCaption(p models.NotificationPayload) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<b><a href=\"%s\">%s is live on Twitch!</a></b>\n", html.EscapeString(p.StreamURL), html.EscapeString(p.UserName))
+	fmt.Fprintf(&b, "%s\n\n", html.EscapeString(truncate(p.Title, maxTitleRunes)))
+	fmt.Fprintf(&b, "<b>Game:</b> %s\n", html.EscapeString(p.GameName))
+	fmt.Fprintf(&b, "<b>Viewers:</b> %d", p.ViewerCount)
+	return b.String()
+}
+
+// buildEndedText constructs the HTML message for a stream that went offline.
+func buildEndedText(e models.StreamEndedEvent) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<b><a href=\"%s\">%s was live for %s</a></b>\n", html.EscapeString(e.StreamURL), html.EscapeString(e.UserName),
+		format.Duration(time.Duration(e.DurationSeconds)*time.Second))
+	fmt.Fprintf(&b, "%s\n\n", html.EscapeString(truncate(e.Title, maxTitleRunes)))
+	fmt.Fprintf(&b, "<b>Game:</b> %s\n", html.EscapeString(e.GameName))
+	fmt.Fprintf(&b, "<b>Peak viewers:</b> %d", e.PeakViewers)
+	return b.String()
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
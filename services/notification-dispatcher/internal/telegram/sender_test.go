@@ -0,0 +1,134 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+)
+
+const testToken = "123456:ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghi"
+
+func testPayload(baseURL string) models.NotificationPayload {
+	return models.NotificationPayload{
+		DestinationType: models.DestinationTelegram,
+		DestinationConfig: &models.DestinationConfig{
+			Telegram: &models.TelegramConfig{BotToken: testToken, ChatID: "-1001234"},
+		},
+		UserName:     "Streamer",
+		GameName:     "Fortnite",
+		Title:        "Ranked <3 & chill",
+		ViewerCount:  42,
+		StartedAt:    time.Unix(1700000000, 0),
+		ThumbnailURL: baseURL + "/thumb.jpg",
+		StreamURL:    "https://twitch.tv/streamer",
+	}
+}
+
+func TestSend_SendsPhotoWithCaption(t *testing.T) {
+	var got sendPhotoRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bot"+testToken+"/sendPhoto" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		_ = json.UnmarshalRead(r.Body, &got)
+		io.WriteString(w, `{"ok":true,"result":{"message_id":1}}`)
+	}))
+	defer srv.Close()
+
+	if err := New(srv.URL).Send(context.Background(), testPayload(srv.URL)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.ChatID != "-1001234" || got.ParseMode != "HTML" {
+		t.Errorf("request = %+v", got)
+	}
+	if got.Photo != srv.URL+"/thumb.jpg?t=1700000000" {
+		t.Errorf("photo = %q", got.Photo)
+	}
+	if !strings.Contains(got.Caption, `<a href="https://twitch.tv/streamer">Streamer is live on Twitch!</a>`) ||
+		!strings.Contains(got.Caption, "Ranked &lt;3 &amp; chill") ||
+		!strings.Contains(got.Caption, "<b>Viewers:</b> 42") {
+		t.Errorf("caption = %q", got.Caption)
+	}
+}
+
+func TestSend_FallsBackToMessage(t *testing.T) {
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+		if strings.HasSuffix(r.URL.Path, "/sendPhoto") {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"ok":false,"error_code":400,"description":"Bad Request: wrong file identifier/HTTP URL specified"}`)
+			return
+		}
+		io.WriteString(w, `{"ok":true,"result":{"message_id":1}}`)
+	}))
+	defer srv.Close()
+
+	if err := New(srv.URL).Send(context.Background(), testPayload(srv.URL)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(methods, ",") != "sendPhoto,sendMessage" {
+		t.Errorf("methods = %v", methods)
+	}
+}
+
+func TestSend_RetriesAfter429(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 1","parameters":{"retry_after":1}}`)
+			return
+		}
+		io.WriteString(w, `{"ok":true,"result":{}}`)
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	if err := New(srv.URL).Send(context.Background(), testPayload(srv.URL)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("calls = %d, want 2", got)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("retried after %v, want retry_after (1s)", elapsed)
+	}
+}
+
+func TestSend_UnusableChat(t *testing.T) {
+	cases := map[string]struct {
+		status int
+		body   string
+	}{
+		"revoked token": {http.StatusUnauthorized, `{"ok":false,"error_code":401,"description":"Unauthorized"}`},
+		"bot kicked":    {http.StatusForbidden, `{"ok":false,"error_code":403,"description":"Forbidden: bot was kicked from the group chat"}`},
+		"chat missing":  {http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`},
+		"migrated":      {http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: group chat was upgraded to a supergroup chat","parameters":{"migrate_to_chat_id":-1009}}`},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				io.WriteString(w, tc.body)
+			}))
+			defer srv.Close()
+
+			err := New(srv.URL).Send(context.Background(), testPayload(srv.URL))
+			var invalid *notifier.InvalidWebhookError
+			if !errors.As(err, &invalid) || invalid.StatusCode != tc.status {
+				t.Errorf("err = %v, want InvalidWebhookError with status %d", err, tc.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/netguard"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+)
+
+// Request headers sent with every delivery.
+const (
+	HeaderEvent     = "X-Twitch-Watcher-Event"
+	HeaderDelivery  = "X-Twitch-Watcher-Delivery"
+	HeaderTimestamp = "X-Twitch-Watcher-Timestamp"
+	HeaderSignature = "X-Twitch-Watcher-Signature"
+)
+
+// Event types, sent in HeaderEvent.
+const (
+	EventStreamOnline  = "stream.online"
+	EventStreamOffline = "stream.offline"
+)
+
+// DefaultRetryPolicy is used for any field of the sender's policy left at
+// zero. Network errors, 408, 429 and 5xx responses are retried; the delay
+// follows the receiver's Retry-After if it sends one.
+var DefaultRetryPolicy = notifier.RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+}
+
+// endedPayload is the body of a stream.offline delivery.
+type endedPayload struct {
+	SubscriptionID string `json:"subscription_id"`
+	models.StreamEndedEvent
+}
+
+// Sender delivers notifications to generic HTTP webhooks. Each delivery is a
+// JSON POST signed with the subscription's secret: HeaderSignature carries
+// "sha256=" and the hex HMAC-SHA256 of HeaderTimestamp, a ".", and the body.
+type Sender struct {
+	httpClient *http.Client
+	policy     notifier.RetryPolicy
+}
+
+// New creates a Sender that retries failed deliveries according to policy.
+// It only connects to publicly routable addresses unless an option replaces
+// its transport.
+func New(policy notifier.RetryPolicy, opts ...notifier.Option) *Sender {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if policy.MaxBackoff < policy.InitialBackoff {
+		policy.MaxBackoff = max(DefaultRetryPolicy.MaxBackoff, policy.InitialBackoff)
+	}
+	return &Sender{
+		httpClient: notifier.NewHTTPClient(opts...),
+		policy:     policy,
+	}
+}
+
+// Send delivers a stream.online event carrying the NotificationPayload.
+func (s *Sender) Send(ctx context.Context, payload models.NotificationPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal webhook payload: %w", err)
+	}
+	delivery := DeliveryID(payload.SubscriptionID, payload.StreamID, EventStreamOnline)
+	return s.post(ctx, payload.WebhookURL, payload.WebhookSecret, EventStreamOnline, delivery, body)
+}
+
+// SendEnded delivers a stream.offline event for ref's subscription.
+func (s *Sender) SendEnded(ctx context.Context, ref models.SubscriptionRef, event models.StreamEndedEvent) error {
+	event.Subscriptions = nil
+
+	body, err := json.Marshal(endedPayload{SubscriptionID: ref.SubscriptionID, StreamEndedEvent: event})
+	if err != nil {
+		return fmt.Errorf("marshal webhook payload: %w", err)
+	}
+	delivery := DeliveryID(ref.SubscriptionID, event.StreamID, EventStreamOffline)
+	return s.post(ctx, ref.WebhookURL, ref.WebhookSecret, EventStreamOffline, delivery, body)
+}
+
+// DeliveryID identifies one event for one subscription. It is derived from
+// its inputs, so redeliveries of the same event carry the same ID and
+// receivers can use it to drop duplicates.
+func DeliveryID(subscriptionID, streamID, event string) string {
+	sum := sha256.Sum256([]byte(subscriptionID + "\x00" + streamID + "\x00" + event))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Sign returns the HeaderSignature value for body sent at timestamp.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// post sends body to target, retrying according to the policy. Each attempt
+// is signed with a fresh timestamp.
+func (s *Sender) post(ctx context.Context, target, secret, event, delivery string, body []byte) error {
+	return s.policy.Retry(ctx, func() error {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+		if err != nil {
+			return notifier.Permanent(fmt.Errorf("build webhook request: %w", err))
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "twitch-watcher")
+		req.Header.Set(HeaderEvent, event)
+		req.Header.Set(HeaderDelivery, delivery)
+		req.Header.Set(HeaderTimestamp, timestamp)
+		req.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+
+		resp, err := s.httpClient.Do(req)
+		if errors.Is(err, netguard.ErrForbidden) {
+			return notifier.Permanent(fmt.Errorf("webhook post: %w", err))
+		}
+		if err != nil {
+			return fmt.Errorf("webhook post: %w", err)
+		}
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			return nil
+		case resp.StatusCode == http.StatusGone:
+			return &notifier.InvalidWebhookError{Destination: "webhook", StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+		case !retryable(resp.StatusCode):
+			return notifier.Permanent(fmt.Errorf("webhook returned %d: %s", resp.StatusCode, respBody))
+		}
+		return notifier.Delayed(fmt.Errorf("webhook returned %d", resp.StatusCode), notifier.RetryAfter(resp.Header))
+	})
+}
+
+// retryable reports whether a response with status may succeed if sent again.
+func retryable(status int) bool {
+	return status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+}
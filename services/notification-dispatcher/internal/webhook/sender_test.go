@@ -0,0 +1,173 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/netguard"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier"
+	"github.com/khiemnguyen15/twitch-watcher/services/notification-dispatcher/internal/notifier/notifiertest"
+)
+
+// fastRetries keeps retry tests quick.
+var fastRetries = notifier.RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}
+
+func TestSend_SignsPayload(t *testing.T) {
+	const secret = "whsec_test"
+	var got models.NotificationPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if want := Sign(secret, r.Header.Get(HeaderTimestamp), body); r.Header.Get(HeaderSignature) != want {
+			t.Errorf("signature = %q, want %q", r.Header.Get(HeaderSignature), want)
+		}
+		if r.Header.Get(HeaderEvent) != EventStreamOnline {
+			t.Errorf("event = %q, want %q", r.Header.Get(HeaderEvent), EventStreamOnline)
+		}
+		if r.Header.Get(HeaderDelivery) != DeliveryID("sub-1", "stream-1", EventStreamOnline) {
+			t.Errorf("delivery = %q", r.Header.Get(HeaderDelivery))
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	err := New(fastRetries, notifiertest.AllowLoopback).Send(context.Background(), models.NotificationPayload{
+		SubscriptionID: "sub-1",
+		WebhookURL:     srv.URL,
+		WebhookSecret:  secret,
+		StreamID:       "stream-1",
+		UserName:       "Streamer",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.UserName != "Streamer" || got.StreamID != "stream-1" {
+		t.Errorf("payload = %+v", got)
+	}
+	if got.WebhookSecret != "" {
+		t.Error("secret was sent in the body")
+	}
+}
+
+func TestDeliveryID_Stable(t *testing.T) {
+	a := DeliveryID("sub-1", "stream-1", EventStreamOnline)
+	if a != DeliveryID("sub-1", "stream-1", EventStreamOnline) {
+		t.Error("delivery ID changed between calls")
+	}
+	if a == DeliveryID("sub-1", "stream-1", EventStreamOffline) || a == DeliveryID("sub-2", "stream-1", EventStreamOnline) {
+		t.Error("different deliveries share an ID")
+	}
+}
+
+func TestSend_RetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	want := DeliveryID("sub-1", "stream-1", EventStreamOnline)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get(HeaderDelivery); got != want {
+			t.Errorf("attempt %d: delivery = %q, want %q", calls.Load()+1, got, want)
+		}
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	err := New(fastRetries, notifiertest.AllowLoopback).Send(context.Background(), models.NotificationPayload{
+		SubscriptionID: "sub-1",
+		WebhookURL:     srv.URL,
+		StreamID:       "stream-1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("calls = %d, want 3", got)
+	}
+}
+
+func TestSend_GivesUpAfterMaxAttempts(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	err := New(fastRetries, notifiertest.AllowLoopback).Send(context.Background(), models.NotificationPayload{WebhookURL: srv.URL})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("calls = %d, want 3", got)
+	}
+}
+
+func TestSend_ClientErrorsNotRetried(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusGone} {
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(status)
+		}))
+
+		err := New(fastRetries, notifiertest.AllowLoopback).Send(context.Background(), models.NotificationPayload{WebhookURL: srv.URL})
+		var invalid *notifier.InvalidWebhookError
+		if gone := errors.As(err, &invalid); err == nil || gone != (status == http.StatusGone) {
+			t.Errorf("status %d: err = %v", status, err)
+		}
+		if got := calls.Load(); got != 1 {
+			t.Errorf("status %d: calls = %d, want 1", status, got)
+		}
+		srv.Close()
+	}
+}
+
+func TestSendEnded_OmitsSubscriptions(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(HeaderEvent) != EventStreamOffline {
+			t.Errorf("event = %q, want %q", r.Header.Get(HeaderEvent), EventStreamOffline)
+		}
+		_ = json.UnmarshalRead(r.Body, &got)
+	}))
+	defer srv.Close()
+
+	ref := models.SubscriptionRef{SubscriptionID: "sub-1", WebhookURL: srv.URL, WebhookSecret: "whsec_test"}
+	err := New(fastRetries, notifiertest.AllowLoopback).SendEnded(context.Background(), ref, models.StreamEndedEvent{
+		StreamID:      "stream-1",
+		Subscriptions: []models.SubscriptionRef{ref},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got["subscription_id"] != "sub-1" || got["stream_id"] != "stream-1" {
+		t.Errorf("body = %v", got)
+	}
+	if _, ok := got["subscriptions"]; ok {
+		t.Error("other subscriptions were sent in the body")
+	}
+}
+
+func TestSend_RefusesInternalAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the request reached a loopback server")
+	}))
+	defer srv.Close()
+
+	err := New(fastRetries).Send(context.Background(), models.NotificationPayload{WebhookURL: srv.URL})
+	if !errors.Is(err, netguard.ErrForbidden) || notifier.Retryable(err) {
+		t.Errorf("err = %v, want a permanent ErrForbidden", err)
+	}
+}
@@ -44,17 +44,20 @@ func (f *Filter) Process(ctx context.Context, event models.StreamEvent) (int, er
 	published := 0
 	for _, ref := range event.Subscriptions {
 		payload := models.NotificationPayload{
-			SubscriptionID: ref.SubscriptionID,
-			DiscordWebhook: ref.DiscordWebhook,
-			StreamID:       event.StreamID,
-			UserLogin:      event.UserLogin,
-			UserName:       event.UserName,
-			GameName:       event.GameName,
-			Title:          event.Title,
-			ViewerCount:    event.ViewerCount,
-			StartedAt:      event.StartedAt,
-			ThumbnailURL:   event.ThumbnailURL,
-			StreamURL:      event.StreamURL,
+			SubscriptionID:    ref.SubscriptionID,
+			DestinationType:   ref.DestinationType,
+			WebhookURL:        ref.WebhookURL,
+			DestinationConfig: ref.DestinationConfig,
+			StreamID:          event.StreamID,
+			UserLogin:         event.UserLogin,
+			UserName:          event.UserName,
+			GameName:          event.GameName,
+			Title:             event.Title,
+			ViewerCount:       event.ViewerCount,
+			StartedAt:         event.StartedAt,
+			ThumbnailURL:      event.ThumbnailURL,
+			StreamURL:         event.StreamURL,
+			ProfileImageURL:   event.ProfileImageURL,
 		}
 		if err := f.publisher.Publish(ctx, payload); err != nil {
 			return published, fmt.Errorf("publish notification for sub %s: %w", ref.SubscriptionID, err)
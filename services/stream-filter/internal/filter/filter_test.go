@@ -52,8 +52,8 @@ func TestProcess_NewStream_PublishesOnePerRef(t *testing.T) {
 	f := newTestFilter(t, pub)
 
 	event := testEvent("stream-1", "streamer1",
-		models.SubscriptionRef{SubscriptionID: "sub-1", DiscordWebhook: "https://discord.com/api/webhooks/1/a"},
-		models.SubscriptionRef{SubscriptionID: "sub-2", DiscordWebhook: "https://discord.com/api/webhooks/2/b"},
+		models.SubscriptionRef{SubscriptionID: "sub-1", WebhookURL: "https://discord.com/api/webhooks/1/a"},
+		models.SubscriptionRef{SubscriptionID: "sub-2", WebhookURL: "https://discord.com/api/webhooks/2/b"},
 	)
 
 	n, err := f.Process(context.Background(), event)
@@ -73,7 +73,7 @@ func TestProcess_DuplicateStream_Discarded(t *testing.T) {
 	f := newTestFilter(t, pub)
 
 	event := testEvent("stream-1", "streamer1",
-		models.SubscriptionRef{SubscriptionID: "sub-1", DiscordWebhook: "https://discord.com/api/webhooks/1/a"},
+		models.SubscriptionRef{SubscriptionID: "sub-1", WebhookURL: "https://discord.com/api/webhooks/1/a"},
 	)
 
 	// First call: new stream — should publish.
@@ -102,7 +102,7 @@ func TestProcess_DifferentStreams_BothPublished(t *testing.T) {
 	pub := &mockPublisher{}
 	f := newTestFilter(t, pub)
 
-	ref := models.SubscriptionRef{SubscriptionID: "sub-1", DiscordWebhook: "https://discord.com/api/webhooks/1/a"}
+	ref := models.SubscriptionRef{SubscriptionID: "sub-1", WebhookURL: "https://discord.com/api/webhooks/1/a"}
 
 	_, err := f.Process(context.Background(), testEvent("stream-1", "streamer1", ref))
 	if err != nil {
@@ -122,7 +122,7 @@ func TestProcess_PayloadFieldsMatchEvent(t *testing.T) {
 	pub := &mockPublisher{}
 	f := newTestFilter(t, pub)
 
-	ref := models.SubscriptionRef{SubscriptionID: "sub-42", DiscordWebhook: "https://discord.com/api/webhooks/9/z"}
+	ref := models.SubscriptionRef{SubscriptionID: "sub-42", WebhookURL: "https://discord.com/api/webhooks/9/z"}
 	event := testEvent("stream-99", "mycaster", ref)
 
 	if _, err := f.Process(context.Background(), event); err != nil {
@@ -152,7 +152,7 @@ func TestProcess_PublisherError_ReturnsError(t *testing.T) {
 	f := newTestFilter(t, pub)
 
 	event := testEvent("stream-1", "streamer1",
-		models.SubscriptionRef{SubscriptionID: "sub-1", DiscordWebhook: "https://discord.com/api/webhooks/1/a"},
+		models.SubscriptionRef{SubscriptionID: "sub-1", WebhookURL: "https://discord.com/api/webhooks/1/a"},
 	)
 
 	_, err := f.Process(context.Background(), event)
@@ -167,7 +167,7 @@ func TestProcess_KeyFormat(t *testing.T) {
 	pub := &mockPublisher{}
 	f := newTestFilter(t, pub)
 
-	ref := models.SubscriptionRef{SubscriptionID: "sub-1", DiscordWebhook: "https://discord.com/api/webhooks/1/a"}
+	ref := models.SubscriptionRef{SubscriptionID: "sub-1", WebhookURL: "https://discord.com/api/webhooks/1/a"}
 
 	// Same stream ID, different user login — should both publish.
 	_, _ = f.Process(context.Background(), testEvent("stream-1", "streamer-a", ref))
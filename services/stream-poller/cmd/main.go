@@ -2,18 +2,22 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/nats-io/nats.go"
 	"github.com/redis/go-redis/v9"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/twitch"
 	"github.com/khiemnguyen15/twitch-watcher/services/stream-poller/internal/config"
+	"github.com/khiemnguyen15/twitch-watcher/services/stream-poller/internal/eventsub"
 	"github.com/khiemnguyen15/twitch-watcher/services/stream-poller/internal/poller"
 	"github.com/khiemnguyen15/twitch-watcher/services/stream-poller/internal/publisher"
 	"github.com/khiemnguyen15/twitch-watcher/services/stream-poller/internal/subscription"
-	"github.com/khiemnguyen15/twitch-watcher/services/stream-poller/internal/twitch"
 )
 
 func main() {
@@ -42,7 +46,7 @@ func main() {
 	defer rdb.Close()
 
 	tokenMgr := twitch.NewTokenManager(cfg.TwitchClientID, cfg.TwitchClientSecret)
-	twitchClient := twitch.NewClient(cfg.TwitchClientID, tokenMgr)
+	twitchClient := twitch.NewClient(cfg.TwitchClientID, tokenMgr, twitch.NewRateLimiter(nil))
 	subClient := subscription.New(cfg.SubscriptionSvcURL, cfg.InternalAPIKey)
 
 	p := poller.New(subClient, twitchClient, pub, rdb, logger)
@@ -50,6 +54,52 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	switch cfg.IngestionMode {
+	case config.ModeEventSub:
+		userTokenMgr := twitch.NewUserTokenManager(cfg.TwitchClientID, cfg.TwitchClientSecret, cfg.TwitchUserRefreshToken)
+		userClient := twitch.NewClient(cfg.TwitchClientID, userTokenMgr, twitch.NewRateLimiter(nil))
+
+		subs := eventsub.NewManager(userClient, logger)
+		p.SetStreamerWatcher(subs)
+
+		ws := eventsub.NewClient(cfg.EventSubWSURL, subs, p, logger)
+		go ws.Run(ctx)
+
+	case config.ModeWebhook:
+		subs := eventsub.NewManager(twitchClient, logger)
+		p.SetStreamerWatcher(subs)
+
+		guard := eventsub.NewValkeyReplayGuard(rdb)
+		srv := &http.Server{
+			Addr:           cfg.EventSubWebhookAddr,
+			Handler:        eventsub.NewWebhookHandler(cfg.EventSubWebhookSecret, guard, subs, p, logger),
+			ReadTimeout:    10 * time.Second,
+			WriteTimeout:   10 * time.Second,
+			IdleTimeout:    60 * time.Second,
+			MaxHeaderBytes: 1 << 13, // 8 KB
+		}
+
+		go func() {
+			logger.Info("eventsub webhook receiver listening", "addr", cfg.EventSubWebhookAddr)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("webhook server error", "error", err)
+				os.Exit(1)
+			}
+		}()
+		defer func() {
+			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer shutdownCancel()
+			srv.Shutdown(shutdownCtx)
+		}()
+
+		// The receiver must be listening before Twitch sends verification challenges.
+		subs.Bind(ctx, twitch.EventSubTransport{
+			Method:   "webhook",
+			Callback: cfg.EventSubWebhookCallback,
+			Secret:   cfg.EventSubWebhookSecret,
+		})
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
@@ -59,7 +109,7 @@ func main() {
 		cancel()
 	}()
 
-	logger.Info("stream-poller started", "interval", cfg.PollInterval)
+	logger.Info("stream-poller started", "interval", cfg.PollInterval, "mode", cfg.IngestionMode)
 	p.Run(ctx, cfg.PollInterval)
 	logger.Info("stream-poller stopped")
 }
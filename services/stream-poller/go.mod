@@ -3,6 +3,8 @@ module github.com/khiemnguyen15/twitch-watcher/services/stream-poller
 go 1.25.0
 
 require (
+	github.com/alicebob/miniredis/v2 v2.36.1
+	github.com/coder/websocket v1.8.14
 	github.com/khiemnguyen15/twitch-watcher/pkg v0.0.0-20260214045458-3c626ebe510c
 	github.com/nats-io/nats.go v1.48.0
 	github.com/redis/go-redis/v9 v9.17.3
@@ -15,6 +17,7 @@ require (
 	github.com/klauspost/compress v1.18.0 // indirect
 	github.com/nats-io/nkeys v0.4.11 // indirect
 	github.com/nats-io/nuid v1.0.1 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
 	golang.org/x/crypto v0.37.0 // indirect
 	golang.org/x/sys v0.32.0 // indirect
 )
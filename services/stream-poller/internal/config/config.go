@@ -7,6 +7,18 @@ import (
 	"time"
 )
 
+// Ingestion modes.
+const (
+	// ModePoll discovers live streams by polling Helix /streams only.
+	ModePoll = "poll"
+	// ModeEventSub receives streamer go-live events over an EventSub WebSocket
+	// and polls only for games and streamers EventSub could not cover.
+	ModeEventSub = "eventsub"
+	// ModeWebhook receives streamer go-live events as EventSub webhook callbacks
+	// and polls only for games and streamers EventSub could not cover.
+	ModeWebhook = "webhook"
+)
+
 // Config holds all stream-poller configuration.
 type Config struct {
 	TwitchClientID     string
@@ -16,6 +28,14 @@ type Config struct {
 	SubscriptionSvcURL string
 	InternalAPIKey     string
 	PollInterval       time.Duration
+
+	IngestionMode          string
+	TwitchUserRefreshToken string
+	EventSubWSURL          string
+
+	EventSubWebhookAddr     string
+	EventSubWebhookCallback string
+	EventSubWebhookSecret   string
 }
 
 // Load reads configuration from environment variables.
@@ -33,6 +53,14 @@ func Load() (*Config, error) {
 		SubscriptionSvcURL: getEnv("SUBSCRIPTION_SVC_URL", "http://localhost:8080"),
 		InternalAPIKey:     os.Getenv("INTERNAL_API_KEY"),
 		PollInterval:       time.Duration(pollSec) * time.Second,
+
+		IngestionMode:          getEnv("INGESTION_MODE", ModePoll),
+		TwitchUserRefreshToken: os.Getenv("TWITCH_USER_REFRESH_TOKEN"),
+		EventSubWSURL:          getEnv("EVENTSUB_WS_URL", "wss://eventsub.wss.twitch.tv/ws"),
+
+		EventSubWebhookAddr:     getEnv("EVENTSUB_WEBHOOK_ADDR", ":8081"),
+		EventSubWebhookCallback: os.Getenv("EVENTSUB_WEBHOOK_CALLBACK"),
+		EventSubWebhookSecret:   os.Getenv("EVENTSUB_WEBHOOK_SECRET"),
 	}
 
 	if cfg.TwitchClientID == "" {
@@ -45,6 +73,25 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("INTERNAL_API_KEY is required")
 	}
 
+	switch cfg.IngestionMode {
+	case ModePoll:
+	case ModeEventSub:
+		// EventSub WebSocket subscriptions must be created with a user access token.
+		if cfg.TwitchUserRefreshToken == "" {
+			return nil, fmt.Errorf("TWITCH_USER_REFRESH_TOKEN is required when INGESTION_MODE=%s", ModeEventSub)
+		}
+	case ModeWebhook:
+		if cfg.EventSubWebhookCallback == "" {
+			return nil, fmt.Errorf("EVENTSUB_WEBHOOK_CALLBACK is required when INGESTION_MODE=%s", ModeWebhook)
+		}
+		// Twitch requires the webhook secret to be 10-100 ASCII characters.
+		if n := len(cfg.EventSubWebhookSecret); n < 10 || n > 100 {
+			return nil, fmt.Errorf("EVENTSUB_WEBHOOK_SECRET must be 10-100 characters when INGESTION_MODE=%s", ModeWebhook)
+		}
+	default:
+		return nil, fmt.Errorf("INGESTION_MODE must be %q, %q or %q", ModePoll, ModeEventSub, ModeWebhook)
+	}
+
 	return cfg, nil
 }
 
@@ -0,0 +1,62 @@
+package eventsub
+
+import (
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"fmt"
+	"time"
+)
+
+// EventSub subscription types handled by the poller.
+const (
+	TypeStreamOnline  = "stream.online"
+	TypeStreamOffline = "stream.offline"
+)
+
+// topics lists the subscriptions created for every watched broadcaster.
+var topics = []string{TypeStreamOnline, TypeStreamOffline}
+
+// StreamOnlineEvent is the event body of a stream.online notification.
+type StreamOnlineEvent struct {
+	ID                   string    `json:"id"`
+	BroadcasterUserID    string    `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string    `json:"broadcaster_user_login"`
+	BroadcasterUserName  string    `json:"broadcaster_user_name"`
+	Type                 string    `json:"type"`
+	StartedAt            time.Time `json:"started_at"`
+}
+
+// StreamOfflineEvent is the event body of a stream.offline notification.
+type StreamOfflineEvent struct {
+	BroadcasterUserID    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	BroadcasterUserName  string `json:"broadcaster_user_name"`
+}
+
+// Handler receives decoded stream notifications, whichever transport delivered them.
+type Handler interface {
+	StreamOnline(ctx context.Context, e StreamOnlineEvent)
+	StreamOffline(ctx context.Context, e StreamOfflineEvent)
+}
+
+// dispatch decodes a notification event body and passes it to h.
+func dispatch(ctx context.Context, h Handler, subType string, event jsontext.Value) error {
+	switch subType {
+	case TypeStreamOnline:
+		var e StreamOnlineEvent
+		if err := json.Unmarshal(event, &e); err != nil {
+			return fmt.Errorf("decode %s event: %w", subType, err)
+		}
+		h.StreamOnline(ctx, e)
+	case TypeStreamOffline:
+		var e StreamOfflineEvent
+		if err := json.Unmarshal(event, &e); err != nil {
+			return fmt.Errorf("decode %s event: %w", subType, err)
+		}
+		h.StreamOffline(ctx, e)
+	default:
+		return fmt.Errorf("unsupported subscription type %q", subType)
+	}
+	return nil
+}
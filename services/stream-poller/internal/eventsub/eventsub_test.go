@@ -0,0 +1,405 @@
+package eventsub
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/twitch"
+)
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// fakeAPI records subscription calls and starts failing with 429 after limit creates.
+type fakeAPI struct {
+	mu       sync.Mutex
+	created  []twitch.EventSubSubscription
+	deleted  []string
+	existing []twitch.EventSubSubscription
+	limit    int
+	bound    chan string
+}
+
+func newFakeAPI() *fakeAPI {
+	return &fakeAPI{limit: 1000, bound: make(chan string, 100)}
+}
+
+func (f *fakeAPI) GetUsers(_ context.Context, logins []string) ([]twitch.User, error) {
+	users := make([]twitch.User, len(logins))
+	for i, l := range logins {
+		users[i] = twitch.User{ID: "id-" + l, Login: l}
+	}
+	return users, nil
+}
+
+func (f *fakeAPI) CreateEventSubSubscription(
+	_ context.Context,
+	subType, version string,
+	condition map[string]string,
+	transport twitch.EventSubTransport,
+) (*twitch.EventSubSubscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.created) >= f.limit {
+		return nil, &twitch.APIError{Method: http.MethodPost, StatusCode: http.StatusTooManyRequests}
+	}
+	sub := twitch.EventSubSubscription{
+		ID:        fmt.Sprintf("sub-%d", len(f.created)),
+		Type:      subType,
+		Version:   version,
+		Condition: condition,
+		Transport: transport,
+	}
+	f.created = append(f.created, sub)
+	f.bound <- transport.SessionID
+	return &sub, nil
+}
+
+func (f *fakeAPI) DeleteEventSubSubscription(_ context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deleted = append(f.deleted, id)
+	return nil
+}
+
+func (f *fakeAPI) GetEventSubSubscriptions(context.Context) ([]twitch.EventSubSubscription, error) {
+	return f.existing, nil
+}
+
+// fakeHandler forwards events to channels.
+type fakeHandler struct {
+	online  chan StreamOnlineEvent
+	offline chan StreamOfflineEvent
+}
+
+func newFakeHandler() *fakeHandler {
+	return &fakeHandler{online: make(chan StreamOnlineEvent, 10), offline: make(chan StreamOfflineEvent, 10)}
+}
+
+func (h *fakeHandler) StreamOnline(_ context.Context, e StreamOnlineEvent)   { h.online <- e }
+func (h *fakeHandler) StreamOffline(_ context.Context, e StreamOfflineEvent) { h.offline <- e }
+
+func welcome(sessionID string, keepalive int) string {
+	return fmt.Sprintf(`{"metadata":{"message_id":"w-%[1]s","message_type":"session_welcome","message_timestamp":"2026-01-01T00:00:00Z"},
+		"payload":{"session":{"id":%[1]q,"status":"connected","keepalive_timeout_seconds":%[2]d,"reconnect_url":null}}}`,
+		sessionID, keepalive)
+}
+
+func reconnect(url string) string {
+	return fmt.Sprintf(`{"metadata":{"message_id":"r1","message_type":"session_reconnect","message_timestamp":"2026-01-01T00:00:00Z"},
+		"payload":{"session":{"id":"old","status":"reconnecting","keepalive_timeout_seconds":null,"reconnect_url":%q}}}`, url)
+}
+
+func onlineNotification(login string) string {
+	return fmt.Sprintf(`{"metadata":{"message_id":"n-%[1]s","message_type":"notification","message_timestamp":"2026-01-01T00:00:00Z","subscription_type":"stream.online"},
+		"payload":{"subscription":{"id":"sub-0","status":"enabled","type":"stream.online","version":"1","condition":{"broadcaster_user_id":"id-%[1]s"},"transport":{"method":"websocket","session_id":"s1"},"created_at":"2026-01-01T00:00:00Z","cost":1},
+		"event":{"id":"stream-1","broadcaster_user_id":"id-%[1]s","broadcaster_user_login":%[1]q,"broadcaster_user_name":%[1]q,"type":"live","started_at":"2026-01-01T00:00:00Z"}}}`, login)
+}
+
+// wsServer runs script for each accepted connection.
+func wsServer(t *testing.T, script func(ctx context.Context, conn *websocket.Conn)) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			t.Errorf("accept: %v", err)
+			return
+		}
+		defer conn.CloseNow()
+		script(r.Context(), conn)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func wsURL(srv *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func write(ctx context.Context, conn *websocket.Conn, msg string) {
+	_ = conn.Write(ctx, websocket.MessageText, []byte(msg))
+}
+
+func waitFor[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting")
+		panic("unreachable")
+	}
+}
+
+func TestClient_WelcomeBindsAndDispatchesNotification(t *testing.T) {
+	api := newFakeAPI()
+	subs := NewManager(api, testLogger)
+	subs.Watch(context.Background(), []string{"streamer1"})
+
+	srv := wsServer(t, func(ctx context.Context, conn *websocket.Conn) {
+		write(ctx, conn, welcome("s1", 10))
+		// Twitch only delivers notifications once a subscription exists.
+		<-api.bound
+		write(ctx, conn, onlineNotification("streamer1"))
+		<-ctx.Done()
+	})
+
+	h := newFakeHandler()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go NewClient(wsURL(srv), subs, h, testLogger).Run(ctx)
+
+	e := waitFor(t, h.online)
+	if e.BroadcasterUserLogin != "streamer1" || e.ID != "stream-1" {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if !subs.Covers("streamer1") {
+		t.Error("streamer1 should be covered after bind")
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if len(api.created) != len(topics) {
+		t.Fatalf("created %d subscriptions, want %d", len(api.created), len(topics))
+	}
+	for _, sub := range api.created {
+		if sub.Transport.Method != "websocket" || sub.Transport.SessionID != "s1" {
+			t.Errorf("unexpected transport %+v", sub.Transport)
+		}
+		if sub.Condition["broadcaster_user_id"] != "id-streamer1" {
+			t.Errorf("unexpected condition %+v", sub.Condition)
+		}
+	}
+}
+
+func TestClient_ReconnectKeepsSubscriptions(t *testing.T) {
+	api := newFakeAPI()
+	subs := NewManager(api, testLogger)
+	subs.Watch(context.Background(), []string{"streamer1"})
+
+	second := wsServer(t, func(ctx context.Context, conn *websocket.Conn) {
+		write(ctx, conn, welcome("s2", 10))
+		write(ctx, conn, onlineNotification("streamer1"))
+		<-ctx.Done()
+	})
+	first := wsServer(t, func(ctx context.Context, conn *websocket.Conn) {
+		write(ctx, conn, welcome("s1", 10))
+		<-api.bound
+		<-api.bound
+		write(ctx, conn, reconnect(wsURL(second)))
+		<-ctx.Done()
+	})
+
+	h := newFakeHandler()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go NewClient(wsURL(first), subs, h, testLogger).Run(ctx)
+
+	waitFor(t, h.online)
+
+	api.mu.Lock()
+	if len(api.created) != len(topics) {
+		t.Errorf("created %d subscriptions, want %d (reconnect must not resubscribe)", len(api.created), len(topics))
+	}
+	api.mu.Unlock()
+
+	// Streamers watched after the reconnect are subscribed on the new session.
+	subs.Watch(ctx, []string{"streamer1", "streamer2"})
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if len(api.created) != 2*len(topics) {
+		t.Fatalf("created %d subscriptions, want %d", len(api.created), 2*len(topics))
+	}
+	for _, sub := range api.created[len(topics):] {
+		if sub.Transport.SessionID != "s2" {
+			t.Errorf("subscription created on session %q after reconnect, want s2", sub.Transport.SessionID)
+		}
+	}
+	if !subs.Covers("streamer1") {
+		t.Error("streamer1 should stay covered across the reconnect")
+	}
+}
+
+func TestClient_KeepaliveTimeoutReconnects(t *testing.T) {
+	api := newFakeAPI()
+	subs := NewManager(api, testLogger)
+
+	var mu sync.Mutex
+	connections := 0
+	reconnected := make(chan struct{})
+	srv := wsServer(t, func(ctx context.Context, conn *websocket.Conn) {
+		mu.Lock()
+		connections++
+		n := connections
+		mu.Unlock()
+
+		write(ctx, conn, welcome(fmt.Sprintf("s%d", n), 1))
+		if n == 2 {
+			close(reconnected)
+		}
+		// Never send a keepalive; the client should give up on this session.
+		<-ctx.Done()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go NewClient(wsURL(srv), subs, newFakeHandler(), testLogger).Run(ctx)
+
+	waitFor(t, reconnected)
+}
+
+func TestClient_RevocationForgetsSubscription(t *testing.T) {
+	api := newFakeAPI()
+	subs := NewManager(api, testLogger)
+	subs.Watch(context.Background(), []string{"streamer1"})
+
+	done := make(chan struct{})
+	srv := wsServer(t, func(ctx context.Context, conn *websocket.Conn) {
+		write(ctx, conn, welcome("s1", 10))
+		<-api.bound
+		<-api.bound
+		write(ctx, conn, `{"metadata":{"message_id":"v1","message_type":"revocation","message_timestamp":"2026-01-01T00:00:00Z","subscription_type":"stream.online"},
+			"payload":{"subscription":{"id":"sub-0","status":"authorization_revoked","type":"stream.online","version":"1","condition":{},"transport":{"method":"websocket","session_id":"s1"},"created_at":"2026-01-01T00:00:00Z","cost":1}}}`)
+		write(ctx, conn, `{"metadata":{"message_id":"k1","message_type":"session_keepalive","message_timestamp":"2026-01-01T00:00:00Z"},"payload":{}}`)
+		close(done)
+		<-ctx.Done()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go NewClient(wsURL(srv), subs, newFakeHandler(), testLogger).Run(ctx)
+
+	waitFor(t, done)
+	deadline := time.Now().Add(2 * time.Second)
+	for subs.Covers("streamer1") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if subs.Covers("streamer1") {
+		t.Error("streamer1 should not be covered after its stream.online subscription was revoked")
+	}
+}
+
+func TestManager_WatchCreatesAndDeletes(t *testing.T) {
+	api := newFakeAPI()
+	subs := NewManager(api, testLogger)
+	ctx := context.Background()
+
+	subs.Watch(ctx, []string{"a", "b"})
+	if len(api.created) != 0 {
+		t.Fatalf("no subscriptions should be created before Bind, got %d", len(api.created))
+	}
+
+	subs.Bind(ctx, twitch.EventSubTransport{Method: "websocket", SessionID: "s1"})
+	if len(api.created) != 2*len(topics) {
+		t.Fatalf("created = %d, want %d", len(api.created), 2*len(topics))
+	}
+
+	subs.Watch(ctx, []string{"a"})
+	if len(api.deleted) != len(topics) {
+		t.Errorf("deleted = %d, want %d", len(api.deleted), len(topics))
+	}
+	if !subs.Covers("a") || subs.Covers("b") {
+		t.Errorf("coverage wrong: a=%v b=%v", subs.Covers("a"), subs.Covers("b"))
+	}
+}
+
+// blockingAPI holds GetUsers until release is closed.
+type blockingAPI struct {
+	*fakeAPI
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingAPI) GetUsers(ctx context.Context, logins []string) ([]twitch.User, error) {
+	close(b.entered)
+	<-b.release
+	return b.fakeAPI.GetUsers(ctx, logins)
+}
+
+func TestManager_CoversDoesNotWaitForHelix(t *testing.T) {
+	api := &blockingAPI{fakeAPI: newFakeAPI(), entered: make(chan struct{}), release: make(chan struct{})}
+	subs := NewManager(api, testLogger)
+	ctx := context.Background()
+	subs.Bind(ctx, twitch.EventSubTransport{Method: "websocket", SessionID: "s1"})
+
+	synced := make(chan struct{})
+	go func() {
+		subs.Watch(ctx, []string{"a"})
+		close(synced)
+	}()
+	<-api.entered
+
+	covered := make(chan bool)
+	go func() { covered <- subs.Covers("a") }()
+	select {
+	case ok := <-covered:
+		if ok {
+			t.Error("a should not be covered before its subscriptions exist")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Covers blocked while Watch was calling Helix")
+	}
+
+	close(api.release)
+	<-synced
+	if !subs.Covers("a") {
+		t.Error("a should be covered once Watch returns")
+	}
+}
+
+func TestManager_CostLimitLeavesStreamersUncovered(t *testing.T) {
+	api := newFakeAPI()
+	api.limit = len(topics) // room for exactly one broadcaster
+	subs := NewManager(api, testLogger)
+	ctx := context.Background()
+
+	subs.Bind(ctx, twitch.EventSubTransport{Method: "websocket", SessionID: "s1"})
+	subs.Watch(ctx, []string{"a", "b", "c"})
+
+	covered := 0
+	for _, login := range []string{"a", "b", "c"} {
+		if subs.Covers(login) {
+			covered++
+		}
+	}
+	if covered != 1 {
+		t.Errorf("covered = %d, want 1", covered)
+	}
+}
+
+func TestManager_BindAdoptsExistingWebhookSubscriptions(t *testing.T) {
+	transport := twitch.EventSubTransport{Method: "webhook", Callback: "https://example.com/eventsub"}
+	api := newFakeAPI()
+	api.existing = []twitch.EventSubSubscription{
+		{ID: "old-online", Status: "enabled", Type: TypeStreamOnline,
+			Condition: map[string]string{"broadcaster_user_id": "id-a"}, Transport: transport},
+		{ID: "old-offline", Status: "webhook_callback_verification_failed", Type: TypeStreamOffline,
+			Condition: map[string]string{"broadcaster_user_id": "id-a"}, Transport: transport},
+		{ID: "other-callback", Status: "enabled", Type: TypeStreamOnline,
+			Condition: map[string]string{"broadcaster_user_id": "id-b"},
+			Transport: twitch.EventSubTransport{Method: "webhook", Callback: "https://other.example.com"}},
+	}
+	subs := NewManager(api, testLogger)
+	ctx := context.Background()
+
+	subs.Bind(ctx, transport)
+	if len(api.deleted) != 1 || api.deleted[0] != "old-offline" {
+		t.Errorf("deleted = %v, want only the failed subscription", api.deleted)
+	}
+
+	subs.Watch(ctx, []string{"a"})
+	if len(api.created) != 1 || api.created[0].Type != TypeStreamOffline {
+		t.Errorf("created = %+v, want only a replacement stream.offline", api.created)
+	}
+	if !subs.Covers("a") {
+		t.Error("a should be covered by the adopted stream.online subscription")
+	}
+}
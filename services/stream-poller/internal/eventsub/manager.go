@@ -0,0 +1,289 @@
+package eventsub
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/twitch"
+)
+
+// Subscription statuses that mean a subscription is usable.
+const (
+	statusEnabled             = "enabled"
+	statusVerificationPending = "webhook_callback_verification_pending"
+)
+
+// SubscriptionAPI is the subset of the Helix client used to manage EventSub subscriptions.
+type SubscriptionAPI interface {
+	GetUsers(ctx context.Context, logins []string) ([]twitch.User, error)
+	CreateEventSubSubscription(
+		ctx context.Context,
+		subType, version string,
+		condition map[string]string,
+		transport twitch.EventSubTransport,
+	) (*twitch.EventSubSubscription, error)
+	DeleteEventSubSubscription(ctx context.Context, id string) error
+	GetEventSubSubscriptions(ctx context.Context) ([]twitch.EventSubSubscription, error)
+}
+
+// Manager keeps one stream.online and one stream.offline subscription per
+// watched broadcaster on the current transport. Broadcasters it cannot
+// subscribe (e.g. once the transport's cost limit is reached) are left
+// uncovered so the poller keeps polling them.
+//
+// Helix is never called with mu held, so Covers answers immediately while a
+// slow reconciliation is in progress.
+type Manager struct {
+	api    SubscriptionAPI
+	logger *slog.Logger
+
+	syncMu sync.Mutex // serialises Watch and Bind, which call Helix
+
+	mu        sync.Mutex
+	transport *twitch.EventSubTransport
+	watching  bool // set once Watch has provided the desired set
+	desired   map[string]struct{}
+	userIDs   map[string]string            // login → broadcaster user ID
+	active    map[string]map[string]string // broadcaster user ID → subscription type → subscription ID
+}
+
+// NewManager creates a Manager. No subscriptions are created until Bind is called.
+func NewManager(api SubscriptionAPI, logger *slog.Logger) *Manager {
+	return &Manager{
+		api:     api,
+		logger:  logger,
+		desired: make(map[string]struct{}),
+		userIDs: make(map[string]string),
+		active:  make(map[string]map[string]string),
+	}
+}
+
+// Watch replaces the set of streamer logins that should be subscribed and
+// reconciles subscriptions against it.
+func (m *Manager) Watch(ctx context.Context, logins []string) {
+	m.syncMu.Lock()
+	defer m.syncMu.Unlock()
+
+	m.mu.Lock()
+	m.watching = true
+	m.desired = make(map[string]struct{}, len(logins))
+	for _, login := range logins {
+		m.desired[login] = struct{}{}
+	}
+	m.mu.Unlock()
+
+	m.sync(ctx)
+}
+
+// Bind points subscriptions at a new transport, such as a fresh WebSocket
+// session. Subscriptions tied to the previous transport are forgotten, since
+// Twitch disables them when that transport goes away.
+func (m *Manager) Bind(ctx context.Context, transport twitch.EventSubTransport) {
+	m.syncMu.Lock()
+	defer m.syncMu.Unlock()
+
+	m.mu.Lock()
+	m.transport = &transport
+	m.active = make(map[string]map[string]string)
+	m.mu.Unlock()
+
+	if transport.Method == "webhook" {
+		m.adopt(ctx, transport)
+	}
+	m.sync(ctx)
+}
+
+// Rebind points subscriptions created from now on at transport while keeping
+// the existing ones, for a session_reconnect after which Twitch carries them
+// over to the new session.
+func (m *Manager) Rebind(transport twitch.EventSubTransport) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transport = &transport
+}
+
+// Covers reports whether login currently has a stream.online subscription.
+func (m *Manager) Covers(login string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.active[m.userIDs[login]][TypeStreamOnline]
+	return ok
+}
+
+// Revoked forgets a subscription that Twitch revoked. It is recreated on the
+// next sync if the broadcaster is still watched.
+func (m *Manager) Revoked(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for userID, subs := range m.active {
+		for subType, subID := range subs {
+			if subID == id {
+				m.forget(userID, subType)
+			}
+		}
+	}
+}
+
+// remember records subscription id as the subType subscription of userID.
+// Callers must hold m.mu.
+func (m *Manager) remember(userID, subType, id string) {
+	if m.active[userID] == nil {
+		m.active[userID] = make(map[string]string)
+	}
+	m.active[userID][subType] = id
+}
+
+// forget drops the subType subscription of userID. Callers must hold m.mu.
+func (m *Manager) forget(userID, subType string) {
+	delete(m.active[userID], subType)
+	if len(m.active[userID]) == 0 {
+		delete(m.active, userID)
+	}
+}
+
+// adopt takes over subscriptions a previous run created for the same webhook
+// callback, so a restart neither duplicates them nor fails with 409 Conflict.
+// Subscriptions that are no longer enabled are deleted and recreated by sync.
+// Callers must hold m.syncMu.
+func (m *Manager) adopt(ctx context.Context, transport twitch.EventSubTransport) {
+	existing, err := m.api.GetEventSubSubscriptions(ctx)
+	if err != nil {
+		m.logger.Warn("list eventsub subscriptions failed", "error", err)
+		return
+	}
+
+	for _, sub := range existing {
+		if sub.Transport.Method != transport.Method || sub.Transport.Callback != transport.Callback {
+			continue
+		}
+		if !slices.Contains(topics, sub.Type) {
+			continue
+		}
+		if sub.Status != statusEnabled && sub.Status != statusVerificationPending {
+			if err := m.api.DeleteEventSubSubscription(ctx, sub.ID); err != nil {
+				m.logger.Warn("delete stale eventsub subscription failed", "subscription_id", sub.ID, "error", err)
+			}
+			continue
+		}
+
+		m.mu.Lock()
+		m.remember(sub.Condition["broadcaster_user_id"], sub.Type, sub.ID)
+		m.mu.Unlock()
+	}
+}
+
+// subscriptionKey names one subscription of one broadcaster.
+type subscriptionKey struct {
+	userID, login, subType, id string
+}
+
+// sync creates and deletes subscriptions so that active matches desired.
+// Nothing happens until both a transport and a desired set are known, so
+// adopted subscriptions are not deleted before the first Watch.
+// Callers must hold m.syncMu.
+func (m *Manager) sync(ctx context.Context) {
+	m.mu.Lock()
+	ready := m.transport != nil && m.watching
+	m.mu.Unlock()
+	if !ready {
+		return
+	}
+
+	if err := m.resolveUserIDs(ctx); err != nil {
+		m.logger.Error("resolve broadcaster IDs failed", "error", err)
+		return
+	}
+
+	m.mu.Lock()
+	transport := *m.transport
+	desiredIDs := make(map[string]string, len(m.desired)) // broadcaster user ID → login
+	for login := range m.desired {
+		if userID, ok := m.userIDs[login]; ok {
+			desiredIDs[userID] = login
+		}
+	}
+	var stale, missing []subscriptionKey
+	for userID, subs := range m.active {
+		if _, ok := desiredIDs[userID]; ok {
+			continue
+		}
+		for subType, id := range subs {
+			stale = append(stale, subscriptionKey{userID: userID, subType: subType, id: id})
+		}
+	}
+	for userID, login := range desiredIDs {
+		for _, subType := range topics {
+			if _, ok := m.active[userID][subType]; !ok {
+				missing = append(missing, subscriptionKey{userID: userID, login: login, subType: subType})
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	for _, sub := range stale {
+		if err := m.api.DeleteEventSubSubscription(ctx, sub.id); err != nil {
+			m.logger.Warn("delete eventsub subscription failed", "broadcaster_id", sub.userID, "type", sub.subType, "error", err)
+			continue
+		}
+		m.mu.Lock()
+		m.forget(sub.userID, sub.subType)
+		m.mu.Unlock()
+	}
+
+	created := 0
+	for _, want := range missing {
+		sub, err := m.api.CreateEventSubSubscription(ctx, want.subType, "1",
+			map[string]string{"broadcaster_user_id": want.userID}, transport)
+		if err != nil {
+			var apiErr *twitch.APIError
+			if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests {
+				m.logger.Warn("eventsub subscription limit reached; remaining streamers fall back to polling",
+					"error", err)
+				return
+			}
+			m.logger.Warn("create eventsub subscription failed", "user_login", want.login, "type", want.subType, "error", err)
+			continue
+		}
+		m.mu.Lock()
+		m.remember(want.userID, want.subType, sub.ID)
+		m.mu.Unlock()
+		created++
+	}
+
+	if created > 0 {
+		m.logger.Info("eventsub subscriptions created", "count", created, "transport", transport.Method)
+	}
+}
+
+// resolveUserIDs looks up broadcaster IDs for desired logins not yet known.
+// Callers must hold m.syncMu.
+func (m *Manager) resolveUserIDs(ctx context.Context) error {
+	m.mu.Lock()
+	var missing []string
+	for login := range m.desired {
+		if _, ok := m.userIDs[login]; !ok {
+			missing = append(missing, login)
+		}
+	}
+	m.mu.Unlock()
+	if len(missing) == 0 {
+		return nil
+	}
+
+	users, err := m.api.GetUsers(ctx, missing)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range users {
+		m.userIDs[u.Login] = u.ID
+	}
+	return nil
+}
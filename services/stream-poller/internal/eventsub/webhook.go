@@ -0,0 +1,195 @@
+package eventsub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/twitch"
+)
+
+// EventSub webhook request headers.
+const (
+	headerMessageID        = "Twitch-Eventsub-Message-Id"
+	headerMessageTimestamp = "Twitch-Eventsub-Message-Timestamp"
+	headerMessageSignature = "Twitch-Eventsub-Message-Signature"
+	headerMessageType      = "Twitch-Eventsub-Message-Type"
+)
+
+// Webhook message types.
+const (
+	msgWebhookVerification = "webhook_callback_verification"
+)
+
+const (
+	// maxMessageAge is how old a webhook message may be before it is rejected
+	// as a possible replay. Message IDs are remembered for the same window.
+	maxMessageAge = 10 * time.Minute
+
+	replayKeyPrefix = "eventsub:msg:"
+)
+
+// ReplayGuard remembers webhook message IDs that have already been handled.
+type ReplayGuard interface {
+	// Seen records id and reports whether it had already been recorded.
+	Seen(ctx context.Context, id string) (bool, error)
+}
+
+// ValkeyReplayGuard is a ReplayGuard shared across replicas through Valkey.
+type ValkeyReplayGuard struct {
+	cache *redis.Client
+}
+
+// NewValkeyReplayGuard creates a ValkeyReplayGuard.
+func NewValkeyReplayGuard(cache *redis.Client) *ValkeyReplayGuard {
+	return &ValkeyReplayGuard{cache: cache}
+}
+
+// Seen implements ReplayGuard with SETNX on a key that expires after maxMessageAge.
+func (g *ValkeyReplayGuard) Seen(ctx context.Context, id string) (bool, error) {
+	set, err := g.cache.SetNX(ctx, replayKeyPrefix+id, "1", maxMessageAge).Result()
+	if err != nil {
+		return false, err
+	}
+	return !set, nil
+}
+
+type webhookPayload struct {
+	Challenge    string                      `json:"challenge"`
+	Subscription twitch.EventSubSubscription `json:"subscription"`
+	Event        jsontext.Value              `json:"event"`
+}
+
+// WebhookHandler receives EventSub webhook callbacks. Every request must carry
+// a valid HMAC-SHA256 signature made with the subscription secret; messages
+// older than maxMessageAge or already seen are dropped.
+type WebhookHandler struct {
+	secret  []byte
+	guard   ReplayGuard
+	subs    *Manager
+	handler Handler
+	logger  *slog.Logger
+}
+
+// NewWebhookHandler creates a WebhookHandler. secret must match the one
+// passed to Twitch in the webhook transport.
+func NewWebhookHandler(secret string, guard ReplayGuard, subs *Manager, h Handler, logger *slog.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		secret:  []byte(secret),
+		guard:   guard,
+		subs:    subs,
+		handler: h,
+		logger:  logger,
+	}
+}
+
+// ServeHTTP handles POST requests from Twitch to the callback URL.
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageSize))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	id := r.Header.Get(headerMessageID)
+	timestamp := r.Header.Get(headerMessageTimestamp)
+	if !h.validSignature(id, timestamp, body, r.Header.Get(headerMessageSignature)) {
+		h.logger.Warn("eventsub webhook signature mismatch", "message_id", id)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	sent, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil || time.Since(sent) > maxMessageAge || time.Until(sent) > maxMessageAge {
+		h.logger.Warn("eventsub webhook timestamp outside replay window", "message_id", id, "timestamp", timestamp)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	var p webhookPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	msgType := r.Header.Get(headerMessageType)
+	switch msgType {
+	case msgWebhookVerification:
+		// Answered before the replay check: if a response is lost, Twitch
+		// resends the challenge with the same message ID, and a 204 would leave
+		// the subscription unverified.
+		h.logger.Info("eventsub webhook verified", "subscription_id", p.Subscription.ID, "type", p.Subscription.Type)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, p.Challenge)
+		return
+	case msgNotification, msgRevocation:
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	seen, err := h.guard.Seen(r.Context(), id)
+	if err != nil {
+		h.logger.Error("eventsub replay check failed", "message_id", id, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if seen {
+		// Twitch retries until it gets a 2xx, so acknowledge duplicates.
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	switch msgType {
+	case msgNotification:
+		// Twitch expects a response within a few seconds; handlers may call Helix.
+		ctx := context.WithoutCancel(r.Context())
+		go func() {
+			if err := dispatch(ctx, h.handler, p.Subscription.Type, p.Event); err != nil {
+				h.logger.Error("handle eventsub notification failed", "message_id", id, "error", err)
+			}
+		}()
+		w.WriteHeader(http.StatusNoContent)
+	case msgRevocation:
+		h.subs.Revoked(p.Subscription.ID)
+		h.logger.Warn("eventsub subscription revoked",
+			"subscription_id", p.Subscription.ID,
+			"type", p.Subscription.Type,
+			"status", p.Subscription.Status,
+		)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// validSignature checks the sha256=<hex> signature over id + timestamp + body.
+func (h *WebhookHandler) validSignature(id, timestamp string, body []byte, signature string) bool {
+	got, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	gotMAC, err := hex.DecodeString(got)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(id))
+	mac.Write([]byte(timestamp))
+	mac.Write(body)
+	return hmac.Equal(gotMAC, mac.Sum(nil))
+}
@@ -0,0 +1,158 @@
+package eventsub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef"
+
+// memoryGuard is an in-memory ReplayGuard.
+type memoryGuard struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func (g *memoryGuard) Seen(_ context.Context, id string) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.seen == nil {
+		g.seen = make(map[string]bool)
+	}
+	was := g.seen[id]
+	g.seen[id] = true
+	return was, nil
+}
+
+func newTestWebhookHandler(h Handler) *WebhookHandler {
+	return NewWebhookHandler(testSecret, &memoryGuard{}, NewManager(newFakeAPI(), testLogger), h, testLogger)
+}
+
+func sign(secret, id, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(id + timestamp + body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookRequest(msgType, id string, sent time.Time, body, signature string) *http.Request {
+	ts := sent.UTC().Format(time.RFC3339Nano)
+	if signature == "" {
+		signature = sign(testSecret, id, ts, body)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/eventsub", strings.NewReader(body))
+	req.Header.Set(headerMessageID, id)
+	req.Header.Set(headerMessageTimestamp, ts)
+	req.Header.Set(headerMessageSignature, signature)
+	req.Header.Set(headerMessageType, msgType)
+	return req
+}
+
+const onlineWebhookBody = `{"subscription":{"id":"sub-1","status":"enabled","type":"stream.online","version":"1",
+	"condition":{"broadcaster_user_id":"1"},"transport":{"method":"webhook","callback":"https://example.com/eventsub"},
+	"created_at":"2026-01-01T00:00:00Z","cost":1},
+	"event":{"id":"stream-1","broadcaster_user_id":"1","broadcaster_user_login":"streamer1","broadcaster_user_name":"Streamer1","type":"live","started_at":"2026-01-01T00:00:00Z"}}`
+
+func TestWebhook_VerificationChallenge(t *testing.T) {
+	body := `{"challenge":"pogchamp-kappa-360noscope-vohiyo","subscription":{"id":"sub-1","status":"webhook_callback_verification_pending","type":"stream.online","version":"1","condition":{},"transport":{"method":"webhook","callback":"https://example.com"},"created_at":"2026-01-01T00:00:00Z","cost":1}}`
+	wh := newTestWebhookHandler(newFakeHandler())
+
+	// A challenge resent with the same message ID is answered again.
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		wh.ServeHTTP(rr, webhookRequest(msgWebhookVerification, "m1", time.Now(), body, ""))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("attempt %d: status = %d, want 200", i, rr.Code)
+		}
+		if got := rr.Body.String(); got != "pogchamp-kappa-360noscope-vohiyo" {
+			t.Errorf("attempt %d: body = %q, want the challenge", i, got)
+		}
+	}
+}
+
+func TestWebhook_NotificationDispatched(t *testing.T) {
+	h := newFakeHandler()
+	rr := httptest.NewRecorder()
+	newTestWebhookHandler(h).ServeHTTP(rr, webhookRequest(msgNotification, "m1", time.Now(), onlineWebhookBody, ""))
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204", rr.Code)
+	}
+	e := waitFor(t, h.online)
+	if e.BroadcasterUserLogin != "streamer1" {
+		t.Errorf("unexpected event %+v", e)
+	}
+}
+
+func TestWebhook_InvalidSignatureRejected(t *testing.T) {
+	cases := map[string]string{
+		"wrong secret":  sign("another-secret-value", "m1", time.Now().UTC().Format(time.RFC3339Nano), onlineWebhookBody),
+		"missing":       "",
+		"no prefix":     "deadbeef",
+		"not hex":       "sha256=zz",
+		"truncated mac": "sha256=abcd",
+	}
+	for name, sig := range cases {
+		t.Run(name, func(t *testing.T) {
+			h := newFakeHandler()
+			req := webhookRequest(msgNotification, "m1", time.Now(), onlineWebhookBody, "placeholder")
+			req.Header.Set(headerMessageSignature, sig)
+
+			rr := httptest.NewRecorder()
+			newTestWebhookHandler(h).ServeHTTP(rr, req)
+			if rr.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want 403", rr.Code)
+			}
+		})
+	}
+}
+
+func TestWebhook_TamperedBodyRejected(t *testing.T) {
+	ts := time.Now().UTC().Format(time.RFC3339Nano)
+	req := webhookRequest(msgNotification, "m1", time.Now(), strings.Replace(onlineWebhookBody, "streamer1", "evil", 1),
+		sign(testSecret, "m1", ts, onlineWebhookBody))
+	req.Header.Set(headerMessageTimestamp, ts)
+
+	rr := httptest.NewRecorder()
+	newTestWebhookHandler(newFakeHandler()).ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rr.Code)
+	}
+}
+
+func TestWebhook_StaleTimestampRejected(t *testing.T) {
+	rr := httptest.NewRecorder()
+	req := webhookRequest(msgNotification, "m1", time.Now().Add(-maxMessageAge-time.Minute), onlineWebhookBody, "")
+	newTestWebhookHandler(newFakeHandler()).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rr.Code)
+	}
+}
+
+func TestWebhook_ReplayedMessageIgnored(t *testing.T) {
+	h := newFakeHandler()
+	wh := newTestWebhookHandler(h)
+
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		wh.ServeHTTP(rr, webhookRequest(msgNotification, "same-id", time.Now(), onlineWebhookBody, ""))
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("attempt %d: status = %d, want 204", i, rr.Code)
+		}
+	}
+
+	waitFor(t, h.online)
+	select {
+	case e := <-h.online:
+		t.Errorf("replayed message dispatched again: %+v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,209 @@
+package eventsub
+
+import (
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/twitch"
+)
+
+const (
+	defaultKeepalive    = 10 * time.Second
+	welcomeTimeout      = 10 * time.Second
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = 2 * time.Minute
+	maxMessageSize      = 1 << 20
+)
+
+// WebSocket message types.
+const (
+	msgSessionWelcome   = "session_welcome"
+	msgSessionKeepalive = "session_keepalive"
+	msgSessionReconnect = "session_reconnect"
+	msgNotification     = "notification"
+	msgRevocation       = "revocation"
+)
+
+type wsMessage struct {
+	Metadata struct {
+		MessageID        string    `json:"message_id"`
+		MessageType      string    `json:"message_type"`
+		MessageTimestamp time.Time `json:"message_timestamp"`
+		SubscriptionType string    `json:"subscription_type"`
+	} `json:"metadata"`
+	Payload jsontext.Value `json:"payload"`
+}
+
+type session struct {
+	ID                      string `json:"id"`
+	Status                  string `json:"status"`
+	KeepaliveTimeoutSeconds int    `json:"keepalive_timeout_seconds"`
+	ReconnectURL            string `json:"reconnect_url"`
+}
+
+// keepalive is how long to wait for any message before treating the
+// connection as dead: the advertised keepalive plus half again as grace.
+func (s session) keepalive() time.Duration {
+	d := defaultKeepalive
+	if s.KeepaliveTimeoutSeconds > 0 {
+		d = time.Duration(s.KeepaliveTimeoutSeconds) * time.Second
+	}
+	return d + d/2
+}
+
+type sessionPayload struct {
+	Session session `json:"session"`
+}
+
+type notificationPayload struct {
+	Subscription twitch.EventSubSubscription `json:"subscription"`
+	Event        jsontext.Value              `json:"event"`
+}
+
+// Client receives EventSub notifications over a WebSocket session and keeps
+// the Manager's subscriptions bound to the live session.
+type Client struct {
+	url     string
+	subs    *Manager
+	handler Handler
+	logger  *slog.Logger
+}
+
+// NewClient creates a WebSocket EventSub client connecting to url.
+func NewClient(url string, subs *Manager, h Handler, logger *slog.Logger) *Client {
+	return &Client{url: url, subs: subs, handler: h, logger: logger}
+}
+
+// Run connects to EventSub and processes messages until ctx is cancelled,
+// reconnecting with exponential backoff whenever the connection drops.
+func (c *Client) Run(ctx context.Context) {
+	backoff := minReconnectBackoff
+
+	for {
+		conn, sess, err := c.connect(ctx, c.url)
+		if err == nil {
+			backoff = minReconnectBackoff
+			c.logger.Info("eventsub session started", "session_id", sess.ID)
+			c.subs.Bind(ctx, twitch.EventSubTransport{Method: "websocket", SessionID: sess.ID})
+			err = c.serve(ctx, conn, sess)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		c.logger.Warn("eventsub connection lost", "error", err, "retry_in", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxReconnectBackoff)
+	}
+}
+
+// connect dials url and waits for the session_welcome message.
+func (c *Client) connect(ctx context.Context, url string) (*websocket.Conn, session, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, welcomeTimeout)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(dialCtx, url, nil)
+	if err != nil {
+		return nil, session{}, fmt.Errorf("dial eventsub: %w", err)
+	}
+	conn.SetReadLimit(maxMessageSize)
+
+	msg, err := readMessage(dialCtx, conn)
+	if err != nil {
+		conn.CloseNow()
+		return nil, session{}, fmt.Errorf("read welcome: %w", err)
+	}
+	if msg.Metadata.MessageType != msgSessionWelcome {
+		conn.CloseNow()
+		return nil, session{}, fmt.Errorf("expected %s, got %s", msgSessionWelcome, msg.Metadata.MessageType)
+	}
+
+	var p sessionPayload
+	if err := json.Unmarshal(msg.Payload, &p); err != nil {
+		conn.CloseNow()
+		return nil, session{}, fmt.Errorf("decode welcome: %w", err)
+	}
+	return conn, p.Session, nil
+}
+
+// serve reads messages until the connection fails. A session_reconnect
+// swaps to the new connection and rebinds the Manager to the new session
+// without forgetting its subscriptions, because Twitch carries them over.
+func (c *Client) serve(ctx context.Context, conn *websocket.Conn, sess session) error {
+	defer func() { conn.CloseNow() }()
+
+	for {
+		readCtx, cancel := context.WithTimeout(ctx, sess.keepalive())
+		msg, err := readMessage(readCtx, conn)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		switch msg.Metadata.MessageType {
+		case msgSessionKeepalive:
+			// Any message resets the keepalive window; nothing else to do.
+		case msgNotification:
+			var p notificationPayload
+			if err := json.Unmarshal(msg.Payload, &p); err != nil {
+				c.logger.Error("decode eventsub notification failed", "error", err)
+				continue
+			}
+			// Handlers may call Helix, so keep them off the read loop.
+			go func() {
+				if err := dispatch(ctx, c.handler, p.Subscription.Type, p.Event); err != nil {
+					c.logger.Error("handle eventsub notification failed",
+						"message_id", msg.Metadata.MessageID, "error", err)
+				}
+			}()
+		case msgSessionReconnect:
+			var p sessionPayload
+			if err := json.Unmarshal(msg.Payload, &p); err != nil {
+				return fmt.Errorf("decode reconnect: %w", err)
+			}
+			newConn, newSess, err := c.connect(ctx, p.Session.ReconnectURL)
+			if err != nil {
+				return fmt.Errorf("reconnect: %w", err)
+			}
+			conn.CloseNow()
+			conn, sess = newConn, newSess
+			c.subs.Rebind(twitch.EventSubTransport{Method: "websocket", SessionID: sess.ID})
+			c.logger.Info("eventsub session reconnected", "session_id", sess.ID)
+		case msgRevocation:
+			var p notificationPayload
+			if err := json.Unmarshal(msg.Payload, &p); err != nil {
+				c.logger.Error("decode eventsub revocation failed", "error", err)
+				continue
+			}
+			c.subs.Revoked(p.Subscription.ID)
+			c.logger.Warn("eventsub subscription revoked",
+				"subscription_id", p.Subscription.ID,
+				"type", p.Subscription.Type,
+				"status", p.Subscription.Status,
+			)
+		default:
+			c.logger.Warn("unknown eventsub message type", "type", msg.Metadata.MessageType)
+		}
+	}
+}
+
+func readMessage(ctx context.Context, conn *websocket.Conn) (wsMessage, error) {
+	var msg wsMessage
+	_, data, err := conn.Read(ctx)
+	if err != nil {
+		return msg, err
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return msg, fmt.Errorf("decode eventsub message: %w", err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,65 @@
+package poller
+
+import (
+	"context"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/stream-poller/internal/eventsub"
+)
+
+const (
+	// Helix /streams can lag a few seconds behind stream.online.
+	streamLookupAttempts = 3
+	streamLookupDelay    = 5 * time.Second
+)
+
+// StreamOnline implements eventsub.Handler. EventSub only identifies the
+// broadcaster, so the stream is looked up in Helix and published with the
+// same subscription refs a poll cycle would attach.
+func (p *Poller) StreamOnline(ctx context.Context, e eventsub.StreamOnlineEvent) {
+	p.mu.RLock()
+	gameMap, streamerMap := p.gameMap, p.streamerMap
+	p.mu.RUnlock()
+
+	var streams []models.TwitchStream
+	for attempt := 0; attempt < streamLookupAttempts && len(streams) == 0; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(streamLookupDelay):
+			}
+		}
+
+		var err error
+		streams, err = p.twitchClient.GetStreams(ctx, nil, []string{e.BroadcasterUserLogin})
+		if err != nil {
+			p.logger.Warn("look up online stream failed", "user_login", e.BroadcasterUserLogin, "error", err)
+		}
+	}
+	if len(streams) == 0 {
+		p.logger.Warn("online stream not found in Helix", "user_login", e.BroadcasterUserLogin)
+		return
+	}
+
+	published := p.publishStreams(ctx, streams, gameMap, streamerMap)
+	p.logger.Info("eventsub stream online", "user_login", e.BroadcasterUserLogin, "published", published)
+}
+
+// StreamOffline implements eventsub.Handler by ending the broadcaster's
+// tracked stream, if any.
+func (p *Poller) StreamOffline(ctx context.Context, e eventsub.StreamOfflineEvent) {
+	ls, err := p.live.get(ctx, e.BroadcasterUserLogin)
+	if err != nil {
+		p.logger.Warn("load live stream failed", "user_login", e.BroadcasterUserLogin, "error", err)
+		return
+	}
+	if ls == nil {
+		p.logger.Info("eventsub stream offline; stream was not tracked", "user_login", e.BroadcasterUserLogin)
+		return
+	}
+
+	ended := p.endStream(ctx, *ls, time.Now().UTC())
+	p.logger.Info("eventsub stream offline", "user_login", e.BroadcasterUserLogin, "ended", ended)
+}
@@ -0,0 +1,314 @@
+package poller
+
+import (
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+)
+
+// maxRecordRetries bounds how often record retries a write another poller or
+// the EventSub handler raced with.
+const maxRecordRetries = 10
+
+// liveSetKey is the Valkey hash holding every stream the poller has seen
+// live, keyed by user login, so the set survives restarts and is shared
+// between replicas.
+const liveSetKey = "poller:live"
+
+// viewerUpdateInterval throttles updates caused only by viewer count changes;
+// title and game changes are sent straight away.
+const viewerUpdateInterval = 10 * time.Minute
+
+// liveStream is what the poller remembers about a stream between cycles.
+type liveStream struct {
+	StreamID        string                   `json:"stream_id"`
+	UserLogin       string                   `json:"user_login"`
+	UserName        string                   `json:"user_name"`
+	GameName        string                   `json:"game_name"`
+	Title           string                   `json:"title"`
+	StartedAt       time.Time                `json:"started_at"`
+	ViewerCount     int                      `json:"viewer_count"` // as of LastUpdate
+	PeakViewers     int                      `json:"peak_viewers"`
+	ThumbnailURL    string                   `json:"thumbnail_url"`
+	StreamURL       string                   `json:"stream_url"`
+	ProfileImageURL string                   `json:"profile_image_url,omitempty"`
+	Subscriptions   []models.SubscriptionRef `json:"subscriptions"`
+	LastUpdate      time.Time                `json:"last_update"` // when subscribers last saw these details
+}
+
+// endedEvent builds the StreamEndedEvent for a stream that ended at endedAt.
+func (ls liveStream) endedEvent(endedAt time.Time) models.StreamEndedEvent {
+	return models.StreamEndedEvent{
+		StreamID:        ls.StreamID,
+		UserLogin:       ls.UserLogin,
+		UserName:        ls.UserName,
+		GameName:        ls.GameName,
+		Title:           ls.Title,
+		StartedAt:       ls.StartedAt,
+		EndedAt:         endedAt,
+		DurationSeconds: int64(endedAt.Sub(ls.StartedAt).Seconds()),
+		PeakViewers:     ls.PeakViewers,
+		ThumbnailURL:    ls.ThumbnailURL,
+		StreamURL:       ls.StreamURL,
+		ProfileImageURL: ls.ProfileImageURL,
+		Subscriptions:   ls.Subscriptions,
+	}
+}
+
+// liveSet stores liveStreams in Valkey.
+type liveSet struct {
+	cache *redis.Client
+}
+
+// all returns every tracked stream keyed by user login.
+func (l liveSet) all(ctx context.Context) (map[string]liveStream, error) {
+	raw, err := l.cache.HGetAll(ctx, liveSetKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("valkey HGETALL %s: %w", liveSetKey, err)
+	}
+
+	streams := make(map[string]liveStream, len(raw))
+	for login, data := range raw {
+		var ls liveStream
+		if err := json.Unmarshal([]byte(data), &ls); err != nil {
+			return nil, fmt.Errorf("decode live stream %s: %w", login, err)
+		}
+		streams[login] = ls
+	}
+	return streams, nil
+}
+
+// get returns the tracked stream for login, if any.
+func (l liveSet) get(ctx context.Context, login string) (*liveStream, error) {
+	return getLive(ctx, l.cache, login)
+}
+
+// getLive reads login's tracked stream through c, which may be a transaction.
+func getLive(ctx context.Context, c redis.Cmdable, login string) (*liveStream, error) {
+	data, err := c.HGet(ctx, liveSetKey, login).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("valkey HGET %s: %w", liveSetKey, err)
+	}
+
+	var ls liveStream
+	if err := json.Unmarshal(data, &ls); err != nil {
+		return nil, fmt.Errorf("decode live stream %s: %w", login, err)
+	}
+	return &ls, nil
+}
+
+// record stores the latest state of a live stream, keeping the highest viewer
+// count seen so far. If the login was tracked under a different stream ID,
+// that earlier stream has ended and is returned so the caller can report it.
+// changed reports whether subscribers should be sent the new details: the
+// title or game changed, or the viewer count changed and viewerUpdateInterval
+// has passed since the last update.
+//
+// The read and the write form one transaction on the set, retried if anything
+// else wrote to it in between, so of several concurrent callers only one
+// sees a stream as changed or ended.
+func (l liveSet) record(ctx context.Context, event models.StreamEvent) (ended *liveStream, changed bool, err error) {
+	for range maxRecordRetries {
+		err = l.cache.Watch(ctx, func(tx *redis.Tx) error {
+			ended, changed = nil, false
+			prev, err := getLive(ctx, tx, event.UserLogin)
+			if err != nil {
+				return err
+			}
+			var ls liveStream
+			ls, ended, changed = nextLive(prev, event)
+
+			data, err := json.Marshal(ls)
+			if err != nil {
+				return fmt.Errorf("encode live stream %s: %w", ls.UserLogin, err)
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.HSet(ctx, liveSetKey, ls.UserLogin, data)
+				return nil
+			})
+			return err
+		}, liveSetKey)
+		if err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("valkey HSET %s: %w", liveSetKey, err)
+	}
+	return ended, changed, nil
+}
+
+// nextLive returns what to store for event given the tracked stream prev, which
+// may be nil, and whether prev ended or subscribers should be sent the
+// event's details.
+func nextLive(prev *liveStream, event models.StreamEvent) (ls liveStream, ended *liveStream, changed bool) {
+	ls = liveStream{
+		StreamID:        event.StreamID,
+		UserLogin:       event.UserLogin,
+		UserName:        event.UserName,
+		GameName:        event.GameName,
+		Title:           event.Title,
+		StartedAt:       event.StartedAt,
+		ViewerCount:     event.ViewerCount,
+		PeakViewers:     event.ViewerCount,
+		ThumbnailURL:    event.ThumbnailURL,
+		StreamURL:       event.StreamURL,
+		ProfileImageURL: event.ProfileImageURL,
+		Subscriptions:   event.Subscriptions,
+		LastUpdate:      event.PolledAt,
+	}
+
+	if prev != nil {
+		if prev.StreamID == ls.StreamID {
+			ls.PeakViewers = max(ls.PeakViewers, prev.PeakViewers)
+			changed = prev.Title != ls.Title || prev.GameName != ls.GameName ||
+				(prev.ViewerCount != ls.ViewerCount && ls.LastUpdate.Sub(prev.LastUpdate) >= viewerUpdateInterval)
+			if !changed {
+				ls.ViewerCount, ls.LastUpdate = prev.ViewerCount, prev.LastUpdate
+			}
+		} else {
+			ended = prev
+		}
+	}
+	return ls, ended, changed
+}
+
+// put writes ls to the set.
+func (l liveSet) put(ctx context.Context, ls liveStream) error {
+	data, err := json.Marshal(ls)
+	if err != nil {
+		return fmt.Errorf("encode live stream %s: %w", ls.UserLogin, err)
+	}
+	if err := l.cache.HSet(ctx, liveSetKey, ls.UserLogin, data).Err(); err != nil {
+		return fmt.Errorf("valkey HSET %s: %w", liveSetKey, err)
+	}
+	return nil
+}
+
+// remove deletes login from the set and reports whether it was present, so
+// only one of several concurrent callers reports the stream as ended.
+func (l liveSet) remove(ctx context.Context, login string) (bool, error) {
+	n, err := l.cache.HDel(ctx, liveSetKey, login).Result()
+	if err != nil {
+		return false, fmt.Errorf("valkey HDEL %s: %w", liveSetKey, err)
+	}
+	return n > 0, nil
+}
+
+// trackLive records a stream the poller just saw live and publishes a
+// StreamUpdatedEvent if its details changed. An earlier stream by the same
+// broadcaster still in the set ended when the new one started.
+func (p *Poller) trackLive(ctx context.Context, event models.StreamEvent) {
+	prev, changed, err := p.live.record(ctx, event)
+	if err != nil {
+		p.logger.Warn("record live stream failed", "stream_id", event.StreamID, "error", err)
+		return
+	}
+	if prev != nil {
+		p.publishEnded(ctx, *prev, event.StartedAt)
+	}
+	if changed {
+		if err := p.publisher.PublishUpdated(ctx, event); err != nil {
+			p.logger.Error("publish stream updated event failed", "stream_id", event.StreamID, "error", err)
+		}
+	}
+}
+
+// detectEnded ends every tracked stream whose broadcaster is not in seen.
+// A stream can drop out of the poll while still live (it changed category),
+// so absent streams are looked up by login before being reported. Streams of
+// broadcasters EventSub covers are left to its stream.offline notification.
+// A stream still live is re-tracked with the subscriptions in gameMap and
+// streamerMap it still matches, or dropped quietly if it matches none.
+// It returns how many streams ended.
+func (p *Poller) detectEnded(
+	ctx context.Context,
+	seen map[string]struct{},
+	gameMap map[string][]models.SubscriptionRef,
+	streamerMap map[string][]models.SubscriptionRef,
+) int {
+	tracked, err := p.live.all(ctx)
+	if err != nil {
+		p.logger.Warn("load live streams failed", "error", err)
+		return 0
+	}
+
+	var missing []string
+	for login := range tracked {
+		if _, ok := seen[login]; ok {
+			continue
+		}
+		if p.watcher != nil && p.watcher.Covers(login) {
+			continue
+		}
+		missing = append(missing, login)
+	}
+	if len(missing) == 0 {
+		return 0
+	}
+
+	// Any failure leaves us unable to tell offline from unknown; retry next cycle.
+	streams, err := p.twitchClient.GetStreams(ctx, nil, missing)
+	if err != nil {
+		p.logger.Warn("confirm ended streams failed", "user_logins", len(missing), "error", err)
+		return 0
+	}
+	stillLive := make(map[string]models.TwitchStream, len(streams))
+	for _, s := range streams {
+		stillLive[s.UserLogin] = s
+	}
+
+	endedAt := time.Now().UTC()
+	ended := 0
+	for _, login := range missing {
+		ls := tracked[login]
+		if s, ok := stillLive[login]; ok && s.ID == ls.StreamID {
+			if refs := p.collectRefs(s, gameMap, streamerMap); len(refs) > 0 {
+				p.trackLive(ctx, streamEvent(s, refs, ls.ProfileImageURL, endedAt))
+			} else if _, err := p.live.remove(ctx, login); err != nil {
+				p.logger.Warn("remove live stream failed", "user_login", login, "error", err)
+			}
+			continue
+		}
+		if p.endStream(ctx, ls, endedAt) {
+			ended++
+		}
+	}
+	return ended
+}
+
+// endStream removes ls from the live set and publishes its StreamEndedEvent.
+// It reports false if another caller already ended the stream.
+func (p *Poller) endStream(ctx context.Context, ls liveStream, endedAt time.Time) bool {
+	removed, err := p.live.remove(ctx, ls.UserLogin)
+	if err != nil {
+		p.logger.Warn("remove live stream failed", "user_login", ls.UserLogin, "error", err)
+		return false
+	}
+	if !removed {
+		return false
+	}
+	p.publishEnded(ctx, ls, endedAt)
+	return true
+}
+
+func (p *Poller) publishEnded(ctx context.Context, ls liveStream, endedAt time.Time) {
+	event := ls.endedEvent(endedAt)
+	if err := p.publisher.PublishEnded(ctx, event); err != nil {
+		p.logger.Error("publish stream ended event failed", "stream_id", ls.StreamID, "error", err)
+		return
+	}
+	p.logger.Info("stream ended",
+		"stream_id", ls.StreamID,
+		"user_login", ls.UserLogin,
+		"duration_seconds", event.DurationSeconds,
+		"peak_viewers", event.PeakViewers,
+	)
+}
@@ -0,0 +1,222 @@
+package poller
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+)
+
+func newTestLiveSet(t *testing.T) liveSet {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	return liveSet{cache: redis.NewClient(&redis.Options{Addr: mr.Addr()})}
+}
+
+func liveEvent(streamID, userLogin string, viewers int) models.StreamEvent {
+	return models.StreamEvent{
+		StreamID:    streamID,
+		UserLogin:   userLogin,
+		UserName:    "TestUser",
+		GameName:    "Fortnite",
+		ViewerCount: viewers,
+		StartedAt:   time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+		PolledAt:    time.Date(2026, 1, 1, 12, 5, 0, 0, time.UTC),
+		Subscriptions: []models.SubscriptionRef{
+			{SubscriptionID: "sub-1", WebhookURL: "https://discord.com/api/webhooks/1/a", NotifyOnEnd: true},
+		},
+	}
+}
+
+func TestLiveSet_RecordKeepsPeakViewers(t *testing.T) {
+	l := newTestLiveSet(t)
+	ctx := context.Background()
+
+	for _, viewers := range []int{100, 250, 180} {
+		if _, _, err := l.record(ctx, liveEvent("stream-1", "streamer1", viewers)); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+
+	ls, err := l.get(ctx, "streamer1")
+	if err != nil || ls == nil {
+		t.Fatalf("get: %v, %v", ls, err)
+	}
+	if ls.PeakViewers != 250 {
+		t.Errorf("PeakViewers = %d, want 250", ls.PeakViewers)
+	}
+	if len(ls.Subscriptions) != 1 || !ls.Subscriptions[0].NotifyOnEnd {
+		t.Errorf("subscriptions not preserved: %+v", ls.Subscriptions)
+	}
+}
+
+func TestLiveSet_RecordNewStreamReturnsPrevious(t *testing.T) {
+	l := newTestLiveSet(t)
+	ctx := context.Background()
+
+	if _, _, err := l.record(ctx, liveEvent("stream-1", "streamer1", 100)); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	prev, _, err := l.record(ctx, liveEvent("stream-2", "streamer1", 5))
+	if err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if prev == nil || prev.StreamID != "stream-1" {
+		t.Fatalf("expected previous stream-1, got %+v", prev)
+	}
+
+	ls, _ := l.get(ctx, "streamer1")
+	if ls.StreamID != "stream-2" || ls.PeakViewers != 5 {
+		t.Errorf("tracked stream = %+v, want stream-2 with 5 viewers", ls)
+	}
+}
+
+func TestLiveSet_RecordConcurrentChangeReportedOnce(t *testing.T) {
+	l := newTestLiveSet(t)
+	ctx := context.Background()
+	if _, _, err := l.record(ctx, liveEvent("stream-1", "streamer1", 100)); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	retitled := liveEvent("stream-1", "streamer1", 100)
+	retitled.Title = "new title"
+	var (
+		wg      sync.WaitGroup
+		changes atomic.Int32
+	)
+	for range 8 {
+		wg.Go(func() {
+			_, changed, err := l.record(ctx, retitled)
+			if err != nil {
+				t.Errorf("record: %v", err)
+			}
+			if changed {
+				changes.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+	if n := changes.Load(); n != 1 {
+		t.Errorf("%d callers saw the change, want 1", n)
+	}
+}
+
+func TestLiveSet_RecordChanged(t *testing.T) {
+	l := newTestLiveSet(t)
+	ctx := context.Background()
+
+	first := liveEvent("stream-1", "streamer1", 100)
+	if _, changed, err := l.record(ctx, first); err != nil || changed {
+		t.Fatalf("first record: changed = %v, err = %v", changed, err)
+	}
+
+	cases := []struct {
+		name    string
+		mutate  func(e *models.StreamEvent)
+		changed bool
+	}{
+		{"nothing changed", func(e *models.StreamEvent) {}, false},
+		{"viewers changed too soon", func(e *models.StreamEvent) {
+			e.ViewerCount = 150
+			e.PolledAt = e.PolledAt.Add(time.Minute)
+		}, false},
+		{"viewers changed after interval", func(e *models.StreamEvent) {
+			e.ViewerCount = 150
+			e.PolledAt = e.PolledAt.Add(viewerUpdateInterval)
+		}, true},
+		{"title changed", func(e *models.StreamEvent) {
+			e.ViewerCount = 150
+			e.Title = "new title"
+			e.PolledAt = e.PolledAt.Add(viewerUpdateInterval + time.Minute)
+		}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := first
+			tc.mutate(&e)
+			_, changed, err := l.record(ctx, e)
+			if err != nil {
+				t.Fatalf("record: %v", err)
+			}
+			if changed != tc.changed {
+				t.Errorf("changed = %v, want %v", changed, tc.changed)
+			}
+		})
+	}
+}
+
+func TestLiveSet_RemoveOnlyOnce(t *testing.T) {
+	l := newTestLiveSet(t)
+	ctx := context.Background()
+
+	if _, _, err := l.record(ctx, liveEvent("stream-1", "streamer1", 100)); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	for i, want := range []bool{true, false} {
+		removed, err := l.remove(ctx, "streamer1")
+		if err != nil {
+			t.Fatalf("remove: %v", err)
+		}
+		if removed != want {
+			t.Errorf("remove #%d = %v, want %v", i+1, removed, want)
+		}
+	}
+
+	all, err := l.all(ctx)
+	if err != nil {
+		t.Fatalf("all: %v", err)
+	}
+	if len(all) != 0 {
+		t.Errorf("expected empty set, got %+v", all)
+	}
+}
+
+// coveringWatcher covers every streamer.
+type coveringWatcher struct{}
+
+func (coveringWatcher) Watch(context.Context, []string) {}
+func (coveringWatcher) Covers(string) bool              { return true }
+
+func TestDetectEnded_LeavesCoveredStreamsToEventSub(t *testing.T) {
+	p := &Poller{live: newTestLiveSet(t), watcher: coveringWatcher{}}
+	ctx := context.Background()
+	if _, _, err := p.live.record(ctx, liveEvent("stream-1", "streamer1", 100)); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	// With no Twitch client, a lookup of the missing stream would panic.
+	if ended := p.detectEnded(ctx, map[string]struct{}{}, nil, nil); ended != 0 {
+		t.Errorf("ended = %d, want 0", ended)
+	}
+	if ls, err := p.live.get(ctx, "streamer1"); err != nil || ls == nil {
+		t.Errorf("covered stream no longer tracked: %v, %v", ls, err)
+	}
+}
+
+func TestLiveStream_EndedEvent(t *testing.T) {
+	ls := liveStream{
+		StreamID:        "stream-1",
+		UserLogin:       "streamer1",
+		StartedAt:       time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+		PeakViewers:     250,
+		ProfileImageURL: "https://static-cdn.jtvnw.net/streamer1.png",
+	}
+	e := ls.endedEvent(time.Date(2026, 1, 1, 15, 12, 0, 0, time.UTC))
+
+	if e.DurationSeconds != 3*3600+12*60 {
+		t.Errorf("DurationSeconds = %d, want %d", e.DurationSeconds, 3*3600+12*60)
+	}
+	if e.PeakViewers != 250 {
+		t.Errorf("PeakViewers = %d, want 250", e.PeakViewers)
+	}
+	if e.ProfileImageURL != ls.ProfileImageURL {
+		t.Errorf("ProfileImageURL = %q, want %q", e.ProfileImageURL, ls.ProfileImageURL)
+	}
+}
@@ -2,27 +2,49 @@ package poller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/twitch"
 	"github.com/khiemnguyen15/twitch-watcher/services/stream-poller/internal/publisher"
 	"github.com/khiemnguyen15/twitch-watcher/services/stream-poller/internal/subscription"
-	"github.com/khiemnguyen15/twitch-watcher/services/stream-poller/internal/twitch"
 )
 
 const gameCacheTTL = 24 * time.Hour
 const gameIDCachePrefix = "game:"
 
+// Profile images rarely change; a stale one only shows an old avatar.
+const profileImageCacheTTL = 24 * time.Hour
+const profileImageCachePrefix = "profile_image:"
+
+// StreamerWatcher receives push notifications for streamers on the poller's
+// behalf. Streamers it covers are left out of the /streams poll.
+type StreamerWatcher interface {
+	Watch(ctx context.Context, logins []string)
+	Covers(login string) bool
+}
+
 // Poller is the core poll loop.
 type Poller struct {
-	subClient   *subscription.Client
+	subClient    *subscription.Client
 	twitchClient *twitch.Client
-	publisher   *publisher.Publisher
-	cache       *redis.Client
-	logger      *slog.Logger
+	publisher    *publisher.Publisher
+	cache        *redis.Client
+	logger       *slog.Logger
+	watcher      StreamerWatcher
+	live         liveSet
+
+	// Subscription refs from the latest poll cycle, used to route pushed events.
+	mu          sync.RWMutex
+	gameMap     map[string][]models.SubscriptionRef
+	streamerMap map[string][]models.SubscriptionRef
 }
 
 // New creates a Poller.
@@ -39,9 +61,15 @@ func New(
 		publisher:    pub,
 		cache:        cache,
 		logger:       logger,
+		live:         liveSet{cache: cache},
 	}
 }
 
+// SetStreamerWatcher hands streamer subscriptions to w. Must be called before Run.
+func (p *Poller) SetStreamerWatcher(w StreamerWatcher) {
+	p.watcher = w
+}
+
 // Run starts the polling loop and blocks until ctx is cancelled.
 func (p *Poller) Run(ctx context.Context, interval time.Duration) {
 	ticker := time.NewTicker(interval)
@@ -74,26 +102,40 @@ func (p *Poller) poll(ctx context.Context) {
 	}
 
 	// Build dedup maps.
-	gameMap := make(map[string][]models.SubscriptionRef)    // gameName → refs
+	gameMap := make(map[string][]models.SubscriptionRef)     // gameName → refs
 	streamerMap := make(map[string][]models.SubscriptionRef) // userLogin → refs
+	knownGameIDs := make(map[string]string)                  // gameName → ID resolved by subscription-service
 
 	for _, s := range subs {
 		ref := models.SubscriptionRef{
-			SubscriptionID: s.ID,
-			DiscordWebhook: s.DiscordWebhook,
+			SubscriptionID:    s.ID,
+			DestinationType:   s.DestinationType,
+			WebhookURL:        s.WebhookURL,
+			DestinationConfig: s.DestinationConfig,
+			NotifyOnEnd:       s.NotifyOnEnd,
 		}
 		switch s.WatchType {
 		case models.WatchTypeGame:
 			gameMap[s.WatchTarget] = append(gameMap[s.WatchTarget], ref)
+			if s.WatchTargetID != "" {
+				knownGameIDs[s.WatchTarget] = s.WatchTargetID
+			}
 		case models.WatchTypeStreamer:
 			streamerMap[s.WatchTarget] = append(streamerMap[s.WatchTarget], ref)
 		}
 	}
 
-	// Resolve game names → game IDs (Valkey-cached).
+	p.mu.Lock()
+	p.gameMap, p.streamerMap = gameMap, streamerMap
+	p.mu.Unlock()
+
+	// Resolve game names → game IDs (Valkey-cached), except those stored
+	// with their subscriptions.
 	gameNames := make([]string, 0, len(gameMap))
 	for name := range gameMap {
-		gameNames = append(gameNames, name)
+		if _, ok := knownGameIDs[name]; !ok {
+			gameNames = append(gameNames, name)
+		}
 	}
 
 	gameIDMap, err := p.resolveGameIDs(ctx, gameNames)
@@ -101,6 +143,7 @@ func (p *Poller) poll(ctx context.Context) {
 		p.logger.Error("resolve game IDs failed", "error", err)
 		return
 	}
+	maps.Copy(gameIDMap, knownGameIDs)
 
 	// Collect unique game IDs and user logins for batch query.
 	gameIDs := make([]string, 0, len(gameIDMap))
@@ -115,36 +158,83 @@ func (p *Poller) poll(ctx context.Context) {
 		userLogins = append(userLogins, login)
 	}
 
-	// Batch fetch live streams.
+	// Streamers covered by push notifications don't need polling.
+	if p.watcher != nil {
+		p.watcher.Watch(ctx, userLogins)
+		userLogins = slices.DeleteFunc(userLogins, p.watcher.Covers)
+	}
+
+	// Batch fetch live streams. A partial failure still yields the streams
+	// from the batches that succeeded, so only abort when nothing came back.
 	streams, err := p.twitchClient.GetStreams(ctx, gameIDs, userLogins)
+	complete := err == nil
 	if err != nil {
-		p.logger.Error("fetch streams failed", "error", err)
-		return
+		var batchErr *twitch.BatchError
+		if !errors.As(err, &batchErr) || len(batchErr.Failures) == batchErr.Total {
+			p.logger.Error("fetch streams failed", "error", err)
+			return
+		}
+		for _, f := range batchErr.Failures {
+			p.logger.Warn("stream batch failed",
+				"game_ids", len(f.GameIDs),
+				"user_logins", len(f.UserLogins),
+				"error", f.Err,
+			)
+		}
+	}
+
+	published := p.publishStreams(ctx, streams, gameMap, streamerMap)
+
+	// Streams from failed batches are missing too; don't mistake them for ended.
+	ended := 0
+	if complete {
+		seen := make(map[string]struct{}, len(streams))
+		for _, s := range streams {
+			seen[s.UserLogin] = struct{}{}
+		}
+		ended = p.detectEnded(ctx, seen, gameMap, streamerMap)
 	}
 
+	budget := p.twitchClient.RateLimit()
+	p.logger.Info("poll cycle complete",
+		"streams", len(streams),
+		"published", published,
+		"ended", ended,
+		"ratelimit_remaining", budget.Remaining,
+		"ratelimit_limit", budget.Limit,
+	)
+}
+
+// publishStreams publishes a StreamEvent for every stream with at least one
+// matching subscription, records it in the live set, and returns how many
+// were published.
+func (p *Poller) publishStreams(
+	ctx context.Context,
+	streams []models.TwitchStream,
+	gameMap map[string][]models.SubscriptionRef,
+	streamerMap map[string][]models.SubscriptionRef,
+) int {
 	polledAt := time.Now().UTC()
 	published := 0
 
+	matched := make(map[string][]models.SubscriptionRef, len(streams))
+	logins := make([]string, 0, len(streams))
+	for _, s := range streams {
+		if refs := p.collectRefs(s, gameMap, streamerMap); len(refs) > 0 {
+			matched[s.ID] = refs
+			logins = append(logins, s.UserLogin)
+		}
+	}
+	profileImages := p.resolveProfileImages(ctx, logins)
+
 	for _, s := range streams {
-		refs := p.collectRefs(s, gameMap, streamerMap)
+		refs := matched[s.ID]
 		if len(refs) == 0 {
 			continue
 		}
 
-		event := models.StreamEvent{
-			StreamID:      s.ID,
-			UserLogin:     s.UserLogin,
-			UserName:      s.UserName,
-			GameID:        s.GameID,
-			GameName:      s.GameName,
-			Title:         s.Title,
-			ViewerCount:   s.ViewerCount,
-			StartedAt:     s.StartedAt,
-			ThumbnailURL:  formatThumbnail(s.ThumbnailURL, 440, 248),
-			StreamURL:     "https://twitch.tv/" + s.UserLogin,
-			Subscriptions: refs,
-			PolledAt:      polledAt,
-		}
+		event := streamEvent(s, refs, profileImages[s.UserLogin], polledAt)
+		p.trackLive(ctx, event)
 
 		if err := p.publisher.Publish(ctx, event); err != nil {
 			p.logger.Error("publish stream event failed", "stream_id", s.ID, "error", err)
@@ -153,10 +243,29 @@ func (p *Poller) poll(ctx context.Context) {
 		published++
 	}
 
-	p.logger.Info("poll cycle complete", "streams", len(streams), "published", published)
+	return published
+}
+
+// streamEvent builds the StreamEvent for a live stream.
+func streamEvent(s models.TwitchStream, refs []models.SubscriptionRef, profileImageURL string, polledAt time.Time) models.StreamEvent {
+	return models.StreamEvent{
+		StreamID:        s.ID,
+		UserLogin:       s.UserLogin,
+		UserName:        s.UserName,
+		GameID:          s.GameID,
+		GameName:        s.GameName,
+		Title:           s.Title,
+		ViewerCount:     s.ViewerCount,
+		StartedAt:       s.StartedAt,
+		ThumbnailURL:    formatThumbnail(s.ThumbnailURL, 440, 248),
+		StreamURL:       "https://twitch.tv/" + s.UserLogin,
+		ProfileImageURL: profileImageURL,
+		Subscriptions:   refs,
+		PolledAt:        polledAt,
+	}
 }
 
-// collectRefs gathers all SubscriptionRefs for a stream and deduplicates by DiscordWebhook.
+// collectRefs gathers all SubscriptionRefs for a stream and deduplicates by WebhookURL.
 func (p *Poller) collectRefs(
 	s models.TwitchStream,
 	gameMap map[string][]models.SubscriptionRef,
@@ -166,14 +275,14 @@ func (p *Poller) collectRefs(
 	var refs []models.SubscriptionRef
 
 	for _, ref := range gameMap[s.GameName] {
-		if _, ok := seen[ref.DiscordWebhook]; !ok {
-			seen[ref.DiscordWebhook] = struct{}{}
+		if _, ok := seen[ref.WebhookURL]; !ok {
+			seen[ref.WebhookURL] = struct{}{}
 			refs = append(refs, ref)
 		}
 	}
 	for _, ref := range streamerMap[s.UserLogin] {
-		if _, ok := seen[ref.DiscordWebhook]; !ok {
-			seen[ref.DiscordWebhook] = struct{}{}
+		if _, ok := seen[ref.WebhookURL]; !ok {
+			seen[ref.WebhookURL] = struct{}{}
 			refs = append(refs, ref)
 		}
 	}
@@ -211,6 +320,40 @@ func (p *Poller) resolveGameIDs(ctx context.Context, names []string) (map[string
 	return result, nil
 }
 
+// resolveProfileImages returns the profile image URL of each login, using
+// Valkey as a 24h cache. Images are cosmetic: logins that cannot be resolved
+// are left out and the events are published without them.
+func (p *Poller) resolveProfileImages(ctx context.Context, logins []string) map[string]string {
+	result := make(map[string]string, len(logins))
+	var toFetch []string
+
+	for _, login := range logins {
+		image, err := p.cache.Get(ctx, profileImageCachePrefix+login).Result()
+		if err == nil {
+			result[login] = image
+		} else {
+			toFetch = append(toFetch, login)
+		}
+	}
+
+	if len(toFetch) == 0 {
+		return result
+	}
+
+	users, err := p.twitchClient.GetUsers(ctx, toFetch)
+	if err != nil {
+		p.logger.Warn("fetch profile images failed", "user_logins", len(toFetch), "error", err)
+		return result
+	}
+
+	for _, u := range users {
+		result[u.Login] = u.ProfileImageURL
+		p.cache.Set(ctx, profileImageCachePrefix+u.Login, u.ProfileImageURL, profileImageCacheTTL)
+	}
+
+	return result
+}
+
 // formatThumbnail replaces Twitch thumbnail URL template placeholders.
 func formatThumbnail(tmpl string, w, h int) string {
 	if tmpl == "" {
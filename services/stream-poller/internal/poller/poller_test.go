@@ -1,8 +1,11 @@
 package poller
 
 import (
+	"context"
 	"testing"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
 	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
 )
 
@@ -10,7 +13,7 @@ import (
 var p = &Poller{}
 
 func ref(subID, webhook string) models.SubscriptionRef {
-	return models.SubscriptionRef{SubscriptionID: subID, DiscordWebhook: webhook}
+	return models.SubscriptionRef{SubscriptionID: subID, WebhookURL: webhook}
 }
 
 func stream(gameName, userLogin string) models.TwitchStream {
@@ -118,3 +121,15 @@ func TestFormatThumbnail_NoPlaceholders(t *testing.T) {
 		t.Errorf("got %q, want %q", got, input)
 	}
 }
+
+func TestResolveProfileImages_Cached(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.Set(profileImageCachePrefix+"streamer1", "https://static-cdn.jtvnw.net/streamer1.png")
+	// A nil twitch client fails the test if the cache is bypassed.
+	p := &Poller{cache: redis.NewClient(&redis.Options{Addr: mr.Addr()})}
+
+	images := p.resolveProfileImages(context.Background(), []string{"streamer1"})
+	if images["streamer1"] != "https://static-cdn.jtvnw.net/streamer1.png" {
+		t.Errorf("images = %v", images)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json/v2"
 	"fmt"
+	"time"
 
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
@@ -11,12 +12,12 @@ import (
 	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
 )
 
-// Publisher publishes StreamEvents to NATS JetStream.
+// Publisher publishes stream lifecycle events to NATS JetStream.
 type Publisher struct {
 	js jetstream.JetStream
 }
 
-// New creates a Publisher, ensuring the JetStream stream exists.
+// New creates a Publisher, ensuring the JetStream streams exist.
 func New(nc *nats.Conn) (*Publisher, error) {
 	js, err := jetstream.New(nc)
 	if err != nil {
@@ -35,6 +36,30 @@ func New(nc *nats.Conn) (*Publisher, error) {
 		return nil, fmt.Errorf("create stream %s: %w", messaging.StreamTwitchStreamsRaw, err)
 	}
 
+	_, err = js.CreateOrUpdateStream(context.Background(), jetstream.StreamConfig{
+		Name:      messaging.StreamTwitchStreamsEnded,
+		Subjects:  []string{messaging.SubjectStreamsEnded},
+		Retention: jetstream.WorkQueuePolicy,
+		MaxAge:    30 * time.Minute, // an "ended" message older than this is no longer useful
+		Storage:   jetstream.FileStorage,
+		Replicas:  1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create stream %s: %w", messaging.StreamTwitchStreamsEnded, err)
+	}
+
+	_, err = js.CreateOrUpdateStream(context.Background(), jetstream.StreamConfig{
+		Name:      messaging.StreamTwitchStreamsUpdated,
+		Subjects:  []string{messaging.SubjectStreamsUpdated},
+		Retention: jetstream.WorkQueuePolicy,
+		MaxAge:    10 * time.Minute, // superseded by the next update anyway
+		Storage:   jetstream.FileStorage,
+		Replicas:  1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create stream %s: %w", messaging.StreamTwitchStreamsUpdated, err)
+	}
+
 	return &Publisher{js: js}, nil
 }
 
@@ -51,3 +76,32 @@ func (p *Publisher) Publish(ctx context.Context, event models.StreamEvent) error
 	}
 	return nil
 }
+
+// PublishEnded serialises and publishes a StreamEndedEvent envelope.
+func (p *Publisher) PublishEnded(ctx context.Context, event models.StreamEndedEvent) error {
+	env := messaging.NewEnvelope(event)
+	data, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("marshal stream ended event: %w", err)
+	}
+
+	if _, err := p.js.Publish(ctx, messaging.SubjectStreamsEnded, data); err != nil {
+		return fmt.Errorf("publish stream ended event: %w", err)
+	}
+	return nil
+}
+
+// PublishUpdated serialises and publishes a StreamEvent envelope for a live
+// stream whose details changed.
+func (p *Publisher) PublishUpdated(ctx context.Context, event models.StreamEvent) error {
+	env := messaging.NewEnvelope(event)
+	data, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("marshal stream updated event: %w", err)
+	}
+
+	if _, err := p.js.Publish(ctx, messaging.SubjectStreamsUpdated, data); err != nil {
+		return fmt.Errorf("publish stream updated event: %w", err)
+	}
+	return nil
+}
@@ -7,12 +7,18 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nats-io/nats.go"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/twitch"
 	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/api"
 	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/config"
+	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/consumer"
+	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/discord"
+	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/publisher"
 	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/repository"
 	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/service"
 )
@@ -41,9 +47,56 @@ func main() {
 		os.Exit(1)
 	}
 
+	nc, err := nats.Connect(cfg.NATSUrl)
+	if err != nil {
+		logger.Error("NATS connect failed", "error", err)
+		os.Exit(1)
+	}
+	defer nc.Drain()
+
+	pub, err := publisher.New(nc)
+	if err != nil {
+		logger.Error("create publisher failed", "error", err)
+		os.Exit(1)
+	}
+
 	repo := repository.New(pool)
-	svc := service.New(repo)
-	router := api.NewRouter(svc, cfg.InternalAPIKey)
+
+	var twitchClient service.TwitchClient
+	if cfg.TwitchClientID != "" {
+		tokenMgr := twitch.NewTokenManager(cfg.TwitchClientID, cfg.TwitchClientSecret)
+		twitchClient = twitch.NewClient(cfg.TwitchClientID, tokenMgr, twitch.NewRateLimiter(nil))
+	} else {
+		logger.Warn("TWITCH_CLIENT_ID is not set; watch targets will not be checked against Twitch")
+	}
+	svc := service.New(repo, pub, twitchClient, cfg.PublicURL)
+	users := service.NewUserService(repo)
+
+	var auth *service.AuthService
+	if cfg.DiscordClientID != "" {
+		oauth := discord.NewClient(cfg.DiscordClientID, cfg.DiscordClientSecret,
+			strings.TrimSuffix(cfg.PublicURL, "/")+"/v1/auth/discord/callback", cfg.DiscordAPIURL)
+		auth = service.NewAuthService(repo, users, oauth)
+	}
+
+	cons, err := consumer.New(nc, svc, logger)
+	if err != nil {
+		logger.Error("create consumer failed", "error", err)
+		os.Exit(1)
+	}
+
+	consumeCtx, stopConsuming := context.WithCancel(context.Background())
+	defer stopConsuming()
+	go func() {
+		if err := cons.Run(consumeCtx); err != nil {
+			logger.Error("consumer error", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	go purgeExpiredEmails(consumeCtx, svc, logger)
+
+	router := api.NewRouter(svc, users, auth, cfg.InternalAPIKey, strings.HasPrefix(cfg.PublicURL, "https://"))
 
 	srv := &http.Server{
 		Addr:           cfg.HTTPAddr,
@@ -65,6 +118,7 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
+	stopConsuming()
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer shutdownCancel()
@@ -74,3 +128,29 @@ func main() {
 	}
 	logger.Info("subscription-service stopped")
 }
+
+// purgeInterval is how often email subscriptions left unconfirmed past their
+// link's expiry are deleted.
+const purgeInterval = time.Hour
+
+// purgeExpiredEmails deletes expired pending email subscriptions every
+// purgeInterval until ctx is cancelled.
+func purgeExpiredEmails(ctx context.Context, svc *service.SubscriptionService, logger *slog.Logger) {
+	t := time.NewTicker(purgeInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			n, err := svc.PurgeExpiredEmails(ctx)
+			if err != nil {
+				logger.Error("purge expired email subscriptions failed", "error", err)
+				continue
+			}
+			if n > 0 {
+				logger.Info("expired email subscriptions purged", "count", n)
+			}
+		}
+	}
+}
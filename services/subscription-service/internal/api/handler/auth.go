@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/api/middleware"
+	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/service"
+)
+
+// stateCookie holds the state of a Discord login in progress, binding the
+// callback to the browser that started it.
+const stateCookie = "tw_oauth_state"
+
+// AuthHandler handles signing in with Discord.
+type AuthHandler struct {
+	auth *service.AuthService
+	// secure marks cookies Secure, for deployments served over HTTPS.
+	secure bool
+}
+
+// NewAuthHandler creates an AuthHandler. secure marks its cookies Secure.
+func NewAuthHandler(auth *service.AuthService, secure bool) *AuthHandler {
+	return &AuthHandler{auth: auth, secure: secure}
+}
+
+type discordWebhooksResponse struct {
+	Webhooks []models.DiscordWebhook `json:"webhooks"`
+}
+
+// Login handles GET /v1/auth/discord/login, which redirects to Discord to sign in.
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	h.start(w, r, false)
+}
+
+// AddWebhook handles GET /v1/auth/discord/webhook, which redirects to Discord
+// to sign in and pick a channel for Discord to create a webhook in.
+func (h *AuthHandler) AddWebhook(w http.ResponseWriter, r *http.Request) {
+	h.start(w, r, true)
+}
+
+func (h *AuthHandler) start(w http.ResponseWriter, r *http.Request, webhook bool) {
+	authURL, state, err := h.auth.StartDiscordLogin(r.Context(), webhook)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal error"})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    state,
+		Path:     "/v1/auth/discord",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   h.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback handles GET /v1/auth/discord/callback, where Discord sends the user
+// back. It starts a session in the SessionCookie and responds with the user
+// and any webhook Discord created.
+func (h *AuthHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	state := q.Get("state")
+	c, err := r.Cookie(stateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(c.Value), []byte(state)) != 1 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid OAuth state; start the login again"})
+		return
+	}
+	h.clearCookie(w, stateCookie, "/v1/auth/discord")
+
+	if q.Get("error") != "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "Discord login was not authorized: " + q.Get("error")})
+		return
+	}
+
+	login, err := h.auth.FinishDiscordLogin(r.Context(), state, q.Get("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidOAuthState):
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid OAuth state; start the login again"})
+		case errors.Is(err, service.ErrDiscordLoginFailed):
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "Discord login failed; start the login again"})
+		default:
+			writeJSON(w, http.StatusBadGateway, errorResponse{Error: "could not complete Discord login"})
+		}
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.SessionCookie,
+		Value:    login.Session.Token,
+		Path:     "/",
+		Expires:  *login.Session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   h.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	writeJSON(w, http.StatusOK, login)
+}
+
+// Logout handles POST /v1/auth/logout, ending the session in the SessionCookie.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(middleware.SessionCookie); err == nil && c.Value != "" {
+		if err := h.auth.Logout(r.Context(), c.Value); err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal error"})
+			return
+		}
+	}
+	h.clearCookie(w, middleware.SessionCookie, "/")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhooks handles GET /v1/discord/webhooks, the caller's webhooks created
+// by signing in with Discord.
+func (h *AuthHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.auth.ListDiscordWebhooks(r.Context(), middleware.User(r.Context()).ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal error"})
+		return
+	}
+	if webhooks == nil {
+		webhooks = []models.DiscordWebhook{}
+	}
+	writeJSON(w, http.StatusOK, discordWebhooksResponse{Webhooks: webhooks})
+}
+
+func (h *AuthHandler) clearCookie(w http.ResponseWriter, name, path string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Path:     path,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -2,13 +2,16 @@ package handler
 
 import (
 	"encoding/json/v2"
+	"errors"
 	"net/http"
 
+	"github.com/google/uuid"
 	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
 	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/service"
 )
 
-// InternalHandler handles internal endpoints consumed by stream-poller.
+// InternalHandler handles internal endpoints consumed by stream-poller and
+// notification-dispatcher.
 type InternalHandler struct {
 	svc *service.SubscriptionService
 }
@@ -43,3 +46,25 @@ func (h *InternalHandler) ListActive(w http.ResponseWriter, r *http.Request) {
 		Total:         len(subs),
 	})
 }
+
+// Get handles GET /internal/subscriptions/{id}. Unlike the public API it
+// returns the subscription's credentials, and deleted or deactivated
+// subscriptions too.
+func (h *InternalHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid subscription ID"})
+		return
+	}
+
+	sub, err := h.svc.Lookup(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, service.ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "subscription not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, sub)
+}
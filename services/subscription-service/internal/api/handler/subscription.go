@@ -4,13 +4,19 @@ import (
 	"encoding/json/v2"
 	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/api/middleware"
 	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/service"
 )
 
-// SubscriptionHandler handles public subscription endpoints.
+// SubscriptionHandler handles public subscription endpoints. Its routes must be
+// wrapped in middleware.BearerToken; each caller sees only their own
+// subscriptions.
 type SubscriptionHandler struct {
 	svc *service.SubscriptionService
 }
@@ -21,15 +27,45 @@ func NewSubscriptionHandler(svc *service.SubscriptionService) *SubscriptionHandl
 }
 
 type createRequest struct {
-	DiscordWebhook string           `json:"discord_webhook"`
-	WatchType      models.WatchType `json:"watch_type"`
-	WatchTarget    string           `json:"watch_target"`
+	DestinationType   models.DestinationType    `json:"destination_type"`
+	WebhookURL        string                    `json:"webhook_url"`
+	DestinationConfig *models.DestinationConfig `json:"destination_config"`
+	WatchType         models.WatchType          `json:"watch_type"`
+	WatchTarget       string                    `json:"watch_target"`
+	NotifyOnEnd       bool                      `json:"notify_on_end"`
+
+	// DiscordWebhook is the pre-destination_type name of webhook_url, still
+	// accepted from older clients.
+	DiscordWebhook string `json:"discord_webhook"`
+
+	// DiscordWebhookID names one of the caller's webhooks created by signing
+	// in with Discord, instead of a webhook_url.
+	DiscordWebhookID string `json:"discord_webhook_id"`
+}
+
+// patchRequest is the body of PATCH /v1/subscriptions/{id}. Absent fields
+// are left unchanged.
+type patchRequest struct {
+	DestinationType   *models.DestinationType   `json:"destination_type"`
+	WebhookURL        *string                   `json:"webhook_url"`
+	DestinationConfig *models.DestinationConfig `json:"destination_config"`
+	WatchType         *models.WatchType         `json:"watch_type"`
+	WatchTarget       *string                   `json:"watch_target"`
+	NotifyOnEnd       *bool                     `json:"notify_on_end"`
+	Active            *bool                     `json:"active"`
 }
 
 type errorResponse struct {
 	Error string `json:"error"`
 }
 
+// unknownTargetResponse rejects a watch_target Twitch does not know,
+// suggesting similar ones that it does.
+type unknownTargetResponse struct {
+	Error       string   `json:"error"`
+	Suggestions []string `json:"suggestions"`
+}
+
 // Create handles POST /v1/subscriptions.
 func (h *SubscriptionHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var req createRequest
@@ -38,19 +74,46 @@ func (h *SubscriptionHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sub, err := h.svc.Create(r.Context(), req.DiscordWebhook, req.WatchType, req.WatchTarget)
-	if err != nil {
-		switch {
-		case errors.Is(err, service.ErrInvalidWebhook):
-			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid Discord webhook URL"})
-		case errors.Is(err, service.ErrDuplicate):
-			writeJSON(w, http.StatusConflict, errorResponse{Error: "subscription already exists"})
-		default:
-			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request"})
+	if req.WebhookURL == "" {
+		req.WebhookURL = req.DiscordWebhook
+	}
+	owner := middleware.User(r.Context())
+	if req.DiscordWebhookID != "" {
+		if req.WebhookURL != "" || (req.DestinationType != "" && req.DestinationType != models.DestinationDiscord) {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "discord_webhook_id replaces webhook_url and needs destination_type 'discord'"})
+			return
 		}
+		if _, err := uuid.Parse(req.DiscordWebhookID); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "unknown discord_webhook_id"})
+			return
+		}
+		hook, err := h.svc.DiscordWebhook(r.Context(), owner.ID, req.DiscordWebhookID)
+		if err != nil {
+			if errors.Is(err, service.ErrDiscordWebhookNotFound) {
+				writeJSON(w, http.StatusBadRequest, errorResponse{Error: "unknown discord_webhook_id"})
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal error"})
+			return
+		}
+		req.DestinationType = models.DestinationDiscord
+		req.WebhookURL = hook.WebhookURL
+	}
+
+	sub, err := h.svc.Create(r.Context(), owner, models.Subscription{
+		DestinationType:   req.DestinationType,
+		WebhookURL:        req.WebhookURL,
+		DestinationConfig: req.DestinationConfig,
+		WatchType:         req.WatchType,
+		WatchTarget:       req.WatchTarget,
+		NotifyOnEnd:       req.NotifyOnEnd,
+	})
+	if err != nil {
+		writeInvalid(w, err)
 		return
 	}
 
+	w.Header().Set("ETag", etag(sub))
 	writeJSON(w, http.StatusCreated, sub)
 }
 
@@ -62,7 +125,7 @@ func (h *SubscriptionHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sub, err := h.svc.GetByID(r.Context(), id)
+	sub, err := h.svc.GetByID(r.Context(), middleware.User(r.Context()).ID, id)
 	if err != nil {
 		if errors.Is(err, service.ErrNotFound) {
 			writeJSON(w, http.StatusNotFound, errorResponse{Error: "subscription not found"})
@@ -72,6 +135,127 @@ func (h *SubscriptionHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", etag(sub))
+	writeJSON(w, http.StatusOK, sub)
+}
+
+// Patch handles PATCH /v1/subscriptions/{id}. The request must carry the
+// subscription's ETag, or "*", in If-Match so concurrent changes are not
+// overwritten. "active": true restores a deleted or deactivated subscription.
+func (h *SubscriptionHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid subscription ID"})
+		return
+	}
+	version, ok := parseIfMatch(r.Header.Get("If-Match"))
+	if !ok {
+		writeJSON(w, http.StatusPreconditionRequired, errorResponse{Error: "If-Match must be the subscription's ETag or *"})
+		return
+	}
+
+	var req patchRequest
+	if err := json.UnmarshalRead(r.Body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request body"})
+		return
+	}
+
+	sub, err := h.svc.Update(r.Context(), middleware.User(r.Context()), id, service.Patch{
+		DestinationType:   req.DestinationType,
+		WebhookURL:        req.WebhookURL,
+		DestinationConfig: req.DestinationConfig,
+		WatchType:         req.WatchType,
+		WatchTarget:       req.WatchTarget,
+		NotifyOnEnd:       req.NotifyOnEnd,
+		Active:            req.Active,
+	}, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotFound):
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "subscription not found"})
+		case errors.Is(err, service.ErrVersionConflict):
+			writeJSON(w, http.StatusPreconditionFailed, errorResponse{Error: "subscription was changed; fetch it again and retry"})
+		default:
+			writeInvalid(w, err)
+		}
+		return
+	}
+
+	w.Header().Set("ETag", etag(sub))
+	writeJSON(w, http.StatusOK, sub)
+}
+
+// List handles GET /v1/subscriptions.
+func (h *SubscriptionHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := service.ListFilter{
+		WebhookURL:        q.Get("webhook"),
+		WatchType:         models.WatchType(q.Get("watch_type")),
+		WatchTargetPrefix: q.Get("watch_target"),
+	}
+	if f.WatchType != "" && f.WatchType != models.WatchTypeGame && f.WatchType != models.WatchTypeStreamer {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "watch_type must be 'game' or 'streamer'"})
+		return
+	}
+	if v := q.Get("active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "active must be true or false"})
+			return
+		}
+		f.Active = &active
+	}
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"created_after", &f.CreatedAfter}, {"created_before", &f.CreatedBefore}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: p.name + " must be an RFC 3339 timestamp"})
+			return
+		}
+		*p.t = t
+	}
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "limit must be a positive integer"})
+			return
+		}
+		limit = n
+	}
+
+	page, err := h.svc.List(r.Context(), middleware.User(r.Context()).ID, f, q.Get("cursor"), limit)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCursor) {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid cursor"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// VerifyEmail handles GET /v1/email/verify, the confirmation link sent to the
+// address of a new email subscription.
+func (h *SubscriptionHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.svc.VerifyEmail(r.Context(), r.URL.Query().Get("token"))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidVerificationToken) {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid or expired verification token"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal error"})
+		return
+	}
+
 	writeJSON(w, http.StatusOK, sub)
 }
 
@@ -83,7 +267,7 @@ func (h *SubscriptionHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.svc.Delete(r.Context(), id); err != nil {
+	if err := h.svc.Delete(r.Context(), middleware.User(r.Context()).ID, id); err != nil {
 		if errors.Is(err, service.ErrNotFound) {
 			writeJSON(w, http.StatusNotFound, errorResponse{Error: "subscription not found"})
 			return
@@ -95,6 +279,69 @@ func (h *SubscriptionHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// writeInvalid writes the response for an error creating or updating a
+// subscription, which is a 400 unless it says otherwise.
+func writeInvalid(w http.ResponseWriter, err error) {
+	var unknown *service.UnknownTargetError
+	switch {
+	case errors.As(err, &unknown):
+		suggestions := unknown.Suggestions
+		if suggestions == nil {
+			suggestions = []string{}
+		}
+		writeJSON(w, http.StatusBadRequest, unknownTargetResponse{Error: unknown.Error(), Suggestions: suggestions})
+	case errors.Is(err, service.ErrTwitchUnavailable):
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: "could not check watch_target with Twitch; try again later"})
+	case errors.Is(err, service.ErrInvalidWebhook):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid webhook URL for destination_type"})
+	case errors.Is(err, service.ErrInvalidDestinationType):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "destination_type must be 'discord', 'slack', 'teams', 'webhook', 'telegram', 'matrix', 'email', 'ntfy' or 'gotify'"})
+	case errors.Is(err, service.ErrInvalidTelegramConfig):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "destination_config.telegram needs a valid bot_token and chat_id"})
+	case errors.Is(err, service.ErrInvalidMatrixConfig):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "destination_config.matrix needs an https homeserver_url, a room_id and an access_token"})
+	case errors.Is(err, service.ErrInvalidEmailConfig):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "destination_config.email needs a valid address and a delivery of 'instant' or 'hourly'"})
+	case errors.Is(err, service.ErrInvalidNtfyConfig):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "destination_config.ntfy needs an https server_url, a topic of letters, digits, '-' or '_', and an optional priority from 1 to 5"})
+	case errors.Is(err, service.ErrInvalidGotifyConfig):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "destination_config.gotify needs an https server_url, an app_token and an optional priority from 1 to 10"})
+	case errors.Is(err, service.ErrInvalidThread):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "destination_config.discord takes a thread_id or a thread_name, not both: " + err.Error()})
+	case errors.Is(err, service.ErrInvalidTemplate):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "destination_config.discord.template: " + err.Error()})
+	case errors.Is(err, service.ErrInvalidMentions):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "destination_config.discord.mentions takes up to 50 role and user IDs, everyone and here"})
+	case errors.Is(err, service.ErrInvalidDiscordIdentity):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "destination_config.discord.username must be at most 80 characters without 'discord' or 'clyde', and avatar_url an https URL"})
+	case errors.Is(err, service.ErrImmutable):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error() + "; create a new subscription instead"})
+	case errors.Is(err, service.ErrQuotaExceeded):
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "subscription quota exceeded; delete a subscription first"})
+	case errors.Is(err, service.ErrDuplicate):
+		writeJSON(w, http.StatusConflict, errorResponse{Error: "subscription already exists"})
+	default:
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request"})
+	}
+}
+
+// etag returns the ETag of sub's current version.
+func etag(sub *models.Subscription) string {
+	return `"` + strconv.Itoa(sub.Version) + `"`
+}
+
+// parseIfMatch returns the version an If-Match header asks for, or 0 for "*".
+func parseIfMatch(h string) (int, bool) {
+	if h == "*" {
+		return 0, true
+	}
+	v, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(h, `"`), `"`))
+	if err != nil || v < 1 || !strings.HasPrefix(h, `"`) {
+		return 0, false
+	}
+	return v, true
+}
+
 func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
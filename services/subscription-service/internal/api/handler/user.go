@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"encoding/json/v2"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/service"
+)
+
+// UserHandler handles the internal endpoints that manage users and their API tokens.
+type UserHandler struct {
+	users *service.UserService
+}
+
+// NewUserHandler creates a UserHandler.
+func NewUserHandler(users *service.UserService) *UserHandler {
+	return &UserHandler{users: users}
+}
+
+type createUserRequest struct {
+	Name             string `json:"name"`
+	MaxSubscriptions int    `json:"max_subscriptions"`
+}
+
+type createUserResponse struct {
+	User  *models.User     `json:"user"`
+	Token *models.APIToken `json:"token"`
+}
+
+type createTokenRequest struct {
+	Name string `json:"name"`
+}
+
+type claimRequest struct {
+	WebhookURL string `json:"webhook_url"`
+}
+
+type claimResponse struct {
+	Claimed int64 `json:"claimed"`
+}
+
+// CreateUser handles POST /internal/users. The response carries the user's
+// first API token, which cannot be retrieved again.
+func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req createUserRequest
+	if err := json.UnmarshalRead(r.Body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request body"})
+		return
+	}
+
+	u, t, err := h.users.CreateUser(r.Context(), req.Name, req.MaxSubscriptions)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidUser) {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal error"})
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, createUserResponse{User: u, Token: t})
+}
+
+// CreateToken handles POST /internal/users/{id}/tokens.
+func (h *UserHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid user ID"})
+		return
+	}
+
+	var req createTokenRequest
+	if err := json.UnmarshalRead(r.Body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request body"})
+		return
+	}
+
+	t, err := h.users.CreateToken(r.Context(), id, req.Name)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "user not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal error"})
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, t)
+}
+
+// ClaimSubscriptions handles POST /internal/users/{id}/subscriptions/claim,
+// giving the user the subscriptions without an owner that deliver to a
+// webhook.
+func (h *UserHandler) ClaimSubscriptions(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid user ID"})
+		return
+	}
+
+	var req claimRequest
+	if err := json.UnmarshalRead(r.Body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request body"})
+		return
+	}
+
+	n, err := h.users.ClaimSubscriptions(r.Context(), id, req.WebhookURL)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidClaim):
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		case errors.Is(err, service.ErrUserNotFound):
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "user not found"})
+		default:
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal error"})
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, claimResponse{Claimed: n})
+}
+
+// RevokeToken handles DELETE /internal/tokens/{id}.
+func (h *UserHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid token ID"})
+		return
+	}
+
+	if err := h.users.RevokeToken(r.Context(), id); err != nil {
+		if errors.Is(err, service.ErrTokenNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "token not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
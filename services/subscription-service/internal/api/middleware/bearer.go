@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/service"
+)
+
+// Authenticator resolves an API token to the user it belongs to, returning
+// service.ErrInvalidAPIToken for tokens that do not authenticate anyone.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*models.User, error)
+}
+
+// SessionCookie is the cookie holding the session token of a user who signed
+// in with Discord.
+const SessionCookie = "tw_session"
+
+type userKey struct{}
+
+// BearerToken returns middleware that authenticates requests by the API token
+// in their "Authorization: Bearer" header, or else in their SessionCookie, and
+// makes the user available to handlers through User.
+func BearerToken(auth Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := requestToken(r)
+			if !ok {
+				unauthorized(w)
+				return
+			}
+			u, err := auth.Authenticate(r.Context(), token)
+			if errors.Is(err, service.ErrInvalidAPIToken) {
+				unauthorized(w)
+				return
+			}
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, u)))
+		})
+	}
+}
+
+// requestToken returns the API token r carries, if any.
+func requestToken(r *http.Request) (string, bool) {
+	if h := r.Header.Get("Authorization"); h != "" {
+		token, ok := strings.CutPrefix(h, "Bearer ")
+		return token, ok && token != ""
+	}
+	c, err := r.Cookie(SessionCookie)
+	if err != nil || c.Value == "" {
+		return "", false
+	}
+	return c.Value, true
+}
+
+// User returns the user BearerToken authenticated the request as, or nil.
+func User(ctx context.Context) *models.User {
+	u, _ := ctx.Value(userKey{}).(*models.User)
+	return u
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
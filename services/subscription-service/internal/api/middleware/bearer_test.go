@@ -0,0 +1,121 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/api/middleware"
+	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/service"
+)
+
+const testToken = "tw_token"
+
+type fakeAuth struct {
+	err error
+}
+
+func (a fakeAuth) Authenticate(_ context.Context, token string) (*models.User, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	if token != testToken {
+		return nil, service.ErrInvalidAPIToken
+	}
+	return &models.User{ID: "user-1"}, nil
+}
+
+func TestBearerToken_ValidToken(t *testing.T) {
+	var got *models.User
+	handler := middleware.BearerToken(fakeAuth{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = middleware.User(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if got == nil || got.ID != "user-1" {
+		t.Errorf("User = %+v, want user-1", got)
+	}
+}
+
+func TestBearerToken_SessionCookie(t *testing.T) {
+	handler := middleware.BearerToken(fakeAuth{})(http.HandlerFunc(okHandler))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: middleware.SessionCookie, Value: testToken})
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+}
+
+func TestBearerToken_HeaderTakesPrecedence(t *testing.T) {
+	handler := middleware.BearerToken(fakeAuth{})(http.HandlerFunc(okHandler))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer tw_other")
+	req.AddCookie(&http.Cookie{Name: middleware.SessionCookie, Value: testToken})
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestBearerToken_Unauthorized(t *testing.T) {
+	tests := map[string]string{
+		"missing header": "",
+		"wrong scheme":   "Basic " + testToken,
+		"empty token":    "Bearer ",
+		"unknown token":  "Bearer tw_other",
+	}
+	for name, header := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler := middleware.BearerToken(fakeAuth{})(http.HandlerFunc(okHandler))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if header != "" {
+				req.Header.Set("Authorization", header)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", rr.Code, http.StatusUnauthorized)
+			}
+			if got := rr.Header().Get("WWW-Authenticate"); got != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want Bearer", got)
+			}
+		})
+	}
+}
+
+func TestBearerToken_AuthenticatorError(t *testing.T) {
+	handler := middleware.BearerToken(fakeAuth{err: errors.New("db down")})(http.HandlerFunc(okHandler))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusInternalServerError)
+	}
+}
@@ -9,16 +9,39 @@ import (
 )
 
 // NewRouter builds and returns the HTTP mux for the subscription service.
-func NewRouter(svc *service.SubscriptionService, internalAPIKey string) http.Handler {
+// Signing in with Discord is only served if auth is not nil; secureCookies
+// marks its cookies Secure.
+func NewRouter(svc *service.SubscriptionService, users *service.UserService, auth *service.AuthService, internalAPIKey string, secureCookies bool) http.Handler {
 	mux := http.NewServeMux()
 
 	subHandler := handler.NewSubscriptionHandler(svc)
 	intHandler := handler.NewInternalHandler(svc)
-
-	// Public routes
-	mux.HandleFunc("POST /v1/subscriptions", subHandler.Create)
-	mux.HandleFunc("GET /v1/subscriptions/{id}", subHandler.GetByID)
-	mux.HandleFunc("DELETE /v1/subscriptions/{id}", subHandler.Delete)
+	userHandler := handler.NewUserHandler(users)
+
+	// Public routes (bearer-token protected)
+	subMux := http.NewServeMux()
+	subMux.HandleFunc("POST /v1/subscriptions", subHandler.Create)
+	subMux.HandleFunc("GET /v1/subscriptions", subHandler.List)
+	subMux.HandleFunc("GET /v1/subscriptions/{id}", subHandler.GetByID)
+	subMux.HandleFunc("PATCH /v1/subscriptions/{id}", subHandler.Patch)
+	subMux.HandleFunc("DELETE /v1/subscriptions/{id}", subHandler.Delete)
+
+	bearer := middleware.BearerToken(users)
+	mux.Handle("/v1/subscriptions", bearer(subMux))
+	mux.Handle("/v1/subscriptions/", bearer(subMux))
+
+	// Discord sign-in
+	if auth != nil {
+		authHandler := handler.NewAuthHandler(auth, secureCookies)
+		mux.HandleFunc("GET /v1/auth/discord/login", authHandler.Login)
+		mux.HandleFunc("GET /v1/auth/discord/webhook", authHandler.AddWebhook)
+		mux.HandleFunc("GET /v1/auth/discord/callback", authHandler.Callback)
+		mux.HandleFunc("POST /v1/auth/logout", authHandler.Logout)
+		mux.Handle("GET /v1/discord/webhooks", bearer(http.HandlerFunc(authHandler.ListWebhooks)))
+	}
+
+	// Public routes (authenticated by the link's token)
+	mux.HandleFunc("GET /v1/email/verify", subHandler.VerifyEmail)
 
 	// Health check
 	mux.HandleFunc("GET /v1/health", func(w http.ResponseWriter, r *http.Request) {
@@ -28,6 +51,11 @@ func NewRouter(svc *service.SubscriptionService, internalAPIKey string) http.Han
 	// Internal routes (API-key protected)
 	internalMux := http.NewServeMux()
 	internalMux.HandleFunc("GET /internal/subscriptions/active", intHandler.ListActive)
+	internalMux.HandleFunc("GET /internal/subscriptions/{id}", intHandler.Get)
+	internalMux.HandleFunc("POST /internal/users", userHandler.CreateUser)
+	internalMux.HandleFunc("POST /internal/users/{id}/tokens", userHandler.CreateToken)
+	internalMux.HandleFunc("POST /internal/users/{id}/subscriptions/claim", userHandler.ClaimSubscriptions)
+	internalMux.HandleFunc("DELETE /internal/tokens/{id}", userHandler.RevokeToken)
 
 	mux.Handle("/internal/", middleware.InternalAPIKey(internalAPIKey)(internalMux))
 
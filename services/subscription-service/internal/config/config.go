@@ -10,6 +10,19 @@ type Config struct {
 	HTTPAddr       string
 	DatabaseURL    string
 	InternalAPIKey string
+	NATSUrl        string
+	PublicURL      string // base of the links in confirmation emails
+
+	// Twitch application used to check watch targets; they are not checked
+	// without a client ID.
+	TwitchClientID     string
+	TwitchClientSecret string
+
+	// Discord OAuth2 application used to sign in with Discord; sign-in is
+	// disabled without a client ID.
+	DiscordClientID     string
+	DiscordClientSecret string
+	DiscordAPIURL       string // "" for Discord's; set to test against a fake provider
 }
 
 // Load reads configuration from environment variables, returning an error for any missing required value.
@@ -18,6 +31,15 @@ func Load() (*Config, error) {
 		HTTPAddr:       getEnv("HTTP_ADDR", ":8080"),
 		DatabaseURL:    os.Getenv("DATABASE_URL"),
 		InternalAPIKey: os.Getenv("INTERNAL_API_KEY"),
+		NATSUrl:        getEnv("NATS_URL", "nats://localhost:4222"),
+		PublicURL:      getEnv("PUBLIC_URL", "http://localhost:8080"),
+
+		TwitchClientID:     os.Getenv("TWITCH_CLIENT_ID"),
+		TwitchClientSecret: os.Getenv("TWITCH_CLIENT_SECRET"),
+
+		DiscordClientID:     os.Getenv("DISCORD_CLIENT_ID"),
+		DiscordClientSecret: os.Getenv("DISCORD_CLIENT_SECRET"),
+		DiscordAPIURL:       os.Getenv("DISCORD_API_URL"),
 	}
 
 	if cfg.DatabaseURL == "" {
@@ -26,6 +48,12 @@ func Load() (*Config, error) {
 	if cfg.InternalAPIKey == "" {
 		return nil, fmt.Errorf("INTERNAL_API_KEY is required")
 	}
+	if cfg.TwitchClientID != "" && cfg.TwitchClientSecret == "" {
+		return nil, fmt.Errorf("TWITCH_CLIENT_SECRET is required with TWITCH_CLIENT_ID")
+	}
+	if cfg.DiscordClientID != "" && cfg.DiscordClientSecret == "" {
+		return nil, fmt.Errorf("DISCORD_CLIENT_SECRET is required with DISCORD_CLIENT_ID")
+	}
 
 	return cfg, nil
 }
@@ -0,0 +1,101 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/messaging"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/service"
+)
+
+// Consumer pulls WebhookInvalidEvents from twitch.webhooks.invalid and
+// deactivates the subscriptions using those webhooks.
+type Consumer struct {
+	js     jetstream.JetStream
+	svc    *service.SubscriptionService
+	logger *slog.Logger
+}
+
+// New creates a Consumer, ensuring the TWITCH_WEBHOOKS_INVALID stream and its
+// durable consumer exist. The stream is also created by notification-dispatcher,
+// whichever service starts first.
+func New(nc *nats.Conn, svc *service.SubscriptionService, logger *slog.Logger) (*Consumer, error) {
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, fmt.Errorf("create jetstream context: %w", err)
+	}
+
+	_, err = js.CreateOrUpdateStream(context.Background(), jetstream.StreamConfig{
+		Name:      messaging.StreamTwitchWebhooksInvalid,
+		Subjects:  []string{messaging.SubjectWebhooksInvalid},
+		Retention: jetstream.WorkQueuePolicy,
+		MaxAge:    7 * 24 * time.Hour,
+		Storage:   jetstream.FileStorage,
+		Replicas:  1, // set to 3 via Helm in production
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create stream %s: %w", messaging.StreamTwitchWebhooksInvalid, err)
+	}
+
+	_, err = js.CreateOrUpdateConsumer(context.Background(), messaging.StreamTwitchWebhooksInvalid, jetstream.ConsumerConfig{
+		Durable:       messaging.ConsumerSubscriptionService,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		MaxDeliver:    5,
+		AckWait:       30 * time.Second,
+		FilterSubject: messaging.SubjectWebhooksInvalid,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create consumer %s: %w", messaging.ConsumerSubscriptionService, err)
+	}
+
+	return &Consumer{js: js, svc: svc, logger: logger}, nil
+}
+
+// Run starts consuming messages until ctx is cancelled.
+func (c *Consumer) Run(ctx context.Context) error {
+	cons, err := c.js.Consumer(ctx, messaging.StreamTwitchWebhooksInvalid, messaging.ConsumerSubscriptionService)
+	if err != nil {
+		return err
+	}
+
+	cc, err := cons.Consume(func(msg jetstream.Msg) {
+		env, err := messaging.Unmarshal[models.WebhookInvalidEvent](msg.Data())
+		if err != nil {
+			c.logger.Error("unmarshal webhook invalid event failed", "error", err)
+			msg.Term()
+			return
+		}
+		event := env.Payload
+
+		destination := event.DestinationType
+		if destination == "" {
+			destination = models.DestinationDiscord
+		}
+		reason := fmt.Sprintf("%s webhook invalid: %d %s", destination, event.StatusCode, event.Reason)
+		n, err := c.svc.DeactivateByWebhook(ctx, event.WebhookURL, reason)
+		if err != nil {
+			c.logger.Error("deactivate subscriptions failed", "error", err)
+			msg.Nak()
+			return
+		}
+
+		c.logger.Info("subscriptions deactivated for invalid webhook",
+			"count", n,
+			"status", event.StatusCode,
+			"reason", event.Reason,
+		)
+		msg.Ack()
+	})
+	if err != nil {
+		return err
+	}
+	defer cc.Stop()
+
+	<-ctx.Done()
+	return nil
+}
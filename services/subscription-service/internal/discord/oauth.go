@@ -0,0 +1,192 @@
+// Package discord implements the parts of Discord's OAuth2 authorization-code
+// flow the subscription service needs to sign users in and have Discord create
+// a webhook in a channel they pick.
+package discord
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const apiBase = "https://discord.com/api"
+
+const (
+	// scopeIdentify identifies the user.
+	scopeIdentify = "identify"
+	// scopeWebhook also lets them add a webhook to a channel of a guild they
+	// can manage webhooks in.
+	scopeWebhook = "identify webhook.incoming"
+)
+
+// ErrInvalidGrant is returned by Exchange when Discord rejects the
+// authorization code, e.g. because it expired or was already used.
+var ErrInvalidGrant = errors.New("authorization code rejected")
+
+// Client talks to Discord's OAuth2 endpoints on behalf of one application.
+type Client struct {
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	baseURL      string
+	httpClient   *http.Client
+}
+
+// NewClient creates a Client. baseURL is Discord's API, or "" for
+// https://discord.com/api; pointing it elsewhere allows testing against a
+// fake provider.
+func NewClient(clientID, clientSecret, redirectURL, baseURL string) *Client {
+	if baseURL == "" {
+		baseURL = apiBase
+	}
+	return &Client{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Token is the result of exchanging an authorization code.
+type Token struct {
+	AccessToken string   `json:"access_token"`
+	TokenType   string   `json:"token_type"`
+	Scope       string   `json:"scope"`
+	Webhook     *Webhook `json:"webhook"`
+}
+
+// Webhook is the webhook Discord created in the channel the user picked.
+type Webhook struct {
+	ID        string `json:"id"`
+	Token     string `json:"token"`
+	URL       string `json:"url"`
+	Name      string `json:"name"`
+	ChannelID string `json:"channel_id"`
+	GuildID   string `json:"guild_id"`
+}
+
+// User is the Discord user an access token belongs to.
+type User struct {
+	ID         string `json:"id"`
+	Username   string `json:"username"`
+	GlobalName string `json:"global_name"`
+}
+
+// DisplayName returns the user's display name, or their username if they have none.
+func (u *User) DisplayName() string {
+	if u.GlobalName != "" {
+		return u.GlobalName
+	}
+	return u.Username
+}
+
+// NewVerifier returns a random PKCE code verifier.
+func NewVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate code verifier: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// challenge returns the S256 PKCE code challenge of verifier.
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL to send the user to. Discord redirects back to
+// the redirect URL with state and a code that Exchange accepts together with
+// verifier. With webhook set, the user also picks a channel for Discord to
+// create a webhook in.
+func (c *Client) AuthCodeURL(state, verifier string, webhook bool) string {
+	scope := scopeIdentify
+	if webhook {
+		scope = scopeWebhook
+	}
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.clientID},
+		"scope":                 {scope},
+		"redirect_uri":          {c.redirectURL},
+		"state":                 {state},
+		"code_challenge":        {challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	return c.baseURL + "/oauth2/authorize?" + params.Encode()
+}
+
+// Exchange trades an authorization code for an access token and, if one was
+// asked for, the webhook Discord created.
+func (c *Client) Exchange(ctx context.Context, code, verifier string) (*Token, error) {
+	body := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.redirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/oauth2/token", strings.NewReader(body.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("exchange authorization code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusBadRequest {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.UnmarshalRead(resp.Body, &e) == nil && e.Error == "invalid_grant" {
+			return nil, ErrInvalidGrant
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d", resp.StatusCode)
+	}
+
+	var t Token
+	if err := json.UnmarshalRead(resp.Body, &t); err != nil {
+		return nil, fmt.Errorf("decode token response: %w", err)
+	}
+	return &t, nil
+}
+
+// CurrentUser returns the user accessToken was issued to.
+func (c *Client) CurrentUser(ctx context.Context, accessToken string) (*User, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/users/@me", nil)
+	if err != nil {
+		return nil, fmt.Errorf("build user request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch current user: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("users/@me returned %d", resp.StatusCode)
+	}
+
+	var u User
+	if err := json.UnmarshalRead(resp.Body, &u); err != nil {
+		return nil, fmt.Errorf("decode user: %w", err)
+	}
+	return &u, nil
+}
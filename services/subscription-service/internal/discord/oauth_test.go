@@ -0,0 +1,140 @@
+package discord
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// fakeProvider is a minimal Discord OAuth2 server. authorize stands in for the
+// user approving the consent screen: it issues a code bound to the request's
+// code challenge, which the token endpoint checks against the verifier.
+type fakeProvider struct {
+	codes  map[string]string // code → code challenge
+	scopes map[string]string // code → scope
+}
+
+func (p *fakeProvider) authorize(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != "client" {
+		t.Fatalf("authorize query = %v", q)
+	}
+	code = "code-" + q.Get("state")
+	p.codes[code] = q.Get("code_challenge")
+	p.scopes[code] = q.Get("scope")
+	return code, q.Get("state")
+}
+
+func (p *fakeProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/oauth2/token":
+		id, secret, _ := r.BasicAuth()
+		if id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		code := r.PostFormValue("code")
+		want, ok := p.codes[code]
+		delete(p.codes, code)
+		if !ok || challenge(r.PostFormValue("code_verifier")) != want || r.PostFormValue("redirect_uri") != "http://localhost/callback" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.MarshalWrite(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		tok := Token{AccessToken: "access", TokenType: "Bearer", Scope: p.scopes[code]}
+		if tok.Scope == scopeWebhook {
+			tok.Webhook = &Webhook{
+				ID: "111", Token: "tok", URL: "https://discord.com/api/webhooks/111/tok",
+				ChannelID: "222", GuildID: "333",
+			}
+		}
+		_ = json.MarshalWrite(w, tok)
+	case "/users/@me":
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.MarshalWrite(w, User{ID: "444", Username: "streamfan"})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestClient(t *testing.T) (*Client, *fakeProvider) {
+	p := &fakeProvider{codes: make(map[string]string), scopes: make(map[string]string)}
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+	return NewClient("client", "secret", "http://localhost/callback", srv.URL), p
+}
+
+func TestChallenge(t *testing.T) {
+	// RFC 7636, appendix B.
+	if got := challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("challenge = %q", got)
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	c, p := newTestClient(t)
+	verifier, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state := p.authorize(t, c.AuthCodeURL("state-1", verifier, true))
+	if state != "state-1" {
+		t.Errorf("state = %q, want state-1", state)
+	}
+	tok, err := c.Exchange(context.Background(), code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if tok.Webhook == nil || tok.Webhook.URL != "https://discord.com/api/webhooks/111/tok" || tok.Webhook.GuildID != "333" {
+		t.Errorf("Webhook = %+v", tok.Webhook)
+	}
+
+	u, err := c.CurrentUser(context.Background(), tok.AccessToken)
+	if err != nil {
+		t.Fatalf("CurrentUser: %v", err)
+	}
+	if u.ID != "444" || u.DisplayName() != "streamfan" {
+		t.Errorf("User = %+v", u)
+	}
+}
+
+func TestExchange_IdentifyOnly(t *testing.T) {
+	c, p := newTestClient(t)
+	verifier, _ := NewVerifier()
+
+	code, _ := p.authorize(t, c.AuthCodeURL("state-1", verifier, false))
+	tok, err := c.Exchange(context.Background(), code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if tok.Webhook != nil {
+		t.Errorf("Webhook = %+v, want none without webhook.incoming", tok.Webhook)
+	}
+}
+
+func TestExchange_InvalidGrant(t *testing.T) {
+	c, p := newTestClient(t)
+	verifier, _ := NewVerifier()
+	other, _ := NewVerifier()
+
+	code, _ := p.authorize(t, c.AuthCodeURL("state-1", verifier, false))
+	if _, err := c.Exchange(context.Background(), code, other); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("Exchange with the wrong verifier: error = %v, want ErrInvalidGrant", err)
+	}
+	if _, err := c.Exchange(context.Background(), code, verifier); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("Exchange of a used code: error = %v, want ErrInvalidGrant", err)
+	}
+}
@@ -0,0 +1,56 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/messaging"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+)
+
+// Publisher publishes EmailVerificationEvents to NATS JetStream.
+type Publisher struct {
+	js jetstream.JetStream
+}
+
+// New creates a Publisher, ensuring the twitch.email.verification stream
+// exists. The stream is also created by notification-dispatcher, whichever
+// service starts first.
+func New(nc *nats.Conn) (*Publisher, error) {
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, fmt.Errorf("create jetstream context: %w", err)
+	}
+
+	_, err = js.CreateOrUpdateStream(context.Background(), jetstream.StreamConfig{
+		Name:      messaging.StreamTwitchEmailVerify,
+		Subjects:  []string{messaging.SubjectEmailVerify},
+		Retention: jetstream.WorkQueuePolicy,
+		MaxAge:    48 * time.Hour, // confirmation links expire after 48h anyway
+		Storage:   jetstream.FileStorage,
+		Replicas:  1, // set to 3 via Helm in production
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create stream %s: %w", messaging.StreamTwitchEmailVerify, err)
+	}
+
+	return &Publisher{js: js}, nil
+}
+
+// PublishEmailVerification serialises and publishes an EmailVerificationEvent envelope.
+func (p *Publisher) PublishEmailVerification(ctx context.Context, event models.EmailVerificationEvent) error {
+	env := messaging.NewEnvelope(event)
+	data, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("marshal email verification event: %w", err)
+	}
+
+	if _, err := p.js.Publish(ctx, messaging.SubjectEmailVerify, data); err != nil {
+		return fmt.Errorf("publish email verification event: %w", err)
+	}
+	return nil
+}
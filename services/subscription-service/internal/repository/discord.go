@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+)
+
+// ErrOAuthStateNotFound is returned when an OAuth2 state does not exist, was
+// already used or expired.
+var ErrOAuthStateNotFound = errors.New("OAuth state not found")
+
+// ErrDiscordWebhookNotFound is returned when a user has no Discord webhook with a given ID.
+var ErrDiscordWebhookNotFound = errors.New("Discord webhook not found")
+
+// discordWebhookColumns lists the discord_webhooks columns in the order scanDiscordWebhook reads them.
+const discordWebhookColumns = `id, webhook_id, guild_id, channel_id, name, webhook_url, created_at`
+
+// SaveOAuthState records the PKCE code verifier of a login whose state
+// parameter hashes to stateHash, until expiresAt. Expired states of abandoned
+// logins are removed on the way.
+func (r *Repository) SaveOAuthState(ctx context.Context, stateHash, codeVerifier string, expiresAt time.Time) error {
+	if _, err := r.db.Exec(ctx, `DELETE FROM oauth_states WHERE expires_at <= NOW()`); err != nil {
+		return err
+	}
+	const q = `INSERT INTO oauth_states (state_hash, code_verifier, expires_at) VALUES ($1, $2, $3)`
+	_, err := r.db.Exec(ctx, q, stateHash, codeVerifier, expiresAt)
+	return err
+}
+
+// TakeOAuthState removes the unexpired state hashing to stateHash and returns
+// its code verifier, so each state completes at most one login.
+func (r *Repository) TakeOAuthState(ctx context.Context, stateHash string) (string, error) {
+	const q = `DELETE FROM oauth_states WHERE state_hash = $1 AND expires_at > NOW() RETURNING code_verifier`
+	var verifier string
+	err := r.db.QueryRow(ctx, q, stateHash).Scan(&verifier)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrOAuthStateNotFound
+	}
+	return verifier, err
+}
+
+// SaveDiscordWebhook stores a webhook Discord created for ownerID.
+func (r *Repository) SaveDiscordWebhook(ctx context.Context, ownerID string, w models.DiscordWebhook) (*models.DiscordWebhook, error) {
+	const q = `
+		INSERT INTO discord_webhooks (owner_id, webhook_id, guild_id, channel_id, name, webhook_url)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (webhook_id) DO UPDATE
+		SET owner_id = EXCLUDED.owner_id, name = EXCLUDED.name, webhook_url = EXCLUDED.webhook_url
+		RETURNING ` + discordWebhookColumns
+
+	return scanDiscordWebhook(r.db.QueryRow(ctx, q, ownerID, w.WebhookID, w.GuildID, w.ChannelID, w.Name, w.WebhookURL))
+}
+
+// GetDiscordWebhook returns ownerID's Discord webhook with the given ID.
+func (r *Repository) GetDiscordWebhook(ctx context.Context, ownerID, id string) (*models.DiscordWebhook, error) {
+	const q = `SELECT ` + discordWebhookColumns + ` FROM discord_webhooks WHERE id = $1 AND owner_id = $2`
+
+	w, err := scanDiscordWebhook(r.db.QueryRow(ctx, q, id, ownerID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDiscordWebhookNotFound
+	}
+	return w, err
+}
+
+// ListDiscordWebhooks returns ownerID's Discord webhooks, newest first.
+func (r *Repository) ListDiscordWebhooks(ctx context.Context, ownerID string) ([]models.DiscordWebhook, error) {
+	const q = `SELECT ` + discordWebhookColumns + ` FROM discord_webhooks WHERE owner_id = $1 ORDER BY created_at DESC`
+
+	rows, err := r.db.Query(ctx, q, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []models.DiscordWebhook
+	for rows.Next() {
+		w, err := scanDiscordWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *w)
+	}
+	return webhooks, rows.Err()
+}
+
+func scanDiscordWebhook(row pgx.Row) (*models.DiscordWebhook, error) {
+	var w models.DiscordWebhook
+	err := row.Scan(&w.ID, &w.WebhookID, &w.GuildID, &w.ChannelID, &w.Name, &w.WebhookURL, &w.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
@@ -3,6 +3,9 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -15,6 +18,27 @@ var ErrNotFound = errors.New("subscription not found")
 // ErrDuplicate is returned when a subscription already exists.
 var ErrDuplicate = errors.New("subscription already exists")
 
+// ErrVersionConflict is returned by Update when the subscription changed
+// since the version it was given.
+var ErrVersionConflict = errors.New("subscription was changed concurrently")
+
+// ErrQuotaExceeded is returned when creating or reactivating a subscription
+// would give its owner more active subscriptions than their max_subscriptions.
+var ErrQuotaExceeded = errors.New("subscription quota exceeded")
+
+// ReasonDeleted is the deactivation reason recorded when a subscription is deleted through the API.
+const ReasonDeleted = "deleted"
+
+// columns lists the subscription columns in the order scanSubscription reads them.
+const columns = `id, COALESCE(owner_id::text, ''), destination_type, webhook_url, watch_type, watch_target,
+		COALESCE(watch_target_id, ''), notify_on_end, active, created_at,
+		COALESCE(deactivated_reason, ''), deactivated_at, COALESCE(webhook_secret, ''), destination_config,
+		pending_verification, updated_at, version`
+
+// expiredPending matches subscriptions whose confirmation link expired
+// before they were verified.
+const expiredPending = `pending_verification = TRUE AND verification_expires_at <= NOW()`
+
 // Repository provides data access for subscriptions.
 type Repository struct {
 	db *pgxpool.Pool
@@ -25,47 +49,146 @@ func New(db *pgxpool.Pool) *Repository {
 	return &Repository{db: db}
 }
 
-// Create inserts a new subscription and returns it.
-func (r *Repository) Create(ctx context.Context, webhook string, watchType models.WatchType, watchTarget string) (*models.Subscription, error) {
+// Create inserts a new subscription and returns it. ID, Active and CreatedAt
+// are assigned by the database. It fails with ErrQuotaExceeded if the owner
+// already has as many active subscriptions as they are allowed.
+func (r *Repository) Create(ctx context.Context, sub models.Subscription) (*models.Subscription, error) {
+	return r.insert(ctx, sub, "", nil)
+}
+
+// CreatePending inserts a subscription that stays pending until Verify is
+// called with the token hashing to tokenHash, before expiresAt. An expired
+// pending subscription for the same address and watch target is replaced.
+func (r *Repository) CreatePending(ctx context.Context, sub models.Subscription, tokenHash string, expiresAt time.Time) (*models.Subscription, error) {
+	return r.insert(ctx, sub, tokenHash, &expiresAt)
+}
+
+func (r *Repository) insert(ctx context.Context, sub models.Subscription, tokenHash string, expiresAt *time.Time) (*models.Subscription, error) {
 	const q = `
-		INSERT INTO subscriptions (discord_webhook, watch_type, watch_target)
-		VALUES ($1, $2, $3)
-		RETURNING id, discord_webhook, watch_type, watch_target, active, created_at`
+		INSERT INTO subscriptions (destination_type, webhook_url, watch_type, watch_target, notify_on_end,
+			webhook_secret, destination_config, pending_verification, verification_token_hash, verification_expires_at,
+			owner_id, watch_target_id)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8 <> '', NULLIF($8, ''), $9, NULLIF($10, '')::uuid, NULLIF($11, ''))
+		RETURNING ` + columns
 
-	var s models.Subscription
-	err := r.db.QueryRow(ctx, q, webhook, watchType, watchTarget).
-		Scan(&s.ID, &s.DiscordWebhook, &s.WatchType, &s.WatchTarget, &s.Active, &s.CreatedAt)
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := reserveQuota(ctx, tx, sub.OwnerID); err != nil {
+		return nil, err
+	}
+	const expired = `
+		DELETE FROM subscriptions
+		WHERE webhook_url = $1 AND watch_type = $2 AND watch_target = $3
+			AND owner_id IS NOT DISTINCT FROM NULLIF($4, '')::uuid AND ` + expiredPending
+	if _, err := tx.Exec(ctx, expired, sub.WebhookURL, sub.WatchType, sub.WatchTarget, sub.OwnerID); err != nil {
+		return nil, err
+	}
+	s, err := scanSubscription(tx.QueryRow(ctx, q,
+		sub.DestinationType, sub.WebhookURL, sub.WatchType, sub.WatchTarget, sub.NotifyOnEnd,
+		sub.WebhookSecret, sub.DestinationConfig, tokenHash, expiresAt, sub.OwnerID, sub.WatchTargetID))
 	if err != nil {
 		if isUniqueViolation(err) {
 			return nil, ErrDuplicate
 		}
 		return nil, err
 	}
-	return &s, nil
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ClaimUnowned gives userID the subscriptions without an owner that deliver
+// to webhookURL, which were created before users existed, and returns how
+// many it was given. Those duplicating one of userID's subscriptions stay
+// unowned. Claimed subscriptions count towards the user's quota, but
+// claiming is not limited by it.
+func (r *Repository) ClaimUnowned(ctx context.Context, userID, webhookURL string) (int64, error) {
+	const q = `
+		UPDATE subscriptions s
+		SET owner_id = $1, version = version + 1, updated_at = NOW()
+		WHERE s.owner_id IS NULL AND s.webhook_url = $2
+			AND NOT EXISTS (
+				SELECT 1 FROM subscriptions o
+				WHERE o.owner_id = $1 AND o.webhook_url = s.webhook_url
+					AND o.watch_type = s.watch_type AND o.watch_target = s.watch_target)`
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Locked like reserveQuota, so a concurrent create cannot add a duplicate.
+	err = tx.QueryRow(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(new(string))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrUserNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	tag, err := tx.Exec(ctx, q, userID, webhookURL)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// reserveQuota locks the user row of ownerID until tx ends, so that creates
+// and reactivations for one owner are counted one at a time, and returns
+// ErrQuotaExceeded if the owner has no active subscription to spare.
+// Subscriptions without an owner are not limited.
+func reserveQuota(ctx context.Context, tx pgx.Tx, ownerID string) error {
+	if ownerID == "" {
+		return nil
+	}
+	var max int
+	if err := tx.QueryRow(ctx, `SELECT max_subscriptions FROM users WHERE id = $1 FOR UPDATE`, ownerID).Scan(&max); err != nil {
+		return err
+	}
+	// A separate statement, so it sees what the previous holder of the lock committed.
+	var n int
+	const q = `SELECT COUNT(*) FROM subscriptions WHERE owner_id = $1 AND active = TRUE AND NOT (` + expiredPending + `)`
+	if err := tx.QueryRow(ctx, q, ownerID).Scan(&n); err != nil {
+		return err
+	}
+	if n >= max {
+		return ErrQuotaExceeded
+	}
+	return nil
 }
 
 // GetByID retrieves a single subscription by its UUID.
 func (r *Repository) GetByID(ctx context.Context, id string) (*models.Subscription, error) {
 	const q = `
-		SELECT id, discord_webhook, watch_type, watch_target, active, created_at
+		SELECT ` + columns + `
 		FROM subscriptions WHERE id = $1`
 
-	var s models.Subscription
-	err := r.db.QueryRow(ctx, q, id).
-		Scan(&s.ID, &s.DiscordWebhook, &s.WatchType, &s.WatchTarget, &s.Active, &s.CreatedAt)
+	s, err := scanSubscription(r.db.QueryRow(ctx, q, id))
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrNotFound
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &s, nil
+	return s, nil
 }
 
 // Delete soft-deletes a subscription by setting active = false.
 func (r *Repository) Delete(ctx context.Context, id string) error {
-	const q = `UPDATE subscriptions SET active = FALSE WHERE id = $1`
-	tag, err := r.db.Exec(ctx, q, id)
+	const q = `
+		UPDATE subscriptions
+		SET active = FALSE, deactivated_reason = $2, deactivated_at = NOW(),
+			version = version + 1, updated_at = NOW()
+		WHERE id = $1`
+	tag, err := r.db.Exec(ctx, q, id, ReasonDeleted)
 	if err != nil {
 		return err
 	}
@@ -75,11 +198,124 @@ func (r *Repository) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
-// ListActive returns all subscriptions where active = true.
+// Update saves the editable fields of sub if its stored version is still
+// version, and returns the updated subscription. Reactivating a subscription
+// clears its deactivation reason, and fails with ErrQuotaExceeded if its
+// owner has no active subscription to spare; deactivating it records
+// ReasonDeleted.
+func (r *Repository) Update(ctx context.Context, sub models.Subscription, version int) (*models.Subscription, error) {
+	const q = `
+		UPDATE subscriptions
+		SET webhook_url = $3, watch_type = $4, watch_target = $5, notify_on_end = $6, destination_config = $7,
+			active = $8, watch_target_id = NULLIF($10, ''),
+			deactivated_reason = CASE WHEN $8 THEN NULL WHEN active THEN $9 ELSE deactivated_reason END,
+			deactivated_at = CASE WHEN $8 THEN NULL WHEN active THEN NOW() ELSE deactivated_at END,
+			version = version + 1, updated_at = NOW()
+		WHERE id = $1 AND version = $2
+		RETURNING ` + columns
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if sub.Active {
+		var active bool
+		err := tx.QueryRow(ctx, `SELECT active FROM subscriptions WHERE id = $1`, sub.ID).Scan(&active)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !active {
+			if err := reserveQuota(ctx, tx, sub.OwnerID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	s, err := scanSubscription(tx.QueryRow(ctx, q,
+		sub.ID, version, sub.WebhookURL, sub.WatchType, sub.WatchTarget, sub.NotifyOnEnd, sub.DestinationConfig,
+		sub.Active, ReasonDeleted, sub.WatchTargetID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err := r.GetByID(ctx, sub.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrVersionConflict
+	}
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrDuplicate
+		}
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Verify confirms the pending subscription whose unexpired verification token
+// hashes to tokenHash, and returns it. The token cannot be used again.
+func (r *Repository) Verify(ctx context.Context, tokenHash string) (*models.Subscription, error) {
+	const q = `
+		UPDATE subscriptions
+		SET pending_verification = FALSE, verification_token_hash = NULL, verification_expires_at = NULL,
+			version = version + 1, updated_at = NOW()
+		WHERE verification_token_hash = $1 AND verification_expires_at > NOW() AND active = TRUE
+		RETURNING ` + columns
+
+	s, err := scanSubscription(r.db.QueryRow(ctx, q, tokenHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// DeletePending removes a subscription that was never verified. Unlike
+// Delete it leaves no row behind, so the subscription can be created again.
+func (r *Repository) DeletePending(ctx context.Context, id string) error {
+	const q = `DELETE FROM subscriptions WHERE id = $1 AND pending_verification = TRUE`
+	_, err := r.db.Exec(ctx, q, id)
+	return err
+}
+
+// DeleteExpiredPending removes every subscription whose confirmation link
+// expired before it was verified, and returns how many were removed.
+func (r *Repository) DeleteExpiredPending(ctx context.Context) (int64, error) {
+	tag, err := r.db.Exec(ctx, `DELETE FROM subscriptions WHERE `+expiredPending)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// DeactivateByWebhook deactivates every active subscription that delivers to
+// webhook, recording reason, and returns how many were deactivated.
+func (r *Repository) DeactivateByWebhook(ctx context.Context, webhook, reason string) (int64, error) {
+	const q = `
+		UPDATE subscriptions
+		SET active = FALSE, deactivated_reason = $2, deactivated_at = NOW(),
+			version = version + 1, updated_at = NOW()
+		WHERE webhook_url = $1 AND active = TRUE`
+	tag, err := r.db.Exec(ctx, q, webhook, reason)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ListActive returns all subscriptions where active = true, except those
+// still pending verification.
 func (r *Repository) ListActive(ctx context.Context) ([]models.Subscription, error) {
 	const q = `
-		SELECT id, discord_webhook, watch_type, watch_target, active, created_at
-		FROM subscriptions WHERE active = TRUE`
+		SELECT ` + columns + `
+		FROM subscriptions WHERE active = TRUE AND pending_verification = FALSE`
 
 	rows, err := r.db.Query(ctx, q)
 	if err != nil {
@@ -89,15 +325,130 @@ func (r *Repository) ListActive(ctx context.Context) ([]models.Subscription, err
 
 	var subs []models.Subscription
 	for rows.Next() {
-		var s models.Subscription
-		if err := rows.Scan(&s.ID, &s.DiscordWebhook, &s.WatchType, &s.WatchTarget, &s.Active, &s.CreatedAt); err != nil {
+		s, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, *s)
+	}
+	return subs, rows.Err()
+}
+
+// ListFilter narrows List. Zero fields do not filter.
+type ListFilter struct {
+	OwnerID           string
+	WebhookURL        string
+	WatchType         models.WatchType
+	WatchTargetPrefix string
+	Active            *bool
+	CreatedAfter      time.Time
+	CreatedBefore     time.Time
+}
+
+// Cursor is the position of a subscription in List's order.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// List returns up to limit subscriptions matching f, newest first, starting
+// after the subscription at after if it is not nil.
+func (r *Repository) List(ctx context.Context, f ListFilter, after *Cursor, limit int) ([]models.Subscription, error) {
+	q, args := listQuery(f, after, limit)
+	rows, err := r.db.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []models.Subscription
+	for rows.Next() {
+		s, err := scanSubscription(rows)
+		if err != nil {
 			return nil, err
 		}
-		subs = append(subs, s)
+		subs = append(subs, *s)
 	}
 	return subs, rows.Err()
 }
 
+// likeEscaper escapes the LIKE wildcards in a prefix.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// listQuery builds the query and arguments of List. Rows are ordered by
+// (created_at, id) so pages stay stable while subscriptions are added.
+func listQuery(f ListFilter, after *Cursor, limit int) (string, []any) {
+	var where []string
+	var args []any
+	add := func(cond string, vals ...any) {
+		for _, v := range vals {
+			args = append(args, v)
+			cond = strings.Replace(cond, "?", fmt.Sprintf("$%d", len(args)), 1)
+		}
+		where = append(where, cond)
+	}
+
+	if f.OwnerID != "" {
+		add("owner_id = ?", f.OwnerID)
+	}
+	if f.WebhookURL != "" {
+		add("webhook_url = ?", f.WebhookURL)
+	}
+	if f.WatchType != "" {
+		add("watch_type = ?", f.WatchType)
+	}
+	if f.WatchTargetPrefix != "" {
+		add(`watch_target LIKE ? ESCAPE '\'`, likeEscaper.Replace(f.WatchTargetPrefix)+"%")
+	}
+	if f.Active != nil {
+		add("active = ?", *f.Active)
+	}
+	if !f.CreatedAfter.IsZero() {
+		add("created_at > ?", f.CreatedAfter)
+	}
+	if !f.CreatedBefore.IsZero() {
+		add("created_at < ?", f.CreatedBefore)
+	}
+	if after != nil {
+		add("(created_at, id) < (?, ?)", after.CreatedAt, after.ID)
+	}
+
+	q := `
+		SELECT ` + columns + `
+		FROM subscriptions`
+	if len(where) > 0 {
+		q += `
+		WHERE ` + strings.Join(where, " AND ")
+	}
+	args = append(args, limit)
+	q += fmt.Sprintf(`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d`, len(args))
+	return q, args
+}
+
+// scanSubscription reads one row selected with columns.
+func scanSubscription(row pgx.Row) (*models.Subscription, error) {
+	var s models.Subscription
+	err := row.Scan(&s.ID, &s.OwnerID, &s.DestinationType, &s.WebhookURL, &s.WatchType, &s.WatchTarget, &s.WatchTargetID, &s.NotifyOnEnd, &s.Active, &s.CreatedAt,
+		&s.DeactivatedReason, &s.DeactivatedAt, &s.WebhookSecret, &s.DestinationConfig,
+		&s.PendingVerification, &s.UpdatedAt, &s.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// isForeignKeyViolation checks whether the error is a PostgreSQL foreign key violation.
+func isForeignKeyViolation(err error) bool {
+	type pgErr interface{ SQLState() string }
+	var pe pgErr
+	if errors.As(err, &pe) {
+		return pe.SQLState() == "23503"
+	}
+	return false
+}
+
 // isUniqueViolation checks whether the error is a PostgreSQL unique constraint violation.
 func isUniqueViolation(err error) bool {
 	// pgx wraps pgconn.PgError; check SQLSTATE 23505.
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+)
+
+func TestListQuery(t *testing.T) {
+	active := true
+	createdAt := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	q, args := listQuery(ListFilter{
+		WebhookURL:        "https://discord.com/api/webhooks/1/a",
+		WatchType:         models.WatchTypeStreamer,
+		WatchTargetPrefix: "a_b%",
+		Active:            &active,
+	}, &Cursor{CreatedAt: createdAt, ID: "4c7f5a3e-8a6b-4b8e-9d3f-2f1e0c9b8a7d"}, 51)
+
+	for _, want := range []string{
+		"webhook_url = $1", "watch_type = $2", `watch_target LIKE $3 ESCAPE '\'`, "active = $4",
+		"(created_at, id) < ($5, $6)", "ORDER BY created_at DESC, id DESC", "LIMIT $7",
+	} {
+		if !strings.Contains(q, want) {
+			t.Errorf("query is missing %q:\n%s", want, q)
+		}
+	}
+	if len(args) != 7 || args[2] != `a\_b\%%` || args[6] != 51 {
+		t.Errorf("args = %v", args)
+	}
+}
+
+func TestListQuery_NoFilters(t *testing.T) {
+	q, args := listQuery(ListFilter{}, nil, 10)
+	if strings.Contains(q, "WHERE") || !strings.Contains(q, "LIMIT $1") || len(args) != 1 {
+		t.Errorf("query = %s, args = %v", q, args)
+	}
+}
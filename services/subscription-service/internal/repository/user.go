@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+)
+
+// ErrUserNotFound is returned when a user does not exist.
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrTokenNotFound is returned when an API token does not exist, or is
+// revoked or expired.
+var ErrTokenNotFound = errors.New("API token not found")
+
+// userColumns lists the user columns in the order userFields reads them.
+const userColumns = `id, name, max_subscriptions, COALESCE(discord_user_id, ''), created_at`
+
+// userFields returns the scan destinations for userColumns.
+func userFields(u *models.User) []any {
+	return []any{&u.ID, &u.Name, &u.MaxSubscriptions, &u.DiscordUserID, &u.CreatedAt}
+}
+
+// CreateUser inserts a new user allowed maxSubscriptions active subscriptions.
+func (r *Repository) CreateUser(ctx context.Context, name string, maxSubscriptions int) (*models.User, error) {
+	const q = `
+		INSERT INTO users (name, max_subscriptions)
+		VALUES ($1, $2)
+		RETURNING ` + userColumns
+
+	var u models.User
+	if err := r.db.QueryRow(ctx, q, name, maxSubscriptions).Scan(userFields(&u)...); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// UpsertDiscordUser returns the user who signed in with discordUserID,
+// creating them allowed maxSubscriptions active subscriptions on their first
+// sign-in. name is updated to their current Discord name.
+func (r *Repository) UpsertDiscordUser(ctx context.Context, discordUserID, name string, maxSubscriptions int) (*models.User, error) {
+	const q = `
+		INSERT INTO users (name, max_subscriptions, discord_user_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (discord_user_id) DO UPDATE SET name = EXCLUDED.name
+		RETURNING ` + userColumns
+
+	var u models.User
+	if err := r.db.QueryRow(ctx, q, name, maxSubscriptions, discordUserID).Scan(userFields(&u)...); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// CreateToken stores the hash of a new API token of userID, which stops
+// authenticating at expiresAt unless that is nil.
+func (r *Repository) CreateToken(ctx context.Context, userID, name, tokenHash string, expiresAt *time.Time) (*models.APIToken, error) {
+	const q = `
+		INSERT INTO api_tokens (user_id, name, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, user_id, name, created_at, expires_at`
+
+	var t models.APIToken
+	err := r.db.QueryRow(ctx, q, userID, name, tokenHash, expiresAt).Scan(&t.ID, &t.UserID, &t.Name, &t.CreatedAt, &t.ExpiresAt)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+// UserByToken returns the user of the unrevoked, unexpired API token hashing
+// to tokenHash, and records that the token was used.
+func (r *Repository) UserByToken(ctx context.Context, tokenHash string) (*models.User, error) {
+	const q = `
+		UPDATE api_tokens t
+		SET last_used_at = NOW()
+		FROM users u
+		WHERE t.token_hash = $1 AND t.revoked_at IS NULL AND (t.expires_at IS NULL OR t.expires_at > NOW())
+			AND u.id = t.user_id
+		RETURNING u.id, u.name, u.max_subscriptions, COALESCE(u.discord_user_id, ''), u.created_at`
+
+	var u models.User
+	err := r.db.QueryRow(ctx, q, tokenHash).Scan(userFields(&u)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// RevokeToken stops the API token with the given ID from authenticating.
+func (r *Repository) RevokeToken(ctx context.Context, id string) error {
+	const q = `UPDATE api_tokens SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+	return r.revokeToken(ctx, q, id)
+}
+
+// RevokeTokenByHash stops the API token hashing to tokenHash from authenticating.
+func (r *Repository) RevokeTokenByHash(ctx context.Context, tokenHash string) error {
+	const q = `UPDATE api_tokens SET revoked_at = NOW() WHERE token_hash = $1 AND revoked_at IS NULL`
+	return r.revokeToken(ctx, q, tokenHash)
+}
+
+func (r *Repository) revokeToken(ctx context.Context, q, arg string) error {
+	tag, err := r.db.Exec(ctx, q, arg)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
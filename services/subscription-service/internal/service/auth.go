@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/discord"
+	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/repository"
+)
+
+// ErrInvalidOAuthState is returned when a login callback's state is unknown,
+// already used or expired, e.g. because it was not started by this browser.
+var ErrInvalidOAuthState = errors.New("invalid or expired OAuth state")
+
+// ErrDiscordLoginFailed is returned when Discord does not complete a login,
+// e.g. because the authorization code expired or its webhook is unusable.
+var ErrDiscordLoginFailed = errors.New("Discord login failed")
+
+// ErrDiscordWebhookNotFound is forwarded from the repository layer.
+var ErrDiscordWebhookNotFound = repository.ErrDiscordWebhookNotFound
+
+// oauthStateTTL is how long a user has to complete a login on Discord.
+const oauthStateTTL = 10 * time.Minute
+
+// SessionTTL is how long a login session lasts.
+const SessionTTL = 30 * 24 * time.Hour
+
+// AuthService signs users in with Discord's OAuth2 authorization-code flow
+// with PKCE. Sessions are API tokens that expire after SessionTTL.
+type AuthService struct {
+	repo  *repository.Repository
+	users *UserService
+	oauth *discord.Client
+}
+
+// NewAuthService creates an AuthService.
+func NewAuthService(repo *repository.Repository, users *UserService, oauth *discord.Client) *AuthService {
+	return &AuthService{repo: repo, users: users, oauth: oauth}
+}
+
+// Login is the outcome of a completed Discord login.
+type Login struct {
+	User    *models.User           `json:"user"`
+	Session *models.APIToken       `json:"-"`
+	Webhook *models.DiscordWebhook `json:"webhook,omitempty"`
+}
+
+// StartDiscordLogin begins a login and returns the Discord URL to send the
+// user to and the state the callback must carry. With webhook set, the user
+// also picks a channel for Discord to create a webhook in.
+func (s *AuthService) StartDiscordLogin(ctx context.Context, webhook bool) (authURL, state string, err error) {
+	state, err = newVerificationToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := discord.NewVerifier()
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.repo.SaveOAuthState(ctx, hashToken(state), verifier, time.Now().Add(oauthStateTTL)); err != nil {
+		return "", "", err
+	}
+	return s.oauth.AuthCodeURL(state, verifier, webhook), state, nil
+}
+
+// FinishDiscordLogin completes the login that state began with the code
+// Discord redirected back with. The Discord user's account is created on
+// their first login, and any webhook Discord created is stored for them.
+func (s *AuthService) FinishDiscordLogin(ctx context.Context, state, code string) (*Login, error) {
+	if state == "" {
+		return nil, ErrInvalidOAuthState
+	}
+	verifier, err := s.repo.TakeOAuthState(ctx, hashToken(state))
+	if errors.Is(err, repository.ErrOAuthStateNotFound) {
+		return nil, ErrInvalidOAuthState
+	}
+	if err != nil {
+		return nil, err
+	}
+	if code == "" {
+		return nil, fmt.Errorf("%w: no authorization code", ErrDiscordLoginFailed)
+	}
+
+	tok, err := s.oauth.Exchange(ctx, code, verifier)
+	if errors.Is(err, discord.ErrInvalidGrant) {
+		return nil, fmt.Errorf("%w: %w", ErrDiscordLoginFailed, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	du, err := s.oauth.CurrentUser(ctx, tok.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := s.repo.UpsertDiscordUser(ctx, du.ID, du.DisplayName(), DefaultMaxSubscriptions)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(SessionTTL)
+	session, err := s.users.issueToken(ctx, u.ID, "discord session", &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	login := &Login{User: u, Session: session}
+	if w := tok.Webhook; w != nil {
+		if err := validateDiscordWebhook(w.URL); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDiscordLoginFailed, err)
+		}
+		login.Webhook, err = s.repo.SaveDiscordWebhook(ctx, u.ID, models.DiscordWebhook{
+			WebhookID:  w.ID,
+			GuildID:    w.GuildID,
+			ChannelID:  w.ChannelID,
+			Name:       w.Name,
+			WebhookURL: w.URL,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return login, nil
+}
+
+// Logout ends the session whose token is session.
+func (s *AuthService) Logout(ctx context.Context, session string) error {
+	err := s.users.RevokeTokenValue(ctx, session)
+	if errors.Is(err, ErrTokenNotFound) {
+		return nil
+	}
+	return err
+}
+
+// ListDiscordWebhooks returns the webhooks Discord created for ownerID, newest first.
+func (s *AuthService) ListDiscordWebhooks(ctx context.Context, ownerID string) ([]models.DiscordWebhook, error) {
+	return s.repo.ListDiscordWebhooks(ctx, ownerID)
+}
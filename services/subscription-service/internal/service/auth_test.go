@@ -0,0 +1,14 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFinishDiscordLogin_EmptyState(t *testing.T) {
+	auth := &AuthService{}
+	if _, err := auth.FinishDiscordLogin(context.Background(), "", "code"); !errors.Is(err, ErrInvalidOAuthState) {
+		t.Errorf("error = %v, want ErrInvalidOAuthState", err)
+	}
+}
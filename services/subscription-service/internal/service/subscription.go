@@ -2,17 +2,99 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"net/mail"
 	"net/url"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/google/uuid"
 	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/netguard"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/templates"
 	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/repository"
 )
 
-// ErrInvalidWebhook is returned when the provided discord_webhook URL is malformed.
-var ErrInvalidWebhook = errors.New("invalid Discord webhook URL")
+// ErrInvalidWebhook is returned when the provided webhook_url is not a valid
+// webhook URL for the subscription's destination type.
+var ErrInvalidWebhook = errors.New("invalid webhook URL")
+
+// ErrInvalidDestinationType is returned when destination_type is not supported.
+var ErrInvalidDestinationType = errors.New("invalid destination type")
+
+// ErrInvalidTelegramConfig is returned when a Telegram subscription lacks a
+// well-formed bot token or chat ID.
+var ErrInvalidTelegramConfig = errors.New("invalid Telegram bot token or chat ID")
+
+// ErrInvalidMatrixConfig is returned when a Matrix subscription lacks a
+// homeserver URL, room ID or access token.
+var ErrInvalidMatrixConfig = errors.New("invalid Matrix homeserver, room ID or access token")
+
+// ErrInvalidEmailConfig is returned when an email subscription lacks a valid
+// address or names an unknown delivery mode.
+var ErrInvalidEmailConfig = errors.New("invalid email address or delivery")
+
+// ErrInvalidNtfyConfig is returned when an ntfy subscription lacks an HTTPS
+// server URL or a valid topic, or has a priority outside 1–5.
+var ErrInvalidNtfyConfig = errors.New("invalid ntfy server URL, topic or priority")
+
+// ErrInvalidGotifyConfig is returned when a Gotify subscription lacks an HTTPS
+// server URL or an application token, or has a priority outside 1–10.
+var ErrInvalidGotifyConfig = errors.New("invalid Gotify server URL, token or priority")
+
+// ErrInvalidTemplate is wrapped by the error returned when a Discord
+// subscription's message template does not parse or render. The error's text
+// says what is wrong.
+var ErrInvalidTemplate = templates.ErrInvalid
+
+// ErrInvalidMentions is returned when a Discord subscription's mentions
+// contain something other than role and user IDs, or too many of them.
+var ErrInvalidMentions = errors.New("invalid Discord mentions")
+
+// ErrInvalidThread is returned when a Discord subscription sets both a
+// thread_id and a thread_name, or either is malformed.
+var ErrInvalidThread = errors.New("invalid Discord thread")
+
+// ErrInvalidDiscordIdentity is returned when a Discord subscription's
+// username or avatar_url would be rejected by Discord.
+var ErrInvalidDiscordIdentity = errors.New("invalid Discord username or avatar")
+
+// ErrInvalidVerificationToken is returned when an email verification token is
+// unknown, already used or expired.
+var ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+
+// ErrInvalidCursor is returned when a List cursor was not returned by List.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page sizes of List.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// maxMentions bounds the roles and users one Discord subscription pings, so
+// the mention line fits in a message.
+const maxMentions = 50
+
+// verificationTTL is how long the confirmation link of an email subscription stays valid.
+const verificationTTL = 48 * time.Hour
+
+var (
+	telegramBotToken = regexp.MustCompile(`^[0-9]+:[A-Za-z0-9_-]{30,}$`)
+	telegramChatID   = regexp.MustCompile(`^(-?[0-9]+|@[A-Za-z][A-Za-z0-9_]{4,31})$`)
+	matrixRoomID     = regexp.MustCompile(`^![^:\s]+:[A-Za-z0-9.-]+(:[0-9]+)?$`)
+	ntfyTopic        = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`)
+	gotifyAppToken   = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	discordSnowflake = regexp.MustCompile(`^[0-9]{17,20}$`)
+)
 
 // ErrDuplicate is forwarded from the repository layer.
 var ErrDuplicate = repository.ErrDuplicate
@@ -20,43 +102,508 @@ var ErrDuplicate = repository.ErrDuplicate
 // ErrNotFound is forwarded from the repository layer.
 var ErrNotFound = repository.ErrNotFound
 
+// ErrVersionConflict is forwarded from the repository layer.
+var ErrVersionConflict = repository.ErrVersionConflict
+
+// ErrQuotaExceeded is forwarded from the repository layer.
+var ErrQuotaExceeded = repository.ErrQuotaExceeded
+
+// ErrImmutable is returned when an update would change the destination type
+// or the address of an email subscription, which need a new subscription.
+var ErrImmutable = errors.New("field cannot be changed")
+
+// Patch lists the fields Update changes. Nil fields are left as they are; a
+// DestinationConfig replaces the stored one as a whole.
+type Patch struct {
+	DestinationType   *models.DestinationType
+	WebhookURL        *string
+	DestinationConfig *models.DestinationConfig
+	WatchType         *models.WatchType
+	WatchTarget       *string
+	NotifyOnEnd       *bool
+	Active            *bool
+}
+
+// ListFilter narrows List.
+type ListFilter = repository.ListFilter
+
+// Page is one page of List results. NextCursor is empty on the last page.
+type Page struct {
+	Subscriptions []models.Subscription `json:"subscriptions"`
+	NextCursor    string                `json:"next_cursor,omitempty"`
+}
+
+// VerificationPublisher hands confirmation links for email subscriptions to
+// notification-dispatcher, which sends them.
+type VerificationPublisher interface {
+	PublishEmailVerification(ctx context.Context, event models.EmailVerificationEvent) error
+}
+
 // SubscriptionService contains business logic for managing subscriptions.
 type SubscriptionService struct {
-	repo *repository.Repository
+	repo      *repository.Repository
+	verifier  VerificationPublisher
+	twitch    TwitchClient
+	publicURL string
 }
 
-// New creates a new SubscriptionService.
-func New(repo *repository.Repository) *SubscriptionService {
-	return &SubscriptionService{repo: repo}
+// New creates a new SubscriptionService. Watch targets are checked against
+// Twitch unless twitch is nil. publicURL is the externally reachable base URL
+// of the API, used to build email confirmation links.
+func New(repo *repository.Repository, verifier VerificationPublisher, twitch TwitchClient, publicURL string) *SubscriptionService {
+	return &SubscriptionService{repo: repo, verifier: verifier, twitch: twitch, publicURL: strings.TrimRight(publicURL, "/")}
 }
 
-// Create validates inputs and creates a new subscription.
-func (s *SubscriptionService) Create(ctx context.Context, webhook string, watchType models.WatchType, watchTarget string) (*models.Subscription, error) {
-	if err := validateDiscordWebhook(webhook); err != nil {
+// Create validates sub and creates a new subscription from it. An empty
+// destination type defaults to Discord. Generic webhook subscriptions get a
+// newly generated signing secret, returned only in the created subscription.
+// Telegram, Matrix, email, ntfy and Gotify subscriptions are addressed by
+// destination_config, and webhook_url records where they deliver: the chat,
+// room or mailbox as "telegram:<chat_id>#<bot token fingerprint>",
+// "matrix:<homeserver_url>/<room_id>#<access token fingerprint>" or
+// "email:<address>", the ntfy topic URL followed by "#<access token
+// fingerprint>" if it has a token, or the Gotify server and a fingerprint of
+// the application token. Email subscriptions stay pending
+// until the address is confirmed. The subscription belongs to owner and
+// counts towards their quota. Its watch target must exist on Twitch and is
+// stored under Twitch's name for it, along with its ID.
+func (s *SubscriptionService) Create(ctx context.Context, owner *models.User, sub models.Subscription) (*models.Subscription, error) {
+	if sub.DestinationType == "" {
+		sub.DestinationType = models.DestinationDiscord
+	}
+	if err := prepareDestination(&sub); err != nil {
 		return nil, err
 	}
-	if watchType != models.WatchTypeGame && watchType != models.WatchTypeStreamer {
-		return nil, fmt.Errorf("watch_type must be 'game' or 'streamer'")
+	if err := validateWatch(sub); err != nil {
+		return nil, err
 	}
-	if strings.TrimSpace(watchTarget) == "" {
-		return nil, fmt.Errorf("watch_target must not be empty")
+	if err := checkDestinationHost(ctx, sub); err != nil {
+		return nil, err
 	}
-	return s.repo.Create(ctx, webhook, watchType, watchTarget)
+	if err := s.resolveWatchTarget(ctx, &sub); err != nil {
+		return nil, err
+	}
+
+	sub.OwnerID = owner.ID
+	sub.WebhookSecret = ""
+	if sub.DestinationType == models.DestinationWebhook {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+		sub.WebhookSecret = secret
+	}
+	if sub.DestinationType == models.DestinationEmail {
+		return s.createPendingEmail(ctx, sub)
+	}
+	created, err := s.repo.Create(ctx, sub)
+	if err != nil {
+		return nil, err
+	}
+	// The owner needs the generated secret once, but never the bot token back.
+	secret := created.WebhookSecret
+	redact(created)
+	created.WebhookSecret = secret
+	return created, nil
 }
 
-// GetByID retrieves a subscription by ID.
-func (s *SubscriptionService) GetByID(ctx context.Context, id string) (*models.Subscription, error) {
-	return s.repo.GetByID(ctx, id)
+// createPendingEmail creates an email subscription and has a confirmation
+// link sent to its address. Only the hash of the link's token is stored.
+func (s *SubscriptionService) createPendingEmail(ctx context.Context, sub models.Subscription) (*models.Subscription, error) {
+	token, err := newVerificationToken()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(verificationTTL)
+	created, err := s.repo.CreatePending(ctx, sub, hashToken(token), expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	event := models.EmailVerificationEvent{
+		SubscriptionID: created.ID,
+		Address:        sub.DestinationConfig.Email.Address,
+		WatchType:      sub.WatchType,
+		WatchTarget:    sub.WatchTarget,
+		VerifyURL:      s.publicURL + "/v1/email/verify?token=" + url.QueryEscape(token),
+		ExpiresAt:      expiresAt.UTC(),
+	}
+	if err := s.verifier.PublishEmailVerification(ctx, event); err != nil {
+		// Without the link the subscription could never be confirmed.
+		if delErr := s.repo.DeletePending(ctx, created.ID); delErr != nil {
+			return nil, errors.Join(err, delErr)
+		}
+		return nil, err
+	}
+	redact(created)
+	return created, nil
 }
 
-// Delete soft-deletes a subscription.
-func (s *SubscriptionService) Delete(ctx context.Context, id string) error {
+// VerifyEmail confirms the email subscription a confirmation link was sent
+// for. Notifications are sent to it from the next poll on.
+func (s *SubscriptionService) VerifyEmail(ctx context.Context, token string) (*models.Subscription, error) {
+	if token == "" {
+		return nil, ErrInvalidVerificationToken
+	}
+	sub, err := s.repo.Verify(ctx, hashToken(token))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	redact(sub)
+	return sub, nil
+}
+
+// PurgeExpiredEmails deletes the email subscriptions whose confirmation link
+// expired unopened, so they neither count towards their owner's quota nor
+// block subscribing the address again, and returns how many were deleted.
+func (s *SubscriptionService) PurgeExpiredEmails(ctx context.Context) (int64, error) {
+	return s.repo.DeleteExpiredPending(ctx)
+}
+
+// GetByID retrieves a subscription of ownerID by ID, without its credentials.
+func (s *SubscriptionService) GetByID(ctx context.Context, ownerID, id string) (*models.Subscription, error) {
+	sub, err := s.owned(ctx, ownerID, id)
+	if err != nil {
+		return nil, err
+	}
+	redact(sub)
+	return sub, nil
+}
+
+// DiscordWebhook returns ownerID's Discord webhook with the given ID, created
+// when they signed in with Discord.
+func (s *SubscriptionService) DiscordWebhook(ctx context.Context, ownerID, id string) (*models.DiscordWebhook, error) {
+	return s.repo.GetDiscordWebhook(ctx, ownerID, id)
+}
+
+// owned retrieves a subscription by ID if it belongs to ownerID. Other
+// owners' subscriptions are reported as not found.
+func (s *SubscriptionService) owned(ctx context.Context, ownerID, id string) (*models.Subscription, error) {
+	sub, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub.OwnerID == "" || sub.OwnerID != ownerID {
+		return nil, ErrNotFound
+	}
+	return sub, nil
+}
+
+// Update applies p to owner's subscription with the given ID, validating the
+// result with the same rules as Create, and returns it without its
+// credentials. version is the subscription's current version, or 0 to update
+// whatever version is stored. Setting Active restores a deactivated
+// subscription if owner's quota allows.
+func (s *SubscriptionService) Update(ctx context.Context, owner *models.User, id string, p Patch, version int) (*models.Subscription, error) {
+	cur, err := s.owned(ctx, owner.ID, id)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		version = cur.Version
+	}
+	if cur.Version != version {
+		return nil, ErrVersionConflict
+	}
+
+	sub, err := applyPatch(*cur, p)
+	if err != nil {
+		return nil, err
+	}
+	if sub.WebhookURL != cur.WebhookURL {
+		if err := checkDestinationHost(ctx, sub); err != nil {
+			return nil, err
+		}
+	}
+	if sub.WatchType != cur.WatchType || sub.WatchTarget != cur.WatchTarget {
+		sub.WatchTargetID = ""
+		if err := s.resolveWatchTarget(ctx, &sub); err != nil {
+			return nil, err
+		}
+	}
+	updated, err := s.repo.Update(ctx, sub, version)
+	if err != nil {
+		return nil, err
+	}
+	redact(updated)
+	return updated, nil
+}
+
+// applyPatch returns cur with p applied, after validating the fields it changes.
+func applyPatch(cur models.Subscription, p Patch) (models.Subscription, error) {
+	sub := cur
+	if p.DestinationType != nil && *p.DestinationType != cur.DestinationType {
+		return sub, fmt.Errorf("%w: destination_type", ErrImmutable)
+	}
+	if p.WebhookURL != nil || p.DestinationConfig != nil {
+		if p.WebhookURL != nil {
+			sub.WebhookURL = *p.WebhookURL
+		}
+		if p.DestinationConfig != nil {
+			sub.DestinationConfig = keepCredentials(p.DestinationConfig, cur.DestinationConfig)
+		}
+		if err := prepareDestination(&sub); err != nil {
+			return sub, err
+		}
+		// A new address would skip its confirmation.
+		if sub.DestinationType == models.DestinationEmail && sub.WebhookURL != cur.WebhookURL {
+			return sub, fmt.Errorf("%w: destination_config.email.address", ErrImmutable)
+		}
+	}
+	if p.WatchType != nil {
+		sub.WatchType = *p.WatchType
+	}
+	if p.WatchTarget != nil {
+		sub.WatchTarget = *p.WatchTarget
+	}
+	if err := validateWatch(sub); err != nil {
+		return sub, err
+	}
+	if p.NotifyOnEnd != nil {
+		sub.NotifyOnEnd = *p.NotifyOnEnd
+	}
+	if p.Active != nil {
+		sub.Active = *p.Active
+	}
+	return sub, nil
+}
+
+// keepCredentials returns cfg with the credentials it omits taken from
+// stored, since the public API never returns them for a client to send back.
+// A credential is kept only for the server it was stored for, so it is never
+// sent somewhere new.
+func keepCredentials(cfg, stored *models.DestinationConfig) *models.DestinationConfig {
+	if stored == nil {
+		return cfg
+	}
+	merged := *cfg
+	if tg := merged.Telegram; tg != nil && tg.BotToken == "" && stored.Telegram != nil {
+		t := *tg
+		t.BotToken = stored.Telegram.BotToken
+		merged.Telegram = &t
+	}
+	if mx := merged.Matrix; mx != nil && mx.AccessToken == "" && stored.Matrix != nil &&
+		sameServer(mx.HomeserverURL, stored.Matrix.HomeserverURL) {
+		m := *mx
+		m.AccessToken = stored.Matrix.AccessToken
+		merged.Matrix = &m
+	}
+	if nt := merged.Ntfy; nt != nil && nt.AccessToken == "" && stored.Ntfy != nil &&
+		sameServer(nt.ServerURL, stored.Ntfy.ServerURL) {
+		n := *nt
+		n.AccessToken = stored.Ntfy.AccessToken
+		merged.Ntfy = &n
+	}
+	if gt := merged.Gotify; gt != nil && gt.AppToken == "" && stored.Gotify != nil &&
+		sameServer(gt.ServerURL, stored.Gotify.ServerURL) {
+		g := *gt
+		g.AppToken = stored.Gotify.AppToken
+		merged.Gotify = &g
+	}
+	return &merged
+}
+
+// sameServer reports whether two server URLs are the same once trailing
+// slashes, which prepareDestination strips, are ignored.
+func sameServer(a, b string) bool {
+	return strings.TrimRight(a, "/") == strings.TrimRight(b, "/")
+}
+
+// Delete soft-deletes a subscription of ownerID.
+func (s *SubscriptionService) Delete(ctx context.Context, ownerID, id string) error {
+	if _, err := s.owned(ctx, ownerID, id); err != nil {
+		return err
+	}
 	return s.repo.Delete(ctx, id)
 }
 
-// ListActive returns all active subscriptions (used by stream-poller internal endpoint).
+// List returns a page of ownerID's subscriptions matching f, newest first,
+// without their credentials. cursor is "" for the first page or the
+// NextCursor of the previous one. limit is clamped to maxPageSize; 0 means
+// defaultPageSize.
+func (s *SubscriptionService) List(ctx context.Context, ownerID string, f ListFilter, cursor string, limit int) (*Page, error) {
+	f.OwnerID = ownerID
+	var after *repository.Cursor
+	if cursor != "" {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = &c
+	}
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	limit = min(limit, maxPageSize)
+
+	// One extra row tells whether there is a next page.
+	subs, err := s.repo.List(ctx, f, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Subscriptions: subs}
+	if len(subs) > limit {
+		page.Subscriptions = subs[:limit]
+		last := page.Subscriptions[limit-1]
+		page.NextCursor = encodeCursor(repository.Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	if page.Subscriptions == nil {
+		page.Subscriptions = []models.Subscription{}
+	}
+	for i := range page.Subscriptions {
+		redact(&page.Subscriptions[i])
+	}
+	return page, nil
+}
+
+// DeactivateByWebhook deactivates every active subscription using webhook,
+// recording reason so it shows up on the subscription.
+func (s *SubscriptionService) DeactivateByWebhook(ctx context.Context, webhook, reason string) (int64, error) {
+	return s.repo.DeactivateByWebhook(ctx, webhook, reason)
+}
+
+// ListActive returns all active, verified subscriptions without their
+// credentials (used by stream-poller internal endpoint). Credentials would
+// otherwise travel in every event published for the subscriptions.
 func (s *SubscriptionService) ListActive(ctx context.Context) ([]models.Subscription, error) {
-	return s.repo.ListActive(ctx)
+	subs, err := s.repo.ListActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range subs {
+		redact(&subs[i])
+	}
+	return subs, nil
+}
+
+// Lookup retrieves any subscription by ID with its credentials (used by
+// notification-dispatcher internal endpoint, which fetches them just before
+// delivering).
+func (s *SubscriptionService) Lookup(ctx context.Context, id string) (*models.Subscription, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+// validateWatch ensures sub watches a game or a streamer by name.
+func validateWatch(sub models.Subscription) error {
+	if sub.WatchType != models.WatchTypeGame && sub.WatchType != models.WatchTypeStreamer {
+		return fmt.Errorf("watch_type must be 'game' or 'streamer'")
+	}
+	if strings.TrimSpace(sub.WatchTarget) == "" {
+		return fmt.Errorf("watch_target must not be empty")
+	}
+	return nil
+}
+
+// prepareDestination validates sub's destination and keeps only the settings
+// its type uses.
+func prepareDestination(sub *models.Subscription) error {
+	switch sub.DestinationType {
+	case models.DestinationDiscord:
+		if err := validateDiscordWebhook(sub.WebhookURL); err != nil {
+			return err
+		}
+		if sub.DestinationConfig == nil || sub.DestinationConfig.Discord == nil {
+			sub.DestinationConfig = nil
+			return nil
+		}
+		discord := *sub.DestinationConfig.Discord
+		if discord.Template != nil {
+			if err := templates.Validate(discord.Template); err != nil {
+				return err
+			}
+		}
+		if discord.Mentions != nil {
+			mentions, err := validateMentions(discord.Mentions)
+			if err != nil {
+				return err
+			}
+			discord.Mentions = mentions
+		}
+		if err := validateThread(&discord); err != nil {
+			return err
+		}
+		if err := validateDiscordIdentity(discord.Username, discord.AvatarURL); err != nil {
+			return err
+		}
+		if discord == (models.DiscordConfig{}) {
+			sub.DestinationConfig = nil
+			return nil
+		}
+		sub.DestinationConfig = &models.DestinationConfig{Discord: &discord}
+		return nil
+	case models.DestinationTelegram:
+		if err := validateTelegram(sub.DestinationConfig); err != nil {
+			return err
+		}
+		telegram := sub.DestinationConfig.Telegram
+		sub.WebhookURL = "telegram:" + telegram.ChatID + "#" + fingerprint(telegram.BotToken)
+		sub.DestinationConfig = &models.DestinationConfig{Telegram: sub.DestinationConfig.Telegram}
+		return nil
+	case models.DestinationMatrix:
+		if err := validateMatrix(sub.DestinationConfig); err != nil {
+			return err
+		}
+		matrix := *sub.DestinationConfig.Matrix
+		matrix.HomeserverURL = strings.TrimRight(matrix.HomeserverURL, "/")
+		sub.WebhookURL = "matrix:" + matrix.HomeserverURL + "/" + matrix.RoomID + "#" + fingerprint(matrix.AccessToken)
+		sub.DestinationConfig = &models.DestinationConfig{Matrix: &matrix}
+		return nil
+	case models.DestinationEmail:
+		if err := validateEmail(sub.DestinationConfig); err != nil {
+			return err
+		}
+		email := *sub.DestinationConfig.Email
+		if email.Delivery == "" {
+			email.Delivery = models.EmailInstant
+		}
+		sub.WebhookURL = "email:" + email.Address
+		sub.DestinationConfig = &models.DestinationConfig{Email: &email}
+		return nil
+	case models.DestinationNtfy:
+		if err := validateNtfy(sub.DestinationConfig); err != nil {
+			return err
+		}
+		ntfy := *sub.DestinationConfig.Ntfy
+		ntfy.ServerURL = strings.TrimRight(ntfy.ServerURL, "/")
+		sub.WebhookURL = ntfy.ServerURL + "/" + ntfy.Topic
+		if ntfy.AccessToken != "" {
+			sub.WebhookURL += "#" + fingerprint(ntfy.AccessToken)
+		}
+		sub.DestinationConfig = &models.DestinationConfig{Ntfy: &ntfy}
+		return nil
+	case models.DestinationGotify:
+		if err := validateGotify(sub.DestinationConfig); err != nil {
+			return err
+		}
+		gotify := *sub.DestinationConfig.Gotify
+		gotify.ServerURL = strings.TrimRight(gotify.ServerURL, "/")
+		sub.WebhookURL = "gotify:" + gotify.ServerURL + "#" + fingerprint(gotify.AppToken)
+		sub.DestinationConfig = &models.DestinationConfig{Gotify: &gotify}
+		return nil
+	default:
+		sub.DestinationConfig = nil
+		return validateDestination(sub.DestinationType, sub.WebhookURL)
+	}
+}
+
+// validateDestination ensures raw is a well-formed webhook URL for destination type t.
+func validateDestination(t models.DestinationType, raw string) error {
+	switch t {
+	case models.DestinationDiscord:
+		return validateDiscordWebhook(raw)
+	case models.DestinationSlack:
+		return validateSlackWebhook(raw)
+	case models.DestinationWebhook:
+		return validateGenericWebhook(raw)
+	case models.DestinationTeams:
+		return validateTeamsWebhook(raw)
+	default:
+		return ErrInvalidDestinationType
+	}
 }
 
 // validateDiscordWebhook ensures the URL is a well-formed Discord webhook.
@@ -76,3 +623,307 @@ func validateDiscordWebhook(raw string) error {
 	}
 	return nil
 }
+
+// validateMentions ensures m only lists role and user IDs, and returns it with
+// duplicates removed, or nil if it mentions no one.
+func validateMentions(m *models.DiscordMentions) (*models.DiscordMentions, error) {
+	out := &models.DiscordMentions{Everyone: m.Everyone, Here: m.Here && !m.Everyone}
+	for _, ids := range []struct{ in, out *[]string }{{&m.Roles, &out.Roles}, {&m.Users, &out.Users}} {
+		for _, id := range *ids.in {
+			if !discordSnowflake.MatchString(id) {
+				return nil, ErrInvalidMentions
+			}
+			if !slices.Contains(*ids.out, id) {
+				*ids.out = append(*ids.out, id)
+			}
+		}
+	}
+	if len(out.Roles)+len(out.Users) > maxMentions {
+		return nil, ErrInvalidMentions
+	}
+	if len(out.Roles) == 0 && len(out.Users) == 0 && !out.Everyone && !out.Here {
+		return nil, nil
+	}
+	return out, nil
+}
+
+// validateThread ensures cfg targets at most one existing thread or names new
+// forum posts with a template that renders.
+func validateThread(cfg *models.DiscordConfig) error {
+	switch {
+	case cfg.ThreadID != "" && cfg.ThreadName != "":
+		return ErrInvalidThread
+	case cfg.ThreadID != "" && !discordSnowflake.MatchString(cfg.ThreadID):
+		return ErrInvalidThread
+	case cfg.ThreadName != "":
+		if _, err := templates.ThreadName(cfg.ThreadName, templates.Sample); err != nil {
+			return fmt.Errorf("%w: thread_name: %w", ErrInvalidThread, err)
+		}
+	}
+	return nil
+}
+
+// validateDiscordIdentity ensures Discord accepts username, if set, as a
+// webhook username and avatarURL, if set, is an https URL.
+func validateDiscordIdentity(username, avatarURL string) error {
+	lower := strings.ToLower(username)
+	if utf8.RuneCountInString(username) > 80 || strings.Contains(lower, "discord") || strings.Contains(lower, "clyde") {
+		return ErrInvalidDiscordIdentity
+	}
+	if avatarURL == "" {
+		return nil
+	}
+	u, err := url.ParseRequestURI(avatarURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return ErrInvalidDiscordIdentity
+	}
+	return nil
+}
+
+// validateSlackWebhook ensures the URL is a well-formed Slack incoming webhook.
+func validateSlackWebhook(raw string) error {
+	u, err := url.ParseRequestURI(raw)
+	if err != nil {
+		return ErrInvalidWebhook
+	}
+	if u.Scheme != "https" || u.Host != "hooks.slack.com" {
+		return ErrInvalidWebhook
+	}
+	if !strings.HasPrefix(u.Path, "/services/") {
+		return ErrInvalidWebhook
+	}
+	return nil
+}
+
+// validateTeamsWebhook ensures the URL is a Microsoft Teams Workflows webhook
+// (hosted on Logic Apps or Power Platform) or a legacy incoming webhook
+// connector. Workflows URLs often carry an explicit :443 port.
+func validateTeamsWebhook(raw string) error {
+	u, err := url.ParseRequestURI(raw)
+	if err != nil {
+		return ErrInvalidWebhook
+	}
+	if u.Scheme != "https" || u.User != nil {
+		return ErrInvalidWebhook
+	}
+	host := u.Hostname()
+	switch {
+	case strings.HasSuffix(host, ".logic.azure.com"), strings.HasSuffix(host, ".api.powerplatform.com"):
+		if !strings.Contains(u.Path, "/workflows/") {
+			return ErrInvalidWebhook
+		}
+	case strings.HasSuffix(host, ".webhook.office.com"):
+		if !strings.HasPrefix(u.Path, "/webhookb2/") {
+			return ErrInvalidWebhook
+		}
+	default:
+		return ErrInvalidWebhook
+	}
+	return nil
+}
+
+// validateGenericWebhook ensures the URL is an absolute HTTPS URL.
+func validateGenericWebhook(raw string) error {
+	u, err := url.ParseRequestURI(raw)
+	if err != nil {
+		return ErrInvalidWebhook
+	}
+	if u.Scheme != "https" || u.Hostname() == "" {
+		return ErrInvalidWebhook
+	}
+	return nil
+}
+
+// newWebhookSecret returns a random secret for signing generic webhook deliveries.
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// validateTelegram ensures cfg carries a bot token and chat ID of the shape
+// Telegram issues.
+func validateTelegram(cfg *models.DestinationConfig) error {
+	if cfg == nil || cfg.Telegram == nil {
+		return ErrInvalidTelegramConfig
+	}
+	if !telegramBotToken.MatchString(cfg.Telegram.BotToken) || !telegramChatID.MatchString(cfg.Telegram.ChatID) {
+		return ErrInvalidTelegramConfig
+	}
+	return nil
+}
+
+// validateMatrix ensures cfg names an HTTPS homeserver, a room ID and an access token.
+func validateMatrix(cfg *models.DestinationConfig) error {
+	if cfg == nil || cfg.Matrix == nil {
+		return ErrInvalidMatrixConfig
+	}
+	u, err := url.ParseRequestURI(cfg.Matrix.HomeserverURL)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return ErrInvalidMatrixConfig
+	}
+	if !matrixRoomID.MatchString(cfg.Matrix.RoomID) || strings.TrimSpace(cfg.Matrix.AccessToken) == "" {
+		return ErrInvalidMatrixConfig
+	}
+	return nil
+}
+
+// validateNtfy ensures cfg names an HTTPS server and a topic, with an optional
+// priority in ntfy's 1–5 range.
+func validateNtfy(cfg *models.DestinationConfig) error {
+	if cfg == nil || cfg.Ntfy == nil {
+		return ErrInvalidNtfyConfig
+	}
+	if !validServerURL(cfg.Ntfy.ServerURL) || !ntfyTopic.MatchString(cfg.Ntfy.Topic) {
+		return ErrInvalidNtfyConfig
+	}
+	if cfg.Ntfy.Priority < 0 || cfg.Ntfy.Priority > 5 {
+		return ErrInvalidNtfyConfig
+	}
+	return nil
+}
+
+// validateGotify ensures cfg names an HTTPS server and an application token,
+// with an optional priority in Gotify's 1–10 range.
+func validateGotify(cfg *models.DestinationConfig) error {
+	if cfg == nil || cfg.Gotify == nil {
+		return ErrInvalidGotifyConfig
+	}
+	if !validServerURL(cfg.Gotify.ServerURL) || !gotifyAppToken.MatchString(cfg.Gotify.AppToken) {
+		return ErrInvalidGotifyConfig
+	}
+	if cfg.Gotify.Priority < 0 || cfg.Gotify.Priority > 10 {
+		return ErrInvalidGotifyConfig
+	}
+	return nil
+}
+
+// checkDestinationHost rejects a subscription delivering to a server its
+// owner chose, unless every address the server's name resolves to is publicly
+// routable, so the dispatcher cannot be pointed at the internal network. The
+// dispatcher checks again when it connects, in case the name re-resolves.
+func checkDestinationHost(ctx context.Context, sub models.Subscription) error {
+	var raw string
+	var invalid error
+	switch sub.DestinationType {
+	case models.DestinationWebhook:
+		raw, invalid = sub.WebhookURL, ErrInvalidWebhook
+	case models.DestinationMatrix:
+		raw, invalid = sub.DestinationConfig.Matrix.HomeserverURL, ErrInvalidMatrixConfig
+	case models.DestinationNtfy:
+		raw, invalid = sub.DestinationConfig.Ntfy.ServerURL, ErrInvalidNtfyConfig
+	case models.DestinationGotify:
+		raw, invalid = sub.DestinationConfig.Gotify.ServerURL, ErrInvalidGotifyConfig
+	default:
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return invalid
+	}
+	if err := netguard.CheckHost(ctx, u.Hostname()); err != nil {
+		return fmt.Errorf("%w: %v", invalid, err)
+	}
+	return nil
+}
+
+// validServerURL reports whether raw is an HTTPS URL of a self-hosted server,
+// possibly under a path prefix, with no query or fragment.
+func validServerURL(raw string) bool {
+	u, err := url.ParseRequestURI(raw)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "https" && u.Hostname() != "" && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
+
+// validateEmail ensures cfg carries a bare email address and a known delivery mode.
+func validateEmail(cfg *models.DestinationConfig) error {
+	if cfg == nil || cfg.Email == nil {
+		return ErrInvalidEmailConfig
+	}
+	addr, err := mail.ParseAddress(cfg.Email.Address)
+	if err != nil || addr.Name != "" || addr.Address != cfg.Email.Address || len(addr.Address) > 254 {
+		return ErrInvalidEmailConfig
+	}
+	switch cfg.Email.Delivery {
+	case "", models.EmailInstant, models.EmailHourly:
+		return nil
+	}
+	return ErrInvalidEmailConfig
+}
+
+// newVerificationToken returns a random token for an email confirmation link.
+func newVerificationToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate verification token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the form in which a verification, API or OAuth state token is stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// encodeCursor turns c into the opaque cursor List returns.
+func encodeCursor(c repository.Cursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.CreatedAt.UTC().Format(time.RFC3339Nano) + " " + c.ID))
+}
+
+// decodeCursor parses a cursor made by encodeCursor.
+func decodeCursor(s string) (repository.Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return repository.Cursor{}, ErrInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(raw), " ")
+	if !ok {
+		return repository.Cursor{}, ErrInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil || uuid.Validate(id) != nil {
+		return repository.Cursor{}, ErrInvalidCursor
+	}
+	return repository.Cursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+// fingerprint identifies a credential in webhook_url without revealing it.
+func fingerprint(token string) string {
+	return hashToken(token)[:12]
+}
+
+// redact clears the credentials the public API never returns. The
+// destination config is copied rather than modified in place.
+func redact(sub *models.Subscription) {
+	sub.WebhookSecret = ""
+	if sub.DestinationConfig == nil {
+		return
+	}
+	cfg := *sub.DestinationConfig
+	if cfg.Telegram != nil {
+		tg := *cfg.Telegram
+		tg.BotToken = ""
+		cfg.Telegram = &tg
+	}
+	if cfg.Matrix != nil {
+		m := *cfg.Matrix
+		m.AccessToken = ""
+		cfg.Matrix = &m
+	}
+	if cfg.Ntfy != nil {
+		n := *cfg.Ntfy
+		n.AccessToken = ""
+		cfg.Ntfy = &n
+	}
+	if cfg.Gotify != nil {
+		g := *cfg.Gotify
+		g.AppToken = ""
+		cfg.Gotify = &g
+	}
+	sub.DestinationConfig = &cfg
+}
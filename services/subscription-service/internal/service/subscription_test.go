@@ -3,14 +3,20 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/repository"
 )
 
 // svc with a nil repo is valid for tests that never reach the repository.
 var svc = &SubscriptionService{}
 
+var owner = &models.User{ID: "00000000-0000-0000-0000-000000000001", MaxSubscriptions: DefaultMaxSubscriptions}
+
 func TestCreate_InvalidWebhook(t *testing.T) {
 	cases := []struct {
 		name    string
@@ -26,7 +32,11 @@ func TestCreate_InvalidWebhook(t *testing.T) {
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			_, err := svc.Create(context.Background(), tc.webhook, models.WatchTypeGame, "Fortnite")
+			_, err := svc.Create(context.Background(), owner, models.Subscription{
+				WebhookURL:  tc.webhook,
+				WatchType:   models.WatchTypeGame,
+				WatchTarget: "Fortnite",
+			})
 			if !errors.Is(err, ErrInvalidWebhook) {
 				t.Errorf("webhook %q: got error %v, want ErrInvalidWebhook", tc.webhook, err)
 			}
@@ -49,9 +59,613 @@ func TestValidateDiscordWebhook_ValidHosts(t *testing.T) {
 	}
 }
 
+func TestCreate_SlackWebhook(t *testing.T) {
+	cases := []struct {
+		name    string
+		webhook string
+		valid   bool
+	}{
+		{"valid", "https://hooks.slack.com/services/T000/B000/XXXX", true},
+		{"http scheme", "http://hooks.slack.com/services/T000/B000/XXXX", false},
+		{"wrong host", "https://slack.com/services/T000/B000/XXXX", false},
+		{"missing path prefix", "https://hooks.slack.com/workflows/T000/A000/1/XXXX", false},
+		{"discord webhook", "https://discord.com/api/webhooks/1234/token", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateDestination(models.DestinationSlack, tc.webhook)
+			if tc.valid && err != nil {
+				t.Errorf("webhook %q should be valid, got %v", tc.webhook, err)
+			}
+			if !tc.valid && !errors.Is(err, ErrInvalidWebhook) {
+				t.Errorf("webhook %q: got error %v, want ErrInvalidWebhook", tc.webhook, err)
+			}
+		})
+	}
+}
+
+func TestCreate_TeamsWebhook(t *testing.T) {
+	cases := []struct {
+		name    string
+		webhook string
+		valid   bool
+	}{
+		{"logic apps workflow", "https://prod-12.westus.logic.azure.com:443/workflows/abc123/triggers/manual/paths/invoke?api-version=2016-06-01&sig=xyz", true},
+		{"power platform workflow", "https://default0000.00.environment.api.powerplatform.com:443/powerautomate/automations/direct/workflows/abc123/triggers/manual/paths/invoke?sig=xyz", true},
+		{"legacy connector", "https://contoso.webhook.office.com/webhookb2/aaa@bbb/IncomingWebhook/ccc/ddd", true},
+		{"http scheme", "http://prod-12.westus.logic.azure.com/workflows/abc123/triggers/manual/paths/invoke", false},
+		{"wrong host", "https://logic.azure.com.example.com/workflows/abc123", false},
+		{"missing workflow path", "https://prod-12.westus.logic.azure.com/subscriptions/abc123", false},
+		{"slack webhook", "https://hooks.slack.com/services/T000/B000/XXXX", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateDestination(models.DestinationTeams, tc.webhook)
+			if tc.valid && err != nil {
+				t.Errorf("webhook %q should be valid, got %v", tc.webhook, err)
+			}
+			if !tc.valid && !errors.Is(err, ErrInvalidWebhook) {
+				t.Errorf("webhook %q: got error %v, want ErrInvalidWebhook", tc.webhook, err)
+			}
+		})
+	}
+}
+
+func TestCreate_InvalidDestinationType(t *testing.T) {
+	_, err := svc.Create(context.Background(), owner, models.Subscription{
+		DestinationType: "carrier-pigeon",
+		WebhookURL:      "https://discord.com/api/webhooks/1234/token",
+		WatchType:       models.WatchTypeGame,
+		WatchTarget:     "Fortnite",
+	})
+	if !errors.Is(err, ErrInvalidDestinationType) {
+		t.Errorf("got error %v, want ErrInvalidDestinationType", err)
+	}
+}
+
+func TestValidateGenericWebhook(t *testing.T) {
+	cases := map[string]bool{
+		"https://hooks.example.com/twitch": true,
+		"https://10.0.0.5:8443/notify?x=1": true,
+		"http://hooks.example.com/twitch":  false,
+		"https:///no-host":                 false,
+		"not-a-url":                        false,
+	}
+	for webhook, valid := range cases {
+		if err := validateDestination(models.DestinationWebhook, webhook); (err == nil) != valid {
+			t.Errorf("webhook %q: got error %v, want valid=%v", webhook, err, valid)
+		}
+	}
+}
+
+func TestNewWebhookSecret_Unique(t *testing.T) {
+	a, err := newWebhookSecret()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ := newWebhookSecret()
+	if a == b || !strings.HasPrefix(a, "whsec_") || len(a) != len("whsec_")+64 {
+		t.Errorf("secrets %q and %q", a, b)
+	}
+}
+
+func TestPrepareDestination_Telegram(t *testing.T) {
+	const token = "123456:ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghi"
+	cases := []struct {
+		name  string
+		cfg   *models.DestinationConfig
+		valid bool
+	}{
+		{"group", &models.DestinationConfig{Telegram: &models.TelegramConfig{BotToken: token, ChatID: "-1001234567890"}}, true},
+		{"channel", &models.DestinationConfig{Telegram: &models.TelegramConfig{BotToken: token, ChatID: "@twitch_alerts"}}, true},
+		{"missing config", nil, false},
+		{"bad token", &models.DestinationConfig{Telegram: &models.TelegramConfig{BotToken: "nope", ChatID: "-100"}}, false},
+		{"bad chat", &models.DestinationConfig{Telegram: &models.TelegramConfig{BotToken: token, ChatID: "chat"}}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sub := models.Subscription{DestinationType: models.DestinationTelegram, DestinationConfig: tc.cfg}
+			err := prepareDestination(&sub)
+			if !tc.valid {
+				if !errors.Is(err, ErrInvalidTelegramConfig) {
+					t.Errorf("got error %v, want ErrInvalidTelegramConfig", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if sub.WebhookURL != "telegram:"+tc.cfg.Telegram.ChatID+"#"+fingerprint(tc.cfg.Telegram.BotToken) {
+				t.Errorf("webhook_url = %q", sub.WebhookURL)
+			}
+		})
+	}
+}
+
+func TestPrepareDestination_Matrix(t *testing.T) {
+	valid := models.MatrixConfig{HomeserverURL: "https://matrix.example.org", RoomID: "!abc123:example.org", AccessToken: "syt_x"}
+	cases := map[string]func(*models.MatrixConfig){
+		"http homeserver": func(m *models.MatrixConfig) { m.HomeserverURL = "http://matrix.example.org" },
+		"room alias":      func(m *models.MatrixConfig) { m.RoomID = "#twitch:example.org" },
+		"no server":       func(m *models.MatrixConfig) { m.RoomID = "!abc123" },
+		"no token":        func(m *models.MatrixConfig) { m.AccessToken = " " },
+	}
+
+	sub := models.Subscription{DestinationType: models.DestinationMatrix, DestinationConfig: &models.DestinationConfig{Matrix: &valid}}
+	if err := prepareDestination(&sub); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+	if sub.WebhookURL != "matrix:https://matrix.example.org/!abc123:example.org#"+fingerprint("syt_x") {
+		t.Errorf("webhook_url = %q", sub.WebhookURL)
+	}
+
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			m := valid
+			mutate(&m)
+			sub := models.Subscription{DestinationType: models.DestinationMatrix, DestinationConfig: &models.DestinationConfig{Matrix: &m}}
+			if err := prepareDestination(&sub); !errors.Is(err, ErrInvalidMatrixConfig) {
+				t.Errorf("got error %v, want ErrInvalidMatrixConfig", err)
+			}
+		})
+	}
+}
+
+func TestPrepareDestination_Ntfy(t *testing.T) {
+	valid := models.NtfyConfig{ServerURL: "https://ntfy.example.com/", Topic: "twitch-alerts", AccessToken: "tk_x", Priority: 4}
+	cases := map[string]func(*models.NtfyConfig){
+		"http server":  func(n *models.NtfyConfig) { n.ServerURL = "http://ntfy.example.com" },
+		"query":        func(n *models.NtfyConfig) { n.ServerURL = "https://ntfy.example.com/?x=1" },
+		"no topic":     func(n *models.NtfyConfig) { n.Topic = "" },
+		"topic path":   func(n *models.NtfyConfig) { n.Topic = "a/b" },
+		"priority 6":   func(n *models.NtfyConfig) { n.Priority = 6 },
+		"negative pri": func(n *models.NtfyConfig) { n.Priority = -1 },
+	}
+
+	sub := models.Subscription{DestinationType: models.DestinationNtfy, DestinationConfig: &models.DestinationConfig{Ntfy: &valid}}
+	if err := prepareDestination(&sub); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+	if sub.WebhookURL != "https://ntfy.example.com/twitch-alerts#"+fingerprint("tk_x") {
+		t.Errorf("webhook_url = %q", sub.WebhookURL)
+	}
+
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			n := valid
+			mutate(&n)
+			sub := models.Subscription{DestinationType: models.DestinationNtfy, DestinationConfig: &models.DestinationConfig{Ntfy: &n}}
+			if err := prepareDestination(&sub); !errors.Is(err, ErrInvalidNtfyConfig) {
+				t.Errorf("got error %v, want ErrInvalidNtfyConfig", err)
+			}
+		})
+	}
+}
+
+func TestPrepareDestination_Gotify(t *testing.T) {
+	valid := models.GotifyConfig{ServerURL: "https://push.example.com/gotify", AppToken: "AbCdEf.GhIjKlMn"}
+	cases := map[string]func(*models.GotifyConfig){
+		"http server": func(g *models.GotifyConfig) { g.ServerURL = "http://push.example.com" },
+		"no token":    func(g *models.GotifyConfig) { g.AppToken = "" },
+		"token space": func(g *models.GotifyConfig) { g.AppToken = "Ab Cd" },
+		"priority 11": func(g *models.GotifyConfig) { g.Priority = 11 },
+	}
+
+	sub := models.Subscription{DestinationType: models.DestinationGotify, DestinationConfig: &models.DestinationConfig{Gotify: &valid}}
+	if err := prepareDestination(&sub); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+	if !strings.HasPrefix(sub.WebhookURL, "gotify:https://push.example.com/gotify#") || strings.Contains(sub.WebhookURL, valid.AppToken) {
+		t.Errorf("webhook_url = %q", sub.WebhookURL)
+	}
+
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			g := valid
+			mutate(&g)
+			sub := models.Subscription{DestinationType: models.DestinationGotify, DestinationConfig: &models.DestinationConfig{Gotify: &g}}
+			if err := prepareDestination(&sub); !errors.Is(err, ErrInvalidGotifyConfig) {
+				t.Errorf("got error %v, want ErrInvalidGotifyConfig", err)
+			}
+		})
+	}
+}
+
+func TestPrepareDestination_Email(t *testing.T) {
+	cases := []struct {
+		name  string
+		cfg   *models.EmailConfig
+		valid bool
+	}{
+		{"instant", &models.EmailConfig{Address: "viewer@example.com", Delivery: models.EmailInstant}, true},
+		{"hourly", &models.EmailConfig{Address: "viewer@example.com", Delivery: models.EmailHourly}, true},
+		{"default delivery", &models.EmailConfig{Address: "viewer@example.com"}, true},
+		{"missing config", nil, false},
+		{"not an address", &models.EmailConfig{Address: "viewer"}, false},
+		{"display name", &models.EmailConfig{Address: "Viewer <viewer@example.com>"}, false},
+		{"unknown delivery", &models.EmailConfig{Address: "viewer@example.com", Delivery: "daily"}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sub := models.Subscription{DestinationType: models.DestinationEmail}
+			if tc.cfg != nil {
+				sub.DestinationConfig = &models.DestinationConfig{Email: tc.cfg}
+			}
+			err := prepareDestination(&sub)
+			if !tc.valid {
+				if !errors.Is(err, ErrInvalidEmailConfig) {
+					t.Errorf("got error %v, want ErrInvalidEmailConfig", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if sub.WebhookURL != "email:viewer@example.com" {
+				t.Errorf("webhook_url = %q", sub.WebhookURL)
+			}
+			if sub.DestinationConfig.Email.Delivery == "" {
+				t.Error("delivery not defaulted")
+			}
+		})
+	}
+}
+
+func TestPrepareDestination_DiscordTemplate(t *testing.T) {
+	const webhook = "https://discord.com/api/webhooks/1234/token"
+	cases := []struct {
+		name  string
+		tmpl  *models.MessageTemplate
+		valid bool
+	}{
+		{"no template", nil, true},
+		{"template", &models.MessageTemplate{Title: "{{.UserName}} is streaming {{.GameName}}", Color: "#FF0000"}, true},
+		{"unknown variable", &models.MessageTemplate{Title: "{{.WebhookURL}}"}, false},
+		{"disallowed function", &models.MessageTemplate{Title: `{{printf "%s" .Title}}`}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sub := models.Subscription{DestinationType: models.DestinationDiscord, WebhookURL: webhook}
+			if tc.tmpl != nil {
+				sub.DestinationConfig = &models.DestinationConfig{Discord: &models.DiscordConfig{Template: tc.tmpl}}
+			}
+			err := prepareDestination(&sub)
+			if !tc.valid {
+				if !errors.Is(err, ErrInvalidTemplate) {
+					t.Errorf("got error %v, want ErrInvalidTemplate", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (tc.tmpl == nil) != (sub.DestinationConfig == nil) {
+				t.Errorf("destination_config = %+v", sub.DestinationConfig)
+			}
+		})
+	}
+}
+
+func TestPrepareDestination_DiscordMentions(t *testing.T) {
+	const (
+		webhook = "https://discord.com/api/webhooks/1234/token"
+		role    = "123456789012345678"
+	)
+	tooMany := make([]string, maxMentions+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("1000000000000000%03d", i)
+	}
+	cases := []struct {
+		name     string
+		mentions models.DiscordMentions
+		valid    bool
+	}{
+		{"roles and here", models.DiscordMentions{Roles: []string{role, role}, Users: []string{"98765432109876543"}, Here: true}, true},
+		{"everyone", models.DiscordMentions{Everyone: true}, true},
+		{"mention syntax", models.DiscordMentions{Roles: []string{"<@&" + role + ">"}}, false},
+		{"name", models.DiscordMentions{Roles: []string{"StreamAlerts"}}, false},
+		{"too many", models.DiscordMentions{Users: tooMany}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sub := models.Subscription{
+				DestinationType:   models.DestinationDiscord,
+				WebhookURL:        webhook,
+				DestinationConfig: &models.DestinationConfig{Discord: &models.DiscordConfig{Mentions: &tc.mentions}},
+			}
+			err := prepareDestination(&sub)
+			if !tc.valid {
+				if !errors.Is(err, ErrInvalidMentions) {
+					t.Errorf("got error %v, want ErrInvalidMentions", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if sub.DestinationConfig == nil || sub.DestinationConfig.Discord.Mentions == nil {
+				t.Fatalf("destination_config = %+v, want the mentions kept", sub.DestinationConfig)
+			}
+			if roles := sub.DestinationConfig.Discord.Mentions.Roles; len(roles) > 1 {
+				t.Errorf("roles = %v, want duplicates removed", roles)
+			}
+		})
+	}
+
+	sub := models.Subscription{
+		DestinationType:   models.DestinationDiscord,
+		WebhookURL:        webhook,
+		DestinationConfig: &models.DestinationConfig{Discord: &models.DiscordConfig{Mentions: &models.DiscordMentions{}}},
+	}
+	if err := prepareDestination(&sub); err != nil || sub.DestinationConfig != nil {
+		t.Errorf("empty mentions: err = %v, destination_config = %+v, want both nil", err, sub.DestinationConfig)
+	}
+}
+
+func TestPrepareDestination_DiscordThread(t *testing.T) {
+	const webhook = "https://discord.com/api/webhooks/1234/token"
+	cases := []struct {
+		name  string
+		cfg   models.DiscordConfig
+		valid bool
+	}{
+		{"thread ID", models.DiscordConfig{ThreadID: "123456789012345678"}, true},
+		{"thread name", models.DiscordConfig{ThreadName: "{{.UserName}} playing {{.GameName}}"}, true},
+		{"both", models.DiscordConfig{ThreadID: "123456789012345678", ThreadName: "{{.UserName}}"}, false},
+		{"bad thread ID", models.DiscordConfig{ThreadID: "general"}, false},
+		{"bad thread name", models.DiscordConfig{ThreadName: "{{.WebhookURL}}"}, false},
+		{"empty thread name", models.DiscordConfig{ThreadName: "{{if false}}x{{end}}"}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sub := models.Subscription{
+				DestinationType:   models.DestinationDiscord,
+				WebhookURL:        webhook,
+				DestinationConfig: &models.DestinationConfig{Discord: &tc.cfg},
+			}
+			err := prepareDestination(&sub)
+			if !tc.valid {
+				if !errors.Is(err, ErrInvalidThread) {
+					t.Errorf("got error %v, want ErrInvalidThread", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if sub.DestinationConfig == nil || *sub.DestinationConfig.Discord != tc.cfg {
+				t.Errorf("destination_config = %+v, want the thread kept", sub.DestinationConfig)
+			}
+		})
+	}
+}
+
+func TestPrepareDestination_DiscordIdentity(t *testing.T) {
+	const webhook = "https://discord.com/api/webhooks/1234/token"
+	cases := []struct {
+		name  string
+		cfg   models.DiscordConfig
+		valid bool
+	}{
+		{"username and avatar", models.DiscordConfig{Username: "Stream Alerts", AvatarURL: "https://example.com/bot.png"}, true},
+		{"as streamer", models.DiscordConfig{AsStreamer: true}, true},
+		{"reserved name", models.DiscordConfig{Username: "Discord Alerts"}, false},
+		{"too long", models.DiscordConfig{Username: strings.Repeat("a", 81)}, false},
+		{"http avatar", models.DiscordConfig{AvatarURL: "http://example.com/bot.png"}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sub := models.Subscription{
+				DestinationType:   models.DestinationDiscord,
+				WebhookURL:        webhook,
+				DestinationConfig: &models.DestinationConfig{Discord: &tc.cfg},
+			}
+			err := prepareDestination(&sub)
+			if !tc.valid {
+				if !errors.Is(err, ErrInvalidDiscordIdentity) {
+					t.Errorf("got error %v, want ErrInvalidDiscordIdentity", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if sub.DestinationConfig == nil || *sub.DestinationConfig.Discord != tc.cfg {
+				t.Errorf("destination_config = %+v, want the identity kept", sub.DestinationConfig)
+			}
+		})
+	}
+}
+
+func TestCursor_RoundTrip(t *testing.T) {
+	c := repository.Cursor{CreatedAt: time.Date(2026, 1, 1, 12, 0, 0, 123456000, time.UTC), ID: "4c7f5a3e-8a6b-4b8e-9d3f-2f1e0c9b8a7d"}
+	got, err := decodeCursor(encodeCursor(c))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.CreatedAt.Equal(c.CreatedAt) || got.ID != c.ID {
+		t.Errorf("decoded %+v, want %+v", got, c)
+	}
+}
+
+func TestList_InvalidCursor(t *testing.T) {
+	for _, cursor := range []string{"not base64!", "bm8gc3BhY2U", encodeCursor(repository.Cursor{ID: "'; DROP TABLE subscriptions"})} {
+		if _, err := svc.List(context.Background(), owner.ID, ListFilter{}, cursor, 10); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("cursor %q: err = %v, want ErrInvalidCursor", cursor, err)
+		}
+	}
+}
+
+func TestCheckDestinationHost(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		sub  models.Subscription
+		want error
+	}{
+		{models.Subscription{DestinationType: models.DestinationWebhook, WebhookURL: "https://127.0.0.1/hook"}, ErrInvalidWebhook},
+		{models.Subscription{DestinationType: models.DestinationWebhook, WebhookURL: "https://[::1]:8443/hook"}, ErrInvalidWebhook},
+		{models.Subscription{DestinationType: models.DestinationMatrix, DestinationConfig: &models.DestinationConfig{
+			Matrix: &models.MatrixConfig{HomeserverURL: "https://169.254.169.254"}}}, ErrInvalidMatrixConfig},
+		{models.Subscription{DestinationType: models.DestinationNtfy, DestinationConfig: &models.DestinationConfig{
+			Ntfy: &models.NtfyConfig{ServerURL: "https://10.0.0.8/ntfy"}}}, ErrInvalidNtfyConfig},
+		{models.Subscription{DestinationType: models.DestinationGotify, DestinationConfig: &models.DestinationConfig{
+			Gotify: &models.GotifyConfig{ServerURL: "https://192.168.1.20"}}}, ErrInvalidGotifyConfig},
+		{models.Subscription{DestinationType: models.DestinationWebhook, WebhookURL: "https://93.184.216.34/hook"}, nil},
+		{models.Subscription{DestinationType: models.DestinationDiscord, WebhookURL: "https://discord.com/api/webhooks/1/x"}, nil},
+	}
+	for _, tc := range cases {
+		if err := checkDestinationHost(ctx, tc.sub); !errors.Is(err, tc.want) {
+			t.Errorf("%s %s: err = %v, want %v", tc.sub.DestinationType, tc.sub.WebhookURL, err, tc.want)
+		}
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	ptr := func(s string) *string { return &s }
+	active, slack := true, models.DestinationSlack
+	cur := models.Subscription{
+		ID:              "4c7f5a3e-8a6b-4b8e-9d3f-2f1e0c9b8a7d",
+		DestinationType: models.DestinationDiscord,
+		WebhookURL:      "https://discord.com/api/webhooks/1234/token",
+		WatchType:       models.WatchTypeGame,
+		WatchTarget:     "Fortnite",
+	}
+
+	sub, err := applyPatch(cur, Patch{WatchTarget: ptr("Minecraft"), Active: &active})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sub.WatchTarget != "Minecraft" || !sub.Active || sub.WebhookURL != cur.WebhookURL {
+		t.Errorf("patched = %+v", sub)
+	}
+
+	cases := []struct {
+		name  string
+		patch Patch
+		want  error
+	}{
+		{"invalid webhook", Patch{WebhookURL: ptr("https://example.com/hook")}, ErrInvalidWebhook},
+		{"destination type", Patch{DestinationType: &slack}, ErrImmutable},
+		{"invalid template", Patch{DestinationConfig: &models.DestinationConfig{Discord: &models.DiscordConfig{
+			Template: &models.MessageTemplate{Title: "{{.BotToken}}"},
+		}}}, ErrInvalidTemplate},
+	}
+	for _, tc := range cases {
+		if _, err := applyPatch(cur, tc.patch); !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+	if _, err := applyPatch(cur, Patch{WatchTarget: ptr(" ")}); err == nil {
+		t.Error("an empty watch_target was accepted")
+	}
+}
+
+func TestApplyPatch_EmailAddressIsImmutable(t *testing.T) {
+	cur := models.Subscription{
+		DestinationType:   models.DestinationEmail,
+		WebhookURL:        "email:me@example.com",
+		DestinationConfig: &models.DestinationConfig{Email: &models.EmailConfig{Address: "me@example.com", Delivery: models.EmailInstant}},
+		WatchType:         models.WatchTypeStreamer,
+		WatchTarget:       "streamer",
+	}
+
+	hourly := &models.DestinationConfig{Email: &models.EmailConfig{Address: "me@example.com", Delivery: models.EmailHourly}}
+	if sub, err := applyPatch(cur, Patch{DestinationConfig: hourly}); err != nil || sub.DestinationConfig.Email.Delivery != models.EmailHourly {
+		t.Errorf("changing the delivery: err = %v", err)
+	}
+
+	other := &models.DestinationConfig{Email: &models.EmailConfig{Address: "you@example.com"}}
+	if _, err := applyPatch(cur, Patch{DestinationConfig: other}); !errors.Is(err, ErrImmutable) {
+		t.Errorf("changing the address: err = %v, want ErrImmutable", err)
+	}
+}
+
+func TestApplyPatch_KeepsOmittedCredentials(t *testing.T) {
+	cur := models.Subscription{
+		DestinationType: models.DestinationNtfy,
+		WebhookURL:      "https://ntfy.example.com/alerts#" + fingerprint("tk_x"),
+		DestinationConfig: &models.DestinationConfig{Ntfy: &models.NtfyConfig{
+			ServerURL: "https://ntfy.example.com", Topic: "alerts", AccessToken: "tk_x",
+		}},
+		WatchType:   models.WatchTypeStreamer,
+		WatchTarget: "streamer",
+	}
+
+	// The config as GET returned it, without the token, and a new priority.
+	sub, err := applyPatch(cur, Patch{DestinationConfig: &models.DestinationConfig{Ntfy: &models.NtfyConfig{
+		ServerURL: "https://ntfy.example.com/", Topic: "alerts", Priority: 5,
+	}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := sub.DestinationConfig.Ntfy; n.AccessToken != "tk_x" || n.Priority != 5 || sub.WebhookURL != cur.WebhookURL {
+		t.Errorf("patched = %+v, %q; want the stored token kept", n, sub.WebhookURL)
+	}
+	if cur.DestinationConfig.Ntfy.Priority != 0 {
+		t.Error("applyPatch modified the stored config")
+	}
+
+	// Moving to another server does not take the token along.
+	sub, err = applyPatch(cur, Patch{DestinationConfig: &models.DestinationConfig{Ntfy: &models.NtfyConfig{
+		ServerURL: "https://ntfy.other.example", Topic: "alerts",
+	}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sub.DestinationConfig.Ntfy.AccessToken != "" {
+		t.Error("the stored token was kept for a different server")
+	}
+}
+
+func TestVerificationToken(t *testing.T) {
+	a, err := newVerificationToken()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ := newVerificationToken()
+	if a == b || len(a) != 43 {
+		t.Errorf("tokens %q and %q", a, b)
+	}
+	if hashToken(a) == a || hashToken(a) != hashToken(a) || hashToken(a) == hashToken(b) {
+		t.Error("hashToken is not a stable one-way mapping")
+	}
+}
+
+func TestVerifyEmail_EmptyToken(t *testing.T) {
+	if _, err := svc.VerifyEmail(context.Background(), ""); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("got error %v, want ErrInvalidVerificationToken", err)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tg := &models.TelegramConfig{BotToken: "secret", ChatID: "-100"}
+	mx := &models.MatrixConfig{RoomID: "!abc:example.org", AccessToken: "syt_x"}
+	nt := &models.NtfyConfig{Topic: "alerts", AccessToken: "tk_x"}
+	gt := &models.GotifyConfig{AppToken: "AbCd"}
+	sub := &models.Subscription{WebhookSecret: "whsec_x", DestinationConfig: &models.DestinationConfig{Telegram: tg, Matrix: mx, Ntfy: nt, Gotify: gt}}
+
+	redact(sub)
+	cfg := sub.DestinationConfig
+	if sub.WebhookSecret != "" || cfg.Telegram.BotToken != "" || cfg.Matrix.AccessToken != "" || cfg.Ntfy.AccessToken != "" || cfg.Gotify.AppToken != "" {
+		t.Errorf("credentials left in %+v", sub)
+	}
+	if sub.DestinationConfig.Telegram.ChatID != "-100" {
+		t.Error("chat ID removed")
+	}
+	if tg.BotToken != "secret" || mx.AccessToken != "syt_x" || nt.AccessToken != "tk_x" || gt.AppToken != "AbCd" {
+		t.Error("redact modified the original config")
+	}
+}
+
 func TestCreate_InvalidWatchType(t *testing.T) {
 	webhook := "https://discord.com/api/webhooks/1234/token"
-	_, err := svc.Create(context.Background(), webhook, "channel", "something")
+	_, err := svc.Create(context.Background(), owner, models.Subscription{
+		WebhookURL:  webhook,
+		WatchType:   "channel",
+		WatchTarget: "something",
+	})
 	if err == nil || errors.Is(err, ErrInvalidWebhook) {
 		t.Errorf("expected watch_type error, got %v", err)
 	}
@@ -59,7 +673,11 @@ func TestCreate_InvalidWatchType(t *testing.T) {
 
 func TestCreate_EmptyWatchTarget(t *testing.T) {
 	webhook := "https://discord.com/api/webhooks/1234/token"
-	_, err := svc.Create(context.Background(), webhook, models.WatchTypeGame, "   ")
+	_, err := svc.Create(context.Background(), owner, models.Subscription{
+		WebhookURL:  webhook,
+		WatchType:   models.WatchTypeGame,
+		WatchTarget: "   ",
+	})
 	if err == nil || errors.Is(err, ErrInvalidWebhook) {
 		t.Errorf("expected watch_target error, got %v", err)
 	}
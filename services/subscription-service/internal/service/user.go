@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/services/subscription-service/internal/repository"
+)
+
+// ErrInvalidAPIToken is returned when a bearer token is malformed, unknown or revoked.
+var ErrInvalidAPIToken = errors.New("invalid API token")
+
+// ErrInvalidUser is returned when a user's name or quota is invalid.
+var ErrInvalidUser = errors.New("invalid user")
+
+// ErrInvalidClaim is returned when a claim of subscriptions is invalid.
+var ErrInvalidClaim = errors.New("invalid claim")
+
+// ErrUserNotFound is forwarded from the repository layer.
+var ErrUserNotFound = repository.ErrUserNotFound
+
+// ErrTokenNotFound is forwarded from the repository layer.
+var ErrTokenNotFound = repository.ErrTokenNotFound
+
+// DefaultMaxSubscriptions is the quota of users created without one.
+const DefaultMaxSubscriptions = 100
+
+// apiTokenPrefix starts every API token, so leaked tokens are easy to recognise.
+const apiTokenPrefix = "tw_"
+
+// UserService manages users and their API tokens.
+type UserService struct {
+	repo *repository.Repository
+}
+
+// NewUserService creates a UserService.
+func NewUserService(repo *repository.Repository) *UserService {
+	return &UserService{repo: repo}
+}
+
+// CreateUser creates a user allowed maxSubscriptions active subscriptions, 0
+// meaning DefaultMaxSubscriptions, and a first API token for it.
+func (s *UserService) CreateUser(ctx context.Context, name string, maxSubscriptions int) (*models.User, *models.APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, nil, fmt.Errorf("%w: name must not be empty", ErrInvalidUser)
+	}
+	if maxSubscriptions < 0 {
+		return nil, nil, fmt.Errorf("%w: max_subscriptions must not be negative", ErrInvalidUser)
+	}
+	if maxSubscriptions == 0 {
+		maxSubscriptions = DefaultMaxSubscriptions
+	}
+
+	u, err := s.repo.CreateUser(ctx, name, maxSubscriptions)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := s.CreateToken(ctx, u.ID, "default")
+	if err != nil {
+		return nil, nil, err
+	}
+	return u, t, nil
+}
+
+// CreateToken issues a new API token for userID. The token is only returned here.
+func (s *UserService) CreateToken(ctx context.Context, userID, name string) (*models.APIToken, error) {
+	return s.issueToken(ctx, userID, name, nil)
+}
+
+// ClaimSubscriptions gives userID the subscriptions created before users
+// existed that deliver to webhookURL, and returns how many it was given.
+func (s *UserService) ClaimSubscriptions(ctx context.Context, userID, webhookURL string) (int64, error) {
+	if strings.TrimSpace(webhookURL) == "" {
+		return 0, fmt.Errorf("%w: webhook_url must not be empty", ErrInvalidClaim)
+	}
+	return s.repo.ClaimUnowned(ctx, userID, webhookURL)
+}
+
+// issueToken issues a new API token for userID that expires at expiresAt,
+// or never if it is nil.
+func (s *UserService) issueToken(ctx context.Context, userID, name string, expiresAt *time.Time) (*models.APIToken, error) {
+	token, err := newAPIToken()
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.repo.CreateToken(ctx, userID, strings.TrimSpace(name), hashToken(token), expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	t.Token = token
+	return t, nil
+}
+
+// RevokeToken revokes the API token with the given ID.
+func (s *UserService) RevokeToken(ctx context.Context, id string) error {
+	return s.repo.RevokeToken(ctx, id)
+}
+
+// RevokeTokenValue revokes the API token whose value is token, such as a
+// session being logged out.
+func (s *UserService) RevokeTokenValue(ctx context.Context, token string) error {
+	return s.repo.RevokeTokenByHash(ctx, hashToken(token))
+}
+
+// Authenticate returns the user an API token belongs to.
+func (s *UserService) Authenticate(ctx context.Context, token string) (*models.User, error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return nil, ErrInvalidAPIToken
+	}
+	u, err := s.repo.UserByToken(ctx, hashToken(token))
+	if errors.Is(err, repository.ErrTokenNotFound) {
+		return nil, ErrInvalidAPIToken
+	}
+	return u, err
+}
+
+// newAPIToken returns a random API token.
+func newAPIToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate API token: %w", err)
+	}
+	return apiTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
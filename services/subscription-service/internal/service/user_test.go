@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAuthenticate_WrongPrefix(t *testing.T) {
+	users := &UserService{}
+	for _, token := range []string{"", "abc", "Tw_abc"} {
+		if _, err := users.Authenticate(context.Background(), token); !errors.Is(err, ErrInvalidAPIToken) {
+			t.Errorf("Authenticate(%q) error = %v, want ErrInvalidAPIToken", token, err)
+		}
+	}
+}
+
+func TestNewAPIToken(t *testing.T) {
+	a, err := newAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := newAPIToken()
+	if !strings.HasPrefix(a, apiTokenPrefix) || a == b {
+		t.Errorf("newAPIToken() = %q, %q, want distinct %q-prefixed tokens", a, b, apiTokenPrefix)
+	}
+}
+
+func TestClaimSubscriptions_EmptyWebhook(t *testing.T) {
+	users := &UserService{}
+	if _, err := users.ClaimSubscriptions(context.Background(), "user-1", " "); !errors.Is(err, ErrInvalidClaim) {
+		t.Errorf("error = %v, want ErrInvalidClaim", err)
+	}
+}
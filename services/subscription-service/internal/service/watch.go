@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/twitch"
+)
+
+// ErrUnknownWatchTarget is matched by an *UnknownTargetError.
+var ErrUnknownWatchTarget = errors.New("unknown watch target")
+
+// ErrTwitchUnavailable is returned when a watch target cannot be looked up
+// because Twitch did not answer.
+var ErrTwitchUnavailable = errors.New("Twitch is unavailable")
+
+// maxSuggestions is how many similar games or channels are suggested for an
+// unknown watch target.
+const maxSuggestions = 5
+
+// twitchLogin matches the logins Helix /users accepts; it rejects others
+// outright rather than reporting them unknown.
+var twitchLogin = regexp.MustCompile(`^[a-zA-Z0-9_]{1,25}$`)
+
+// TwitchClient looks watch targets up on Twitch. *twitch.Client implements it.
+type TwitchClient interface {
+	GetGameIDs(ctx context.Context, names []string) (map[string]string, error)
+	GetUsers(ctx context.Context, logins []string) ([]twitch.User, error)
+	SearchCategories(ctx context.Context, query string, first int) ([]twitch.Category, error)
+	SearchChannels(ctx context.Context, query string, first int) ([]twitch.Channel, error)
+}
+
+// UnknownTargetError is returned when a watch target does not exist on
+// Twitch, with the names of similar games or channels that do.
+type UnknownTargetError struct {
+	WatchType   models.WatchType
+	Target      string
+	Suggestions []string
+}
+
+func (e *UnknownTargetError) Error() string {
+	return fmt.Sprintf("no Twitch %s named %q", e.WatchType, e.Target)
+}
+
+// Is makes an UnknownTargetError match ErrUnknownWatchTarget.
+func (e *UnknownTargetError) Is(target error) bool { return target == ErrUnknownWatchTarget }
+
+// resolveWatchTarget looks sub's watch target up on Twitch, replacing it with
+// Twitch's name for it and recording its ID. Targets are not checked when the
+// service has no Twitch client.
+func (s *SubscriptionService) resolveWatchTarget(ctx context.Context, sub *models.Subscription) error {
+	if s.twitch == nil {
+		return nil
+	}
+	target := strings.TrimSpace(sub.WatchTarget)
+
+	switch sub.WatchType {
+	case models.WatchTypeGame:
+		ids, err := s.twitch.GetGameIDs(ctx, []string{target})
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrTwitchUnavailable, err)
+		}
+		for name, id := range ids {
+			sub.WatchTarget, sub.WatchTargetID = name, id
+			return nil
+		}
+		// Suggestions are a courtesy; a failed search just leaves them out.
+		categories, _ := s.twitch.SearchCategories(ctx, target, maxSuggestions)
+		unknown := &UnknownTargetError{WatchType: sub.WatchType, Target: target}
+		for _, c := range categories {
+			unknown.Suggestions = append(unknown.Suggestions, c.Name)
+		}
+		return unknown
+
+	case models.WatchTypeStreamer:
+		if twitchLogin.MatchString(target) {
+			users, err := s.twitch.GetUsers(ctx, []string{target})
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrTwitchUnavailable, err)
+			}
+			if len(users) > 0 {
+				sub.WatchTarget, sub.WatchTargetID = users[0].Login, users[0].ID
+				return nil
+			}
+		}
+		channels, _ := s.twitch.SearchChannels(ctx, target, maxSuggestions)
+		unknown := &UnknownTargetError{WatchType: sub.WatchType, Target: target}
+		for _, c := range channels {
+			unknown.Suggestions = append(unknown.Suggestions, c.BroadcasterLogin)
+		}
+		return unknown
+	}
+	return nil
+}
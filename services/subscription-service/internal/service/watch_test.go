@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/khiemnguyen15/twitch-watcher/pkg/models"
+	"github.com/khiemnguyen15/twitch-watcher/pkg/twitch"
+)
+
+// fakeTwitch knows one game and one user, and suggests the same for any search.
+type fakeTwitch struct {
+	err        error
+	userLookup bool
+}
+
+func (f *fakeTwitch) GetGameIDs(_ context.Context, names []string) (map[string]string, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if names[0] == "valorant" {
+		return map[string]string{"VALORANT": "516575"}, nil
+	}
+	return map[string]string{}, nil
+}
+
+func (f *fakeTwitch) GetUsers(_ context.Context, logins []string) ([]twitch.User, error) {
+	f.userLookup = true
+	if f.err != nil {
+		return nil, f.err
+	}
+	if logins[0] == "Ninja" {
+		return []twitch.User{{ID: "19571641", Login: "ninja"}}, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeTwitch) SearchCategories(context.Context, string, int) ([]twitch.Category, error) {
+	return []twitch.Category{{ID: "516575", Name: "VALORANT"}}, nil
+}
+
+func (f *fakeTwitch) SearchChannels(context.Context, string, int) ([]twitch.Channel, error) {
+	return []twitch.Channel{{ID: "19571641", BroadcasterLogin: "ninja"}}, nil
+}
+
+func TestResolveWatchTarget_Canonical(t *testing.T) {
+	s := &SubscriptionService{twitch: &fakeTwitch{}}
+	tests := []struct {
+		watchType  models.WatchType
+		target     string
+		wantTarget string
+		wantID     string
+	}{
+		{models.WatchTypeGame, " valorant ", "VALORANT", "516575"},
+		{models.WatchTypeStreamer, "Ninja", "ninja", "19571641"},
+	}
+	for _, tt := range tests {
+		sub := models.Subscription{WatchType: tt.watchType, WatchTarget: tt.target}
+		if err := s.resolveWatchTarget(context.Background(), &sub); err != nil {
+			t.Fatalf("resolveWatchTarget(%q): %v", tt.target, err)
+		}
+		if sub.WatchTarget != tt.wantTarget || sub.WatchTargetID != tt.wantID {
+			t.Errorf("resolveWatchTarget(%q) = %q, %q, want %q, %q", tt.target, sub.WatchTarget, sub.WatchTargetID, tt.wantTarget, tt.wantID)
+		}
+	}
+}
+
+func TestResolveWatchTarget_Unknown(t *testing.T) {
+	tests := []struct {
+		watchType      models.WatchType
+		target         string
+		want           string
+		wantUserLookup bool
+	}{
+		{models.WatchTypeGame, "Valorent", "VALORANT", false},
+		{models.WatchTypeStreamer, "ninjaa", "ninja", true},
+		{models.WatchTypeStreamer, "nin ja", "ninja", false}, // not a valid login
+	}
+	for _, tt := range tests {
+		fake := &fakeTwitch{}
+		s := &SubscriptionService{twitch: fake}
+		sub := models.Subscription{WatchType: tt.watchType, WatchTarget: tt.target}
+
+		err := s.resolveWatchTarget(context.Background(), &sub)
+		var unknown *UnknownTargetError
+		if !errors.As(err, &unknown) || !errors.Is(err, ErrUnknownWatchTarget) {
+			t.Fatalf("resolveWatchTarget(%q) error = %v, want *UnknownTargetError", tt.target, err)
+		}
+		if !slices.Equal(unknown.Suggestions, []string{tt.want}) {
+			t.Errorf("resolveWatchTarget(%q) suggestions = %v, want [%s]", tt.target, unknown.Suggestions, tt.want)
+		}
+		if fake.userLookup != tt.wantUserLookup {
+			t.Errorf("resolveWatchTarget(%q) looked the user up = %v, want %v", tt.target, fake.userLookup, tt.wantUserLookup)
+		}
+	}
+}
+
+func TestResolveWatchTarget_TwitchUnavailable(t *testing.T) {
+	s := &SubscriptionService{twitch: &fakeTwitch{err: errors.New("status 503")}}
+	sub := models.Subscription{WatchType: models.WatchTypeGame, WatchTarget: "valorant"}
+	if err := s.resolveWatchTarget(context.Background(), &sub); !errors.Is(err, ErrTwitchUnavailable) {
+		t.Errorf("error = %v, want ErrTwitchUnavailable", err)
+	}
+}
+
+func TestResolveWatchTarget_NoClient(t *testing.T) {
+	sub := models.Subscription{WatchType: models.WatchTypeGame, WatchTarget: "Valorent"}
+	if err := svc.resolveWatchTarget(context.Background(), &sub); err != nil || sub.WatchTarget != "Valorent" || sub.WatchTargetID != "" {
+		t.Errorf("resolveWatchTarget without a client = %v, %+v; want the target unchanged", err, sub)
+	}
+}
@@ -0,0 +1,2 @@
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS notify_on_end BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,6 @@
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS deactivated_reason TEXT,
+    ADD COLUMN IF NOT EXISTS deactivated_at     TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_webhook_active
+    ON subscriptions (discord_webhook) WHERE active = TRUE;
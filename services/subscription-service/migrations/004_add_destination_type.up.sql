@@ -0,0 +1,39 @@
+-- webhook_url replaces discord_webhook. The old column is kept and the two
+-- are synced on every write, so replicas still running the previous release
+-- keep reading and writing discord_webhook during a rolling deploy.
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS webhook_url TEXT;
+
+UPDATE subscriptions SET webhook_url = discord_webhook WHERE webhook_url IS NULL;
+
+CREATE OR REPLACE FUNCTION subscriptions_sync_webhook_url() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        NEW.webhook_url := COALESCE(NEW.webhook_url, NEW.discord_webhook);
+    ELSIF NEW.webhook_url IS NOT DISTINCT FROM OLD.webhook_url THEN
+        -- Only an old replica changes discord_webhook without webhook_url.
+        NEW.webhook_url := NEW.discord_webhook;
+    END IF;
+    NEW.discord_webhook := NEW.webhook_url;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER subscriptions_sync_webhook_url
+    BEFORE INSERT OR UPDATE ON subscriptions
+    FOR EACH ROW EXECUTE FUNCTION subscriptions_sync_webhook_url();
+
+ALTER TABLE subscriptions
+    ALTER COLUMN webhook_url SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_subscriptions_unique;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscriptions_unique
+    ON subscriptions (webhook_url, watch_type, watch_target);
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_webhook_url_active
+    ON subscriptions (webhook_url) WHERE active = TRUE;
+
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS destination_type VARCHAR(20) NOT NULL DEFAULT 'discord'
+        CHECK (destination_type IN ('discord', 'slack'));
@@ -0,0 +1,7 @@
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS webhook_secret TEXT;
+
+ALTER TABLE subscriptions
+    DROP CONSTRAINT IF EXISTS subscriptions_destination_type_check,
+    ADD CONSTRAINT subscriptions_destination_type_check
+        CHECK (destination_type IN ('discord', 'slack', 'webhook'));
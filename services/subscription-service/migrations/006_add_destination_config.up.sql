@@ -0,0 +1,15 @@
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS destination_config JSONB;
+
+ALTER TABLE subscriptions
+    DROP CONSTRAINT IF EXISTS subscriptions_destination_type_check,
+    ADD CONSTRAINT subscriptions_destination_type_check
+        CHECK (destination_type IN ('discord', 'slack', 'webhook', 'telegram'));
+
+-- Telegram subscriptions are recorded by chat and a fingerprint of the bot
+-- token, so two bots posting to the same chat are different destinations.
+UPDATE subscriptions
+SET webhook_url = webhook_url || '#' ||
+    left(encode(sha256(convert_to(destination_config->'telegram'->>'bot_token', 'UTF8')), 'hex'), 12)
+WHERE destination_type = 'telegram'
+  AND webhook_url NOT LIKE '%#%';
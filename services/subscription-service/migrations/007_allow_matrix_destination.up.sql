@@ -0,0 +1,14 @@
+ALTER TABLE subscriptions
+    DROP CONSTRAINT IF EXISTS subscriptions_destination_type_check,
+    ADD CONSTRAINT subscriptions_destination_type_check
+        CHECK (destination_type IN ('discord', 'slack', 'webhook', 'telegram', 'matrix'));
+
+-- Matrix subscriptions are recorded by homeserver, room and a fingerprint of
+-- the access token, so two accounts posting to the same room are different
+-- destinations.
+UPDATE subscriptions
+SET webhook_url = 'matrix:' || rtrim(destination_config->'matrix'->>'homeserver_url', '/') || '/' ||
+    (destination_config->'matrix'->>'room_id') || '#' ||
+    left(encode(sha256(convert_to(destination_config->'matrix'->>'access_token', 'UTF8')), 'hex'), 12)
+WHERE destination_type = 'matrix'
+  AND webhook_url NOT LIKE '%#%';
@@ -0,0 +1,12 @@
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS pending_verification    BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS verification_token_hash TEXT,
+    ADD COLUMN IF NOT EXISTS verification_expires_at TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscriptions_verification_token
+    ON subscriptions (verification_token_hash) WHERE verification_token_hash IS NOT NULL;
+
+ALTER TABLE subscriptions
+    DROP CONSTRAINT IF EXISTS subscriptions_destination_type_check,
+    ADD CONSTRAINT subscriptions_destination_type_check
+        CHECK (destination_type IN ('discord', 'slack', 'webhook', 'telegram', 'matrix', 'email'));
@@ -0,0 +1,14 @@
+ALTER TABLE subscriptions
+    DROP CONSTRAINT IF EXISTS subscriptions_destination_type_check,
+    ADD CONSTRAINT subscriptions_destination_type_check
+        CHECK (destination_type IN ('discord', 'slack', 'webhook', 'telegram', 'matrix', 'email', 'ntfy', 'gotify'));
+
+-- ntfy subscriptions with an access token are recorded by topic URL and a
+-- fingerprint of the token, so two accounts publishing to the same topic are
+-- different destinations.
+UPDATE subscriptions
+SET webhook_url = webhook_url || '#' ||
+    left(encode(sha256(convert_to(destination_config->'ntfy'->>'access_token', 'UTF8')), 'hex'), 12)
+WHERE destination_type = 'ntfy'
+  AND COALESCE(destination_config->'ntfy'->>'access_token', '') <> ''
+  AND webhook_url NOT LIKE '%#%';
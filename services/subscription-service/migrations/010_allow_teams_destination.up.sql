@@ -0,0 +1,4 @@
+ALTER TABLE subscriptions
+    DROP CONSTRAINT IF EXISTS subscriptions_destination_type_check,
+    ADD CONSTRAINT subscriptions_destination_type_check
+        CHECK (destination_type IN ('discord', 'slack', 'webhook', 'telegram', 'matrix', 'email', 'ntfy', 'gotify', 'teams'));
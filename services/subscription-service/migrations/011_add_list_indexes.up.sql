@@ -0,0 +1,8 @@
+CREATE INDEX IF NOT EXISTS idx_subscriptions_created_at_id
+    ON subscriptions (created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_webhook_created_at_id
+    ON subscriptions (webhook_url, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_watch_target_prefix
+    ON subscriptions (watch_target text_pattern_ops);
@@ -0,0 +1,5 @@
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS version    INTEGER     NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+UPDATE subscriptions SET updated_at = COALESCE(deactivated_at, created_at);
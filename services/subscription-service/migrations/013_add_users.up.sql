@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS users (
+    id                UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name              TEXT NOT NULL,
+    max_subscriptions INTEGER NOT NULL,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id           UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id      UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name         TEXT NOT NULL DEFAULT '',
+    token_hash   TEXT NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_tokens_token_hash
+    ON api_tokens (token_hash);
+
+-- Subscriptions created before owners existed have none and are only
+-- reachable through the internal API.
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS owner_id UUID REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_owner_created_at_id
+    ON subscriptions (owner_id, created_at DESC, id DESC);
+
+-- Subscriptions are unique per owner, so one user's subscriptions neither
+-- block nor reveal another's. Those without an owner stay unique among
+-- themselves until claimed through POST /internal/users/{id}/subscriptions/claim.
+DROP INDEX IF EXISTS idx_subscriptions_unique;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscriptions_owner_unique
+    ON subscriptions (owner_id, webhook_url, watch_type, watch_target) NULLS NOT DISTINCT;
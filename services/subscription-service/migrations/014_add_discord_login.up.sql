@@ -0,0 +1,35 @@
+-- Users who signed in with Discord are found again by their Discord user ID.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS discord_user_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_discord_user_id
+    ON users (discord_user_id);
+
+-- Login sessions are API tokens that expire.
+ALTER TABLE api_tokens
+    ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+-- OAuth2 logins in progress, keyed by a hash of their state parameter.
+CREATE TABLE IF NOT EXISTS oauth_states (
+    state_hash    TEXT PRIMARY KEY,
+    code_verifier TEXT NOT NULL,
+    expires_at    TIMESTAMPTZ NOT NULL
+);
+
+-- Webhooks Discord created for a user through the webhook.incoming scope.
+CREATE TABLE IF NOT EXISTS discord_webhooks (
+    id          UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    owner_id    UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    webhook_id  TEXT NOT NULL,
+    guild_id    TEXT NOT NULL,
+    channel_id  TEXT NOT NULL,
+    name        TEXT NOT NULL DEFAULT '',
+    webhook_url TEXT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_discord_webhooks_webhook_id
+    ON discord_webhooks (webhook_id);
+
+CREATE INDEX IF NOT EXISTS idx_discord_webhooks_owner_id
+    ON discord_webhooks (owner_id, created_at DESC);
@@ -0,0 +1,4 @@
+-- The Twitch ID of the game or streamer watched, resolved when the
+-- subscription is created. Subscriptions from before have none.
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS watch_target_id TEXT;